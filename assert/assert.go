@@ -44,7 +44,7 @@ func DeepEqual[V any](t *testing.T, variable string, actual, expected V) bool {
 	//	fmt.Sprintf("%+v\n", []string{})    == "[]\n"
 	//	fmt.Sprintf("%+v\n", []string(nil)) == "[]\n"
 	//
-	t.Error("assert.DeepEqual failed for " + variable)
+	errorf(t, "assert.DeepEqual failed for %s", variable)
 	if osext.GetenvBool("GOBITS_PRETTY_DIFF") {
 		dmp := diffmatchpatch.New()
 		diffs := dmp.DiffMain(fmt.Sprintf("%#v\n", actual), fmt.Sprintf("%#v\n", expected), false)
@@ -0,0 +1,103 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package assert
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	scopesMutex  sync.Mutex
+	scopesByTest = make(map[*testing.T][]string)
+	// This is a variable only so that tests can capture reported failures.
+	reportError = (*testing.T).Error
+)
+
+// WithContext opens a scope whose description is prepended to the failure
+// messages of all assertions from this package that fail within it. This is
+// useful for long integration tests where the same assertion appears many
+// times, for example:
+//
+//	endScope := assert.WithContext(t, "while creating the project")
+//	assert.HTTPRequest{...}.Check(t, handler)
+//	assert.DeepEqual(t, "project count", countProjects(), 1)
+//	endScope()
+//
+// Scopes can be nested, in which case the descriptions are prepended in
+// order, outermost first. The returned function closes the scope. It is
+// usually called with defer at the end of a helper function:
+//
+//	defer assert.WithContext(t, "while creating the project")()
+//
+// Scopes only apply to the *testing.T they were opened on; subtests do not
+// inherit them. Failures reported by other means than the functions in this
+// package (e.g. t.Error() or custom implementations of HTTPResponseBody) are
+// not annotated.
+func WithContext(t *testing.T, description string) (endScope func()) {
+	scopesMutex.Lock()
+	defer scopesMutex.Unlock()
+
+	scopes, exists := scopesByTest[t]
+	if !exists {
+		t.Cleanup(func() {
+			scopesMutex.Lock()
+			defer scopesMutex.Unlock()
+			delete(scopesByTest, t)
+		})
+	}
+	depth := len(scopes)
+	scopesByTest[t] = append(scopes, description)
+
+	return func() {
+		scopesMutex.Lock()
+		defer scopesMutex.Unlock()
+		if scopes := scopesByTest[t]; len(scopes) > depth {
+			scopesByTest[t] = scopes[:depth]
+		}
+	}
+}
+
+// Returns the descriptions of all open scopes on this *testing.T, formatted
+// as a prefix for failure messages.
+func contextPrefix(t *testing.T) string {
+	scopesMutex.Lock()
+	defer scopesMutex.Unlock()
+
+	scopes := scopesByTest[t]
+	if len(scopes) == 0 {
+		return ""
+	}
+	return strings.Join(scopes, ": ") + ": "
+}
+
+// Like t.Errorf(), but with the descriptions of all open scopes prepended.
+func errorf(t *testing.T, format string, args ...any) {
+	t.Helper()
+	reportError(t, contextPrefix(t)+fmt.Sprintf(format, args...))
+}
+
+// Like t.Fatalf(), but with the descriptions of all open scopes prepended.
+func fatalf(t *testing.T, format string, args ...any) {
+	t.Helper()
+	t.Fatal(contextPrefix(t) + fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,128 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package assert
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// Captures the failures reported through errorf() instead of failing the test.
+// The failures are recorded along with the *testing.T they were reported on.
+func captureFailures(t *testing.T) *[]string {
+	var failures []string
+	reportError = func(reportedOn *testing.T, args ...any) {
+		suffix := ""
+		if reportedOn != t {
+			suffix = " (on " + reportedOn.Name() + ")"
+		}
+		failures = append(failures, fmt.Sprint(args...)+suffix)
+	}
+	t.Cleanup(func() { reportError = (*testing.T).Error })
+	return &failures
+}
+
+func expectFailures(t *testing.T, failures *[]string, expected ...string) {
+	t.Helper()
+	actual := *failures
+	*failures = nil
+	if fmt.Sprintf("%#v", actual) != fmt.Sprintf("%#v", expected) {
+		t.Errorf("expected failures %#v, but got %#v", expected, actual)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	failures := captureFailures(t)
+	handler := http.NotFoundHandler()
+
+	// without any scope, failures are reported as-is
+	DeepEqual(t, "answer", 23, 42)
+	expectFailures(t, failures, "assert.DeepEqual failed for answer")
+
+	// scopes can be nested
+	endOuter := WithContext(t, "while creating the project")
+	DeepEqual(t, "answer", 23, 42)
+	endInner := WithContext(t, "while checking the quota")
+	HTTPRequest{Method: http.MethodGet, Path: "/quota", ExpectStatus: http.StatusOK}.Check(t, handler)
+	endInner()
+	DeepEqual(t, "answer", 23, 42)
+	expectFailures(t, failures,
+		"while creating the project: assert.DeepEqual failed for answer",
+		"while creating the project: while checking the quota: GET /quota: expected status code 200, got 404",
+		"while creating the project: assert.DeepEqual failed for answer",
+	)
+
+	// scopes do not leak into subtests...
+	t.Run("subtest", func(t *testing.T) {
+		DeepEqual(t, "answer", 23, 42)
+		defer WithContext(t, "within subtest")()
+		DeepEqual(t, "answer", 23, 42)
+	})
+	// ...and scopes from subtests do not leak back out
+	DeepEqual(t, "answer", 23, 42)
+	expectFailures(t, failures,
+		"assert.DeepEqual failed for answer (on TestWithContext/subtest)",
+		"within subtest: assert.DeepEqual failed for answer (on TestWithContext/subtest)",
+		"while creating the project: assert.DeepEqual failed for answer",
+	)
+
+	// scopes do not apply to unrelated tests either, even if they are left open
+	t.Run("first", func(t *testing.T) {
+		WithContext(t, "never closed")
+	})
+	t.Run("second", func(t *testing.T) {
+		DeepEqual(t, "answer", 23, 42)
+	})
+	expectFailures(t, failures, "assert.DeepEqual failed for answer (on TestWithContext/second)")
+	scopesMutex.Lock()
+	if len(scopesByTest) != 1 {
+		t.Errorf("expected scopes of finished subtests to be cleaned up, but got %#v", scopesByTest)
+	}
+	scopesMutex.Unlock()
+
+	endOuter()
+	DeepEqual(t, "answer", 23, 42)
+	expectFailures(t, failures, "assert.DeepEqual failed for answer")
+
+	// closing an outer scope also closes all scopes nested within it,
+	// and closing the inner scope afterwards does nothing
+	endOuter = WithContext(t, "outer")
+	endInner = WithContext(t, "inner")
+	endOuter()
+	DeepEqual(t, "answer", 23, 42)
+	endInner()
+	endScope := WithContext(t, "next")
+	DeepEqual(t, "answer", 23, 42)
+	endScope()
+	expectFailures(t, failures,
+		"assert.DeepEqual failed for answer",
+		"next: assert.DeepEqual failed for answer",
+	)
+
+	// closing a scope twice does not close its parent scope
+	endOuter = WithContext(t, "outer")
+	endInner = WithContext(t, "inner")
+	endInner()
+	endInner()
+	DeepEqual(t, "answer", 23, 42)
+	endOuter()
+	expectFailures(t, failures, "outer: assert.DeepEqual failed for answer")
+}
@@ -92,7 +92,7 @@ func (r HTTPRequest) Check(t *testing.T, handler http.Handler) (resp *http.Respo
 		var err error
 		requestBody, err = r.Body.GetRequestBody()
 		if err != nil {
-			t.Fatal(err)
+			fatalf(t, "%s", err.Error())
 		}
 	}
 	request := httptest.NewRequest(r.Method, r.Path, requestBody)
@@ -114,12 +114,12 @@ func (r HTTPRequest) Check(t *testing.T, handler http.Handler) (resp *http.Respo
 
 	if err != nil {
 		hadErrors = true
-		t.Errorf("Reading response body failed: %s", err.Error())
+		errorf(t, "Reading response body failed: %s", err.Error())
 	}
 
 	if response.StatusCode != r.ExpectStatus {
 		hadErrors = true
-		t.Errorf("%s %s: expected status code %d, got %d",
+		errorf(t, "%s %s: expected status code %d, got %d",
 			r.Method, r.Path, r.ExpectStatus, response.StatusCode,
 		)
 	}
@@ -127,7 +127,7 @@ func (r HTTPRequest) Check(t *testing.T, handler http.Handler) (resp *http.Respo
 	for key, value := range r.ExpectHeader {
 		actual := response.Header.Get(key)
 		if actual != value {
-			t.Errorf("%s %s: expected %s: %q, got %s: %q",
+			errorf(t, "%s %s: expected %s: %q, got %s: %q",
 				r.Method, r.Path, key, value, key, actual,
 			)
 		}
@@ -25,13 +25,13 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 
+	"github.com/sapcc/go-bits/internal"
 	"github.com/sapcc/go-bits/osext"
 )
 
@@ -61,7 +61,7 @@ func (b ByteData) AssertResponseBody(t *testing.T, requestInfo string, responseB
 	t.Helper()
 
 	if !bytes.Equal([]byte(b), responseBody) {
-		t.Error(requestInfo + ": got unexpected response body")
+		errorf(t, "%s: got unexpected response body", requestInfo)
 		logDiff(t, string(b), string(responseBody))
 		return false
 	}
@@ -83,7 +83,7 @@ func (s StringData) AssertResponseBody(t *testing.T, requestInfo string, respons
 
 	responseStr := string(responseBody)
 	if responseStr != string(s) {
-		t.Errorf("%s: got unexpected response body", requestInfo)
+		errorf(t, "%s: got unexpected response body", requestInfo)
 		logDiff(t, string(s), responseStr)
 		return false
 	}
@@ -106,7 +106,7 @@ func (o JSONObject) AssertResponseBody(t *testing.T, requestInfo string, respons
 
 	buf, err := json.Marshal(o)
 	if err != nil {
-		t.Error(err.Error())
+		errorf(t, "%s", err.Error())
 		return false
 	}
 
@@ -116,13 +116,13 @@ func (o JSONObject) AssertResponseBody(t *testing.T, requestInfo string, respons
 	if err == nil {
 		responseBody, err = json.Marshal(data)
 		if err != nil {
-			t.Errorf("JSON marshalling failed: %s", err.Error())
+			errorf(t, "JSON marshalling failed: %s", err.Error())
 			return false
 		}
 	}
 
 	if string(responseBody) != string(buf) {
-		t.Errorf("%s: got unexpected response body", requestInfo)
+		errorf(t, "%s: got unexpected response body", requestInfo)
 		logDiff(t, string(buf), string(responseBody))
 		return false
 	}
@@ -142,7 +142,7 @@ func (f JSONFixtureFile) AssertResponseBody(t *testing.T, requestInfo string, re
 	err := json.Indent(&buf, responseBody, "", "  ")
 	if err != nil {
 		t.Logf("Response body: %s", responseBody)
-		t.Fatal(err)
+		fatalf(t, "%s", err.Error())
 		return false
 	}
 	buf.WriteByte('\n')
@@ -151,34 +151,186 @@ func (f JSONFixtureFile) AssertResponseBody(t *testing.T, requestInfo string, re
 
 // FixtureFile implements HTTPResponseBody by locating the expected
 // plain-text response body in the given file.
+//
+// If the environment variable GOBITS_UPDATE_FIXTURES is set to a true value,
+// the fixture file is overwritten with the actual response body instead of
+// comparing against it. This is useful when a change in behavior affects many
+// fixtures at once; the changes can then be reviewed with `git diff`.
 type FixtureFile string
 
 // AssertResponseBody implements the HTTPResponseBody interface.
 func (f FixtureFile) AssertResponseBody(t *testing.T, requestInfo string, responseBody []byte) bool {
 	t.Helper()
+	return compareWithFixtureFile(t, requestInfo, string(f), responseBody, nil)
+}
 
-	// write actual content to file to make it easy to copy the computed result over
-	// to the fixture path when a new test is added or an existing one is modified
-	fixturePathAbs, err := filepath.Abs(string(f))
+// FixtureNormalizer is a function that converts a document into a canonical
+// form, such that two documents are semantically equal if and only if their
+// canonical forms are equal. It is used by NormalizedFixtureFile.
+type FixtureNormalizer func(in []byte) ([]byte, error)
+
+// NormalizeJSON is a FixtureNormalizer for JSON documents. The canonical form
+// has object keys in sorted order and is indented with two spaces.
+func NormalizeJSON(in []byte) ([]byte, error) {
+	var data any
+	err := json.Unmarshal(in, &data)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(data, "", "  ")
+	return append(out, '\n'), err
+}
+
+// NormalizeYAML builds a FixtureNormalizer for YAML documents. Since this
+// package does not depend on a YAML library, the functions for marshaling and
+// unmarshaling need to be provided by the caller, for example:
+//
+//	normalize := assert.NormalizeYAML(yaml.Unmarshal, yaml.Marshal)
+//
+// The canonical form is whatever the provided marshal function produces when
+// given the result of the provided unmarshal function.
+func NormalizeYAML(unmarshal func(in []byte, out any) error, marshal func(in any) ([]byte, error)) FixtureNormalizer {
+	return func(in []byte) ([]byte, error) {
+		var data any
+		err := unmarshal(in, &data)
+		if err != nil {
+			return nil, err
+		}
+		return marshal(data)
+	}
+}
+
+// Replacement describes a regex replacement for use with NormalizeByReplacing.
+// Within Replacement, "$1" etc. refer to submatches as in regexp.Regexp.ReplaceAll.
+type Replacement struct {
+	Regexp      *regexp.Regexp
+	Replacement string
+}
+
+var (
+	// ReplaceUUIDs is a Replacement for NormalizeByReplacing that replaces all UUIDs with a fixed placeholder.
+	ReplaceUUIDs = Replacement{
+		Regexp:      regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`),
+		Replacement: "00000000-0000-0000-0000-000000000000",
+	}
+	// ReplaceTimestamps is a Replacement for NormalizeByReplacing that replaces
+	// all timestamps in RFC 3339 format (with or without fractional seconds)
+	// with a fixed placeholder.
+	ReplaceTimestamps = Replacement{
+		Regexp:      regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})`),
+		Replacement: "1970-01-01T00:00:00Z",
+	}
+)
+
+// NormalizeByReplacing builds a FixtureNormalizer that applies the given regex
+// replacements in order. This is useful for response bodies that contain
+// nondeterministic values like generated IDs or timestamps, for example:
+//
+//	normalize := assert.NormalizeByReplacing(assert.ReplaceUUIDs, assert.ReplaceTimestamps, assert.Replacement{
+//		Regexp:      regexp.MustCompile(`"duration_secs": [0-9.]+`),
+//		Replacement: `"duration_secs": 0`,
+//	})
+//
+// Since the replacements are also applied to the fixture, placeholders in the
+// fixture must not themselves be changed by the replacements.
+func NormalizeByReplacing(replacements ...Replacement) FixtureNormalizer {
+	return func(in []byte) ([]byte, error) {
+		for _, r := range replacements {
+			in = r.Regexp.ReplaceAll(in, []byte(r.Replacement))
+		}
+		return in, nil
+	}
+}
+
+// ChainNormalizers builds a FixtureNormalizer that applies the given
+// normalizers in order, for example:
+//
+//	normalize := assert.ChainNormalizers(assert.NormalizeByReplacing(assert.ReplaceUUIDs), assert.NormalizeJSON)
+func ChainNormalizers(normalizers ...FixtureNormalizer) FixtureNormalizer {
+	return func(in []byte) ([]byte, error) {
+		var err error
+		for _, normalize := range normalizers {
+			in, err = normalize(in)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return in, nil
+	}
+}
+
+// NormalizedFixtureFile implements HTTPResponseBody like FixtureFile, but both
+// the fixture and the actual response body are converted into a canonical
+// form before comparing them. This is useful for fixtures that are maintained
+// by hand, where irrelevant differences like key order or indentation shall
+// not cause test failures.
+//
+//	assert.HTTPRequest{
+//		Method:       "GET",
+//		Path:         "/v1/config",
+//		ExpectStatus: http.StatusOK,
+//		ExpectBody:   assert.NormalizedFixtureFile{Path: "fixtures/config.json", Normalize: assert.NormalizeJSON},
+//	}.Check(t, handler)
+//
+// When updating fixtures through GOBITS_UPDATE_FIXTURES (see FixtureFile), the
+// canonical form of the actual response body is written into the fixture file.
+type NormalizedFixtureFile struct {
+	Path      string
+	Normalize FixtureNormalizer
+}
+
+// AssertResponseBody implements the HTTPResponseBody interface.
+func (f NormalizedFixtureFile) AssertResponseBody(t *testing.T, requestInfo string, responseBody []byte) bool {
+	t.Helper()
+
+	actual, err := f.Normalize(responseBody)
 	if err != nil {
-		t.Fatal(err)
+		t.Logf("Response body: %s", responseBody)
+		errorf(t, "%s: cannot normalize response body: %s", requestInfo, err.Error())
 		return false
 	}
-	actualPathAbs := fixturePathAbs + ".actual"
-	err = os.WriteFile(actualPathAbs, responseBody, 0o666)
+	return compareWithFixtureFile(t, requestInfo, f.Path, actual, f.Normalize)
+}
+
+// If normalize is not nil, it is applied to the fixture before comparing.
+// The actual content must already be normalized by the caller.
+func compareWithFixtureFile(t *testing.T, requestInfo, fixturePath string, actual []byte, normalize FixtureNormalizer) bool {
+	t.Helper()
+
+	if osext.GetenvBool("GOBITS_UPDATE_FIXTURES") {
+		err := os.WriteFile(fixturePath, actual, 0o666)
+		if err != nil {
+			fatalf(t, "%s", err.Error())
+			return false
+		}
+		return true
+	}
+
+	// write actual content to file to make it easy to copy the computed result over
+	// to the fixture path when a new test is added or an existing one is modified
+	err := os.WriteFile(fixturePath+".actual", actual, 0o666)
 	if err != nil {
-		t.Fatal(err)
+		fatalf(t, "%s", err.Error())
 		return false
 	}
 
-	cmd := exec.Command("diff", "-u", fixturePathAbs, actualPathAbs)
-	cmd.Stdin = nil
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	expected, err := os.ReadFile(fixturePath)
 	if err != nil {
-		t.Errorf("%s: body does not match: %s", requestInfo, err.Error())
+		errorf(t, "%s: body does not match: %s", requestInfo, err.Error())
+		return false
+	}
+	if normalize != nil {
+		expected, err = normalize(expected)
+		if err != nil {
+			errorf(t, "%s: cannot normalize contents of %s: %s", requestInfo, fixturePath, err.Error())
+			return false
+		}
 	}
 
-	return err == nil
+	diff := internal.UnifiedDiff(fixturePath, fixturePath+".actual", string(expected), string(actual))
+	if diff != "" {
+		errorf(t, "%s: body does not match fixture (set GOBITS_UPDATE_FIXTURES=true to update it):\n%s", requestInfo, diff)
+		return false
+	}
+	return true
 }
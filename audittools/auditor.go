@@ -35,6 +35,7 @@ import (
 	"net/url"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sapcc/go-api-declarations/cadf"
@@ -78,7 +79,27 @@ type AuditorOpts struct {
 	// The following metrics are registered:
 	//   - "audittools_successful_submissions" (counter, no labels)
 	//   - "audittools_failed_submissions" (counter, no labels)
+	//   - "audittools_dropped_events" (counter, no labels; see OnOverflow)
 	Registry prometheus.Registerer
+
+	// Optional. If given, events that cannot be published immediately are
+	// persisted in this store until they can be published, instead of being
+	// held in memory only. See type BackingStore for details.
+	BackingStore BackingStore
+
+	// Optional. If given, attachments whose JSON-serialized content is larger
+	// than this many bytes are handled according to OnOversizedEvent, instead of
+	// making the publish fail because the message is too large for the broker.
+	MaxAttachmentSize int
+	// Ignored if MaxAttachmentSize is zero. Defaults to TruncateAttachments.
+	OnOversizedEvent OversizedEventAction
+
+	// Optional. How many events can be buffered in memory while waiting to be
+	// published. Defaults to 20.
+	EventBufferSize int
+	// Optional. What Record() does when the buffer of events is full.
+	// Defaults to BlockOnOverflow.
+	OnOverflow OverflowAction
 }
 
 func (opts AuditorOpts) getConnectionOptions() (rabbitURL url.URL, queueName string, err error) {
@@ -121,6 +142,7 @@ func (opts AuditorOpts) getConnectionOptions() (rabbitURL url.URL, queueName str
 type standardAuditor struct {
 	Observer  Observer
 	EventSink chan<- cadf.Event
+	Overflow  overflowPolicy
 }
 
 // NewAuditor builds an Auditor connected to a RabbitMQ instance, using the provided configuration.
@@ -135,6 +157,18 @@ func NewAuditor(ctx context.Context, opts AuditorOpts) (Auditor, error) {
 	if opts.Observer.ID == "" {
 		return nil, errors.New("missing required value: AuditorOpts.Observer.ID")
 	}
+	if opts.MaxAttachmentSize > 0 && opts.OnOversizedEvent == DivertToDeadLetter && opts.BackingStore == nil {
+		return nil, errors.New("missing required value: AuditorOpts.BackingStore (required because of OnOversizedEvent = DivertToDeadLetter)")
+	}
+	if opts.OnOverflow == SpillToBackingStore && opts.BackingStore == nil {
+		return nil, errors.New("missing required value: AuditorOpts.BackingStore (required because of OnOverflow = SpillToBackingStore)")
+	}
+	if opts.EventBufferSize < 0 {
+		return nil, errors.New("invalid value: AuditorOpts.EventBufferSize may not be negative")
+	}
+	if opts.EventBufferSize == 0 {
+		opts.EventBufferSize = 20
+	}
 
 	// register Prometheus metrics
 	successCounter := prometheus.NewCounter(prometheus.CounterOpts{
@@ -145,14 +179,21 @@ func NewAuditor(ctx context.Context, opts AuditorOpts) (Auditor, error) {
 		Name: "audittools_failed_submissions",
 		Help: "Counter for failed (but retryable) audit event submissions to the Hermes RabbitMQ server.",
 	})
+	dropCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "audittools_dropped_events",
+		Help: "Counter for audit events that were dropped because the event buffer was full.",
+	})
 	successCounter.Add(0)
 	failureCounter.Add(0)
+	dropCounter.Add(0)
 	if opts.Registry == nil {
 		prometheus.MustRegister(successCounter)
 		prometheus.MustRegister(failureCounter)
+		prometheus.MustRegister(dropCounter)
 	} else {
 		opts.Registry.MustRegister(successCounter)
 		opts.Registry.MustRegister(failureCounter)
+		opts.Registry.MustRegister(dropCounter)
 	}
 
 	// spawn event delivery goroutine
@@ -160,22 +201,40 @@ func NewAuditor(ctx context.Context, opts AuditorOpts) (Auditor, error) {
 	if err != nil {
 		return nil, err
 	}
-	eventChan := make(chan cadf.Event, 20)
+	eventChan := make(chan cadf.Event, opts.EventBufferSize)
+	backingStore := opts.BackingStore
+	if opts.OnOverflow == SpillToBackingStore {
+		// Record() will call into the backing store concurrently with the Commit() goroutine
+		backingStore = &synchronizedBackingStore{inner: opts.BackingStore}
+	}
+	sizePolicy := eventSizePolicy{
+		MaxAttachmentSize: opts.MaxAttachmentSize,
+		Action:            opts.OnOversizedEvent,
+	}
 	go auditTrail{
 		EventSink:           eventChan,
 		OnSuccessfulPublish: func() { successCounter.Inc() },
 		OnFailedPublish:     func() { failureCounter.Inc() },
+		BackingStore:        backingStore,
+		SizePolicy:          sizePolicy,
 	}.Commit(ctx, rabbitURL, queueName)
 
 	return &standardAuditor{
 		Observer:  opts.Observer,
 		EventSink: eventChan,
+		Overflow: overflowPolicy{
+			Action:       opts.OnOverflow,
+			BackingStore: backingStore,
+			SizePolicy:   sizePolicy,
+			DropCounter:  dropCounter,
+			DropLogger:   &dropLogger{Interval: time.Minute},
+		},
 	}, nil
 }
 
 // Record implements the Auditor interface.
 func (a *standardAuditor) Record(event Event) {
-	a.EventSink <- event.ToCADF(a.Observer.ToCADF())
+	a.Overflow.send(a.EventSink, event.ToCADF(a.Observer.ToCADF()))
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,457 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package audittools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sapcc/go-api-declarations/cadf"
+)
+
+// BackingStore is a persistent buffer for audit events. It can be given to
+// NewAuditor() through AuditorOpts.BackingStore.
+//
+// Events that could not be published to RabbitMQ are written into the backing
+// store and delivered from there once RabbitMQ is reachable again, so that
+// they survive restarts of the process. Events that can never be published
+// (e.g. because they are too large, see AuditorOpts.MaxAttachmentSize) are
+// put into a separate dead-letter area for manual inspection.
+//
+// The Auditor never calls the methods of its backing store concurrently, so
+// implementations do not need to be safe for concurrent use. (With
+// AuditorOpts.OnOverflow = SpillToBackingStore, Record() also writes into the
+// backing store, but the Auditor serializes these calls with its own.)
+type BackingStore interface {
+	// Write appends an event to the buffer.
+	Write(event cadf.Event) error
+	// ReadBatch returns up to `limit` events from the start of the buffer,
+	// in the order in which they were written, without removing them.
+	ReadBatch(limit int) ([]cadf.Event, error)
+	// CommitBatch removes the first `count` events from the buffer, usually
+	// after they have been delivered successfully.
+	CommitBatch(count int) error
+	// WriteDeadLetter stores an event that cannot be delivered, along with a
+	// human-readable reason. Dead letters are never read by the Auditor.
+	WriteDeadLetter(event cadf.Event, reason string) error
+}
+
+// FileBackingStoreOpts contains options for NewFileBackingStore().
+type FileBackingStoreOpts struct {
+	// Required. The directory where events are stored. It is created if it does
+	// not exist yet. Dead letters are stored in the "dead-letter" subdirectory.
+	Directory string
+
+	// Optional. If given, the FileBackingStore will register its Prometheus
+	// metrics with this registry instead of the default registry.
+	// The following metrics are registered:
+	//   - "audittools_backing_store_writes" (counter, no labels)
+	//   - "audittools_backing_store_dead_letters" (counter, no labels)
+	Registry prometheus.Registerer
+
+	// Optional. When multiple FileBackingStore instances register their metrics
+	// with the same registry (e.g. because the process runs multiple auditors
+	// with different observers), their metrics need to be told apart using
+	// either of these options:
+	//
+	//   - If MetricNamespace is given, it is prepended to all metric names,
+	//     e.g. "foo" results in "foo_audittools_backing_store_writes".
+	//   - If MetricLabels are given, they are added as constant labels to all
+	//     metrics, e.g. {"observer": "foo"}. All instances sharing a registry
+	//     must use the same set of label names.
+	MetricNamespace string
+	MetricLabels    prometheus.Labels
+}
+
+// FileBackingStore is a BackingStore that stores each event in a separate JSON
+// file in a directory on the local filesystem. Construct it with NewFileBackingStore().
+//
+// Event files are grouped into subdirectories by the UTC date of their
+// writing (e.g. "2025-01-31"), so that no single directory grows too large.
+// Subdirectories are removed once all events in them have been committed.
+// Event files in the top-level directory (as written by earlier versions of
+// this library) are still read, and are delivered before all others.
+//
+// The directory is only listed once, on the first call to ReadBatch() or
+// CommitBatch(). Afterwards, the sorted list of event files is kept in memory
+// and updated by Write() and CommitBatch(), so that even a backlog of many
+// thousands of events does not require listing large directories on every
+// call. Therefore, the directory must not be modified by anything else while
+// the FileBackingStore is in use.
+//
+// Each event file is written into a temporary file, flushed to disk, and then
+// renamed to its final name, so that readers never observe partially-written
+// events. This does not rely on POSIX permissions or on fsync being supported:
+// On platforms like Windows or on network filesystems where flushing files or
+// directories is not supported, events are still written, just without the
+// durability guarantee. Transient failures to rename or remove files (as
+// caused on Windows by virus scanners holding files open) are retried.
+// Temporary files left over from interrupted writes are cleaned up by
+// NewFileBackingStore().
+//
+// Although the BackingStore interface does not require it, FileBackingStore
+// is safe for concurrent use (e.g. when it is inspected through an API while
+// an Auditor is using it).
+type FileBackingStore struct {
+	directory         string
+	mutex             sync.Mutex
+	lastTimestamp     int64
+	filePaths         []string // sorted paths of event files (relative to directory), only valid if hasFilePaths
+	hasFilePaths      bool
+	writeCounter      prometheus.Counter
+	deadLetterCounter prometheus.Counter
+}
+
+// NewFileBackingStore creates a FileBackingStore, using the provided configuration.
+func NewFileBackingStore(opts FileBackingStoreOpts) (*FileBackingStore, error) {
+	if opts.Directory == "" {
+		return nil, errors.New("missing required value: FileBackingStoreOpts.Directory")
+	}
+	for _, path := range []string{opts.Directory, filepath.Join(opts.Directory, "dead-letter")} {
+		err := os.MkdirAll(path, 0777) // subject to umask
+		if err != nil {
+			return nil, err
+		}
+	}
+	removeStaleTempFiles(opts.Directory, time.Now())
+
+	// register Prometheus metrics
+	s := &FileBackingStore{
+		directory: opts.Directory,
+		writeCounter: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   opts.MetricNamespace,
+			Name:        "audittools_backing_store_writes",
+			Help:        "Counter for audit events that were written into the backing store because they could not be published immediately.",
+			ConstLabels: opts.MetricLabels,
+		}),
+		deadLetterCounter: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   opts.MetricNamespace,
+			Name:        "audittools_backing_store_dead_letters",
+			Help:        "Counter for audit events that were put into the dead-letter area of the backing store because they cannot be published.",
+			ConstLabels: opts.MetricLabels,
+		}),
+	}
+	s.writeCounter.Add(0)
+	s.deadLetterCounter.Add(0)
+	if opts.Registry == nil {
+		prometheus.MustRegister(s.writeCounter)
+		prometheus.MustRegister(s.deadLetterCounter)
+	} else {
+		opts.Registry.MustRegister(s.writeCounter)
+		opts.Registry.MustRegister(s.deadLetterCounter)
+	}
+
+	return s, nil
+}
+
+// Write implements the BackingStore interface.
+func (s *FileBackingStore) Write(event cadf.Event) error {
+	err := s.writeFile(s.directory, true, event)
+	if err != nil {
+		return err
+	}
+	s.writeCounter.Inc()
+	return nil
+}
+
+// ReadBatch implements the BackingStore interface.
+func (s *FileBackingStore) ReadBatch(limit int) ([]cadf.Event, error) {
+	filePaths, err := s.listFiles(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]cadf.Event, 0, len(filePaths))
+	for _, filePath := range filePaths {
+		path := filepath.Join(s.directory, filePath)
+		buf, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// the file was removed by a concurrent CommitBatch() since we listed the directory
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var event cadf.Event
+		err = json.Unmarshal(buf, &event)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing %s: %w", path, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// CommitBatch implements the BackingStore interface.
+func (s *FileBackingStore) CommitBatch(count int) error {
+	filePaths, err := s.listFiles(count)
+	if err != nil {
+		return err
+	}
+	if count > len(filePaths) {
+		return fmt.Errorf("cannot commit %d events: only %d events are in the backing store", count, len(filePaths))
+	}
+	for _, filePath := range filePaths {
+		err := removeWithRetry(filepath.Join(s.directory, filePath))
+		if err != nil {
+			// we do not know exactly which files are left, so list them again next time
+			s.mutex.Lock()
+			s.hasFilePaths = false
+			s.mutex.Unlock()
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// drop the removed files from the cached list (a concurrent CommitBatch()
+	// might have dropped some of them already)
+	removed := make(map[string]bool, len(filePaths))
+	for _, filePath := range filePaths {
+		removed[filePath] = true
+	}
+	dropCount := 0
+	for dropCount < len(s.filePaths) && removed[s.filePaths[dropCount]] {
+		dropCount++
+	}
+	s.filePaths = s.filePaths[dropCount:]
+
+	// clean up subdirectories that we emptied; this fails harmlessly if a
+	// subdirectory still contains files (the lock ensures that we do not remove
+	// a subdirectory that a concurrent Write() has just created for a new file)
+	var shards []string
+	for _, filePath := range filePaths {
+		if shard := filepath.Dir(filePath); shard != "." {
+			shards = append(shards, shard)
+		}
+	}
+	for _, shard := range slices.Compact(shards) {
+		_ = os.Remove(filepath.Join(s.directory, shard))
+	}
+	return nil
+}
+
+// WriteDeadLetter implements the BackingStore interface.
+func (s *FileBackingStore) WriteDeadLetter(event cadf.Event, reason string) error {
+	payload := deadLetter{Reason: reason, Event: event}
+	err := s.writeFile(filepath.Join(s.directory, "dead-letter"), false, payload)
+	if err != nil {
+		return err
+	}
+	s.deadLetterCounter.Inc()
+	return nil
+}
+
+// Inspect implements the InspectableBackingStore interface. It only looks at
+// the metadata of the event files: The write times are the modification
+// times of the files, and the total size is the sum of the file sizes.
+func (s *FileBackingStore) Inspect() (BackingStoreSummary, error) {
+	var summary BackingStoreSummary
+	addFile := func(entry os.DirEntry) error {
+		if !isEventFile(entry) {
+			return nil
+		}
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			// the file was removed by a concurrent CommitBatch() since we listed the directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		summary.EventCount++
+		summary.TotalBytes += info.Size()
+		mtime := info.ModTime()
+		if summary.OldestWriteTime == nil || mtime.Before(*summary.OldestWriteTime) {
+			summary.OldestWriteTime = &mtime
+		}
+		if summary.NewestWriteTime == nil || mtime.After(*summary.NewestWriteTime) {
+			summary.NewestWriteTime = &mtime
+		}
+		return nil
+	}
+
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		return BackingStoreSummary{}, err
+	}
+	for _, entry := range entries {
+		if !isShardDirectory(entry) {
+			err := addFile(entry)
+			if err != nil {
+				return BackingStoreSummary{}, err
+			}
+			continue
+		}
+		shardEntries, err := os.ReadDir(filepath.Join(s.directory, entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			// the subdirectory was removed by a concurrent CommitBatch() since we listed the directory
+			continue
+		}
+		if err != nil {
+			return BackingStoreSummary{}, err
+		}
+		for _, shardEntry := range shardEntries {
+			err := addFile(shardEntry)
+			if err != nil {
+				return BackingStoreSummary{}, err
+			}
+		}
+	}
+	return summary, nil
+}
+
+// The file format for dead letters.
+type deadLetter struct {
+	Reason string     `json:"reason"`
+	Event  cadf.Event `json:"event"`
+}
+
+// Writes a JSON file into the given directory. The file name starts with a
+// timestamp, so that sorting file names yields the order of writes. If
+// `sharded` is true, the file is put into a subdirectory for the current date.
+func (s *FileBackingStore) writeFile(directory string, sharded bool, payload any) error {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// ensure that file names are unique and strictly ascending even if the clock
+	// does not advance; the lock is held until the file has been published, so
+	// that files appear in the order of their names (otherwise CommitBatch()
+	// could remove a file that was published late and never seen by ReadBatch())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	timestamp := max(time.Now().UnixNano(), s.lastTimestamp+1)
+	s.lastTimestamp = timestamp
+
+	if sharded {
+		directory = filepath.Join(directory, time.Unix(0, timestamp).UTC().Format(shardNameFormat))
+	}
+
+	// write into a temporary file first and rename afterwards, so that
+	// ReadBatch() never observes a partially-written file
+	fileName := fmt.Sprintf("%020d.json", timestamp)
+	tmpPath := filepath.Join(directory, "."+fileName+".tmp")
+	err = writeFileAndSync(tmpPath, buf)
+	if errors.Is(err, os.ErrNotExist) && sharded {
+		// the subdirectory does not exist yet (or was just cleaned up by CommitBatch())
+		err = os.MkdirAll(directory, 0777) // subject to umask
+		if err == nil {
+			err = writeFileAndSync(tmpPath, buf)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	err = renameWithRetry(tmpPath, filepath.Join(directory, fileName))
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	syncDirectory(directory)
+
+	// since file names are ascending, the new event file goes at the end of the list
+	if sharded && s.hasFilePaths {
+		s.filePaths = append(s.filePaths, filepath.Join(filepath.Base(directory), fileName))
+	}
+	return nil
+}
+
+// The format for names of the subdirectories containing event files.
+const shardNameFormat = "2006-01-02"
+
+// Returns the paths (relative to s.directory) of up to `limit` event files
+// from the start of the buffer, in order of writing.
+func (s *FileBackingStore) listFiles(limit int) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.hasFilePaths {
+		filePaths, err := s.listAllFiles()
+		if err != nil {
+			return nil, err
+		}
+		s.filePaths = filePaths
+		s.hasFilePaths = true
+	}
+	return slices.Clone(s.filePaths[:min(limit, len(s.filePaths))]), nil
+}
+
+// Lists the paths (relative to s.directory) of all event files, in order of writing.
+// The caller must hold s.mutex, so that the listing does not race with Write().
+func (s *FileBackingStore) listAllFiles() ([]string, error) {
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		return nil, err
+	}
+
+	// files in the top-level directory predate all subdirectories
+	filePaths := eventFilePaths("", entries)
+
+	// since os.ReadDir() sorts by name, subdirectories are visited in order of date
+	for _, entry := range entries {
+		if !isShardDirectory(entry) {
+			continue
+		}
+		shard := entry.Name()
+		shardEntries, err := os.ReadDir(filepath.Join(s.directory, shard))
+		if err != nil {
+			return nil, err
+		}
+		filePaths = append(filePaths, eventFilePaths(shard, shardEntries)...)
+	}
+	return filePaths, nil
+}
+
+// Returns the paths of all event files among the given directory entries.
+func eventFilePaths(shard string, entries []os.DirEntry) []string {
+	var result []string
+	for _, entry := range entries {
+		if isEventFile(entry) {
+			result = append(result, filepath.Join(shard, entry.Name()))
+		}
+	}
+	return result
+}
+
+func isEventFile(entry os.DirEntry) bool {
+	name := entry.Name()
+	return entry.Type().IsRegular() && strings.HasSuffix(name, ".json") && !strings.HasPrefix(name, ".")
+}
+
+// Returns whether the given entry is a subdirectory containing event files
+// (as opposed to e.g. "dead-letter").
+func isShardDirectory(entry os.DirEntry) bool {
+	if !entry.IsDir() {
+		return false
+	}
+	_, err := time.Parse(shardNameFormat, entry.Name())
+	return err == nil
+}
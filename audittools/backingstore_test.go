@@ -0,0 +1,491 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package audittools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sapcc/go-api-declarations/cadf"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestFileBackingStore(t *testing.T) {
+	dir := t.TempDir()
+	s := must.Return(NewFileBackingStore(FileBackingStoreOpts{
+		Directory: dir,
+		Registry:  prometheus.NewRegistry(),
+	}))
+
+	// empty store
+	events := must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", len(events), 0)
+
+	// events are returned in order of writing
+	for _, id := range []string{"first", "second", "third"} {
+		must.Succeed(s.Write(cadf.Event{ID: id}))
+	}
+	events = must.Return(s.ReadBatch(2))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "first"}, {ID: "second"}})
+
+	// reading again without commit returns the same events
+	events = must.Return(s.ReadBatch(2))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "first"}, {ID: "second"}})
+
+	// commit removes events from the front
+	must.Succeed(s.CommitBatch(1))
+	events = must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "second"}, {ID: "third"}})
+
+	// events survive reopening the store
+	s = must.Return(NewFileBackingStore(FileBackingStoreOpts{
+		Directory: dir,
+		Registry:  prometheus.NewRegistry(),
+	}))
+	events = must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "second"}, {ID: "third"}})
+
+	// dead letters do not show up in ReadBatch
+	must.Succeed(s.WriteDeadLetter(cadf.Event{ID: "dead"}, "too large"))
+	events = must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", len(events), 2)
+	entries := must.Return(os.ReadDir(filepath.Join(dir, "dead-letter")))
+	assert.DeepEqual(t, "dead letter count", len(entries), 1)
+	buf := must.Return(os.ReadFile(filepath.Join(dir, "dead-letter", entries[0].Name())))
+	if !strings.Contains(string(buf), `"reason":"too large"`) {
+		t.Errorf("unexpected dead letter contents: %s", string(buf))
+	}
+}
+
+func TestFileBackingStoreInspect(t *testing.T) {
+	dir := t.TempDir()
+	s := must.Return(NewFileBackingStore(FileBackingStoreOpts{
+		Directory: dir,
+		Registry:  prometheus.NewRegistry(),
+	}))
+
+	// empty store
+	summary := must.Return(InspectBackingStore(s))
+	assert.DeepEqual(t, "summary", summary, BackingStoreSummary{})
+
+	// events and dead letters are written, but only events are counted
+	start := time.Now().Add(-time.Second) // allow for coarse mtime granularity
+	for _, id := range []string{"first", "second", "third"} {
+		must.Succeed(s.Write(cadf.Event{ID: id}))
+	}
+	must.Succeed(s.WriteDeadLetter(cadf.Event{ID: "dead"}, "too large"))
+	var expectedBytes int64
+	for _, filePath := range must.Return(s.listFiles(10)) {
+		expectedBytes += must.Return(os.Stat(filepath.Join(dir, filePath))).Size()
+	}
+
+	summary = must.Return(InspectBackingStore(s))
+	assert.DeepEqual(t, "event count", summary.EventCount, 3)
+	assert.DeepEqual(t, "total bytes", summary.TotalBytes, expectedBytes)
+	if summary.OldestWriteTime == nil || summary.NewestWriteTime == nil {
+		t.Fatalf("expected write times to be reported, but got %#v", summary)
+	}
+	if summary.OldestWriteTime.Before(start) || summary.NewestWriteTime.Before(*summary.OldestWriteTime) || summary.NewestWriteTime.After(time.Now()) {
+		t.Errorf("unexpected write times: oldest = %s, newest = %s", summary.OldestWriteTime, summary.NewestWriteTime)
+	}
+
+	// inspecting does not consume events
+	events := must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", len(events), 3)
+	must.Succeed(s.CommitBatch(2))
+	summary = must.Return(InspectBackingStore(s))
+	assert.DeepEqual(t, "event count after commit", summary.EventCount, 1)
+
+	// other stores need to opt into inspection
+	_, err := InspectBackingStore(nonInspectableBackingStore{s})
+	assert.DeepEqual(t, "error", fmt.Sprint(err), "backing store of type audittools.nonInspectableBackingStore does not support inspection")
+}
+
+type nonInspectableBackingStore struct {
+	BackingStore
+}
+
+func TestFileBackingStoreLayout(t *testing.T) {
+	dir := t.TempDir()
+	s := must.Return(NewFileBackingStore(FileBackingStoreOpts{
+		Directory: dir,
+		Registry:  prometheus.NewRegistry(),
+	}))
+
+	// an event file from before the introduction of subdirectories
+	must.Succeed(os.WriteFile(filepath.Join(dir, "00000000000000000001.json"), []byte(`{"id":"legacy"}`), 0666))
+
+	// new events go into a subdirectory for the current date
+	must.Succeed(s.Write(cadf.Event{ID: "first"}))
+	must.Succeed(s.Write(cadf.Event{ID: "second"}))
+	shard := time.Now().UTC().Format("2006-01-02")
+	entries := must.Return(os.ReadDir(filepath.Join(dir, shard)))
+	assert.DeepEqual(t, "event files in subdirectory", len(entries), 2)
+
+	// legacy events are delivered first
+	events := must.Return(s.ReadBatch(2))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "legacy"}, {ID: "first"}})
+
+	// subdirectories are cleaned up when they become empty
+	must.Succeed(s.CommitBatch(2))
+	_, err := os.Stat(filepath.Join(dir, shard))
+	assert.DeepEqual(t, "subdirectory exists", err == nil, true)
+	must.Succeed(s.CommitBatch(1))
+	_, err = os.Stat(filepath.Join(dir, shard))
+	assert.DeepEqual(t, "subdirectory removed", errors.Is(err, os.ErrNotExist), true)
+
+	// writing works again after the cleanup
+	must.Succeed(s.Write(cadf.Event{ID: "third"}))
+	events = must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "third"}})
+}
+
+func TestFileBackingStoreListingCache(t *testing.T) {
+	dir := t.TempDir()
+	s := must.Return(NewFileBackingStore(FileBackingStoreOpts{
+		Directory: dir,
+		Registry:  prometheus.NewRegistry(),
+	}))
+
+	// the first read lists the directory (including legacy event files)
+	must.Succeed(os.WriteFile(filepath.Join(dir, "00000000000000000001.json"), []byte(`{"id":"legacy"}`), 0666))
+	must.Succeed(s.Write(cadf.Event{ID: "first"}))
+	events := must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "legacy"}, {ID: "first"}})
+
+	// afterwards, writes and commits update the cached listing
+	must.Succeed(s.Write(cadf.Event{ID: "second"}))
+	must.Succeed(s.CommitBatch(2))
+	must.Succeed(s.Write(cadf.Event{ID: "third"}))
+	events = must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "second"}, {ID: "third"}})
+	assert.DeepEqual(t, "cached listing", s.filePaths, must.Return(s.listAllFiles()))
+
+	// the cached listing does not pick up files added behind our back
+	must.Succeed(os.WriteFile(filepath.Join(dir, "00000000000000000002.json"), []byte(`{"id":"external"}`), 0666))
+	events = must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "second"}, {ID: "third"}})
+
+	// but a fresh FileBackingStore does
+	s = must.Return(NewFileBackingStore(FileBackingStoreOpts{
+		Directory: dir,
+		Registry:  prometheus.NewRegistry(),
+	}))
+	events = must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "external"}, {ID: "second"}, {ID: "third"}})
+}
+
+func TestFileBackingStoreConcurrentWriteAndCommit(t *testing.T) {
+	s := must.Return(NewFileBackingStore(FileBackingStoreOpts{
+		Directory: t.TempDir(),
+		Registry:  prometheus.NewRegistry(),
+	}))
+
+	// several writers run concurrently with a reader that commits everything it reads
+	const (
+		writerCount     = 4
+		eventsPerWriter = 50
+	)
+	var wg sync.WaitGroup
+	for w := range writerCount {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range eventsPerWriter {
+				must.Succeed(s.Write(cadf.Event{ID: fmt.Sprintf("%d-%d", w, i)}))
+			}
+		}()
+	}
+	writersDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(writersDone)
+	}()
+
+	// every event must be read exactly once, none may be lost by CommitBatch()
+	seen := make(map[string]int)
+	for isDone := false; !isDone; {
+		select {
+		case <-writersDone:
+			isDone = true
+		default:
+		}
+		for {
+			events := must.Return(s.ReadBatch(10))
+			if len(events) == 0 {
+				break
+			}
+			for _, event := range events {
+				seen[event.ID]++
+			}
+			must.Succeed(s.CommitBatch(len(events)))
+		}
+	}
+	assert.DeepEqual(t, "number of delivered events", len(seen), writerCount*eventsPerWriter)
+	for id, count := range seen {
+		if count != 1 {
+			t.Errorf("event %s was delivered %d times", id, count)
+		}
+	}
+}
+
+func TestFileBackingStoreMetrics(t *testing.T) {
+	// multiple stores can share a registry if their metrics are distinguished by namespace or labels
+	registry := prometheus.NewPedanticRegistry()
+	for _, opts := range []FileBackingStoreOpts{
+		{MetricLabels: prometheus.Labels{"observer": "foo"}},
+		{MetricLabels: prometheus.Labels{"observer": "bar"}},
+		{MetricNamespace: "other"},
+	} {
+		opts.Directory = t.TempDir()
+		opts.Registry = registry
+		s := must.Return(NewFileBackingStore(opts))
+		if opts.MetricLabels["observer"] == "foo" {
+			must.Succeed(s.Write(cadf.Event{ID: "first"}))
+		}
+	}
+
+	actual := make(map[string]float64)
+	for _, family := range must.Return(registry.Gather()) {
+		for _, metric := range family.GetMetric() {
+			key := family.GetName()
+			for _, label := range metric.GetLabel() {
+				key += "/" + label.GetValue()
+			}
+			actual[key] = metric.GetCounter().GetValue()
+		}
+	}
+	assert.DeepEqual(t, "metrics", actual, map[string]float64{
+		"audittools_backing_store_writes/bar":         0,
+		"audittools_backing_store_writes/foo":         1,
+		"audittools_backing_store_dead_letters/bar":   0,
+		"audittools_backing_store_dead_letters/foo":   0,
+		"other_audittools_backing_store_writes":       0,
+		"other_audittools_backing_store_dead_letters": 0,
+	})
+}
+
+func TestEventSizePolicy(t *testing.T) {
+	makeEvent := func() cadf.Event {
+		return cadf.Event{
+			ID: "event",
+			Attachments: []cadf.Attachment{
+				{Name: "small", TypeURI: "mime:application/json", Content: "ok"},
+				{Name: "large", TypeURI: "mime:application/json", Content: strings.Repeat("ä", 10)},
+			},
+		}
+	}
+
+	// no limit: nothing happens
+	event := makeEvent()
+	assert.DeepEqual(t, "divert reason", eventSizePolicy{}.apply(&event), "")
+	assert.DeepEqual(t, "event", event, makeEvent())
+
+	// truncation (the large attachment serializes to 22 bytes; the limit of 8
+	// bytes falls in the middle of a two-byte character, so only 7 bytes remain)
+	originalAttachments := makeEvent().Attachments
+	event = makeEvent()
+	event.Attachments = originalAttachments
+	p := eventSizePolicy{MaxAttachmentSize: 8, Action: TruncateAttachments}
+	assert.DeepEqual(t, "divert reason", p.apply(&event), "")
+	assert.DeepEqual(t, "attachments", event.Attachments, []cadf.Attachment{
+		{Name: "small", TypeURI: "mime:application/json", Content: "ok"},
+		{Name: "large", TypeURI: "mime:text/plain", Content: `"äää...[truncated: 22 bytes total]`},
+	})
+	assert.DeepEqual(t, "original attachments", originalAttachments, makeEvent().Attachments)
+
+	// diversion
+	event = makeEvent()
+	p = eventSizePolicy{MaxAttachmentSize: 8, Action: DivertToDeadLetter}
+	assert.DeepEqual(t, "divert reason", p.apply(&event), `attachment "large" has 22 bytes (max allowed: 8 bytes)`)
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	eventIDs := func(events []cadf.Event) []string {
+		var result []string
+		for _, e := range events {
+			result = append(result, e.ID)
+		}
+		return result
+	}
+
+	// DropOnOverflow: events that do not fit into the buffer are dropped and counted
+	registry := prometheus.NewPedanticRegistry()
+	dropCounter := prometheus.NewCounter(prometheus.CounterOpts{Name: "dropped", Help: "Dropped events."})
+	registry.MustRegister(dropCounter)
+	eventChan := make(chan cadf.Event, 2)
+	var logBuffer bytes.Buffer
+	logg.SetLogger(log.New(&logBuffer, "", 0))
+	defer logg.SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	dropLogger := &dropLogger{Interval: time.Hour} // we will flush it manually
+	p := overflowPolicy{Action: DropOnOverflow, DropCounter: dropCounter, DropLogger: dropLogger}
+	for _, id := range []string{"first", "second", "third", "fourth"} {
+		p.send(eventChan, cadf.Event{ID: id})
+	}
+	assert.DeepEqual(t, "log before flush", logBuffer.String(), "")
+	dropLogger.flush()
+	assert.DeepEqual(t, "log after flush", logBuffer.String(),
+		"ERROR: audittools: dropped 2 audit events within the last 1h0m0s because the event buffer was full\n")
+	close(eventChan)
+	var received []cadf.Event
+	for e := range eventChan {
+		received = append(received, e)
+	}
+	assert.DeepEqual(t, "received events", eventIDs(received), []string{"first", "second"})
+	families := must.Return(registry.Gather())
+	assert.DeepEqual(t, "dropped events", families[0].GetMetric()[0].GetCounter().GetValue(), 2.0)
+
+	// SpillToBackingStore: events that do not fit into the buffer go into the backing store,
+	// except for those that go directly into the dead-letter area
+	s := must.Return(NewFileBackingStore(FileBackingStoreOpts{
+		Directory: t.TempDir(),
+		Registry:  prometheus.NewRegistry(),
+	}))
+	eventChan = make(chan cadf.Event, 1)
+	p = overflowPolicy{
+		Action:       SpillToBackingStore,
+		BackingStore: s,
+		SizePolicy:   eventSizePolicy{MaxAttachmentSize: 8, Action: DivertToDeadLetter},
+	}
+	p.send(eventChan, cadf.Event{ID: "first"})
+	p.send(eventChan, cadf.Event{ID: "second"})
+	p.send(eventChan, cadf.Event{ID: "oversized", Attachments: []cadf.Attachment{{Name: "large", Content: "too large for the limit"}}})
+	p.send(eventChan, cadf.Event{ID: "third"})
+	assert.DeepEqual(t, "buffered event", (<-eventChan).ID, "first")
+	assert.DeepEqual(t, "spilled events", eventIDs(must.Return(s.ReadBatch(10))), []string{"second", "third"})
+	deadLetters := must.Return(os.ReadDir(filepath.Join(s.directory, "dead-letter")))
+	assert.DeepEqual(t, "number of dead letters", len(deadLetters), 1)
+}
+
+// A BackingStore that fails the test when its methods are called concurrently.
+type concurrencyDetectingBackingStore struct {
+	t        *testing.T
+	inFlight atomic.Int32
+}
+
+func (s *concurrencyDetectingBackingStore) enter() func() {
+	if s.inFlight.Add(1) > 1 {
+		s.t.Error("backing store was called concurrently")
+	}
+	time.Sleep(time.Millisecond)
+	return func() { s.inFlight.Add(-1) }
+}
+
+func (s *concurrencyDetectingBackingStore) Write(event cadf.Event) error {
+	defer s.enter()()
+	return nil
+}
+
+func (s *concurrencyDetectingBackingStore) ReadBatch(limit int) ([]cadf.Event, error) {
+	defer s.enter()()
+	return nil, nil
+}
+
+func (s *concurrencyDetectingBackingStore) CommitBatch(count int) error {
+	defer s.enter()()
+	return nil
+}
+
+func (s *concurrencyDetectingBackingStore) WriteDeadLetter(event cadf.Event, reason string) error {
+	defer s.enter()()
+	return nil
+}
+
+func TestSynchronizedBackingStore(t *testing.T) {
+	// simulate Record() spilling events while the delivery goroutine works through the backing store
+	s := &synchronizedBackingStore{inner: &concurrencyDetectingBackingStore{t: t}}
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				must.SucceedT(t, s.Write(cadf.Event{}))
+				must.SucceedT(t, s.WriteDeadLetter(cadf.Event{}, "reason"))
+			}
+		}()
+	}
+	for range 5 {
+		must.ReturnT(s.ReadBatch(10))(t)
+		must.SucceedT(t, s.CommitBatch(0))
+	}
+	wg.Wait()
+}
+
+func TestFileBackingStoreFilesystemQuirks(t *testing.T) {
+	dir := t.TempDir()
+	shardDir := filepath.Join(dir, "2025-01-31")
+	must.Succeed(os.MkdirAll(shardDir, 0777))
+
+	// temporary files from interrupted writes are cleaned up once they are old enough
+	staleFile := filepath.Join(shardDir, ".00000000000000000001.json.tmp")
+	freshFile := filepath.Join(dir, ".00000000000000000002.json.tmp")
+	for _, path := range []string{staleFile, freshFile} {
+		must.Succeed(os.WriteFile(path, []byte(`{"id":"partial`), 0666))
+	}
+	staleTime := time.Now().Add(-2 * time.Hour)
+	must.Succeed(os.Chtimes(staleFile, staleTime, staleTime))
+
+	s := must.Return(NewFileBackingStore(FileBackingStoreOpts{
+		Directory: dir,
+		Registry:  prometheus.NewRegistry(),
+	}))
+	_, err := os.Stat(staleFile)
+	assert.DeepEqual(t, "stale temporary file removed", errors.Is(err, os.ErrNotExist), true)
+	_, err = os.Stat(freshFile)
+	assert.DeepEqual(t, "fresh temporary file kept", err == nil, true)
+
+	// temporary files are never read as events
+	must.Succeed(s.Write(cadf.Event{ID: "first"}))
+	events := must.Return(s.ReadBatch(10))
+	assert.DeepEqual(t, "events", events, []cadf.Event{{ID: "first"}})
+
+	// removing a file that is already gone is not an error (e.g. after an interrupted CommitBatch())
+	must.Succeed(removeWithRetry(filepath.Join(dir, "does-not-exist.json")))
+
+	// permission errors (as reported by Windows for files held open by other processes) are retried
+	attempts := 0
+	err = retryFileOp(func() error {
+		attempts++
+		if attempts < 3 {
+			return &os.PathError{Op: "rename", Path: "foo", Err: os.ErrPermission}
+		}
+		return nil
+	})
+	assert.DeepEqual(t, "error after retries", err, nil)
+	assert.DeepEqual(t, "attempts", attempts, 3)
+
+	// filesystems that cannot flush files are tolerated
+	assert.DeepEqual(t, "ErrUnsupported", isSyncUnsupported(&os.PathError{Op: "sync", Path: "foo", Err: errors.ErrUnsupported}), true)
+	assert.DeepEqual(t, "ErrPermission", isSyncUnsupported(&os.PathError{Op: "sync", Path: "foo", Err: os.ErrPermission}), false)
+}
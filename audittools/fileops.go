@@ -0,0 +1,131 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package audittools
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The helpers in this file implement the filesystem operations of
+// FileBackingStore such that they also work on platforms without POSIX
+// semantics, e.g. on Windows or on some network filesystems.
+
+// Writes a file and flushes it to stable storage. If the filesystem does not
+// support flushing, the data is still written, but the error is ignored.
+func writeFileAndSync(path string, buf []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666) // subject to umask
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+		if isSyncUnsupported(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// Flushes the directory entry of a file that was just created or renamed in
+// the given directory. This is best-effort: Some platforms (e.g. Windows) do
+// not allow opening or syncing directories at all, so errors are ignored.
+func syncDirectory(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	_ = dir.Sync()
+	dir.Close()
+}
+
+// Returns whether the given error from File.Sync() indicates that the
+// filesystem does not support flushing, rather than a failure to flush.
+func isSyncUnsupported(err error) bool {
+	return errors.Is(err, errors.ErrUnsupported) || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP)
+}
+
+// On Windows, renaming or removing a file can fail temporarily when another
+// process (e.g. a virus scanner or a file indexer) has the file open. These
+// errors are reported as permission errors, so operations are retried a few
+// times before giving up.
+const (
+	fileOpRetries    = 5
+	fileOpRetryDelay = 20 * time.Millisecond
+)
+
+func retryFileOp(op func() error) error {
+	err := op()
+	for attempt := 1; attempt < fileOpRetries && errors.Is(err, os.ErrPermission); attempt++ {
+		time.Sleep(time.Duration(attempt) * fileOpRetryDelay)
+		err = op()
+	}
+	return err
+}
+
+// Like os.Rename, but with retries (see above). Renaming onto an existing file
+// replaces it atomically on all supported platforms.
+func renameWithRetry(oldPath, newPath string) error {
+	return retryFileOp(func() error { return os.Rename(oldPath, newPath) })
+}
+
+// Like os.Remove, but with retries (see above). Files that do not exist
+// (anymore) are not an error.
+func removeWithRetry(path string) error {
+	err := retryFileOp(func() error { return os.Remove(path) })
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Temporary files that are older than this are left over from an interrupted
+// write (e.g. because the process crashed before it could rename the file).
+const staleTempFileAge = time.Hour
+
+// Removes temporary files from interrupted writes in the given directory and
+// its subdirectories. Errors are ignored since these files do not affect correctness.
+func removeStaleTempFiles(directory string, now time.Time) {
+	_ = filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil //nolint:nilerr // skip unreadable entries, but keep walking
+		}
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".tmp") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err == nil && now.Sub(info.ModTime()) > staleTempFileAge {
+			_ = os.Remove(path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,64 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package audittools
+
+import (
+	"fmt"
+	"time"
+)
+
+// BackingStoreSummary describes the events that are currently buffered in a
+// BackingStore. It is returned by InspectBackingStore().
+type BackingStoreSummary struct {
+	// The number of events in the buffer.
+	EventCount int `json:"event_count"`
+	// The total size of all events in the buffer, in bytes. How this is
+	// measured depends on the BackingStore implementation.
+	TotalBytes int64 `json:"total_bytes"`
+	// When the oldest and newest events in the buffer were written into it.
+	// Nil if the buffer is empty.
+	OldestWriteTime *time.Time `json:"oldest_write_time,omitempty"`
+	NewestWriteTime *time.Time `json:"newest_write_time,omitempty"`
+}
+
+// InspectableBackingStore is an optional interface for BackingStore
+// implementations that can summarize their contents without reading all
+// events. FileBackingStore implements this interface.
+type InspectableBackingStore interface {
+	BackingStore
+	// Inspect returns a summary of the events in the buffer without removing
+	// them. Unlike the methods of BackingStore, this may be called at any time,
+	// concurrently with any other method.
+	Inspect() (BackingStoreSummary, error)
+}
+
+// InspectBackingStore summarizes the events that are currently buffered in
+// the given BackingStore without removing them. This is intended for
+// operators to gauge the size of the backlog while RabbitMQ is unavailable.
+//
+// This only works for stores that implement InspectableBackingStore. For all
+// other stores, an error is returned.
+func InspectBackingStore(store BackingStore) (BackingStoreSummary, error) {
+	inspectable, ok := store.(InspectableBackingStore)
+	if !ok {
+		return BackingStoreSummary{}, fmt.Errorf("backing store of type %T does not support inspection", store)
+	}
+	return inspectable.Inspect()
+}
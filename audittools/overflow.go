@@ -0,0 +1,160 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package audittools
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sapcc/go-api-declarations/cadf"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// OverflowAction is the type of AuditorOpts.OnOverflow.
+// It declares what happens when Record() is called while the buffer of
+// events waiting to be published is full (see AuditorOpts.EventBufferSize).
+type OverflowAction int
+
+const (
+	// BlockOnOverflow makes Record() block until there is room in the buffer.
+	// This ensures that no events are lost, but slows down the application
+	// while events cannot be published quickly enough.
+	BlockOnOverflow OverflowAction = iota
+	// DropOnOverflow makes Record() discard the event if the buffer is full.
+	// Dropped events are counted in the metric "audittools_dropped_events".
+	// Instead of logging each dropped event, the number of dropped events is
+	// logged at most once per minute.
+	DropOnOverflow
+	// SpillToBackingStore makes Record() write the event directly into the
+	// AuditorOpts.BackingStore (which is then required) if the buffer is full.
+	// The event will be published once the backing store is flushed.
+	SpillToBackingStore
+)
+
+// Applies the policy from AuditorOpts.OnOverflow.
+type overflowPolicy struct {
+	Action       OverflowAction
+	BackingStore BackingStore // required for SpillToBackingStore
+	SizePolicy   eventSizePolicy
+	DropCounter  prometheus.Counter
+	DropLogger   *dropLogger // required for DropOnOverflow
+}
+
+// Sends the event into the channel, or handles it according to the policy if the channel is full.
+func (p overflowPolicy) send(eventSink chan<- cadf.Event, event cadf.Event) {
+	if p.Action == BlockOnOverflow {
+		eventSink <- event
+		return
+	}
+	select {
+	case eventSink <- event:
+		return
+	default:
+	}
+
+	switch p.Action {
+	case DropOnOverflow:
+		p.DropCounter.Inc()
+		p.DropLogger.recordDrop()
+	case SpillToBackingStore:
+		if reason := p.SizePolicy.apply(&event); reason != "" {
+			err := p.BackingStore.WriteDeadLetter(event, reason)
+			if err == nil {
+				return
+			}
+			logg.Error("audittools: failed to write audit event with ID %q into dead-letter area (reason for diversion: %s): %s", event.ID, reason, err.Error())
+		} else {
+			err := p.BackingStore.Write(event)
+			if err == nil {
+				return
+			}
+			logg.Error("audittools: failed to spill audit event with ID %q into backing store: %s", event.ID, err.Error())
+		}
+		// if the backing store does not work, do not lose the event
+		eventSink <- event
+	}
+}
+
+// Logs how many events were dropped by DropOnOverflow. When the event buffer
+// overflows, there are usually many events being dropped in short succession,
+// so logging each of them individually would flood the log.
+type dropLogger struct {
+	Interval time.Duration
+	mutex    sync.Mutex
+	count    uint64
+}
+
+func (l *dropLogger) recordDrop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.count++
+	if l.count == 1 {
+		time.AfterFunc(l.Interval, l.flush)
+	}
+}
+
+func (l *dropLogger) flush() {
+	l.mutex.Lock()
+	count := l.count
+	l.count = 0
+	l.mutex.Unlock()
+
+	if count > 0 {
+		logg.Error("audittools: dropped %d audit events within the last %s because the event buffer was full", count, l.Interval)
+	}
+}
+
+// Wraps a BackingStore to serialize all calls into it. This is used for
+// SpillToBackingStore, where Record() calls into the backing store
+// concurrently with the goroutine delivering events.
+type synchronizedBackingStore struct {
+	inner BackingStore
+	mutex sync.Mutex
+}
+
+// Write implements the BackingStore interface.
+func (s *synchronizedBackingStore) Write(event cadf.Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.inner.Write(event)
+}
+
+// ReadBatch implements the BackingStore interface.
+func (s *synchronizedBackingStore) ReadBatch(limit int) ([]cadf.Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.inner.ReadBatch(limit)
+}
+
+// CommitBatch implements the BackingStore interface.
+func (s *synchronizedBackingStore) CommitBatch(count int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.inner.CommitBatch(count)
+}
+
+// WriteDeadLetter implements the BackingStore interface.
+func (s *synchronizedBackingStore) WriteDeadLetter(event cadf.Event, reason string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.inner.WriteDeadLetter(event, reason)
+}
@@ -0,0 +1,103 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package audittools
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/sapcc/go-api-declarations/cadf"
+)
+
+// OversizedEventAction is the type of AuditorOpts.OnOversizedEvent.
+// It declares what happens to events with attachments that are larger than
+// AuditorOpts.MaxAttachmentSize.
+type OversizedEventAction int
+
+const (
+	// TruncateAttachments replaces the content of oversized attachments with a
+	// truncated plain-text representation that ends in a marker like
+	// "...[truncated: 123456 bytes total]". The event is then published as usual.
+	TruncateAttachments OversizedEventAction = iota
+	// DivertToDeadLetter does not publish events with oversized attachments.
+	// Instead, the full event is put into the dead-letter area of the
+	// AuditorOpts.BackingStore, which is then required.
+	DivertToDeadLetter
+)
+
+// Applies the policy from AuditorOpts.MaxAttachmentSize and AuditorOpts.OnOversizedEvent.
+type eventSizePolicy struct {
+	MaxAttachmentSize int // 0 = unlimited
+	Action            OversizedEventAction
+}
+
+// Checks the event's attachments against the size limit. If the event has
+// oversized attachments, they are truncated if the policy says so. Otherwise,
+// a non-empty string describing the problem is returned, and the caller shall
+// divert the event to the dead-letter area.
+func (p eventSizePolicy) apply(event *cadf.Event) (divertReason string) {
+	if p.MaxAttachmentSize <= 0 {
+		return ""
+	}
+
+	for _, attachments := range []*[]cadf.Attachment{&event.Attachments, &event.Target.Attachments, &event.Initiator.Attachments} {
+		isCloned := false
+		for idx, attachment := range *attachments {
+			buf, err := json.Marshal(attachment.Content)
+			if err != nil {
+				// cannot happen for well-formed attachments; let the publish fail with a useful error
+				continue
+			}
+			if len(buf) <= p.MaxAttachmentSize {
+				continue
+			}
+
+			if p.Action == DivertToDeadLetter {
+				return fmt.Sprintf("attachment %q has %d bytes (max allowed: %d bytes)", attachment.Name, len(buf), p.MaxAttachmentSize)
+			}
+			if !isCloned {
+				// do not modify the slice that was given to us by the application
+				*attachments = slices.Clone(*attachments)
+				isCloned = true
+			}
+			(*attachments)[idx] = cadf.Attachment{
+				Name:    attachment.Name,
+				TypeURI: "mime:text/plain",
+				Content: fmt.Sprintf("%s...[truncated: %d bytes total]", truncateUTF8(buf, p.MaxAttachmentSize), len(buf)),
+			}
+		}
+	}
+	return ""
+}
+
+// Returns at most the first `maxBytes` bytes of `buf`, without splitting
+// multi-byte UTF-8 sequences.
+func truncateUTF8(buf []byte, maxBytes int) string {
+	if len(buf) <= maxBytes {
+		return string(buf)
+	}
+	end := maxBytes
+	// step back over UTF-8 continuation bytes (0b10xxxxxx) to the start of the character
+	for end > 0 && buf[end]&0xC0 == 0x80 {
+		end--
+	}
+	return string(buf[:end])
+}
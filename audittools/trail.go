@@ -33,6 +33,8 @@ type auditTrail struct {
 	EventSink           <-chan cadf.Event
 	OnSuccessfulPublish func()
 	OnFailedPublish     func()
+	BackingStore        BackingStore // optional
+	SizePolicy          eventSizePolicy
 }
 
 // Commit takes a AuditTrail that receives audit events from an event sink and publishes them to
@@ -58,39 +60,95 @@ func (t auditTrail) Commit(ctx context.Context, rabbitmqURI url.URL, rabbitmqQue
 		return true
 	}
 
+	sendEventWithRetry := func(e *cadf.Event) bool {
+		if sendEvent(e) {
+			return true
+		}
+		// One more try before giving up. We simply set rc to nil
+		// and sendEvent() will take care of refreshing the
+		// connection.
+		time.Sleep(5 * time.Second)
+		rc = nil
+		return sendEvent(e)
+	}
+
+	// if there is no backing store, events that could not be published are held in memory
 	var pendingEvents []cadf.Event
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 	for {
 		select {
 		case e := <-t.EventSink:
+			if reason := t.SizePolicy.apply(&e); reason != "" {
+				t.writeDeadLetter(e, reason)
+				continue
+			}
 			if successful := sendEvent(&e); !successful {
-				pendingEvents = append(pendingEvents, e)
+				if t.BackingStore == nil {
+					pendingEvents = append(pendingEvents, e)
+				} else if err := t.BackingStore.Write(e); err != nil {
+					logg.Error("audittools: failed to write audit event with ID %q into backing store: %s", e.ID, err.Error())
+					pendingEvents = append(pendingEvents, e)
+				}
 			}
 		case <-ticker.C:
 			for len(pendingEvents) > 0 {
-				successful := false // until proven otherwise
-
-				nextEvent := pendingEvents[0]
-				if successful = sendEvent(&nextEvent); !successful {
-					// One more try before giving up. We simply set rc to nil
-					// and sendEvent() will take care of refreshing the
-					// connection.
-					time.Sleep(5 * time.Second)
-					rc = nil
-					successful = sendEvent(&nextEvent)
-				}
-
-				if successful {
-					pendingEvents = pendingEvents[1:]
-				} else {
+				if successful := sendEventWithRetry(&pendingEvents[0]); !successful {
 					break
 				}
+				pendingEvents = pendingEvents[1:]
+			}
+			if len(pendingEvents) == 0 && t.BackingStore != nil {
+				t.flushBackingStore(sendEventWithRetry)
 			}
 		}
 	}
 }
 
+// Publishes events from the backing store until it is empty or a publish fails.
+func (t auditTrail) flushBackingStore(sendEvent func(*cadf.Event) bool) {
+	for {
+		events, err := t.BackingStore.ReadBatch(100)
+		if err != nil {
+			logg.Error("audittools: failed to read audit events from backing store: %s", err.Error())
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+
+		sentCount := 0
+		for idx := range events {
+			if !sendEvent(&events[idx]) {
+				break
+			}
+			sentCount++
+		}
+		if sentCount > 0 {
+			err := t.BackingStore.CommitBatch(sentCount)
+			if err != nil {
+				logg.Error("audittools: failed to remove published audit events from backing store: %s", err.Error())
+				return
+			}
+		}
+		if sentCount < len(events) {
+			return
+		}
+	}
+}
+
+func (t auditTrail) writeDeadLetter(e cadf.Event, reason string) {
+	if t.BackingStore == nil {
+		// this is prevented by input validation in NewAuditor()
+		logg.Error("audittools: dropping audit event with ID %q: %s", e.ID, reason)
+		return
+	}
+	err := t.BackingStore.WriteDeadLetter(e, reason)
+	if err != nil {
+		logg.Error("audittools: failed to write audit event with ID %q into dead-letter area (reason for diversion: %s): %s", e.ID, reason, err.Error())
+	}
+}
+
 func refreshConnectionIfClosedOrOld(rc *rabbitConnection, uri url.URL, queueName string) *rabbitConnection {
 	if !rc.IsNilOrClosed() {
 		if time.Since(rc.LastConnectedAt) < 5*time.Minute {
@@ -0,0 +1,128 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+// AdvisoryLock is a session-level Postgres advisory lock that was acquired
+// through AcquireAdvisoryLock() or TryAdvisoryLock(). Since session-level
+// advisory locks belong to a specific database connection, an AdvisoryLock
+// holds on to one connection from the pool until Unlock() is called.
+//
+// Advisory locks can be used to coordinate singleton work between multiple
+// replicas of the same service, e.g. to ensure that a periodic cleanup job
+// only runs in one replica at a time.
+type AdvisoryLock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+// AdvisoryLockKey computes a key for AcquireAdvisoryLock() or TryAdvisoryLock()
+// from a human-readable name. This is useful because Postgres only accepts
+// integers as advisory lock keys.
+func AdvisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64()) //nolint:gosec // overflow is intended, we just need a stable value
+}
+
+// AcquireAdvisoryLock acquires the session-level advisory lock with the given
+// key, and blocks until the lock is available or until `ctx` expires.
+//
+//	lock, err := easypg.AcquireAdvisoryLock(ctx, db, easypg.AdvisoryLockKey("cleanup-job"))
+//	if err != nil {
+//		return err
+//	}
+//	defer lock.Unlock(ctx)
+func AcquireAdvisoryLock(ctx context.Context, db *sql.DB, key int64) (*AdvisoryLock, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("while acquiring advisory lock %d: %w", key, err)
+	}
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key)
+	if err != nil {
+		discardConn(conn)
+		return nil, fmt.Errorf("while acquiring advisory lock %d: %w", key, err)
+	}
+	return &AdvisoryLock{conn, key}, nil
+}
+
+// TryAdvisoryLock is like AcquireAdvisoryLock(), but does not wait if the lock
+// is currently held by a different session. In that case, (nil, nil) is
+// returned.
+//
+//	lock, err := easypg.TryAdvisoryLock(ctx, db, easypg.AdvisoryLockKey("cleanup-job"))
+//	if err != nil {
+//		return err
+//	}
+//	if lock == nil {
+//		return nil // another replica is already doing the cleanup
+//	}
+//	defer lock.Unlock(ctx)
+func TryAdvisoryLock(ctx context.Context, db *sql.DB, key int64) (*AdvisoryLock, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("while trying to acquire advisory lock %d: %w", key, err)
+	}
+	var acquired bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired)
+	if err != nil {
+		discardConn(conn)
+		return nil, fmt.Errorf("while trying to acquire advisory lock %d: %w", key, err)
+	}
+	if !acquired {
+		err = conn.Close()
+		if err != nil {
+			return nil, fmt.Errorf("while trying to acquire advisory lock %d: %w", key, err)
+		}
+		return nil, nil
+	}
+	return &AdvisoryLock{conn, key}, nil
+}
+
+// Unlock releases the advisory lock and returns its connection to the pool.
+// If the lock cannot be released cleanly, the connection is closed instead,
+// which also makes Postgres release the lock.
+func (l *AdvisoryLock) Unlock(ctx context.Context) error {
+	var released bool
+	err := l.conn.QueryRowContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key).Scan(&released)
+	if err == nil && !released {
+		err = errors.New("lock was not held by this session")
+	}
+	if err != nil {
+		discardConn(l.conn)
+		return fmt.Errorf("while releasing advisory lock %d: %w", l.key, err)
+	}
+	return l.conn.Close()
+}
+
+// Closes the underlying connection of `conn` instead of returning it to the pool.
+// This ensures that all session-level state (including advisory locks) is dropped.
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn }) // returns ErrBadConn, which is expected
+	_ = conn.Close()
+}
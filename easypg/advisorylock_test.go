@@ -0,0 +1,64 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestAdvisoryLockKey(t *testing.T) {
+	// keys must be stable across releases, since different versions of the
+	// same service may run side by side during a rolling upgrade
+	assert.DeepEqual(t, "key", AdvisoryLockKey("cleanup-job"), AdvisoryLockKey("cleanup-job"))
+	assert.DeepEqual(t, "key", AdvisoryLockKey(""), int64(-3750763034362895579))
+	if AdvisoryLockKey("cleanup-job") == AdvisoryLockKey("cleanup-jobs") {
+		t.Error("expected different names to yield different keys")
+	}
+}
+
+func TestDiscardConn(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	d := &txRecordingDriver{}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	// a regular Close() returns the connection into the pool...
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = conn.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "events", d.events, []string(nil))
+
+	// ...but discardConn() closes it for good, so that session-level locks are released
+	conn, err = db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	discardConn(conn)
+	assert.DeepEqual(t, "events", d.events, []string{"CLOSE"})
+}
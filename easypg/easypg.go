@@ -18,25 +18,31 @@
 *******************************************************************************/
 
 // Package easypg is a database library for applications that use PostgreSQL.
-// It imports the libpq SQL driver and integrates
+// It imports the libpq SQL driver (other drivers like pgx can be used through
+// Configuration.OverrideDriverName) and integrates
 // github.com/golang-migrate/migrate for data definition.
 package easypg
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
+	"math"
 	url "net/url"
-	"os"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/sapcc/go-bits/sqlext"
 
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
-	bindata "github.com/golang-migrate/migrate/v4/source/go_bindata"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 
 	// enable postgres driver for database/sql
 	_ "github.com/lib/pq"
@@ -57,12 +63,68 @@ import (
 //	        DROP TABLE things;
 //	    `,
 //	}
+//
+// Alternatively, the migrations can be provided as files through the field
+// MigrationsFS, for example:
+//
+//	//go:embed migrations/*.sql
+//	var migrationsFS embed.FS
+//
+//	cfg.MigrationsFS = must.Return(fs.Sub(migrationsFS, "migrations"))
 type Configuration struct {
-	// (required) The schema migrations, in Postgres syntax. See above for details.
+	// (required unless MigrationsFS is given) The schema migrations, in Postgres syntax. See above for details.
 	Migrations map[string]string
+	// (optional) A filesystem containing further schema migrations (e.g. an embed.FS).
+	// All files with the extension ".sql" in the root directory of this filesystem
+	// are used, with the same filename format as the keys of Migrations. If a
+	// migration appears both here and in Migrations, Connect() will fail.
+	MigrationsFS fs.FS
 	// (optional) If not empty, use this database/sql driver instead of "postgres".
 	// This is useful e.g. when using github.com/majewsky/sqlproxy.
+	//
+	// To use github.com/jackc/pgx instead of github.com/lib/pq, import its
+	// database/sql adapter with `import _ "github.com/jackc/pgx/v5/stdlib"`,
+	// and set this to "pgx" (see const PgxDriverName). The connection URLs
+	// built by func URLFrom are understood by both drivers.
 	OverrideDriverName string
+
+	// (optional) Settings for the connection pool of the returned *sql.DB,
+	// see the respective setter methods on type *sql.DB for details. Fields left
+	// at their zero value are filled from the environment variables
+	// GOBITS_DB_MAX_OPEN_CONNS, GOBITS_DB_MAX_IDLE_CONNS (both integers),
+	// GOBITS_DB_CONN_MAX_LIFETIME and GOBITS_DB_CONN_MAX_IDLE_TIME (both durations
+	// like "5m"). If neither is set, the defaults of package database/sql apply.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// (optional) If true, all connections of the returned *sql.DB are opened
+	// with default_transaction_read_only enabled, so that accidental writes
+	// fail with an error. This is intended for reporting components that only
+	// read from a database owned by a different component. In this mode,
+	// Connect() does not apply any migrations and fails instead if the
+	// database schema is not up to date with the Migrations in this
+	// Configuration. It also does not create the database or the
+	// schema_migrations table if they do not exist yet.
+	ReadOnly bool
+
+	// (optional) Migration steps that are implemented in Go instead of SQL,
+	// keyed by their version. This is intended for data backfills that are
+	// too complex to express in SQL. Go migrations share the version sequence
+	// of the SQL migrations, so their versions must not be used by any SQL
+	// migration. Connect() applies them in order with the SQL migrations,
+	// each in its own transaction, and marks the schema as dirty if one fails.
+	//
+	// Rolling back a Go migration with MigrateDown() or MigrateTo() only
+	// reverts the schema version; no Go code is run in that case. Since Go
+	// migrations run on the connection pool while another connection holds
+	// the migration lock, MaxOpenConns must not be 1 when there are Go migrations.
+	//
+	// Template databases for tests (see ConnectForTest) are only recreated when
+	// the set of Go migration versions changes, since Go code cannot be hashed.
+	// When the body of a Go migration changes, give it a new version number.
+	GoMigrations map[uint]GoMigration
 }
 
 // Connect connects to a Postgres database.
@@ -71,63 +133,237 @@ type Configuration struct {
 // <https://www.postgresql.org/docs/current/libpq-connect.html#LIBPQ-CONNSTRING>
 //
 // We recommend constructing the URL with func URLFrom.
+//
+// Connect is equivalent to ConnectContext() with context.Background().
 func Connect(dbURL url.URL, cfg Configuration) (*sql.DB, error) {
-	migrations := cfg.Migrations
-	migrations = wrapDDLInTransactions(migrations)
-	migrations = stripWhitespace(migrations)
+	return ConnectContext(context.Background(), dbURL, cfg)
+}
+
+// ConnectContext is like Connect, but establishing the connection and applying
+// the schema migrations is aborted once the given context expires. For example,
+// to not wait forever for an unreachable database:
+//
+//	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+//	defer cancel()
+//	db, err := easypg.ConnectContext(ctx, dbURL, cfg)
+//
+// Migrations are only interrupted between two migration files, never in the
+// middle of one. The context only applies to the connection setup; it is not
+// retained by the returned *sql.DB.
+func ConnectContext(ctx context.Context, dbURL url.URL, cfg Configuration) (*sql.DB, error) {
+	if cfg.ReadOnly {
+		dbURL = urlWithReadOnlyMode(dbURL)
+	}
+	db, m, err := prepareMigration(ctx, dbURL, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ReadOnly {
+		err = checkSchemaIsCurrent(m, cfg)
+	} else if len(cfg.GoMigrations) > 0 {
+		err = runMigrationSteps(ctx, m, cfg, math.MaxUint)
+	} else {
+		err = runMigration(ctx, m.Migrate)
+	}
+	// this only returns the migration's connection into the pool, but does not close `db`
+	sourceErr, dbErr := m.Close()
+	err = errors.Join(err, sourceErr, dbErr)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot apply database schema: %w", err)
+	}
+	return db, nil
+}
+
+// Connects to the database and prepares a migrate.Migrate instance for the migrations in cfg.
+// The caller must close both the migrator and the *sql.DB when done.
+func prepareMigration(ctx context.Context, dbURL url.URL, cfg Configuration) (*sql.DB, *migrator, error) {
+	pool, err := cfg.poolSettings()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot configure connection pool: %w", err)
+	}
+	sourceDriver, err := cfg.migrationSource()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// use the "go-bindata" driver for github.com/golang-migrate/migrate
-	var assetNames []string
-	for name := range migrations {
-		assetNames = append(assetNames, name)
+	db, err := connectToPostgres(ctx, dbURL, cfg.OverrideDriverName, !cfg.ReadOnly)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to Postgres: %w", err)
 	}
-	asset := func(name string) ([]byte, error) {
-		data, ok := migrations[name]
-		if ok {
-			return []byte(data), nil
+	pool.ApplyTo(db)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("cannot connect to Postgres: %w", err)
+	}
+	if cfg.ReadOnly {
+		// golang-migrate would try to create the migrations table if it does not exist yet,
+		// which fails with an obscure error in read-only mode
+		err = checkSchemaIsInitialized(ctx, conn)
+		if err != nil {
+			conn.Close()
+			db.Close()
+			return nil, nil, err
 		}
-		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("not found")}
+	}
+	dbd, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, nil, fmt.Errorf("cannot prepare database migrations: %w", err)
 	}
 
-	sourceDriver, err := bindata.WithInstance(bindata.Resource(assetNames, asset))
+	m, err := migrate.NewWithInstance("iofs", sourceDriver, "postgres", dbd)
 	if err != nil {
-		return nil, err
+		dbd.Close()
+		db.Close()
+		return nil, nil, fmt.Errorf("cannot prepare database migrations: %w", err)
 	}
+	return db, &migrator{Migrate: m, db: db, dbd: dbd}, nil
+}
 
-	db, dbd, err := connectToPostgres(dbURL, cfg.OverrideDriverName)
+// Returns a source driver for github.com/golang-migrate/migrate that serves the
+// prepared migrations from cfg out of an in-memory filesystem.
+func (cfg Configuration) migrationSource() (source.Driver, error) {
+	migrations, err := cfg.allMigrationsWithGoPlaceholders()
 	if err != nil {
-		return nil, fmt.Errorf("cannot connect to Postgres: %w", err)
+		return nil, err
+	}
+	migrations = wrapDDLInTransactions(migrations)
+	migrations = stripWhitespace(migrations)
+
+	return iofs.New(migrationFS(migrations), ".")
+}
+
+// A minimal read-only fs.FS that contains one file per migration, with the
+// map keys being file names and the map values being file contents. There are
+// no subdirectories. This only implements as much as iofs.New() needs.
+type migrationFS map[string]string
+
+// Open implements the fs.FS interface.
+func (m migrationFS) Open(name string) (fs.File, error) {
+	data, exists := m[name]
+	if !exists {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &migrationFile{migrationFileInfo{name, int64(len(data))}, strings.NewReader(data)}, nil
+}
+
+// ReadDir implements the fs.ReadDirFS interface.
+func (m migrationFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	result := make([]fs.DirEntry, 0, len(m))
+	for _, fileName := range slices.Sorted(maps.Keys(m)) {
+		result = append(result, fs.FileInfoToDirEntry(migrationFileInfo{fileName, int64(len(m[fileName]))}))
+	}
+	return result, nil
+}
+
+type migrationFile struct {
+	info migrationFileInfo
+	*strings.Reader
+}
+
+// Stat implements the fs.File interface.
+func (f *migrationFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Close implements the fs.File interface.
+func (f *migrationFile) Close() error { return nil }
+
+type migrationFileInfo struct {
+	name string
+	size int64
+}
+
+func (i migrationFileInfo) Name() string       { return i.name }
+func (i migrationFileInfo) Size() int64        { return i.size }
+func (i migrationFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i migrationFileInfo) ModTime() time.Time { return time.Time{} }
+func (i migrationFileInfo) IsDir() bool        { return false }
+func (i migrationFileInfo) Sys() any           { return nil }
+
+// Returns the union of cfg.Migrations and the migrations found in cfg.MigrationsFS.
+func (cfg Configuration) allMigrations() (map[string]string, error) {
+	if cfg.MigrationsFS == nil {
+		return cfg.Migrations, nil
 	}
 
-	err = runMigration(migrate.NewWithInstance("go-bindata", sourceDriver, "postgres", dbd))
+	fileNames, err := fs.Glob(cfg.MigrationsFS, "*.sql")
 	if err != nil {
-		return nil, fmt.Errorf("cannot apply database schema: %w", err)
+		return nil, fmt.Errorf("while listing migrations in Configuration.MigrationsFS: %w", err)
 	}
-	return db, nil
+	result := maps.Clone(cfg.Migrations)
+	if result == nil {
+		result = make(map[string]string, len(fileNames))
+	}
+	for _, fileName := range fileNames {
+		if _, exists := result[fileName]; exists {
+			return nil, fmt.Errorf("migration %q is defined both in Configuration.Migrations and in Configuration.MigrationsFS", fileName)
+		}
+		buf, err := fs.ReadFile(cfg.MigrationsFS, fileName)
+		if err != nil {
+			return nil, fmt.Errorf("while reading migration from Configuration.MigrationsFS: %w", err)
+		}
+		result[fileName] = string(buf)
+	}
+	return result, nil
 }
 
+// PgxDriverName is the name under which the database/sql adapter of
+// github.com/jackc/pgx registers itself. It can be used as
+// Configuration.OverrideDriverName.
+const PgxDriverName = "pgx"
+
 var dbNotExistErrRx = regexp.MustCompile(`^pq: database "([^"]+)" does not exist$`)
 
-func connectToPostgres(dbURL url.URL, driverName string) (*sql.DB, database.Driver, error) {
+// Checks whether the error from the first statement on a fresh connection
+// indicates that the target database does not exist. If so, the name of the
+// database is returned.
+func isDatabaseNotExistError(err error, dbURL url.URL) (string, bool) {
+	// this works for lib/pq as well as for pgx, which both report the SQLSTATE
+	// through this method on their respective error types
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) && pgErr.SQLState() == "3D000" { // invalid_catalog_name
+		dbName := strings.TrimPrefix(dbURL.Path, "/")
+		return dbName, dbName != ""
+	}
+
+	// fallback for drivers that do not expose the SQLSTATE (e.g. proxies)
+	match := dbNotExistErrRx.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// Opens a connection pool for the given database. If `createIfMissing` is
+// true and the database does not exist, it is created.
+func connectToPostgres(ctx context.Context, dbURL url.URL, driverName string, createIfMissing bool) (*sql.DB, error) {
 	if driverName == "" {
 		driverName = "postgres"
 	}
 	db, err := sql.Open(driverName, dbURL.String())
-	if err == nil {
-		// apparently the "database does not exist" error only occurs when trying to issue the first statement
-		_, err = db.Exec("SELECT 1")
+	if err != nil {
+		return nil, err
 	}
+	// apparently the "database does not exist" error only occurs when trying to issue the first statement
+	_, err = db.ExecContext(ctx, "SELECT 1")
 	if err == nil {
-		// success
-		dbd, err := postgres.WithInstance(db, &postgres.Config{})
-		return db, dbd, err
+		return db, nil
 	}
-	match := dbNotExistErrRx.FindStringSubmatch(err.Error())
-	if match == nil {
+	db.Close()
+	dbName, ok := isDatabaseNotExistError(err, dbURL)
+	if !ok {
 		// unexpected error
-		return nil, nil, err
+		return nil, err
+	}
+	if !createIfMissing {
+		return nil, fmt.Errorf("database schema is not initialized (read-only mode cannot create the missing database %q)", dbName)
 	}
-	dbName := match[1]
 
 	// connect to Postgres without the database name specified, so that we can
 	// execute CREATE DATABASE
@@ -135,7 +371,7 @@ func connectToPostgres(dbURL url.URL, driverName string) (*sql.DB, database.Driv
 	urlWithoutDB.Path = "/"
 	db2, err := sql.Open(driverName, urlWithoutDB.String())
 	if err == nil {
-		_, err = db2.Exec("CREATE DATABASE " + dbName)
+		_, err = db2.ExecContext(ctx, `CREATE DATABASE `+quoteIdentifier(dbName))
 	}
 	if err == nil {
 		err = db2.Close()
@@ -143,28 +379,95 @@ func connectToPostgres(dbURL url.URL, driverName string) (*sql.DB, database.Driv
 		db2.Close()
 	}
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// now the actual database is there and we can connect to it
-	db, err = sql.Open(driverName, dbURL.String())
+	return sql.Open(driverName, dbURL.String())
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteLiteral(value string) string {
+	return `'` + strings.ReplaceAll(value, `'`, `''`) + `'`
+}
+
+func runMigration(ctx context.Context, m *migrate.Migrate) error {
+	// migrate.Migrate does not take a context, but can be told to stop after the current migration
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.GracefulStop <- true
+		case <-done:
+		}
+	}()
+
+	err := m.Up()
+	if errors.Is(err, migrate.ErrNoChange) {
+		// no idea why this is an error
+		err = nil
+	}
+	if err == nil && ctx.Err() != nil {
+		// after a graceful stop, Up() returns without error even if not all migrations were applied
+		return ctx.Err()
+	}
+	return err
+}
+
+// Returns a copy of the given URL that instructs the server to make all
+// transactions read-only by default. Both lib/pq and pgx send unknown URL
+// parameters to the server as runtime parameters.
+func urlWithReadOnlyMode(dbURL url.URL) url.URL {
+	query := dbURL.Query()
+	query.Set("default_transaction_read_only", "on")
+	dbURL.RawQuery = query.Encode()
+	return dbURL
+}
+
+var checkMigrationsTableQuery = sqlext.SimplifyWhitespace(`
+	SELECT EXISTS (
+		SELECT 1 FROM information_schema.tables
+		 WHERE table_schema = current_schema() AND table_name = 'schema_migrations'
+	)
+`)
+
+// Used in read-only mode before golang-migrate gets to look at the database.
+func checkSchemaIsInitialized(ctx context.Context, conn *sql.Conn) error {
+	var exists bool
+	err := conn.QueryRowContext(ctx, checkMigrationsTableQuery).Scan(&exists)
 	if err != nil {
-		return nil, nil, err
+		return fmt.Errorf("while checking for the schema_migrations table: %w", err)
+	}
+	if !exists {
+		return errors.New("database schema is not initialized (read-only mode cannot create the schema_migrations table and apply migrations)")
 	}
-	dbd, err := postgres.WithInstance(db, &postgres.Config{})
-	return db, dbd, err
+	return nil
 }
 
-func runMigration(m *migrate.Migrate, err error) error {
+// Used instead of runMigration() in read-only mode.
+func checkSchemaIsCurrent(m *migrator, cfg Configuration) error {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		version, dirty, err = 0, false, nil
+	}
 	if err != nil {
 		return err
 	}
-	err = m.Up()
-	if errors.Is(err, migrate.ErrNoChange) {
-		// no idea why this is an error
-		return nil
+	if dirty {
+		return fmt.Errorf("database schema is dirty at version %d", version)
 	}
-	return err
+	pending, err := cfg.pendingMigrations(version)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is not up to date (read-only mode cannot apply pending migrations: %s)", strings.Join(pending, ", "))
+	}
+	return nil
 }
 
 func stripWhitespace(in map[string]string) map[string]string {
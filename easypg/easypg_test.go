@@ -0,0 +1,421 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestMigrationsFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_index.up.sql":   {Data: []byte("CREATE INDEX things_name ON things (name);")},
+		"002_add_index.down.sql": {Data: []byte("DROP INDEX things_name;")},
+		"README.md":              {Data: []byte("This file is ignored.")},
+		"old/000_ignored.up.sql": {Data: []byte("This file is also ignored.")},
+	}
+
+	// migrations from both sources are merged
+	cfg := Configuration{
+		Migrations:   map[string]string{"001_initial.up.sql": "CREATE TABLE things (name TEXT);"},
+		MigrationsFS: fsys,
+	}
+	migrations, err := cfg.allMigrations()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "migrations", migrations, map[string]string{
+		"001_initial.up.sql":     "CREATE TABLE things (name TEXT);",
+		"002_add_index.up.sql":   "CREATE INDEX things_name ON things (name);",
+		"002_add_index.down.sql": "DROP INDEX things_name;",
+	})
+	assert.DeepEqual(t, "original migrations", len(cfg.Migrations), 1)
+
+	// duplicates are rejected
+	cfg.Migrations["002_add_index.up.sql"] = "CREATE INDEX foo ON things (name);"
+	_, err = cfg.allMigrations()
+	expected := `migration "002_add_index.up.sql" is defined both in Configuration.Migrations and in Configuration.MigrationsFS`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestMigrationSource(t *testing.T) {
+	cfg := Configuration{
+		Migrations: map[string]string{
+			"001_initial.up.sql":     "CREATE TABLE things (name TEXT);",
+			"001_initial.down.sql":   "DROP TABLE things;",
+			"002_add_index.up.sql":   "CREATE INDEX things_name ON things (name);",
+			"002_add_index.down.sql": "DROP INDEX things_name;",
+		},
+	}
+	src := must.ReturnT(cfg.migrationSource())(t)
+	defer src.Close()
+
+	readAll := func(r io.ReadCloser, identifier string, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer r.Close()
+		return identifier + ": " + string(must.ReturnT(io.ReadAll(r))(t))
+	}
+
+	assert.DeepEqual(t, "first version", must.ReturnT(src.First())(t), uint(1))
+	assert.DeepEqual(t, "next version", must.ReturnT(src.Next(1))(t), uint(2))
+	assert.DeepEqual(t, "up migration", readAll(src.ReadUp(2)),
+		"add_index: BEGIN;\nCREATE INDEX things_name ON things (name);\nCOMMIT;")
+	assert.DeepEqual(t, "down migration", readAll(src.ReadDown(1)),
+		"initial: BEGIN;\nDROP TABLE things;\nCOMMIT;")
+}
+
+func TestSchemaVersionString(t *testing.T) {
+	assert.DeepEqual(t, "zero", SchemaVersion{}.String(), "no migrations applied")
+	assert.DeepEqual(t, "clean", SchemaVersion{Version: 42}.String(), "version 42")
+	assert.DeepEqual(t, "dirty", SchemaVersion{Version: 42, Dirty: true}.String(), "version 42 (dirty)")
+}
+
+func TestPendingMigrations(t *testing.T) {
+	cfg := Configuration{
+		Migrations: map[string]string{
+			"001_initial.up.sql":     "CREATE TABLE things (name TEXT);",
+			"001_initial.down.sql":   "DROP TABLE things;",
+			"002_add_index.up.sql":   "CREATE INDEX things_name ON things (name);",
+			"002_add_index.down.sql": "DROP INDEX things_name;",
+			"010_add_column.up.sql":  "ALTER TABLE things ADD COLUMN size INT;",
+		},
+	}
+	assert.DeepEqual(t, "pending from 0", must.ReturnT(cfg.pendingMigrations(0))(t),
+		[]string{"001_initial.up.sql", "002_add_index.up.sql", "010_add_column.up.sql"})
+	assert.DeepEqual(t, "pending from 2", must.ReturnT(cfg.pendingMigrations(2))(t),
+		[]string{"010_add_column.up.sql"})
+	assert.DeepEqual(t, "pending from 10", must.ReturnT(cfg.pendingMigrations(10))(t),
+		[]string{})
+
+	cfg.Migrations["initial.up.sql"] = "SELECT 1;"
+	_, err := cfg.pendingMigrations(0)
+	if err == nil || !strings.Contains(err.Error(), `invalid migration file name "initial.up.sql"`) {
+		t.Errorf("expected error for invalid migration file name, but got %v", err)
+	}
+}
+
+func TestPoolSettings(t *testing.T) {
+	t.Setenv("GOBITS_DB_MAX_OPEN_CONNS", "16")
+	t.Setenv("GOBITS_DB_CONN_MAX_LIFETIME", "5m")
+
+	// fields in Configuration take precedence over the environment
+	cfg := Configuration{MaxOpenConns: 8, MaxIdleConns: 4}
+	s, err := cfg.poolSettings()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "pool settings", s, poolSettings{
+		MaxOpenConns:    8,
+		MaxIdleConns:    4,
+		ConnMaxLifetime: 5 * time.Minute,
+	})
+
+	// fields not set in Configuration are filled from the environment
+	s, err = Configuration{}.poolSettings()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "pool settings", s, poolSettings{
+		MaxOpenConns:    16,
+		ConnMaxLifetime: 5 * time.Minute,
+	})
+
+	// malformed environment variables are reported
+	t.Setenv("GOBITS_DB_CONN_MAX_IDLE_TIME", "forever")
+	_, err = Configuration{}.poolSettings()
+	expected := `invalid value for GOBITS_DB_CONN_MAX_IDLE_TIME: time: invalid duration "forever"`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestReplicaSelection(t *testing.T) {
+	// sql.Open() does not connect yet, so we can use these handles without a database
+	openDB := func() *sql.DB {
+		db, err := sql.Open("postgres", "postgres://localhost/test")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return db
+	}
+	rdb := &ReplicatedDB{
+		primary:  openDB(),
+		replicas: []*replica{{db: openDB()}, {db: openDB()}, {db: openDB()}},
+	}
+	defer rdb.Close()
+
+	// without healthy replicas, reads go to the primary
+	assert.DeepEqual(t, "replica", rdb.Replica() == rdb.primary, true)
+
+	// reads are distributed across healthy replicas
+	rdb.replicas[0].healthy.Store(true)
+	rdb.replicas[2].healthy.Store(true)
+	seen := make(map[*sql.DB]int)
+	for range 10 {
+		seen[rdb.Replica()]++
+	}
+	assert.DeepEqual(t, "reads per DB", seen, map[*sql.DB]int{
+		rdb.replicas[0].db: 5,
+		rdb.replicas[2].db: 5,
+	})
+}
+
+func TestTestDBBackendSelection(t *testing.T) {
+	t.Setenv("GOBITS_TESTDB_BACKEND", "container")
+	useContainer, err := useContainerForTestDB()
+	assert.DeepEqual(t, "useContainer", useContainer, true)
+	assert.DeepEqual(t, "err", err, nil)
+
+	t.Setenv("GOBITS_TESTDB_BACKEND", "local")
+	useContainer, err = useContainerForTestDB()
+	assert.DeepEqual(t, "useContainer", useContainer, false)
+	assert.DeepEqual(t, "err", err, nil)
+
+	t.Setenv("GOBITS_TESTDB_BACKEND", "kubernetes")
+	_, err = useContainerForTestDB()
+	expected := `invalid value for $GOBITS_TESTDB_BACKEND: expected "local" or "container", but got "kubernetes"`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+type fakeSQLStateError string
+
+func (e fakeSQLStateError) Error() string    { return "server error (SQLSTATE " + string(e) + ")" }
+func (e fakeSQLStateError) SQLState() string { return string(e) }
+
+func TestDatabaseNotExistDetection(t *testing.T) {
+	dbURL := must.ReturnT(url.Parse("postgres://postgres@localhost/foo_bar?sslmode=disable"))(t)
+
+	testCases := []struct {
+		Err            error
+		ExpectedDBName string
+		ExpectedOK     bool
+	}{
+		// lib/pq
+		{&pq.Error{Code: "3D000", Message: `database "foo_bar" does not exist`}, "foo_bar", true},
+		// pgx (the actual error type is *pgconn.PgError wrapped in *pgconn.ConnectError)
+		{fmt.Errorf("failed to connect: %w", fakeSQLStateError("3D000")), "foo_bar", true},
+		// drivers that do not expose the SQLSTATE
+		{errors.New(`pq: database "other" does not exist`), "other", true},
+		// unrelated errors
+		{fakeSQLStateError("28P01"), "", false},
+		{errors.New("connection refused"), "", false},
+	}
+	for _, tc := range testCases {
+		dbName, ok := isDatabaseNotExistError(tc.Err, *dbURL)
+		assert.DeepEqual(t, fmt.Sprintf("dbName for %q", tc.Err.Error()), dbName, tc.ExpectedDBName)
+		assert.DeepEqual(t, fmt.Sprintf("ok for %q", tc.Err.Error()), ok, tc.ExpectedOK)
+	}
+}
+
+// A database/sql driver that simulates a Postgres server with an empty
+// database called "fresh" and no other databases. It records all executed
+// statements. Since database/sql drivers can only be registered once per
+// process, this is done in init() instead of in the test.
+type freshServerDriver struct {
+	mutex      sync.Mutex
+	statements []string
+}
+
+const freshServerDriverName = "easypg-fresh-server"
+
+var freshServer = &freshServerDriver{}
+
+func init() {
+	sql.Register(freshServerDriverName, freshServer)
+}
+
+func (d *freshServerDriver) Open(dsn string) (driver.Conn, error) {
+	dbURL, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return freshServerConn{d, strings.TrimPrefix(dbURL.Path, "/")}, nil
+}
+
+func (d *freshServerDriver) takeStatements() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	result := d.statements
+	d.statements = nil
+	return result
+}
+
+type freshServerConn struct {
+	d      *freshServerDriver
+	dbName string
+}
+
+func (c freshServerConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c freshServerConn) Close() error { return nil }
+func (c freshServerConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c freshServerConn) record(query string) error {
+	c.d.mutex.Lock()
+	defer c.d.mutex.Unlock()
+	c.d.statements = append(c.d.statements, query)
+	switch c.dbName {
+	case "", "fresh":
+		return nil
+	default:
+		return &pq.Error{Code: "3D000", Message: fmt.Sprintf("database %q does not exist", c.dbName)}
+	}
+}
+
+func (c freshServerConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), c.record(query)
+}
+
+func (c freshServerConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	err := c.record(query)
+	if err != nil {
+		return nil, err
+	}
+	if query != checkMigrationsTableQuery {
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	return &freshServerRows{values: []driver.Value{false}}, nil
+}
+
+type freshServerRows struct {
+	values []driver.Value
+}
+
+func (r *freshServerRows) Columns() []string { return []string{"exists"} }
+func (r *freshServerRows) Close() error      { return nil }
+func (r *freshServerRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestReadOnlyWithoutSchema(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	cfg := Configuration{
+		Migrations: map[string]string{
+			"001_initial.up.sql":   "CREATE TABLE things (name TEXT);",
+			"001_initial.down.sql": "DROP TABLE things;",
+		},
+		OverrideDriverName: freshServerDriverName,
+		ReadOnly:           true,
+	}
+
+	// when the database does not exist, it is not created
+	_, err := ConnectContext(ctx, *must.ReturnT(url.Parse("postgres://localhost/missing"))(t), cfg)
+	assert.DeepEqual(t, "error", fmt.Sprint(err),
+		`cannot connect to Postgres: database schema is not initialized (read-only mode cannot create the missing database "missing")`)
+	assert.DeepEqual(t, "statements", freshServer.takeStatements(), []string{"SELECT 1"})
+
+	// when the database exists, but golang-migrate was never run on it, the schema_migrations table is not created
+	_, err = ConnectContext(ctx, *must.ReturnT(url.Parse("postgres://localhost/fresh"))(t), cfg)
+	assert.DeepEqual(t, "error", fmt.Sprint(err),
+		`database schema is not initialized (read-only mode cannot create the schema_migrations table and apply migrations)`)
+	assert.DeepEqual(t, "statements", freshServer.takeStatements(), []string{"SELECT 1", checkMigrationsTableQuery})
+}
+
+func TestURLWithReadOnlyMode(t *testing.T) {
+	dbURL := must.ReturnT(url.Parse("postgres://postgres@localhost/foo?sslmode=disable"))(t)
+	actual := urlWithReadOnlyMode(*dbURL)
+	assert.DeepEqual(t, "read-only URL", actual.String(), "postgres://postgres@localhost/foo?default_transaction_read_only=on&sslmode=disable")
+	// the original URL shall not be modified
+	assert.DeepEqual(t, "original URL", dbURL.String(), "postgres://postgres@localhost/foo?sslmode=disable")
+}
+
+func TestGoMigrations(t *testing.T) {
+	backfill := func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE things SET size = LENGTH(name)`)
+		return err
+	}
+	cfg := Configuration{
+		Migrations: map[string]string{
+			"001_initial.up.sql":       "CREATE TABLE things (name TEXT);",
+			"002_add_size.up.sql":      "ALTER TABLE things ADD COLUMN size INT;",
+			"004_size_not_null.up.sql": "ALTER TABLE things ALTER COLUMN size SET NOT NULL;",
+		},
+		GoMigrations: map[uint]GoMigration{3: backfill},
+	}
+
+	// Go migrations take part in the versioning like SQL migrations
+	versions := must.ReturnT(cfg.upMigrationVersions())(t)
+	assert.DeepEqual(t, "versions", versions, []uint{1, 2, 3, 4})
+	assert.DeepEqual(t, "pending from 2", must.ReturnT(cfg.pendingMigrations(2))(t),
+		[]string{"3_go_migration.up.sql", "004_size_not_null.up.sql"})
+
+	next, ok := nextMigrationVersion(versions, 2)
+	assert.DeepEqual(t, "next after 2", next, uint(3))
+	assert.DeepEqual(t, "next after 2 exists", ok, true)
+	_, ok = nextMigrationVersion(versions, 4)
+	assert.DeepEqual(t, "next after 4 exists", ok, false)
+
+	// the placeholders do not do anything when executed
+	src := must.ReturnT(cfg.migrationSource())(t)
+	defer src.Close()
+	r, identifier, err := src.ReadUp(3)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer r.Close()
+	assert.DeepEqual(t, "placeholder identifier", identifier, "go_migration")
+	assert.DeepEqual(t, "placeholder content", string(must.ReturnT(io.ReadAll(r))(t)), "BEGIN;\n COMMIT;")
+
+	// versions cannot be shared with SQL migrations
+	cfg.GoMigrations[2] = backfill
+	_, err = cfg.migrationSource()
+	expected := `migration version 2 is defined both as SQL migration "002_add_size.up.sql" and in Configuration.GoMigrations`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+	delete(cfg.GoMigrations, 2)
+
+	cfg.GoMigrations[5] = nil
+	_, err = cfg.pendingMigrations(0)
+	expected = `Configuration.GoMigrations contains a nil function for version 5`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
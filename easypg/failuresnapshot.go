@@ -0,0 +1,96 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/osext"
+)
+
+// If this environment variable is set to a true value, ConnectForTest() will
+// snapshot the test database into ".testdb/failures/<database name>" when the test fails.
+const snapshotOnFailureEnvVar = "GOBITS_TESTDB_SNAPSHOT_ON_FAILURE"
+
+// Called by ConnectForTest() after the database has been set up.
+func setupSnapshotOnFailure(t TestingT, db *sql.DB, dbName string) {
+	t.Helper()
+	if !osext.GetenvBool(snapshotOnFailureEnvVar) {
+		return
+	}
+	ct, ok := t.(interface {
+		Cleanup(func())
+		Failed() bool
+	})
+	if !ok {
+		t.Fatalf("$%s requires a TestingT that implements Cleanup() and Failed()", snapshotOnFailureEnvVar)
+	}
+
+	ct.Cleanup(func() {
+		if !ct.Failed() {
+			return
+		}
+		// errors are only logged because the test has already failed anyway
+		dirPath, err := snapshotTestDatabase(t, db, dbName)
+		if err != nil {
+			logg.Error("could not snapshot test database %q after test failure: %s", dbName, err.Error())
+		} else {
+			logg.Info("test database %q was snapshotted into %s after test failure", dbName, dirPath)
+		}
+	})
+}
+
+// Writes two files into ".testdb/failures/<dbName>":
+//   - "dump.sql" is a full dump (schema and data) by pg_dump, which can be restored with psql.
+//   - "contents.sql" contains the table contents in the same format as AssertDBContent(),
+//     for comparison with the fixtures used by the test.
+func snapshotTestDatabase(t TestingT, db *sql.DB, dbName string) (string, error) {
+	t.Helper()
+	rootPath, err := findRepositoryRootDir()
+	if err != nil {
+		return "", err
+	}
+	dirPath := filepath.Join(rootPath, ".testdb", "failures", dbName)
+	err = os.MkdirAll(dirPath, 0777) // subject to umask
+	if err != nil {
+		return "", err
+	}
+
+	cmd := testDBClientCommand(t, "pg_dump", "--no-owner", "--no-privileges", "-U", "postgres", dbName)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	dump, err := cmd.Output()
+	if err != nil {
+		logg.Error("could not run pg_dump: %s (stderr: %q)", err.Error(), stderr.String())
+	} else {
+		err = os.WriteFile(filepath.Join(dirPath, "dump.sql"), dump, 0666)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	contents := newDBSnapshot(t, db).ToSQL(nil)
+	err = os.WriteFile(filepath.Join(dirPath, "contents.sql"), []byte(contents), 0666)
+	return dirPath, err
+}
@@ -0,0 +1,199 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// GoMigration is a schema migration step that is implemented in Go instead of
+// SQL, see Configuration.GoMigrations for details. The given transaction is
+// committed if the function returns no error, and rolled back otherwise.
+type GoMigration func(ctx context.Context, tx *sql.Tx) error
+
+// The SQL migrations that stand in for Go migrations when talking to
+// github.com/golang-migrate/migrate. Their content is never executed by Connect().
+const goMigrationPlaceholder = "-- this migration is implemented in Go (see Configuration.GoMigrations)"
+
+// Returns allMigrations() plus placeholder migrations for each entry in
+// cfg.GoMigrations, so that their versions take part in the versioning like
+// those of regular SQL migrations.
+func (cfg Configuration) allMigrationsWithGoPlaceholders() (map[string]string, error) {
+	migrations, err := cfg.allMigrations()
+	if err != nil || len(cfg.GoMigrations) == 0 {
+		return migrations, err
+	}
+
+	result := make(map[string]string, len(migrations)+2*len(cfg.GoMigrations))
+	for fileName, sqlText := range migrations {
+		version, _, err := parseMigrationFileName(fileName)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := cfg.GoMigrations[version]; exists {
+			return nil, fmt.Errorf("migration version %d is defined both as SQL migration %q and in Configuration.GoMigrations", version, fileName)
+		}
+		result[fileName] = sqlText
+	}
+	for version, action := range cfg.GoMigrations {
+		if action == nil {
+			return nil, fmt.Errorf("Configuration.GoMigrations contains a nil function for version %d", version)
+		}
+		result[fmt.Sprintf("%d_go_migration.up.sql", version)] = goMigrationPlaceholder
+		result[fmt.Sprintf("%d_go_migration.down.sql", version)] = goMigrationPlaceholder
+	}
+	return result, nil
+}
+
+// Returns the versions of all up migrations (including Go migrations) in ascending order.
+func (cfg Configuration) upMigrationVersions() ([]uint, error) {
+	migrations, err := cfg.allMigrationsWithGoPlaceholders()
+	if err != nil {
+		return nil, err
+	}
+	var versions []uint
+	for fileName := range migrations {
+		version, direction, err := parseMigrationFileName(fileName)
+		if err != nil {
+			return nil, err
+		}
+		if direction == "up" {
+			versions = append(versions, version)
+		}
+	}
+	slices.Sort(versions)
+	return slices.Compact(versions), nil
+}
+
+// Returns a copy of cfg.GoMigrations that only contains the versions for which `predicate` holds.
+func (cfg Configuration) filterGoMigrations(predicate func(version uint) bool) map[uint]GoMigration {
+	if cfg.GoMigrations == nil {
+		return nil
+	}
+	result := maps.Clone(cfg.GoMigrations)
+	maps.DeleteFunc(result, func(version uint, _ GoMigration) bool { return !predicate(version) })
+	return result
+}
+
+// migrator wraps a migrate.Migrate instance with the objects that it was built
+// from, because applying Go migrations requires direct access to them.
+type migrator struct {
+	*migrate.Migrate
+	// The connection pool that Go migrations run on. Not closed by Close().
+	db *sql.DB
+	// The database driver used by migrate.Migrate, for tracking the schema version of Go migrations.
+	dbd database.Driver
+}
+
+// Used instead of runMigration() when there are Go migrations. Migrations are
+// applied one by one, up to and including the given target version. SQL
+// migrations are applied through migrate.Migrate, Go migrations are run
+// directly and recorded in the schema version table in the same way.
+func runMigrationSteps(ctx context.Context, m *migrator, cfg Configuration, target uint) error {
+	versions, err := cfg.upMigrationVersions()
+	if err != nil {
+		return err
+	}
+
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		current, dirty, err := m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			current, dirty, err = 0, false, nil
+		}
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return migrate.ErrDirty{Version: int(current)} //nolint:gosec // schema versions do not overflow int
+		}
+
+		next, ok := nextMigrationVersion(versions, current)
+		if !ok || next > target {
+			return nil
+		}
+		if action, isGo := cfg.GoMigrations[next]; isGo {
+			err = m.applyGoMigration(ctx, next, action)
+		} else {
+			err = m.Steps(1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Returns the smallest version in the given sorted list that is greater than `current`.
+func nextMigrationVersion(versions []uint, current uint) (uint, bool) {
+	for _, version := range versions {
+		if version > current {
+			return version, true
+		}
+	}
+	return 0, false
+}
+
+func (m *migrator) applyGoMigration(ctx context.Context, version uint, action GoMigration) (returnedErr error) {
+	// like migrate.Migrate, hold the migration lock while changing the schema
+	err := m.dbd.Lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		returnedErr = errors.Join(returnedErr, m.dbd.Unlock())
+	}()
+
+	// another process might have applied this migration while we were waiting for the lock
+	current, dirty, err := m.dbd.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return migrate.ErrDirty{Version: current}
+	}
+	if current >= int(version) { //nolint:gosec // schema versions do not overflow int
+		return nil
+	}
+
+	// like for SQL migrations, the version is marked as dirty while the migration runs,
+	// so that it stays dirty if the migration fails
+	err = m.dbd.SetVersion(int(version), true) //nolint:gosec // schema versions do not overflow int
+	if err != nil {
+		return err
+	}
+	err = WithTransaction(ctx, m.db, func(tx *sql.Tx) error {
+		return action(ctx, tx)
+	})
+	if err != nil {
+		return fmt.Errorf("while running Go migration %d: %w", version, err)
+	}
+	return m.dbd.SetVersion(int(version), false) //nolint:gosec // schema versions do not overflow int
+}
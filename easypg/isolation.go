@@ -0,0 +1,233 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"database/sql"
+	"fmt"
+	url "net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sapcc/go-bits/sqlext"
+)
+
+// CheckIsolation is a TestSetupOption that audits the test for side effects
+// beyond its own database. When the test (including all its subtests) is
+// done, the idle connections of the *sql.DB returned by ConnectForTest() are
+// closed (the *sql.DB itself remains usable for other cleanup functions), and
+// then the test fails if either:
+//
+//   - there are still connections to the test's database (as reported by
+//     pg_stat_activity), which usually indicates a leaked *sql.DB, *sql.Tx,
+//     *sql.Rows or *sql.Conn, or
+//   - databases or roles were created or dropped, or tables etc. were created
+//     or dropped in the "postgres" database. Databases that were created by
+//     easypg within this process (for this or other tests, or as templates)
+//     are not part of the check, so that concurrently running tests do not
+//     cause false positives.
+//
+// This is intended as a diagnostic tool for tests that interfere with each
+// other in ways that are not easily explained. It requires that the
+// TestingT given to ConnectForTest() implements Cleanup(), like *testing.T does.
+func CheckIsolation() TestSetupOption {
+	return func(params *testSetupParams) {
+		params.checkIsolation = true
+	}
+}
+
+var (
+	// names of all databases created by easypg within this process
+	testDatabaseNames   = make(map[string]bool)
+	testDatabaseNamesMu sync.Mutex
+)
+
+func registerTestDatabaseName(dbName string) {
+	testDatabaseNamesMu.Lock()
+	defer testDatabaseNamesMu.Unlock()
+	testDatabaseNames[dbName] = true
+}
+
+func isTestDatabaseName(dbName string) bool {
+	testDatabaseNamesMu.Lock()
+	defer testDatabaseNamesMu.Unlock()
+	return testDatabaseNames[dbName]
+}
+
+// The objects outside of the test's database that can be affected by a test.
+type isolationSnapshot struct {
+	Databases []string
+	Roles     []string
+	Relations []string // in the "postgres" database
+}
+
+func setupIsolationCheck(t TestingT, db *sql.DB, dbURL url.URL, dbName, driverName string) {
+	t.Helper()
+	ct, ok := t.(interface{ Cleanup(func()) })
+	if !ok {
+		t.Fatal("easypg.CheckIsolation() requires a TestingT that implements Cleanup()")
+	}
+	if driverName == "" {
+		driverName = "postgres"
+	}
+
+	// use a separate connection pool for the checks, so that the test's own
+	// connections are neither used nor counted; since the snapshot includes the
+	// relations in the "postgres" database, we need to connect to that one
+	adminURL := dbURL
+	adminURL.Path = "/postgres"
+	adminDB, err := sql.Open(driverName, adminURL.String())
+	if err != nil {
+		t.Fatalf("while connecting to Postgres for isolation check: %s", err.Error())
+	}
+	adminDB.SetMaxOpenConns(1)
+	before, err := takeIsolationSnapshot(adminDB)
+	if err != nil {
+		t.Fatalf("while preparing isolation check: %s", err.Error())
+	}
+
+	ct.Cleanup(func() {
+		defer adminDB.Close()
+		// close all idle connections of the test's pool without closing the pool
+		// itself, so that only connections held by leaked objects remain
+		db.SetMaxIdleConns(0)
+
+		var problems []string
+		leaked, err := waitForConnectionsToClose(adminDB, dbName)
+		if err != nil {
+			t.Fatalf("while checking for leaked connections: %s", err.Error())
+		}
+		for _, conn := range leaked {
+			problems = append(problems, "leaked connection: "+conn)
+		}
+
+		after, err := takeIsolationSnapshot(adminDB)
+		if err != nil {
+			t.Fatalf("while checking for objects outside of the test database: %s", err.Error())
+		}
+		problems = append(problems, diffIsolationSnapshots("database", before.Databases, after.Databases)...)
+		problems = append(problems, diffIsolationSnapshots("role", before.Roles, after.Roles)...)
+		problems = append(problems, diffIsolationSnapshots(`relation in database "postgres"`, before.Relations, after.Relations)...)
+
+		if len(problems) > 0 {
+			t.Fatalf("isolation check for database %q failed:\n\t%s", dbName, strings.Join(problems, "\n\t"))
+		}
+	})
+}
+
+var (
+	listDatabasesQuery = `SELECT datname FROM pg_database WHERE NOT datistemplate ORDER BY datname`
+	listRolesQuery     = `SELECT rolname FROM pg_roles ORDER BY rolname`
+	listRelationsQuery = sqlext.SimplifyWhitespace(`
+		SELECT n.nspname || '.' || c.relname
+		  FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		 WHERE n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+		 ORDER BY 1
+	`)
+	listConnectionsQuery = sqlext.SimplifyWhitespace(`
+		SELECT pid, COALESCE(application_name, ''), COALESCE(state, ''), COALESCE(query, '')
+		  FROM pg_stat_activity WHERE datname = $1 AND pid != pg_backend_pid()
+		 ORDER BY pid
+	`)
+)
+
+func takeIsolationSnapshot(adminDB *sql.DB) (result isolationSnapshot, err error) {
+	databases, err := queryStrings(adminDB, listDatabasesQuery)
+	if err != nil {
+		return result, err
+	}
+	result.Databases = withoutTestDatabases(databases)
+	result.Roles, err = queryStrings(adminDB, listRolesQuery)
+	if err != nil {
+		return result, err
+	}
+	result.Relations, err = queryStrings(adminDB, listRelationsQuery)
+	return result, err
+}
+
+// Removes databases created by easypg within this process from the given list.
+// They are not interesting for the isolation check, since concurrently running
+// tests create and drop them all the time.
+func withoutTestDatabases(dbNames []string) []string {
+	var result []string
+	for _, dbName := range dbNames {
+		if !isTestDatabaseName(dbName) {
+			result = append(result, dbName)
+		}
+	}
+	return result
+}
+
+func queryStrings(db *sql.DB, query string, args ...any) ([]string, error) {
+	var result []string
+	err := sqlext.ForeachRow(db, query, args, func(rows *sql.Rows) error {
+		var value string
+		err := rows.Scan(&value)
+		result = append(result, value)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while executing %q: %w", query, err)
+	}
+	return result, nil
+}
+
+// Backends take a short moment to disappear from pg_stat_activity after the
+// client has disconnected, so this polls for a bit before reporting leaks.
+func waitForConnectionsToClose(adminDB *sql.DB, dbName string) ([]string, error) {
+	var (
+		leaked []string
+		err    error
+	)
+	for range 20 {
+		leaked = nil
+		err = sqlext.ForeachRow(adminDB, listConnectionsQuery, []any{dbName}, func(rows *sql.Rows) error {
+			var (
+				pid                   int64
+				appName, state, query string
+			)
+			err := rows.Scan(&pid, &appName, &state, &query)
+			leaked = append(leaked, fmt.Sprintf("pid %d (application_name = %q, state = %q, last query = %q)", pid, appName, state, query))
+			return err
+		})
+		if err != nil || len(leaked) == 0 {
+			return leaked, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return leaked, nil
+}
+
+func diffIsolationSnapshots(objectType string, before, after []string) []string {
+	var problems []string
+	for _, name := range after {
+		if !slices.Contains(before, name) {
+			problems = append(problems, fmt.Sprintf("%s %q was created", objectType, name))
+		}
+	}
+	for _, name := range before {
+		if !slices.Contains(after, name) {
+			problems = append(problems, fmt.Sprintf("%s %q was dropped", objectType, name))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,62 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestDiffIsolationSnapshots(t *testing.T) {
+	// no changes -> no problems
+	roles := []string{"postgres", "pg_monitor"}
+	assert.DeepEqual(t, "problems", diffIsolationSnapshots("role", roles, roles), []string(nil))
+
+	// created and dropped objects are reported, created ones first
+	before := []string{"public.accounts", "public.projects", "public.schema_migrations"}
+	after := []string{"public.accounts", "public.domains", "public.schema_migrations", "public.zones"}
+	assert.DeepEqual(t, "problems", diffIsolationSnapshots(`relation in database "postgres"`, before, after), []string{
+		`relation in database "postgres" "public.domains" was created`,
+		`relation in database "postgres" "public.zones" was created`,
+		`relation in database "postgres" "public.projects" was dropped`,
+	})
+
+	// databases created by easypg within this process are removed from the snapshot,
+	// so it does not matter whether they were created or dropped during the test
+	registerTestDatabaseName("isolation_test_created")
+	registerTestDatabaseName("isolation_test_dropped")
+	assert.DeepEqual(t, "isTestDatabaseName", isTestDatabaseName("isolation_test_created"), true)
+	assert.DeepEqual(t, "isTestDatabaseName", isTestDatabaseName("postgres"), false)
+	before = withoutTestDatabases([]string{"isolation_test_dropped", "postgres", "stale"})
+	after = withoutTestDatabases([]string{"isolation_test_created", "postgres", "unrelated"})
+	assert.DeepEqual(t, "problems", diffIsolationSnapshots("database", before, after), []string{
+		`database "unrelated" was created`,
+		`database "stale" was dropped`,
+	})
+
+	// empty snapshots (e.g. on a fresh server) work as well
+	assert.DeepEqual(t, "problems", diffIsolationSnapshots("role", nil, []string{"app"}), []string{
+		`role "app" was created`,
+	})
+	assert.DeepEqual(t, "problems", diffIsolationSnapshots("role", []string{"app"}, nil), []string{
+		`role "app" was dropped`,
+	})
+}
@@ -0,0 +1,107 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JSONBValue is a wrapper for values of type T that are stored in JSON or
+// JSONB columns. It implements sql.Scanner and driver.Valuer, so it can be
+// used directly as a query argument or scan target:
+//
+//	type Settings struct { Color string `json:"color"` }
+//	var s easypg.JSONBValue[Settings]
+//	err := db.QueryRow(`SELECT settings FROM users WHERE id = $1`, id).Scan(&s)
+//	fmt.Println(s.Data.Color)
+//
+// Trailing data after the JSON value is rejected. Unknown object fields are
+// ignored by default, so that an older version of the application can still
+// read values that were written by a newer version with additional fields
+// (e.g. during a rolling upgrade). To reject unknown fields instead, in order
+// to avoid silently losing data when the column contents and the Go type
+// disagree, set DisallowUnknownFields before scanning:
+//
+//	s := easypg.JSONBValue[Settings]{DisallowUnknownFields: true}
+//	err := db.QueryRow(`SELECT settings FROM users WHERE id = $1`, id).Scan(&s)
+//
+// SQL NULL is scanned into the zero value of T, and values that encode into
+// JSON null are written as SQL NULL. For nullable columns, T should therefore
+// be a pointer type, a slice type or a map type.
+type JSONBValue[T any] struct {
+	Data T
+	// If true, Scan() fails when the JSON contains object fields that do not exist in T.
+	DisallowUnknownFields bool
+}
+
+// NewJSONBValue is a convenience constructor for JSONBValue.
+func NewJSONBValue[T any](value T) JSONBValue[T] {
+	return JSONBValue[T]{Data: value}
+}
+
+// Scan implements the sql.Scanner interface.
+func (j *JSONBValue[T]) Scan(src any) error {
+	var buf []byte
+	switch src := src.(type) {
+	case nil:
+		var zero T
+		j.Data = zero
+		return nil
+	case []byte:
+		buf = src
+	case string:
+		buf = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan value of type %T into %T", src, j)
+	}
+
+	var value T
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	if j.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(&value)
+	if err != nil {
+		return fmt.Errorf("while decoding JSON into %T: %w", value, err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("while decoding JSON into %T: unexpected trailing data", value)
+	}
+	j.Data = value
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (j JSONBValue[T]) Value() (driver.Value, error) {
+	buf, err := json.Marshal(j.Data)
+	if err != nil {
+		return nil, fmt.Errorf("while encoding %T into JSON: %w", j.Data, err)
+	}
+	if string(buf) == "null" {
+		return nil, nil
+	}
+	// NOTE: returning a string instead of []byte ensures that lib/pq sends this as text, not as bytea
+	return string(buf), nil
+}
@@ -0,0 +1,87 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+type jsonbTestPayload struct {
+	Name  string `json:"name"`
+	Count int    `json:"count,omitempty"`
+}
+
+func TestJSONBValue(t *testing.T) {
+	// check roundtrip
+	value, err := NewJSONBValue(jsonbTestPayload{Name: "foo", Count: 42}).Value()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "encoded value", value, driver.Value(`{"name":"foo","count":42}`))
+
+	var j JSONBValue[jsonbTestPayload]
+	for _, src := range []any{value, []byte(value.(string))} {
+		err = j.Scan(src)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		assert.DeepEqual(t, "decoded value", j.Data, jsonbTestPayload{Name: "foo", Count: 42})
+	}
+
+	// check NULL handling
+	err = j.Scan(nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "decoded NULL", j.Data, jsonbTestPayload{})
+	var jp JSONBValue[*jsonbTestPayload]
+	value, err = jp.Value()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "encoded nil", value, nil)
+
+	// unknown fields are ignored by default
+	err = j.Scan(`{"name":"foo","color":"red"}`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "decoded value with unknown field", j.Data, jsonbTestPayload{Name: "foo"})
+
+	// check strict decoding
+	j.DisallowUnknownFields = true
+	testCases := map[any]string{
+		`{"name":"foo","color":"red"}`:  `while decoding JSON into easypg.jsonbTestPayload: json: unknown field "color"`,
+		`{"name":"foo"} {"name":"bar"}`: `while decoding JSON into easypg.jsonbTestPayload: unexpected trailing data`,
+		`{"name":42}`:                   `while decoding JSON into easypg.jsonbTestPayload: json: cannot unmarshal number into Go struct field jsonbTestPayload.name of type string`,
+		int64(42):                       `cannot scan value of type int64 into *easypg.JSONBValue[github.com/sapcc/go-bits/easypg.jsonbTestPayload]`,
+	}
+	for src, expected := range testCases {
+		err = j.Scan(src)
+		if err == nil {
+			t.Errorf("expected error when scanning %#v, but got none", src)
+		} else {
+			assert.DeepEqual(t, "error message", err.Error(), expected)
+		}
+	}
+}
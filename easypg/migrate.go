@@ -0,0 +1,192 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	url "net/url"
+	"slices"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// SchemaVersion describes the state of the database schema, as returned by GetSchemaVersion().
+type SchemaVersion struct {
+	// The version of the last migration that was applied, or 0 if no migrations were applied yet.
+	Version uint
+	// Whether the last migration failed halfway through. If so, the schema
+	// needs to be repaired manually before migrations can be applied again.
+	Dirty bool
+}
+
+// String returns a human-readable representation of this SchemaVersion, e.g. for log messages.
+func (v SchemaVersion) String() string {
+	switch {
+	case v.Version == 0:
+		return "no migrations applied"
+	case v.Dirty:
+		return fmt.Sprintf("version %d (dirty)", v.Version)
+	default:
+		return fmt.Sprintf("version %d", v.Version)
+	}
+}
+
+// GetSchemaVersion connects to a Postgres database (like Connect does) and
+// reports which schema migrations have been applied to it, without applying
+// any migrations.
+func GetSchemaVersion(dbURL url.URL, cfg Configuration) (SchemaVersion, error) {
+	var result SchemaVersion
+	err := withMigrate(dbURL, cfg, func(m *migrator) error {
+		version, dirty, err := m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return nil
+		}
+		result = SchemaVersion{Version: version, Dirty: dirty}
+		return err
+	})
+	if err != nil {
+		return SchemaVersion{}, fmt.Errorf("cannot read database schema version: %w", err)
+	}
+	return result, nil
+}
+
+// SchemaStatus describes the state of the database schema in relation to the
+// migrations that the application knows about, as returned by GetSchemaStatus().
+// It can be serialized as JSON, e.g. for exposing it on an admin endpoint.
+type SchemaStatus struct {
+	// The version of the last migration that was applied, or 0 if no migrations were applied yet.
+	Version uint `json:"version"`
+	// Whether the last migration failed halfway through (see SchemaVersion.Dirty).
+	Dirty bool `json:"dirty"`
+	// The file names of all up migrations with a version greater than Version,
+	// in the order in which Connect() would apply them. If Dirty is true, the
+	// failed migration itself is not included.
+	PendingMigrations []string `json:"pending_migrations"`
+}
+
+// GetSchemaStatus is like GetSchemaVersion, but also reports which
+// migrations from the given Configuration have not been applied yet. No
+// migrations are applied by this function, so it is suitable for health checks
+// or admin endpoints.
+func GetSchemaStatus(dbURL url.URL, cfg Configuration) (SchemaStatus, error) {
+	version, err := GetSchemaVersion(dbURL, cfg)
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	pending, err := cfg.pendingMigrations(version.Version)
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	return SchemaStatus{
+		Version:           version.Version,
+		Dirty:             version.Dirty,
+		PendingMigrations: pending,
+	}, nil
+}
+
+// Returns the file names of all up migrations in cfg with a version greater than `current`, sorted by version.
+func (cfg Configuration) pendingMigrations(current uint) ([]string, error) {
+	migrations, err := cfg.allMigrationsWithGoPlaceholders()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*source.Migration
+	for fileName := range migrations {
+		m, err := source.Parse(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q: %w", fileName, err)
+		}
+		if m.Direction == source.Up && m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	slices.SortFunc(pending, func(lhs, rhs *source.Migration) int {
+		return cmp.Compare(lhs.Version, rhs.Version)
+	})
+
+	result := make([]string, len(pending))
+	for idx, m := range pending {
+		result[idx] = m.Raw
+	}
+	return result, nil
+}
+
+// MigrateDown connects to a Postgres database (like Connect does) and rolls
+// back the given number of schema migrations, using the down migrations from
+// the given Configuration. This is intended for operators who need to roll
+// back a bad migration. Applications shall not call this during normal
+// operation.
+func MigrateDown(dbURL url.URL, cfg Configuration, steps uint) error {
+	if steps == 0 {
+		return nil
+	}
+	err := withMigrate(dbURL, cfg, func(m *migrator) error {
+		return m.Steps(-int(steps))
+	})
+	if err != nil {
+		return fmt.Errorf("cannot roll back %d database migrations: %w", steps, err)
+	}
+	return nil
+}
+
+// MigrateTo connects to a Postgres database (like Connect does) and applies
+// up or down migrations from the given Configuration as needed to reach the
+// given schema version. Like MigrateDown, this is intended for operators.
+func MigrateTo(dbURL url.URL, cfg Configuration, version uint) error {
+	err := withMigrate(dbURL, cfg, func(m *migrator) error {
+		if version == 0 {
+			return m.Down()
+		}
+		if len(cfg.GoMigrations) > 0 {
+			// Go migrations on the way up need to be run by us instead of by migrate.Migrate
+			current, _, err := m.Version()
+			if (err == nil && current < version) || errors.Is(err, migrate.ErrNilVersion) {
+				versions, err := cfg.upMigrationVersions()
+				if err != nil {
+					return err
+				}
+				if !slices.Contains(versions, version) {
+					return fmt.Errorf("no migration found for version %d", version)
+				}
+				return runMigrationSteps(context.Background(), m, cfg, version)
+			}
+		}
+		return m.Migrate.Migrate(version)
+	})
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("cannot migrate database schema to version %d: %w", version, err)
+	}
+	return nil
+}
+
+func withMigrate(dbURL url.URL, cfg Configuration, action func(*migrator) error) error {
+	db, m, err := prepareMigration(context.Background(), dbURL, cfg)
+	if err != nil {
+		return err
+	}
+	err = action(m)
+	sourceErr, dbErr := m.Close()
+	return errors.Join(err, sourceErr, dbErr, db.Close())
+}
@@ -0,0 +1,101 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Settings for the connection pool of a *sql.DB, as configured through the
+// respective fields in type Configuration.
+type poolSettings struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Computes the pool settings for this Configuration. Fields that are not set
+// in the Configuration are filled from the respective environment variables.
+func (cfg Configuration) poolSettings() (poolSettings, error) {
+	var (
+		s   poolSettings
+		err error
+	)
+	s.MaxOpenConns, err = intFromEnvIfZero(cfg.MaxOpenConns, "GOBITS_DB_MAX_OPEN_CONNS")
+	if err != nil {
+		return s, err
+	}
+	s.MaxIdleConns, err = intFromEnvIfZero(cfg.MaxIdleConns, "GOBITS_DB_MAX_IDLE_CONNS")
+	if err != nil {
+		return s, err
+	}
+	s.ConnMaxLifetime, err = durationFromEnvIfZero(cfg.ConnMaxLifetime, "GOBITS_DB_CONN_MAX_LIFETIME")
+	if err != nil {
+		return s, err
+	}
+	s.ConnMaxIdleTime, err = durationFromEnvIfZero(cfg.ConnMaxIdleTime, "GOBITS_DB_CONN_MAX_IDLE_TIME")
+	return s, err
+}
+
+// Applies these settings to the given DB. Settings with zero value are not
+// applied, i.e. the respective defaults of package database/sql stay in effect.
+func (s poolSettings) ApplyTo(db *sql.DB) {
+	if s.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(s.MaxOpenConns)
+	}
+	if s.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(s.MaxIdleConns)
+	}
+	if s.ConnMaxLifetime != 0 {
+		db.SetConnMaxLifetime(s.ConnMaxLifetime)
+	}
+	if s.ConnMaxIdleTime != 0 {
+		db.SetConnMaxIdleTime(s.ConnMaxIdleTime)
+	}
+}
+
+func intFromEnvIfZero(value int, key string) (int, error) {
+	str := os.Getenv(key)
+	if value != 0 || str == "" {
+		return value, nil
+	}
+	result, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return result, nil
+}
+
+func durationFromEnvIfZero(value time.Duration, key string) (time.Duration, error) {
+	str := os.Getenv(key)
+	if value != 0 || str == "" {
+		return value, nil
+	}
+	result, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector is a prometheus.Collector that reports the statistics of the
+// connection pool of a *sql.DB (as returned by db.Stats()). Construct it with
+// NewPoolCollector(), or use RegisterPoolMetrics() to construct and register
+// it in one step.
+//
+// All metrics carry the label "database" with the name given to the
+// constructor, so that multiple pools can be reported into the same registry.
+type PoolCollector struct {
+	db *sql.DB
+
+	maxOpenDesc           *prometheus.Desc
+	openDesc              *prometheus.Desc
+	inUseDesc             *prometheus.Desc
+	idleDesc              *prometheus.Desc
+	waitCountDesc         *prometheus.Desc
+	waitDurationDesc      *prometheus.Desc
+	maxIdleClosedDesc     *prometheus.Desc
+	maxIdleTimeClosedDesc *prometheus.Desc
+	maxLifetimeClosedDesc *prometheus.Desc
+}
+
+// NewPoolCollector builds a PoolCollector for the given DB. The name is used
+// as the value of the "database" label on all metrics.
+func NewPoolCollector(db *sql.DB, name string) *PoolCollector {
+	labels := prometheus.Labels{"database": name}
+	desc := func(metricName, help string) *prometheus.Desc {
+		return prometheus.NewDesc(metricName, help, nil, labels)
+	}
+	return &PoolCollector{
+		db:                    db,
+		maxOpenDesc:           desc("easypg_pool_max_open_connections", "Maximum number of open connections to the database (0 means unlimited)."),
+		openDesc:              desc("easypg_pool_open_connections", "Number of established connections to the database, both in use and idle."),
+		inUseDesc:             desc("easypg_pool_in_use_connections", "Number of connections to the database that are currently in use."),
+		idleDesc:              desc("easypg_pool_idle_connections", "Number of idle connections to the database."),
+		waitCountDesc:         desc("easypg_pool_wait_count_total", "Counter for times that a connection had to be waited for because the pool was exhausted."),
+		waitDurationDesc:      desc("easypg_pool_wait_duration_seconds_total", "Total time spent waiting for connections because the pool was exhausted."),
+		maxIdleClosedDesc:     desc("easypg_pool_max_idle_closed_total", "Counter for connections that were closed because of the MaxIdleConns limit."),
+		maxIdleTimeClosedDesc: desc("easypg_pool_max_idle_time_closed_total", "Counter for connections that were closed because of the ConnMaxIdleTime limit."),
+		maxLifetimeClosedDesc: desc("easypg_pool_max_lifetime_closed_total", "Counter for connections that were closed because of the ConnMaxLifetime limit."),
+	}
+}
+
+// RegisterPoolMetrics constructs a PoolCollector for the given DB, and
+// registers it with the given registry, or with the default registry if nil
+// is given.
+func RegisterPoolMetrics(registry prometheus.Registerer, db *sql.DB, name string) {
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+	registry.MustRegister(NewPoolCollector(db, name))
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpenDesc
+	ch <- c.openDesc
+	ch <- c.inUseDesc
+	ch <- c.idleDesc
+	ch <- c.waitCountDesc
+	ch <- c.waitDurationDesc
+	ch <- c.maxIdleClosedDesc
+	ch <- c.maxIdleTimeClosedDesc
+	ch <- c.maxLifetimeClosedDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpenDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.openDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUseDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idleDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosedDesc, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
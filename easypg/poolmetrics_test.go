@@ -0,0 +1,72 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestPoolMetrics(t *testing.T) {
+	// sql.Open() does not connect yet, so we can use these handles without a database
+	openDB := func(maxOpenConns int) *sql.DB {
+		db, err := sql.Open("postgres", "postgres://localhost/test")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		db.SetMaxOpenConns(maxOpenConns)
+		return db
+	}
+	primaryDB := openDB(10)
+	defer primaryDB.Close()
+	replicaDB := openDB(20)
+	defer replicaDB.Close()
+
+	// multiple pools can be reported into the same registry
+	registry := prometheus.NewPedanticRegistry()
+	RegisterPoolMetrics(registry, primaryDB, "primary")
+	RegisterPoolMetrics(registry, replicaDB, "replica")
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	actual := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "easypg_pool_max_open_connections" && family.GetName() != "easypg_pool_open_connections" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			key := family.GetName() + "/" + metric.GetLabel()[0].GetValue()
+			actual[key] = metric.GetGauge().GetValue()
+		}
+	}
+	assert.DeepEqual(t, "metrics", actual, map[string]float64{
+		"easypg_pool_max_open_connections/primary": 10,
+		"easypg_pool_max_open_connections/replica": 20,
+		"easypg_pool_open_connections/primary":     0,
+		"easypg_pool_open_connections/replica":     0,
+	})
+	assert.DeepEqual(t, "number of metric families", len(families), 9)
+}
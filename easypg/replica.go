@@ -0,0 +1,161 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// ReplicatedDB holds connections to a primary database and any number of
+// read replicas. It is returned by ConnectWithReplica().
+//
+// Writes and reads that need to observe the results of preceding writes must
+// go to Primary(). Reads that can tolerate replication lag should go to
+// Replica(), which spreads them across all healthy replicas.
+type ReplicatedDB struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+const initialHealthCheckTimeout = 5 * time.Second
+
+type replica struct {
+	db      *sql.DB
+	host    string // only for log messages
+	healthy atomic.Bool
+}
+
+// ConnectWithReplica is like Connect, but additionally connects to the given
+// read replicas of the primary database. Schema migrations are only applied
+// to the primary. The pool settings from the Configuration apply to all
+// connections.
+//
+// Replicas that cannot be reached initially are not an error, but they will
+// not receive any queries until they become healthy. To detect replicas
+// failing and coming back, run the health check loop in a separate goroutine:
+//
+//	db := must.Return(easypg.ConnectWithReplica(primaryURL, replicaURLs, cfg))
+//	go db.RunHealthChecks(ctx, 10*time.Second)
+func ConnectWithReplica(primaryURL url.URL, replicaURLs []url.URL, cfg Configuration) (*ReplicatedDB, error) {
+	pool, err := cfg.poolSettings()
+	if err != nil {
+		return nil, fmt.Errorf("cannot configure connection pool: %w", err)
+	}
+	driverName := cfg.OverrideDriverName
+	if driverName == "" {
+		driverName = "postgres"
+	}
+
+	primary, err := Connect(primaryURL, cfg)
+	if err != nil {
+		return nil, err
+	}
+	rdb := &ReplicatedDB{primary: primary}
+	for _, replicaURL := range replicaURLs {
+		db, err := sql.Open(driverName, replicaURL.String())
+		if err != nil {
+			rdb.Close()
+			return nil, fmt.Errorf("cannot connect to Postgres replica at %s: %w", replicaURL.Host, err)
+		}
+		pool.ApplyTo(db)
+		rdb.replicas = append(rdb.replicas, &replica{db: db, host: replicaURL.Host})
+	}
+
+	for _, r := range rdb.replicas {
+		rdb.checkHealth(context.Background(), r, initialHealthCheckTimeout)
+	}
+	return rdb, nil
+}
+
+// Primary returns the connection to the primary database.
+func (rdb *ReplicatedDB) Primary() *sql.DB {
+	return rdb.primary
+}
+
+// Replica returns the connection to one of the healthy replicas, alternating
+// between them on each call. If no replica is healthy, the connection to the
+// primary database is returned instead.
+func (rdb *ReplicatedDB) Replica() *sql.DB {
+	healthy := make([]*sql.DB, 0, len(rdb.replicas))
+	for _, r := range rdb.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r.db)
+		}
+	}
+	if len(healthy) == 0 {
+		return rdb.primary
+	}
+	return healthy[rdb.next.Add(1)%uint64(len(healthy))]
+}
+
+// RunHealthChecks pings each replica in the given interval, until `ctx`
+// expires. Replicas that fail the health check do not receive queries through
+// Replica() until a later health check succeeds again.
+func (rdb *ReplicatedDB) RunHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, r := range rdb.replicas {
+				rdb.checkHealth(ctx, r, interval)
+			}
+		}
+	}
+}
+
+func (rdb *ReplicatedDB) checkHealth(ctx context.Context, r *replica, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := r.db.PingContext(ctx)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return // we are shutting down, so this result is meaningless
+	}
+
+	wasHealthy := r.healthy.Swap(err == nil)
+	switch {
+	case err != nil && wasHealthy:
+		logg.Error("Postgres replica at %s is unhealthy and will not receive queries: %s", r.host, err.Error())
+	case err != nil && !wasHealthy:
+		logg.Debug("Postgres replica at %s is still unhealthy: %s", r.host, err.Error())
+	case err == nil && !wasHealthy:
+		logg.Info("Postgres replica at %s is healthy and will receive queries", r.host)
+	}
+}
+
+// Close closes the connections to the primary database and all replicas.
+func (rdb *ReplicatedDB) Close() error {
+	errs := []error{rdb.primary.Close()}
+	for _, r := range rdb.replicas {
+		errs = append(errs, r.db.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,151 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryOption is an optional behavior that can be given to RetrySerializable().
+type RetryOption func(*retryParams)
+
+type retryParams struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	metrics        *RetryMetrics
+	operation      string
+}
+
+// WithMaxRetries is a RetryOption that sets how often RetrySerializable()
+// retries after the first attempt. The default is 5.
+func WithMaxRetries(maxRetries int) RetryOption {
+	return func(params *retryParams) {
+		params.maxRetries = maxRetries
+	}
+}
+
+// WithBackoff is a RetryOption that configures the delay between attempts.
+// The delay starts at `initial` and doubles after each failed attempt, but
+// never exceeds `maximum`. A random jitter of up to 50% is subtracted from each
+// delay to keep contending transactions from retrying in lockstep. The default
+// is to start at 10ms and cap at 1s.
+func WithBackoff(initial, maximum time.Duration) RetryOption {
+	return func(params *retryParams) {
+		params.initialBackoff = initial
+		params.maxBackoff = maximum
+	}
+}
+
+// WithRetryMetrics is a RetryOption that reports the outcome of the operation
+// to the given RetryMetrics instance, using the given operation name as label.
+func WithRetryMetrics(metrics *RetryMetrics, operation string) RetryOption {
+	return func(params *retryParams) {
+		params.metrics = metrics
+		params.operation = operation
+	}
+}
+
+// RetrySerializable runs `action` inside a transaction with isolation level
+// SERIALIZABLE, and commits the transaction if `action` returns no error.
+//
+// If `action` or the commit fails with a serialization failure (SQLSTATE 40001)
+// or a deadlock (SQLSTATE 40P01), the transaction is rolled back and the whole
+// thing is attempted again after a capped exponential backoff. Since `action`
+// may run multiple times, it must not have side effects outside of the
+// transaction. Any other error is returned immediately, as is the last error
+// once all retries are used up.
+//
+//	err := easypg.RetrySerializable(ctx, db, func(tx *sql.Tx) error {
+//		_, err := tx.ExecContext(ctx, `UPDATE quotas SET usage = usage + $1 WHERE id = $2`, amount, id)
+//		return err
+//	}, easypg.WithRetryMetrics(retryMetrics, "update-quota"))
+func RetrySerializable(ctx context.Context, db *sql.DB, action func(*sql.Tx) error, opts ...RetryOption) error {
+	return retryOnSerializationFailure(ctx, opts, func() error {
+		return runTransaction(ctx, db, &sql.TxOptions{Isolation: sql.LevelSerializable}, action)
+	})
+}
+
+// This contains the retry loop of RetrySerializable(), separated from the
+// database access to allow for unit tests.
+func retryOnSerializationFailure(ctx context.Context, opts []RetryOption, attempt func() error) (err error) {
+	params := retryParams{
+		maxRetries:     5,
+		initialBackoff: 10 * time.Millisecond,
+		maxBackoff:     1 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&params)
+	}
+
+	obs := RetryObservation{Operation: params.operation}
+	defer func() { params.metrics.Observe(obs) }()
+
+	var firstFailure time.Time
+	backoff := params.initialBackoff
+	for retry := 0; ; retry++ {
+		err = attempt()
+		if err == nil || !isSerializationFailure(err) {
+			return err
+		}
+		if retry == 0 {
+			firstFailure = time.Now()
+		}
+		if retry >= params.maxRetries {
+			obs.GaveUp = true
+			obs.RetryDuration = time.Since(firstFailure)
+			return fmt.Errorf("giving up after %d retries: %w", retry, err)
+		}
+
+		// sleep for a random duration between backoff/2 and backoff
+		delay := backoff/2 + rand.N(backoff/2+1) //nolint:gosec // no crypto-grade randomness needed for jitter
+		select {
+		case <-ctx.Done():
+			obs.RetryDuration = time.Since(firstFailure)
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		backoff = min(2*backoff, params.maxBackoff)
+
+		obs.Retries++
+		obs.RetryDuration = time.Since(firstFailure)
+	}
+}
+
+// isSerializationFailure checks whether the given error is a Postgres error
+// with an SQLSTATE that indicates that the transaction can be retried.
+func isSerializationFailure(err error) bool {
+	// both lib/pq and pgx provide this method on their error types
+	var pgErr interface{ SQLState() string }
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.SQLState() {
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,99 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestIsSerializationFailure(t *testing.T) {
+	testCases := map[error]bool{
+		errors.New("something else"):                                  false,
+		&pq.Error{Code: "23505"}:                                      false, // unique_violation
+		&pq.Error{Code: "40001"}:                                      true,
+		&pq.Error{Code: "40P01"}:                                      true,
+		fmt.Errorf("while doing stuff: %w", &pq.Error{Code: "40001"}): true,
+	}
+	for err, expected := range testCases {
+		assert.DeepEqual(t, fmt.Sprintf("isSerializationFailure(%q)", err.Error()), isSerializationFailure(err), expected)
+	}
+}
+
+func TestRetryOnSerializationFailure(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	serializationFailure := &pq.Error{Code: "40001"}
+	opts := []RetryOption{WithMaxRetries(3), WithBackoff(time.Millisecond, 2*time.Millisecond)}
+
+	// success after some retries
+	attempts := 0
+	err := retryOnSerializationFailure(ctx, opts, func() error {
+		attempts++
+		if attempts < 3 {
+			return serializationFailure
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "attempts", attempts, 3)
+
+	// non-retryable errors are returned immediately
+	attempts = 0
+	otherErr := errors.New("datacenter on fire")
+	err = retryOnSerializationFailure(ctx, opts, func() error {
+		attempts++
+		return otherErr
+	})
+	assert.DeepEqual(t, "error", err, otherErr)
+	assert.DeepEqual(t, "attempts", attempts, 1)
+
+	// giving up after running out of retries
+	attempts = 0
+	err = retryOnSerializationFailure(ctx, opts, func() error {
+		attempts++
+		return serializationFailure
+	})
+	if !errors.Is(err, serializationFailure) {
+		t.Errorf("expected serialization failure, but got %v", err)
+	}
+	assert.DeepEqual(t, "attempts", attempts, 4)
+
+	// cancelled context interrupts the backoff
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	attempts = 0
+	err = retryOnSerializationFailure(cancelledCtx, []RetryOption{WithBackoff(time.Hour, time.Hour)}, func() error {
+		attempts++
+		return serializationFailure
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, but got %v", err)
+	}
+	assert.DeepEqual(t, "attempts", attempts, 1)
+}
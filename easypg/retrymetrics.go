@@ -0,0 +1,134 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RetryMetrics tracks how often database operations had to be retried (e.g.
+// because of serialization failures or deadlocks) and how much time was spent
+// on these retries, broken down by operation name. Steadily growing retry
+// counts are an early warning sign for lock contention.
+//
+// Construct it with NewRetryMetrics(). Operations executed through
+// RetrySerializable() can report here with the WithRetryMetrics() option.
+// Custom retry loops can report each operation with Observe() once it has
+// completed:
+//
+//	var retryMetrics = easypg.NewRetryMetrics(nil)
+//
+//	func updateQuota(ctx context.Context, db *sql.DB) error {
+//		var obs = easypg.RetryObservation{Operation: "update-quota"}
+//		defer func() { retryMetrics.Observe(obs) }()
+//		start := time.Now()
+//		for attempt := 0; ; attempt++ {
+//			err := doUpdateQuota(ctx, db)
+//			if err == nil || !isRetryable(err) {
+//				return err
+//			}
+//			if attempt == maxRetries {
+//				obs.GaveUp = true
+//				return err
+//			}
+//			obs.Retries++
+//			obs.RetryDuration = time.Since(start)
+//			time.Sleep(backoff(attempt))
+//		}
+//	}
+type RetryMetrics struct {
+	operationCounter *prometheus.CounterVec
+	retryCounter     *prometheus.CounterVec
+	retrySeconds     *prometheus.CounterVec
+	gaveUpCounter    *prometheus.CounterVec
+}
+
+// NewRetryMetrics creates a RetryMetrics instance and registers its metrics
+// with the given registry, or with the default registry if nil is given.
+// The following metrics are registered, each with the label "operation":
+//   - "easypg_operations_total" (counter of completed operations)
+//   - "easypg_operation_retries_total" (counter of retries)
+//   - "easypg_operation_retry_seconds_total" (counter of time spent on retries)
+//   - "easypg_operation_retries_exhausted_total" (counter of operations that failed after running out of retries)
+func NewRetryMetrics(registry prometheus.Registerer) *RetryMetrics {
+	labelNames := []string{"operation"}
+	m := &RetryMetrics{
+		operationCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "easypg_operations_total",
+			Help: "Counter for database operations that were executed with retry tracking.",
+		}, labelNames),
+		retryCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "easypg_operation_retries_total",
+			Help: "Counter for retries of database operations, e.g. because of serialization failures or deadlocks.",
+		}, labelNames),
+		retrySeconds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "easypg_operation_retry_seconds_total",
+			Help: "Time spent in retries of database operations (after the first failed attempt, including backoff delays).",
+		}, labelNames),
+		gaveUpCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "easypg_operation_retries_exhausted_total",
+			Help: "Counter for database operations that failed because their retry budget was exhausted.",
+		}, labelNames),
+	}
+
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+	registry.MustRegister(m.operationCounter)
+	registry.MustRegister(m.retryCounter)
+	registry.MustRegister(m.retrySeconds)
+	registry.MustRegister(m.gaveUpCounter)
+	return m
+}
+
+// RetryObservation is the argument type for RetryMetrics.Observe().
+type RetryObservation struct {
+	// The name of the operation, for use as a metric label. This should be a
+	// short identifier from a small, fixed set of values.
+	Operation string
+	// How often the operation was retried after the first attempt.
+	Retries int
+	// The time spent after the first attempt had failed, including backoff
+	// delays. This is zero if the first attempt was successful.
+	RetryDuration time.Duration
+	// Whether the operation ultimately failed because no retries were left.
+	GaveUp bool
+}
+
+// Observe records a completed operation in the metrics.
+// A nil *RetryMetrics is accepted and ignores all observations.
+// Negative values for Retries or RetryDuration are treated as zero.
+func (m *RetryMetrics) Observe(obs RetryObservation) {
+	if m == nil {
+		return
+	}
+	// counters panic when given negative values
+	m.operationCounter.WithLabelValues(obs.Operation).Inc()
+	m.retryCounter.WithLabelValues(obs.Operation).Add(float64(max(obs.Retries, 0)))
+	m.retrySeconds.WithLabelValues(obs.Operation).Add(max(obs.RetryDuration, 0).Seconds())
+	if obs.GaveUp {
+		m.gaveUpCounter.WithLabelValues(obs.Operation).Inc()
+	} else {
+		// make sure that the series exists, so that rate() works from the start
+		m.gaveUpCounter.WithLabelValues(obs.Operation).Add(0)
+	}
+}
@@ -0,0 +1,66 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestRetryMetrics(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	m := NewRetryMetrics(registry)
+
+	m.Observe(RetryObservation{Operation: "foo"})
+	m.Observe(RetryObservation{Operation: "foo", Retries: 2, RetryDuration: 1500 * time.Millisecond})
+	m.Observe(RetryObservation{Operation: "bar", Retries: 5, RetryDuration: 3 * time.Second, GaveUp: true})
+
+	// negative values (e.g. from a miscounting caller) are treated as zero instead of causing a panic
+	m.Observe(RetryObservation{Operation: "bar", Retries: -1, RetryDuration: -time.Second})
+
+	// a nil instance is allowed and does nothing
+	(*RetryMetrics)(nil).Observe(RetryObservation{Operation: "foo", Retries: 1})
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	actual := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			key := family.GetName() + "/" + metric.GetLabel()[0].GetValue()
+			actual[key] = metric.GetCounter().GetValue()
+		}
+	}
+	assert.DeepEqual(t, "metrics", actual, map[string]float64{
+		"easypg_operations_total/bar":                  2,
+		"easypg_operations_total/foo":                  2,
+		"easypg_operation_retries_total/bar":           5,
+		"easypg_operation_retries_total/foo":           2,
+		"easypg_operation_retry_seconds_total/bar":     3,
+		"easypg_operation_retry_seconds_total/foo":     1.5,
+		"easypg_operation_retries_exhausted_total/bar": 1,
+		"easypg_operation_retries_exhausted_total/foo": 0,
+	})
+}
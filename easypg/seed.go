@@ -0,0 +1,336 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/go-bits/sqlext"
+)
+
+// SeedBuilder is a fluent builder for inserting test data into a database,
+// as an alternative to SQL fixture files (see LoadSQLFile). Use func Seed to
+// construct it. For example:
+//
+//	seed := easypg.Seed(t, db)
+//	domain := seed.Table("domains").Row(easypg.Values{"name": "first"})
+//	project := seed.Table("projects").Row(easypg.Values{"name": "foo", "domain_id": domain})
+//	seed.Table("project_resources").Row(db.ProjectResource{Name: "things"}).Set("project_id", project)
+//	seed.Insert()
+//	projectID := project.ID()
+//
+// Rows are not inserted until Insert() is called. Insert() orders the rows
+// such that foreign key constraints are satisfied: Rows that reference other
+// rows (by using a *SeedRow as a value) are inserted after the referenced
+// rows, and rows are inserted after the rows of all tables that their table
+// has foreign keys on. (If tables have foreign keys on each other, only the
+// references between rows are considered for those tables.) Within these
+// constraints, rows are inserted in the order in which they were declared.
+//
+// The generated primary keys can be read from each SeedRow after Insert().
+// Like ResetPrimaryKeys(), this assumes that the primary key of each table
+// is in a column called "id". Tables without an "id" column are supported,
+// but their rows do not have an ID.
+type SeedBuilder struct {
+	t    TestingT
+	db   *sql.DB
+	rows []*SeedRow
+}
+
+// Seed starts building a set of rows to insert into the given database.
+// See type SeedBuilder for details.
+func Seed(t TestingT, db *sql.DB) *SeedBuilder {
+	return &SeedBuilder{t: t, db: db}
+}
+
+// Values is the set of column values for a row given to SeedTable.Row().
+// Values can be of any type supported by the database driver, or *SeedRow
+// to refer to the ID of another row.
+type Values map[string]any
+
+// SeedTable is returned by SeedBuilder.Table().
+type SeedTable struct {
+	builder *SeedBuilder
+	name    string
+}
+
+// Table selects the table into which rows shall be inserted.
+func (b *SeedBuilder) Table(name string) SeedTable {
+	return SeedTable{b, name}
+}
+
+// Row declares a row to be inserted into this table.
+//
+// The argument can either be of type Values, or a struct (or pointer to a
+// struct) whose fields are mapped to columns through `db:"column_name"`
+// tags, as used by gorp. Untagged fields and fields tagged with `db:"-"` are
+// ignored. When using a struct, the "id" column is skipped if the field is
+// set to zero, so that the database can generate the ID.
+func (t SeedTable) Row(values any) *SeedRow {
+	t.builder.t.Helper()
+	columns, err := seedColumnsFrom(values)
+	if err != nil {
+		t.builder.t.Fatalf("while declaring row for table %q: %s", t.name, err.Error())
+	}
+	row := &SeedRow{table: t.name, columns: columns}
+	t.builder.rows = append(t.builder.rows, row)
+	return row
+}
+
+// SeedRow is a row declared through SeedTable.Row().
+type SeedRow struct {
+	table    string
+	columns  Values
+	id       int64
+	inserted bool
+}
+
+// Set sets the value of a column in this row, overriding any previous value.
+// This is useful for setting references to other rows when the row was
+// declared with a struct.
+func (r *SeedRow) Set(column string, value any) *SeedRow {
+	r.columns[column] = value
+	return r
+}
+
+// ID returns the value of the "id" column of this row, as generated during SeedBuilder.Insert().
+// It panics when called before the row has been inserted.
+func (r *SeedRow) ID() int64 {
+	if !r.inserted {
+		panic(fmt.Sprintf("SeedRow.ID() called on row for table %q before SeedBuilder.Insert()", r.table))
+	}
+	return r.id
+}
+
+// Insert inserts all rows that have been declared so far, in a single
+// transaction. Any error is reported through t.Fatal().
+// Insert() can be called multiple times to insert more rows that are
+// declared afterwards; rows that were already inserted are skipped.
+func (b *SeedBuilder) Insert() {
+	b.t.Helper()
+	err := b.insert()
+	if err != nil {
+		b.t.Fatal(err.Error())
+	}
+}
+
+func (b *SeedBuilder) insert() (returnedErr error) {
+	var pending []*SeedRow
+	for _, row := range b.rows {
+		if !row.inserted {
+			pending = append(pending, row)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var tableDeps [][2]string
+	err := sqlext.ForeachRow(b.db, seedForeignKeysQuery, nil, func(rows *sql.Rows) error {
+		var dep [2]string
+		err := rows.Scan(&dep[0], &dep[1])
+		tableDeps = append(tableDeps, dep)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("while listing foreign keys: %w", err)
+	}
+	tablesWithID, err := queryStrings(b.db, seedTablesWithIDQuery)
+	if err != nil {
+		return err
+	}
+	ordered, err := orderSeedRows(pending, tableDeps)
+	if err != nil {
+		return err
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer sqlext.RollbackUnlessCommitted(tx)
+	for _, row := range ordered {
+		query, args := row.buildInsert(slices.Contains(tablesWithID, row.table))
+		if slices.Contains(tablesWithID, row.table) {
+			err = tx.QueryRow(query, args...).Scan(&row.id)
+		} else {
+			_, err = tx.Exec(query, args...)
+		}
+		if err != nil {
+			return fmt.Errorf("while executing %q with %v: %w", query, args, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	for _, row := range ordered {
+		row.inserted = true
+	}
+	return nil
+}
+
+var (
+	// lists pairs of (table, table referenced by foreign key)
+	seedForeignKeysQuery = sqlext.SimplifyWhitespace(`
+		SELECT conrelid::regclass::text, confrelid::regclass::text
+		  FROM pg_constraint WHERE contype = 'f' AND conrelid != confrelid
+	`)
+	seedTablesWithIDQuery = sqlext.SimplifyWhitespace(`
+		SELECT table_name FROM information_schema.columns
+		 WHERE table_schema = current_schema() AND column_name = 'id'
+	`)
+)
+
+func (r *SeedRow) buildInsert(returnID bool) (query string, args []any) {
+	columnNames := make([]string, 0, len(r.columns))
+	for column := range r.columns {
+		columnNames = append(columnNames, column)
+	}
+	slices.Sort(columnNames)
+
+	quotedNames := make([]string, len(columnNames))
+	placeholders := make([]string, len(columnNames))
+	args = make([]any, len(columnNames))
+	for idx, column := range columnNames {
+		quotedNames[idx] = fmt.Sprintf(`"%s"`, column)
+		placeholders[idx] = fmt.Sprintf("$%d", idx+1)
+		args[idx] = r.columns[column]
+		if ref, ok := args[idx].(*SeedRow); ok {
+			args[idx] = ref.id
+		}
+	}
+
+	if len(columnNames) == 0 {
+		query = fmt.Sprintf(`INSERT INTO "%s" DEFAULT VALUES`, r.table)
+	} else {
+		query = fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES (%s)`,
+			r.table, strings.Join(quotedNames, ", "), strings.Join(placeholders, ", "))
+	}
+	if returnID {
+		query += " RETURNING id"
+	}
+	return query, args
+}
+
+// Sorts rows such that each row comes after all rows that it depends on,
+// either through a direct reference or through a foreign key between their
+// tables. Otherwise, the original order is preserved.
+//
+// Foreign keys between tables can be cyclic (e.g. when two tables have
+// foreign keys on each other). If no row can be placed because of this, the
+// foreign keys between tables are disregarded, and only the direct references
+// between rows are taken into account for placing the next row.
+func orderSeedRows(rows []*SeedRow, tableDeps [][2]string) ([]*SeedRow, error) {
+	refersTo := func(row, other *SeedRow) bool {
+		for _, value := range row.columns {
+			if ref, ok := value.(*SeedRow); ok && ref == other {
+				return true
+			}
+		}
+		return false
+	}
+	dependsOn := func(row, other *SeedRow) bool {
+		return refersTo(row, other) || slices.Contains(tableDeps, [2]string{row.table, other.table})
+	}
+
+	result := make([]*SeedRow, 0, len(rows))
+	done := make(map[*SeedRow]bool, len(rows))
+	// finds the first row whose dependencies are all done
+	findNext := func(dependsOn func(row, other *SeedRow) bool) *SeedRow {
+		for _, row := range rows {
+			if done[row] {
+				continue
+			}
+			ready := true
+			for _, other := range rows {
+				if other != row && !done[other] && dependsOn(row, other) {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				return row
+			}
+		}
+		return nil
+	}
+	for len(result) < len(rows) {
+		next := findNext(dependsOn)
+		if next == nil {
+			next = findNext(refersTo)
+		}
+		if next == nil {
+			return nil, errors.New("cannot find an insertion order for seed rows because of cyclic references between them")
+		}
+		result = append(result, next)
+		done[next] = true
+	}
+
+	// check that all referenced rows are part of this batch or were inserted earlier
+	for _, row := range rows {
+		for column, value := range row.columns {
+			ref, ok := value.(*SeedRow)
+			if ok && !ref.inserted && !done[ref] {
+				return nil, fmt.Errorf("row for table %q refers to an undeclared row in column %q", row.table, column)
+			}
+		}
+	}
+	return result, nil
+}
+
+func seedColumnsFrom(values any) (Values, error) {
+	switch values := values.(type) {
+	case Values:
+		result := make(Values, len(values))
+		for column, value := range values {
+			result[column] = value
+		}
+		return result, nil
+	case map[string]any:
+		return seedColumnsFrom(Values(values))
+	}
+
+	v := reflect.ValueOf(values)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected Values or a struct, but got %T", values)
+	}
+	result := make(Values)
+	for idx := range v.NumField() {
+		field := v.Type().Field(idx)
+		column, _, _ := strings.Cut(field.Tag.Get("db"), ",")
+		if column == "" || column == "-" || !field.IsExported() {
+			continue
+		}
+		if column == "id" && v.Field(idx).IsZero() {
+			continue
+		}
+		result[column] = v.Field(idx).Interface()
+	}
+	return result, nil
+}
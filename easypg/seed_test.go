@@ -0,0 +1,94 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestSeedRowOrdering(t *testing.T) {
+	seed := Seed(t, nil)
+	resource := seed.Table("project_resources").Row(Values{"name": "things"})
+	project := seed.Table("projects").Row(Values{"name": "foo"})
+	domain := seed.Table("domains").Row(Values{"name": "first"})
+	resource.Set("project_id", project)
+	project.Set("domain_id", domain)
+	unrelated := seed.Table("unrelated").Row(Values{})
+	otherDomain := seed.Table("domains").Row(Values{"name": "second"})
+
+	// rows are reordered because of direct references and foreign keys between tables
+	tableDeps := [][2]string{{"projects", "domains"}}
+	ordered, err := orderSeedRows(seed.rows, tableDeps)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "ordered rows", ordered, []*SeedRow{domain, unrelated, otherDomain, project, resource})
+
+	// tables with foreign keys on each other are ordered by the references between their rows
+	mutual := Seed(t, nil)
+	firstUser := mutual.Table("users").Row(Values{"name": "alice"})
+	team := mutual.Table("teams").Row(Values{"name": "ops"})
+	secondUser := mutual.Table("users").Row(Values{"name": "bob", "team_id": team})
+	team.Set("owner_id", firstUser)
+	mutualDeps := [][2]string{{"users", "teams"}, {"teams", "users"}}
+	ordered, err = orderSeedRows(mutual.rows, mutualDeps)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "ordered rows", ordered, []*SeedRow{firstUser, team, secondUser})
+
+	// cyclic references are rejected
+	domain.Set("owner_project_id", project)
+	_, err = orderSeedRows(seed.rows, nil)
+	if err == nil {
+		t.Error("expected error for cyclic references, but got none")
+	}
+}
+
+func TestSeedRowInsertQuery(t *testing.T) {
+	type projectRecord struct {
+		ID       int64  `db:"id"`
+		Name     string `db:"name"`
+		DomainID int64  `db:"domain_id"`
+		Comment  string `db:"-"`
+		internal string //nolint:unused // checks that untagged fields are skipped
+	}
+
+	seed := Seed(t, nil)
+	domain := seed.Table("domains").Row(Values{"name": "first"})
+	domain.id = 42
+	project := seed.Table("projects").Row(&projectRecord{Name: "foo"}).Set("domain_id", domain)
+
+	query, args := project.buildInsert(true)
+	assert.DeepEqual(t, "query", query, `INSERT INTO "projects" ("domain_id", "name") VALUES ($1, $2) RETURNING id`)
+	assert.DeepEqual(t, "args", args, []any{int64(42), "foo"})
+
+	// explicit IDs are retained, and tables without ID column do not return anything
+	row := seed.Table("projects").Row(projectRecord{ID: 5, Name: "bar", DomainID: 42})
+	query, args = row.buildInsert(false)
+	assert.DeepEqual(t, "query", query, `INSERT INTO "projects" ("domain_id", "id", "name") VALUES ($1, $2, $3)`)
+	assert.DeepEqual(t, "args", args, []any{int64(42), int64(5), "bar"})
+
+	query, args = seed.Table("counters").Row(Values{}).buildInsert(true)
+	assert.DeepEqual(t, "query", query, `INSERT INTO "counters" DEFAULT VALUES RETURNING id`)
+	assert.DeepEqual(t, "args", args, []any{})
+}
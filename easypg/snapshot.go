@@ -22,6 +22,7 @@ package easypg
 import (
 	"database/sql"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -53,7 +54,25 @@ const (
 	`
 )
 
-func newDBSnapshot(t TestingT, db *sql.DB) dbSnapshot {
+// If `onlyTables` is not empty, only those tables are included in the snapshot.
+// Restricts the given list of table names to those in `onlyTables` (unless
+// that is empty), while keeping the original order. All tables in
+// `onlyTables` must exist.
+func filterTableNames(tableNames, onlyTables []string) ([]string, error) {
+	if len(onlyTables) == 0 {
+		return tableNames, nil
+	}
+	for _, name := range onlyTables {
+		if !slices.Contains(tableNames, name) {
+			return nil, fmt.Errorf("cannot snapshot table %q: no such table", name)
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(tableNames), func(name string) bool {
+		return !slices.Contains(onlyTables, name)
+	}), nil
+}
+
+func newDBSnapshot(t TestingT, db *sql.DB, onlyTables ...string) dbSnapshot {
 	t.Helper()
 
 	// list all tables
@@ -67,6 +86,8 @@ func newDBSnapshot(t TestingT, db *sql.DB) dbSnapshot {
 	}
 	failOnErr(t, rows.Err())
 	failOnErr(t, rows.Close()) //nolint:sqlclosecheck
+	tableNames, err = filterTableNames(tableNames, onlyTables)
+	failOnErr(t, err)
 
 	// list key columns for all tables
 	keyColumnNames := make(map[string][]string)
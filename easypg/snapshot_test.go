@@ -0,0 +1,46 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestFilterTableNames(t *testing.T) {
+	allTables := []string{"domains", "projects", "project_resources", "schema_migrations"}
+
+	// without filter, all tables are snapshotted
+	assert.DeepEqual(t, "tables", must.ReturnT(filterTableNames(allTables, nil))(t), allTables)
+
+	// with filter, only the selected tables are snapshotted, in their original order
+	assert.DeepEqual(t, "tables", must.ReturnT(filterTableNames(allTables, []string{"project_resources", "domains"}))(t),
+		[]string{"domains", "project_resources"})
+	assert.DeepEqual(t, "unchanged input", allTables, []string{"domains", "projects", "project_resources", "schema_migrations"})
+
+	// selecting a table that does not exist is an error (to catch typos in AssertDBContentOfTables() calls)
+	_, err := filterTableNames(allTables, []string{"projects", "project_resource"})
+	if err == nil {
+		t.Fatal("expected error for nonexistent table, but got none")
+	}
+	assert.DeepEqual(t, "error", err.Error(), `cannot snapshot table "project_resource": no such table`)
+}
@@ -0,0 +1,220 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A single statement from a file loaded by LoadSQLFile().
+type sqlStatement struct {
+	Text string
+	Line int // 1-based line number where the statement starts
+}
+
+// Matches the opening tag of a dollar-quoted string, e.g. "$$" or "$body$".
+var dollarQuoteTagRx = regexp.MustCompile(`^\$(?:[A-Za-z_\x80-\x{10FFFF}][A-Za-z0-9_\x80-\x{10FFFF}]*)?\$`)
+
+// Splits a string containing SQL statements into single statements at each
+// semicolon that is not part of a string literal, a quoted identifier, a
+// dollar-quoted string or a comment. Statements that only consist of
+// whitespace and comments are skipped. The last statement does not need to
+// be terminated by a semicolon.
+func splitSQLStatements(input string) ([]sqlStatement, error) {
+	var (
+		result         []sqlStatement
+		current        strings.Builder
+		line           = 1
+		startLine      = 1
+		hasContent     = false // whether `current` contains anything other than whitespace and comments
+		prevIsWordChar = false // whether the previous character can be part of an identifier (for detecting E'...' strings)
+	)
+
+	// appends `text` to the current statement while counting lines
+	consume := func(text string) {
+		if !hasContent {
+			startLine = line
+		}
+		current.WriteString(text)
+		line += strings.Count(text, "\n")
+	}
+
+	for pos := 0; pos < len(input); {
+		rest := input[pos:]
+		c := rest[0]
+		var (
+			token      string
+			isContent  = true
+			isWordChar = false
+			err        error
+		)
+
+		switch {
+		case c == ';':
+			if hasContent {
+				result = append(result, sqlStatement{Text: strings.TrimSpace(current.String()), Line: startLine})
+			}
+			current.Reset()
+			hasContent = false
+			prevIsWordChar = false
+			pos++
+			continue
+		case strings.HasPrefix(rest, "--"):
+			token, _, _ = strings.Cut(rest, "\n")
+			isContent = false
+		case strings.HasPrefix(rest, "/*"):
+			token, err = scanBlockComment(rest)
+			isContent = false
+		case c == '\'':
+			// in E'...' strings, backslashes escape the next character
+			isEscapeString := prevIsWordChar && pos > 0 && strings.ContainsRune("eE", rune(input[pos-1])) &&
+				(pos < 2 || !isIdentifierChar(input[pos-2]))
+			token, err = scanQuoted(rest, '\'', isEscapeString)
+		case c == '"':
+			token, err = scanQuoted(rest, '"', false)
+		case c == '$' && !prevIsWordChar && dollarQuoteTagRx.MatchString(rest):
+			tag := dollarQuoteTagRx.FindString(rest)
+			end := strings.Index(rest[len(tag):], tag)
+			if end < 0 {
+				err = fmt.Errorf("unterminated dollar-quoted string starting with %s", tag)
+			} else {
+				token = rest[:len(tag)+end+len(tag)]
+			}
+		default:
+			token = rest[:1]
+			isContent = !strings.ContainsRune(" \t\r\n", rune(c))
+			isWordChar = isIdentifierChar(c)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("on line %d: %w", line, err)
+		}
+
+		if isContent && !hasContent {
+			// do not include leading whitespace and comments in the statement
+			current.Reset()
+			consume(token)
+			hasContent = true
+		} else {
+			consume(token)
+		}
+		prevIsWordChar = isWordChar
+		pos += len(token)
+	}
+
+	if hasContent {
+		result = append(result, sqlStatement{Text: strings.TrimSpace(current.String()), Line: startLine})
+	}
+	return result, nil
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// Returns the prefix of `input` that contains the quoted string or identifier
+// at the start of `input`. A doubled quote character is an escaped quote
+// character. If `backslashEscapes` is true, backslashes escape the next character.
+func scanQuoted(input string, quote byte, backslashEscapes bool) (string, error) {
+	for pos := 1; pos < len(input); pos++ {
+		switch input[pos] {
+		case '\\':
+			if backslashEscapes {
+				pos++
+			}
+		case quote:
+			if pos+1 < len(input) && input[pos+1] == quote {
+				pos++
+				continue
+			}
+			return input[:pos+1], nil
+		}
+	}
+	return "", fmt.Errorf("unterminated quoted string or identifier starting with %c", quote)
+}
+
+// Returns the prefix of `input` that contains the block comment at the start
+// of `input`. Like in Postgres, block comments can be nested.
+func scanBlockComment(input string) (string, error) {
+	depth := 0
+	for pos := 0; pos+1 < len(input); pos++ {
+		switch input[pos : pos+2] {
+		case "/*":
+			depth++
+			pos++
+		case "*/":
+			depth--
+			pos++
+			if depth == 0 {
+				return input[:pos+1], nil
+			}
+		}
+	}
+	return "", errors.New("unterminated block comment")
+}
+
+// Executes the given statements in order, and returns the line number of the
+// failing statement if any.
+//
+// Before multi-line statements were supported, LoadSQLFile() expected one
+// statement per line and did not require terminating semicolons. In files of
+// this legacy format, consecutive lines without semicolons end up in a single
+// multi-line statement, which fails to execute. In this case, the lines of
+// that statement are executed one by one instead, like in the legacy format.
+// This is safe because a failed statement does not have any effect.
+func execSQLStatements(stmts []sqlStatement, exec func(query string) error) (line int, err error) {
+	for _, stmt := range stmts {
+		err := exec(stmt.Text)
+		if err == nil {
+			continue
+		}
+		if !strings.Contains(stmt.Text, "\n") {
+			return stmt.Line, err
+		}
+
+		// fallback for the legacy format
+		legacyLine, legacyErr := execSQLLines(stmt, exec)
+		if legacyErr != nil {
+			// report the original error, since we do not know which format the file is in
+			return stmt.Line, fmt.Errorf("%w (note: statements need to be terminated by semicolons; "+
+				"executing this statement line by line like in the legacy format failed on line %d: %s)",
+				err, legacyLine, legacyErr.Error())
+		}
+	}
+	return 0, nil
+}
+
+// Executes each line of the given statement as a separate statement.
+func execSQLLines(stmt sqlStatement, exec func(query string) error) (line int, err error) {
+	for idx, text := range strings.Split(stmt.Text, "\n") {
+		text = strings.TrimSpace(text)
+		if text == "" || strings.HasPrefix(text, "--") {
+			continue
+		}
+		err := exec(text)
+		if err != nil {
+			return stmt.Line + idx, err
+		}
+	}
+	return 0, nil
+}
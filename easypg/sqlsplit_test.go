@@ -0,0 +1,114 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	input := `-- leading comment; with a semicolon
+INSERT INTO foo (id, name) VALUES (1, 'bar');
+INSERT INTO foo (id, name)
+  VALUES (2, 'semi;colon'), (3, 'it''s'), (4, E'back\';slash');
+
+/* block comment; /* nested; */ still comment */
+UPDATE "weird;table" SET name = $$dollar;quoted$$ WHERE id = $1;
+CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+  ;;
+SELECT 1 -- trailing comment; without semicolon`
+
+	stmts, err := splitSQLStatements(input)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "statements", stmts, []sqlStatement{
+		{Line: 2, Text: `INSERT INTO foo (id, name) VALUES (1, 'bar')`},
+		{Line: 3, Text: "INSERT INTO foo (id, name)\n  VALUES (2, 'semi;colon'), (3, 'it''s'), (4, E'back\\';slash')"},
+		{Line: 7, Text: `UPDATE "weird;table" SET name = $$dollar;quoted$$ WHERE id = $1`},
+		{Line: 8, Text: `CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql`},
+		{Line: 10, Text: `SELECT 1 -- trailing comment; without semicolon`},
+	})
+
+	// unterminated quotes and comments are reported
+	for input, expected := range map[string]string{
+		"SELECT 1;\nSELECT 'foo;":   "on line 2: unterminated quoted string or identifier starting with '",
+		`SELECT "foo;`:              `on line 1: unterminated quoted string or identifier starting with "`,
+		"SELECT $x$ foo; $y$;":      "on line 1: unterminated dollar-quoted string starting with $x$",
+		"SELECT 1 /* /* foo */;\n;": "on line 1: unterminated block comment",
+	} {
+		_, err := splitSQLStatements(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error %q for input %q, but got %v", expected, input, err)
+		}
+	}
+}
+
+func TestExecSQLStatementsWithLegacyFormat(t *testing.T) {
+	// this fake database only understands single-line statements, and knows no table "missing"
+	var executed []string
+	exec := func(query string) error {
+		if strings.Contains(query, "\n") {
+			return errors.New("syntax error")
+		}
+		if strings.Contains(query, "missing") {
+			return errors.New(`relation "missing" does not exist`)
+		}
+		executed = append(executed, query)
+		return nil
+	}
+
+	// files in the legacy format (one statement per line without semicolons) are still accepted
+	input := `INSERT INTO foo (id) VALUES (1)
+-- comment
+INSERT INTO foo (id) VALUES (2)
+INSERT INTO foo (id) VALUES (3);
+INSERT INTO foo (id) VALUES (4)`
+	stmts := must.ReturnT(splitSQLStatements(input))(t)
+	line, err := execSQLStatements(stmts, exec)
+	assert.DeepEqual(t, "error", err, nil)
+	assert.DeepEqual(t, "line", line, 0)
+	assert.DeepEqual(t, "executed statements", executed, []string{
+		"INSERT INTO foo (id) VALUES (1)",
+		"INSERT INTO foo (id) VALUES (2)",
+		"INSERT INTO foo (id) VALUES (3)",
+		"INSERT INTO foo (id) VALUES (4)",
+	})
+
+	// if the legacy interpretation also fails, the original error is reported with a hint
+	input = `INSERT INTO foo (id) VALUES (5);
+INSERT INTO foo (id) VALUES (6)
+INSERT INTO missing (id) VALUES (7)`
+	stmts = must.ReturnT(splitSQLStatements(input))(t)
+	line, err = execSQLStatements(stmts, exec)
+	assert.DeepEqual(t, "line", line, 2)
+	assert.DeepEqual(t, "error", err.Error(), "syntax error (note: statements need to be terminated by semicolons; "+
+		`executing this statement line by line like in the legacy format failed on line 3: relation "missing" does not exist)`)
+
+	// errors in single-line statements are reported as-is
+	line, err = execSQLStatements([]sqlStatement{{Text: "SELECT * FROM missing", Line: 5}}, exec)
+	assert.DeepEqual(t, "line", line, 5)
+	assert.DeepEqual(t, "error", err.Error(), `relation "missing" does not exist`)
+}
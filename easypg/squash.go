@@ -0,0 +1,381 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	url "net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sapcc/go-bits/sqlext"
+)
+
+// SquashMigrations replaces all migrations in the given Configuration up to
+// and including the given version with a single baseline migration of that
+// version, and returns the resulting Configuration. This is intended for
+// applications with long migration histories, where running all migrations
+// one by one makes test setup unreasonably slow.
+//
+// This function uses the test database server managed by func WithTestDB().
+// The baseline is generated by applying the original migrations up to the
+// given version to a scratch database and dumping it with pg_dump. The dump
+// includes both the schema and all rows that the squashed migrations have
+// inserted (e.g. into lookup tables), as well as the current values of all
+// sequences. Afterwards, the full set of original migrations and the full set
+// of squashed migrations are applied to two further scratch databases, and the
+// test fails if the resulting schemas or table contents are not equivalent.
+//
+// The intended workflow is to call this from a test in the application, and
+// write the baseline migration into the application's source code:
+//
+//	func TestSquashMigrations(t *testing.T) {
+//		cfg := easypg.SquashMigrations(t, myapp.DBConfiguration(), 200)
+//		baseline := cfg.Migrations["200_squashed_baseline.up.sql"]
+//		err := os.WriteFile("baseline.sql", []byte(baseline), 0666)
+//		if err != nil {
+//			t.Fatal(err.Error())
+//		}
+//	}
+//
+// If the given Configuration has migrations in MigrationsFS, the returned
+// Configuration will have all migrations in its Migrations field instead.
+// GoMigrations up to the given version are dropped from the returned
+// Configuration, since their effect on the schema is part of the baseline.
+//
+// The down migration of the baseline is the concatenation of the down
+// migrations that were squashed, in reverse order. If any of them is missing,
+// the baseline will not have a down migration.
+//
+// Squashing only works for migrations that have been applied by all existing
+// deployments: A database whose schema is at a version below the squashed
+// version cannot be migrated with the squashed Configuration anymore.
+func SquashMigrations(t TestingT, cfg Configuration, upToVersion uint) Configuration {
+	t.Helper()
+	if !hasTestDB {
+		t.Fatal("easypg.SquashMigrations() can only be used if easypg.WithTestDB() was called in TestMain (see docs on func WithTestDB for details)")
+	}
+
+	// sort migrations into those to be squashed and those to be kept
+	allMigrations, err := cfg.allMigrations()
+	failOnErr(t, err)
+	squashedCfg := cfg
+	squashedCfg.Migrations = make(map[string]string)
+	squashedCfg.MigrationsFS = nil
+	partialCfg := cfg
+	partialCfg.Migrations = make(map[string]string)
+	partialCfg.MigrationsFS = nil
+	// Go migrations up to the squashed version are subsumed by the baseline
+	partialCfg.GoMigrations = cfg.filterGoMigrations(func(version uint) bool { return version <= upToVersion })
+	squashedCfg.GoMigrations = cfg.filterGoMigrations(func(version uint) bool { return version > upToVersion })
+	downMigrations := make(map[uint]string)
+	for fileName, sqlText := range allMigrations {
+		version, direction, err := parseMigrationFileName(fileName)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if version > upToVersion {
+			squashedCfg.Migrations[fileName] = sqlText
+			continue
+		}
+		partialCfg.Migrations[fileName] = sqlText
+		if direction == "down" {
+			downMigrations[version] = sqlText
+		}
+	}
+	if len(partialCfg.Migrations) == 0 {
+		t.Fatalf("cannot squash migrations up to version %d: no such migrations found", upToVersion)
+	}
+
+	// generate baseline by dumping the database after applying the migrations to be squashed
+	baseName := normalizeDBName(t.Name())
+	dbName := baseName + "_squash_partial"
+	db := connectToFreshTestDB(t, dbName, partialCfg)
+	failOnErr(t, db.Close())
+	baselineUp := dumpDatabase(t, dbName)
+	squashedCfg.Migrations[fmt.Sprintf("%d_squashed_baseline.up.sql", upToVersion)] = baselineUp
+
+	var downVersions []uint
+	for version := range downMigrations {
+		downVersions = append(downVersions, version)
+	}
+	slices.Sort(downVersions)
+	slices.Reverse(downVersions)
+	if isCompleteDownChain(partialCfg.Migrations, downVersions) {
+		downSQL := make([]string, len(downVersions))
+		for idx, version := range downVersions {
+			downSQL[idx] = strings.TrimSuffix(strings.TrimSpace(downMigrations[version]), ";") + ";"
+		}
+		squashedCfg.Migrations[fmt.Sprintf("%d_squashed_baseline.down.sql", upToVersion)] = strings.Join(downSQL, "\n")
+	}
+
+	// verify that the squashed migrations produce the same schema and contents as the original ones
+	originalDB := connectToFreshTestDB(t, baseName+"_squash_original", cfg)
+	defer originalDB.Close()
+	squashedDB := connectToFreshTestDB(t, baseName+"_squash_result", squashedCfg)
+	defer squashedDB.Close()
+	diff := diffSchemaDescriptions(describeSchema(t, originalDB), describeSchema(t, squashedDB))
+	if len(diff) > 0 {
+		t.Fatalf("squashed migrations do not produce the same schema as the original migrations:\n\t%s", strings.Join(diff, "\n\t"))
+	}
+	diff = diffSchemaDescriptions(describeContents(t, originalDB), describeContents(t, squashedDB))
+	if len(diff) > 0 {
+		t.Fatalf("squashed migrations do not produce the same table contents as the original migrations:\n\t%s", strings.Join(diff, "\n\t"))
+	}
+
+	return squashedCfg
+}
+
+var migrationFileNameRx = regexp.MustCompile(`^([0-9]+)_.*\.(up|down)\.sql$`)
+
+func parseMigrationFileName(fileName string) (version uint, direction string, err error) {
+	match := migrationFileNameRx.FindStringSubmatch(fileName)
+	if match == nil {
+		return 0, "", fmt.Errorf("malformed migration file name: %q", fileName)
+	}
+	v, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed migration file name: %q: %w", fileName, err)
+	}
+	return uint(v), match[2], nil
+}
+
+// Checks whether each squashed up migration has a corresponding down migration.
+func isCompleteDownChain(migrations map[string]string, downVersions []uint) bool {
+	upCount := 0
+	for fileName := range migrations {
+		_, direction, _ := parseMigrationFileName(fileName) //nolint:errcheck // already checked by caller
+		if direction == "up" {
+			upCount++
+		}
+	}
+	return upCount == len(downVersions)
+}
+
+// Drops the given database if it exists, then connects to a new empty database
+// with that name and applies the given migrations.
+func connectToFreshTestDB(t TestingT, dbName string, cfg Configuration) *sql.DB {
+	t.Helper()
+	driverName := cfg.OverrideDriverName
+	if driverName == "" {
+		driverName = "postgres"
+	}
+	adminURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword("postgres", "postgres"),
+		Host:     fmt.Sprintf("127.0.0.1:%d", testDBPort(t)),
+		Path:     "/",
+		RawQuery: "sslmode=disable",
+	}
+	adminDB, err := sql.Open(driverName, adminURL.String())
+	failOnErr(t, err)
+	defer adminDB.Close()
+	registerTestDatabaseName(dbName)
+	_, err = adminDB.Exec(fmt.Sprintf(`DROP DATABASE IF EXISTS "%s"`, dbName))
+	failOnErr(t, err)
+
+	dbURL := adminURL
+	dbURL.Path = "/" + dbName
+	db, err := Connect(dbURL, cfg) // this also creates the database
+	if err != nil {
+		t.Fatalf("while applying migrations to %s: %s", dbName, err.Error())
+	}
+	return db
+}
+
+// Returns the schema and contents of the given database as SQL statements
+// that are suitable for use in a migration. Rows are dumped as INSERT
+// statements since the COPY statements that pg_dump generates by default read
+// from stdin, which is not possible within a migration.
+func dumpDatabase(t TestingT, dbName string) string {
+	t.Helper()
+	cmd := testDBClientCommand(t, "pg_dump", "--inserts", "--no-owner", "--no-privileges",
+		"--exclude-table=public.schema_migrations", "-U", "postgres", dbName,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("could not run pg_dump: %s (stderr: %q)", err.Error(), stderr.String())
+	}
+	result, err := cleanupSchemaDump(string(out))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return result
+}
+
+// Matches the psql meta-commands that pg_dump puts around the dump to guard
+// against malicious contents when restoring with psql.
+var pgDumpMetaCommandRx = regexp.MustCompile(`^\\(?:un)?restrict [A-Za-z0-9]+$`)
+
+// Removes everything from the output of pg_dump that is not suitable for
+// inclusion in a migration: the header and the comments that pg_dump puts
+// between statements, the psql meta-commands around the dump, and session
+// configuration (which would leak into the migration connection). Calls to
+// setval() for restoring sequences are kept. The statements themselves
+// (including function bodies and string literals spanning multiple lines) are
+// not modified.
+func cleanupSchemaDump(dump string) (string, error) {
+	// the meta-commands are not SQL, so they need to be removed before splitting
+	// the dump into statements; they only appear before the first and after the
+	// last statement
+	lines := strings.Split(dump, "\n")
+	for idx, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		if pgDumpMetaCommandRx.MatchString(trimmed) {
+			lines[idx] = ""
+		}
+		break
+	}
+	for idx := len(lines) - 1; idx >= 0; idx-- {
+		trimmed := strings.TrimSpace(lines[idx])
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		if pgDumpMetaCommandRx.MatchString(trimmed) {
+			lines[idx] = ""
+		}
+		break
+	}
+
+	// comments between statements are not included in the statements
+	stmts, err := splitSQLStatements(strings.Join(lines, "\n"))
+	if err != nil {
+		return "", fmt.Errorf("while parsing output of pg_dump: %w", err)
+	}
+	var result strings.Builder
+	for _, stmt := range stmts {
+		if strings.HasPrefix(stmt.Text, "SET ") || strings.HasPrefix(stmt.Text, "SELECT pg_catalog.set_config(") {
+			continue
+		}
+		result.WriteString(stmt.Text)
+		result.WriteString(";\n")
+	}
+	return result.String(), nil
+}
+
+// These queries describe all relevant parts of the schema in a canonical form,
+// one line per object. The "schema_migrations" table is excluded since the
+// squashed migrations will naturally result in different migration records.
+var describeSchemaQueries = []string{
+	`SELECT format('column %s.%s: %s, nullable = %s, default = %s', table_name, column_name, data_type, is_nullable, COALESCE(column_default, 'none'))
+	   FROM information_schema.columns WHERE table_schema = 'public' AND table_name != 'schema_migrations'
+	  ORDER BY table_name, ordinal_position`,
+	`SELECT format('constraint %s on %s: %s', conname, conrelid::regclass::text, pg_get_constraintdef(oid))
+	   FROM pg_constraint WHERE connamespace = 'public'::regnamespace AND conrelid != 'public.schema_migrations'::regclass
+	  ORDER BY 1`,
+	`SELECT format('index %s', indexdef) FROM pg_indexes
+	  WHERE schemaname = 'public' AND tablename != 'schema_migrations' ORDER BY 1`,
+	`SELECT format('view %s: %s', viewname, definition) FROM pg_views WHERE schemaname = 'public' ORDER BY 1`,
+	`SELECT format('sequence %s: %s, increment %s', sequence_name, data_type, increment)
+	   FROM information_schema.sequences WHERE sequence_schema = 'public' ORDER BY 1`,
+	`SELECT format('function %s', pg_get_functiondef(oid)) FROM pg_proc
+	  WHERE pronamespace = 'public'::regnamespace AND prokind IN ('f', 'p') ORDER BY 1`,
+	`SELECT format('trigger %s', pg_get_triggerdef(tg.oid)) FROM pg_trigger tg JOIN pg_class c ON c.oid = tg.tgrelid
+	  WHERE c.relnamespace = 'public'::regnamespace AND NOT tg.tgisinternal ORDER BY 1`,
+	`SELECT format('enum value %s.%s', t.typname, e.enumlabel) FROM pg_enum e JOIN pg_type t ON t.oid = e.enumtypid
+	  WHERE t.typnamespace = 'public'::regnamespace ORDER BY t.typname, e.enumsortorder`,
+}
+
+func describeSchema(t TestingT, db *sql.DB) []string {
+	t.Helper()
+	var result []string
+	for _, query := range describeSchemaQueries {
+		err := sqlext.ForeachRow(db, query, nil, func(rows *sql.Rows) error {
+			var line string
+			err := rows.Scan(&line)
+			result = append(result, line)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("while executing %q: %s", sqlext.SimplifyWhitespace(query), err.Error())
+		}
+	}
+	return result
+}
+
+// Describes the contents of all tables in the given database (except for
+// "schema_migrations"), one line per row.
+func describeContents(t TestingT, db *sql.DB) []string {
+	t.Helper()
+	var tableNames []string
+	err := sqlext.ForeachRow(db, describeContentsTablesQuery, nil, func(rows *sql.Rows) error {
+		var name string
+		err := rows.Scan(&name)
+		tableNames = append(tableNames, name)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("while listing tables: %s", err.Error())
+	}
+
+	var result []string
+	for _, tableName := range tableNames {
+		query := fmt.Sprintf(`SELECT format('row in %%s: %%s', %s, t::text) FROM %s t ORDER BY 1`,
+			quoteLiteral(tableName), quoteIdentifier(tableName))
+		err := sqlext.ForeachRow(db, query, nil, func(rows *sql.Rows) error {
+			var line string
+			err := rows.Scan(&line)
+			result = append(result, line)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("while reading contents of table %q: %s", tableName, err.Error())
+		}
+	}
+	return result
+}
+
+var describeContentsTablesQuery = sqlext.SimplifyWhitespace(`
+	SELECT table_name FROM information_schema.tables
+	 WHERE table_schema = 'public' AND table_type = 'BASE TABLE' AND table_name != 'schema_migrations'
+	 ORDER BY table_name
+`)
+
+// Compares two descriptions as multisets of lines, i.e. disregarding order,
+// but taking duplicate lines (e.g. identical rows) into account.
+func diffSchemaDescriptions(original, squashed []string) []string {
+	original = slices.Sorted(slices.Values(original))
+	squashed = slices.Sorted(slices.Values(squashed))
+
+	var missing, unexpected []string
+	for len(original) > 0 || len(squashed) > 0 {
+		switch {
+		case len(squashed) == 0 || (len(original) > 0 && original[0] < squashed[0]):
+			missing = append(missing, "missing in squashed schema: "+original[0])
+			original = original[1:]
+		case len(original) == 0 || squashed[0] < original[0]:
+			unexpected = append(unexpected, "unexpected in squashed schema: "+squashed[0])
+			squashed = squashed[1:]
+		default:
+			original = original[1:]
+			squashed = squashed[1:]
+		}
+	}
+	return append(missing, unexpected...)
+}
@@ -0,0 +1,131 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestParseMigrationFileName(t *testing.T) {
+	version, direction, err := parseMigrationFileName("042_add_things.down.sql")
+	assert.DeepEqual(t, "error", err, nil)
+	assert.DeepEqual(t, "version", version, uint(42))
+	assert.DeepEqual(t, "direction", direction, "down")
+
+	_, _, err = parseMigrationFileName("add_things.sql")
+	assert.DeepEqual(t, "error", err.Error(), `malformed migration file name: "add_things.sql"`)
+}
+
+func TestCleanupSchemaDump(t *testing.T) {
+	dump := `--
+-- PostgreSQL database dump
+--
+
+\restrict abcdef
+
+-- Dumped from database version 17.2
+-- Dumped by pg_dump version 17.2
+
+SET statement_timeout = 0;
+SELECT pg_catalog.set_config('search_path', '', false);
+
+--
+-- Name: count_things(); Type: FUNCTION; Schema: public; Owner: -
+--
+
+CREATE FUNCTION public.count_things() RETURNS bigint
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    -- this comment is part of the function body
+    RETURN (SELECT COUNT(*) FROM public.things);
+END;
+$$;
+
+--
+-- Name: things; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.things (
+    id bigint NOT NULL,
+    name text NOT NULL
+);
+
+INSERT INTO public.things VALUES (1, 'foo');
+INSERT INTO public.things VALUES (2, 'multi-line
+-- not a comment;
+SET not a statement;
+
+\restrict not a meta-command');
+
+SELECT pg_catalog.setval('public.things_id_seq', 2, true);
+
+ALTER TABLE ONLY public.things
+    ADD CONSTRAINT things_pkey PRIMARY KEY (id);
+
+--
+-- PostgreSQL database dump complete
+--
+
+\unrestrict abcdef
+
+`
+	expected := `CREATE FUNCTION public.count_things() RETURNS bigint
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    -- this comment is part of the function body
+    RETURN (SELECT COUNT(*) FROM public.things);
+END;
+$$;
+CREATE TABLE public.things (
+    id bigint NOT NULL,
+    name text NOT NULL
+);
+INSERT INTO public.things VALUES (1, 'foo');
+INSERT INTO public.things VALUES (2, 'multi-line
+-- not a comment;
+SET not a statement;
+
+\restrict not a meta-command');
+SELECT pg_catalog.setval('public.things_id_seq', 2, true);
+ALTER TABLE ONLY public.things
+    ADD CONSTRAINT things_pkey PRIMARY KEY (id);
+`
+	assert.DeepEqual(t, "cleaned dump", must.ReturnT(cleanupSchemaDump(dump))(t), expected)
+}
+
+func TestDiffSchemaDescriptions(t *testing.T) {
+	original := []string{"row in things: (1,foo)", "row in things: (2,bar)", "row in things: (2,bar)", "row in widgets: (1,baz)"}
+	assert.DeepEqual(t, "diff with reordered lines", diffSchemaDescriptions(original, []string{
+		"row in widgets: (1,baz)", "row in things: (2,bar)", "row in things: (1,foo)", "row in things: (2,bar)",
+	}), []string(nil))
+
+	// duplicate lines are counted, not just compared as a set
+	assert.DeepEqual(t, "diff with missing duplicate", diffSchemaDescriptions(original, []string{
+		"row in things: (1,foo)", "row in things: (2,bar)", "row in widgets: (1,baz)", "row in widgets: (1,baz)",
+	}), []string{
+		"missing in squashed schema: row in things: (2,bar)",
+		"unexpected in squashed schema: row in widgets: (1,baz)",
+	})
+}
@@ -23,11 +23,11 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
 
+	"github.com/sapcc/go-bits/internal"
 	"github.com/sapcc/go-bits/osext"
 )
 
@@ -40,14 +40,31 @@ type TestingT interface {
 }
 
 // AssertDBContent makes a dump of the database contents (as a sequence of
-// INSERT statements) and runs diff(1) against the given file, producing a test
-// error if these two are different from each other.
+// INSERT statements) and compares it against the given file, producing a test
+// error if these two are different from each other. The actual dump is written
+// into a file next to the fixture with the additional suffix ".actual".
+// See Assertable.AssertEqualToFile for how to update fixtures.
 func AssertDBContent(t TestingT, db *sql.DB, fixtureFile string) {
 	t.Helper()
 	_, a := NewTracker(t, db)
 	a.AssertEqualToFile(fixtureFile)
 }
 
+// AssertDBContentOfTables is like AssertDBContent, but only dumps the contents
+// of the given tables. This is useful when a test only cares about the effects
+// of a workflow on some tables, and the fixture shall not have to be updated
+// every time unrelated tables change.
+//
+//	easypg.AssertDBContentOfTables(t, db, "fixtures/after-sync.sql", "projects", "project_resources")
+func AssertDBContentOfTables(t TestingT, db *sql.DB, fixtureFile string, tableNames ...string) {
+	t.Helper()
+	if len(tableNames) == 0 {
+		t.Fatal("AssertDBContentOfTables called without any table names!")
+	}
+	snap := newDBSnapshot(t, db, tableNames...)
+	Assertable{t, snap.ToSQL(nil)}.AssertEqualToFile(fixtureFile)
+}
+
 // Tracker keeps a copy of the database contents and allows for checking the
 // database contents (or changes made to them) during tests.
 type Tracker struct {
@@ -97,21 +114,30 @@ type Assertable struct {
 
 // AssertEqualToFile compares the set of SQL statements to those in the given
 // file. A test error is generated in case of differences.
+//
+// If the environment variable GOBITS_UPDATE_FIXTURES is set to a true value,
+// the file is overwritten with the actual set of SQL statements instead.
 func (a Assertable) AssertEqualToFile(fixtureFile string) {
 	a.t.Helper()
 
-	// write actual content to file to make it easy to copy the computed result over
-	// to the fixture path when a new test is added or an existing one is modified
 	fixturePath, err := filepath.Abs(fixtureFile)
 	failOnErr(a.t, err)
+	if osext.GetenvBool("GOBITS_UPDATE_FIXTURES") {
+		failOnErr(a.t, os.WriteFile(fixturePath, []byte(a.payload), 0o666))
+		return
+	}
+
+	// write actual content to file to make it easy to copy the computed result over
+	// to the fixture path when a new test is added or an existing one is modified
 	actualPath := fixturePath + ".actual"
 	failOnErr(a.t, os.WriteFile(actualPath, []byte(a.payload), 0o666))
 
-	cmd := exec.Command("diff", "-u", fixturePath, actualPath)
-	cmd.Stdin = nil
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	failOnErr(a.t, cmd.Run())
+	expected, err := os.ReadFile(fixturePath)
+	failOnErr(a.t, err)
+	diff := internal.UnifiedDiff(fixturePath, actualPath, string(expected), a.payload)
+	if diff != "" {
+		a.t.Fatalf("SQL statements do not match %s (set GOBITS_UPDATE_FIXTURES=true to update it):\n%s", fixtureFile, diff)
+	}
 }
 
 var whitespaceAtStartOfLineRx = regexp.MustCompile(`(?m)^\s+`)
@@ -135,24 +161,8 @@ func (a Assertable) AssertEqual(expected string) {
 	}
 
 	// slow path: show a diff
-	tmpDir, err := os.MkdirTemp("", "easypg-diff")
-	failOnErr(a.t, err)
-	actualPath := filepath.Join(tmpDir, "/actual")
-	failOnErr(a.t, os.WriteFile(actualPath, []byte(actual), 0o666))
-	expectedPath := filepath.Join(tmpDir, "/expected")
-	failOnErr(a.t, os.WriteFile(expectedPath, []byte(expected), 0o666))
-
-	diffCmd := osext.GetenvOrDefault("GOBITS_DIFF_CMD", "diff")
-	diffCmdSlice := []string{}
-	if diffCmd == "diff" {
-		diffCmdSlice = append(diffCmdSlice, "-u", "--color=always")
-	}
-	diffCmdSlice = append(diffCmdSlice, expectedPath, actualPath)
-	cmd := exec.Command(diffCmd, diffCmdSlice...)
-	cmd.Stdin = nil
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	failOnErr(a.t, cmd.Run())
+	diff := internal.UnifiedDiff("expected", "actual", expected, actual)
+	a.t.Fatalf("SQL statements do not match:\n%s", diff)
 }
 
 // AssertEqualf is a shorthand for AssertEqual(fmt.Sprintf(...)).
@@ -0,0 +1,64 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+// A TestingT that records failures instead of failing the test.
+// Since execution continues after Fatal(), this can only be used with
+// functions that do not do anything else after reporting a failure.
+type recordingT struct {
+	failures []string
+}
+
+func (r *recordingT) Fatal(args ...any)                 { r.failures = append(r.failures, fmt.Sprint(args...)) }
+func (r *recordingT) Fatalf(format string, args ...any) { r.Fatal(fmt.Sprintf(format, args...)) }
+func (r *recordingT) Helper()                           {}
+func (r *recordingT) Name() string                      { return "TestRecording" }
+
+func TestAssertableAssertEqual(t *testing.T) {
+	var rt recordingT
+	a := Assertable{&rt, "INSERT INTO things (id, name) VALUES (1, 'foo');\n\nINSERT INTO things (id, name) VALUES (2, 'bar');\n"}
+
+	// whitespace differences are tolerated
+	a.AssertEqual(`
+		INSERT INTO things (id, name) VALUES (1, 'foo');
+		INSERT INTO things (id, name) VALUES (2, 'bar');
+	`)
+	assert.DeepEqual(t, "failures", rt.failures, []string(nil))
+
+	// other differences are reported with a diff
+	a.AssertEqual(`
+		INSERT INTO things (id, name) VALUES (1, 'foo');
+		INSERT INTO things (id, name) VALUES (2, 'baz');
+	`)
+	assert.DeepEqual(t, "failures", rt.failures, []string{
+		"SQL statements do not match:\n" +
+			"--- expected\n+++ actual\n@@ -1,2 +1,2 @@\n" +
+			" INSERT INTO things (id, name) VALUES (1, 'foo');\n" +
+			"-INSERT INTO things (id, name) VALUES (2, 'baz');\n" +
+			"+INSERT INTO things (id, name) VALUES (2, 'bar');\n",
+	})
+}
@@ -0,0 +1,141 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"database/sql"
+	"fmt"
+	url "net/url"
+)
+
+type schemaMigration struct {
+	SchemaName string
+	Config     Configuration
+}
+
+type foreignSchemaImport struct {
+	DatabaseName string
+	RemoteSchema string
+	LocalSchema  string
+}
+
+// MigrateSchema is a TestSetupOption that creates an additional schema with
+// the given name in the test database (if it does not exist yet), and applies
+// the migrations from the given Configuration inside of it. This is useful for
+// testing applications that join across multiple schemas in production.
+//
+// Tables in the additional schema need to be referenced with qualified names
+// (e.g. `SELECT * FROM billing.invoices`) through the *sql.DB returned by
+// ConnectForTest(), since the search path of that connection is not changed.
+//
+// This executes directly after connecting, before any of the other setup options.
+func MigrateSchema(schemaName string, cfg Configuration) TestSetupOption {
+	return func(params *testSetupParams) {
+		params.schemasToMigrate = append(params.schemasToMigrate, schemaMigration{schemaName, cfg})
+	}
+}
+
+// ImportForeignSchema is a TestSetupOption that makes the tables from
+// `remoteSchema` in a different test database visible in the schema
+// `localSchema` of this test's database, by way of the postgres_fdw extension.
+// This is useful for testing applications that access a second database
+// through a foreign data wrapper in production.
+//
+// The other database must have been prepared beforehand by calling
+// ConnectForTest() with OverrideDatabaseName(databaseName). For example:
+//
+//	identityDB := easypg.ConnectForTest(t, identityConfig,
+//		easypg.OverrideDatabaseName(t.Name()+"_identity"),
+//		easypg.LoadSQLFile("fixtures/identity.sql"),
+//	)
+//	db := easypg.ConnectForTest(t, config,
+//		easypg.ImportForeignSchema(t.Name()+"_identity", "public", "identity"),
+//	)
+//
+// The local schema is recreated from scratch each time, so it should not
+// contain anything besides the imported foreign tables.
+//
+// This executes directly after connecting (and after any MigrateSchema()
+// options), before any of the other setup options.
+func ImportForeignSchema(databaseName, remoteSchema, localSchema string) TestSetupOption {
+	return func(params *testSetupParams) {
+		params.foreignSchemasToImport = append(params.foreignSchemasToImport, foreignSchemaImport{
+			DatabaseName: normalizeDBName(databaseName),
+			RemoteSchema: remoteSchema,
+			LocalSchema:  localSchema,
+		})
+	}
+}
+
+func (m schemaMigration) Execute(db *sql.DB, dbURL url.URL) error {
+	_, err := db.Exec(`CREATE SCHEMA IF NOT EXISTS ` + quoteIdentifier(m.SchemaName))
+	if err != nil {
+		return fmt.Errorf("while creating schema %q: %w", m.SchemaName, err)
+	}
+
+	// the migrations are applied through a separate connection whose search
+	// path points to the new schema, so that unqualified table names in the
+	// migrations (and the "schema_migrations" table) end up in that schema
+	schemaDB, err := Connect(urlWithSearchPath(dbURL, m.SchemaName), m.Config)
+	if err != nil {
+		return fmt.Errorf("while migrating schema %q: %w", m.SchemaName, err)
+	}
+	return schemaDB.Close()
+}
+
+func urlWithSearchPath(dbURL url.URL, schemaName string) url.URL {
+	query := dbURL.Query()
+	query.Set("search_path", schemaName)
+	dbURL.RawQuery = query.Encode()
+	return dbURL
+}
+
+func (i foreignSchemaImport) Execute(db *sql.DB) error {
+	// postgres_fdw connects from within the server, so we need the port that the
+	// server listens on locally, not the one that the test connects to (those
+	// differ e.g. when the server runs in a container with a published port)
+	var port int
+	err := db.QueryRow(`SELECT setting::integer FROM pg_settings WHERE name = 'port'`).Scan(&port)
+	if err != nil {
+		return fmt.Errorf("while importing schema %q from database %q: cannot find server port: %w", i.RemoteSchema, i.DatabaseName, err)
+	}
+
+	for _, stmt := range i.statements(port) {
+		_, err := db.Exec(stmt)
+		if err != nil {
+			return fmt.Errorf("while importing schema %q from database %q: %w", i.RemoteSchema, i.DatabaseName, err)
+		}
+	}
+	return nil
+}
+
+func (i foreignSchemaImport) statements(port int) []string {
+	server := quoteIdentifier("gobits_fdw_" + i.DatabaseName)
+	localSchema := quoteIdentifier(i.LocalSchema)
+	return []string{
+		`CREATE EXTENSION IF NOT EXISTS postgres_fdw`,
+		fmt.Sprintf(`CREATE SERVER IF NOT EXISTS %s FOREIGN DATA WRAPPER postgres_fdw OPTIONS (host '127.0.0.1', port '%d', dbname %s)`,
+			server, port, quoteLiteral(i.DatabaseName)),
+		fmt.Sprintf(`CREATE USER MAPPING IF NOT EXISTS FOR CURRENT_USER SERVER %s OPTIONS (user 'postgres', password 'postgres')`, server),
+		fmt.Sprintf(`DROP SCHEMA IF EXISTS %s CASCADE`, localSchema),
+		fmt.Sprintf(`CREATE SCHEMA %s`, localSchema),
+		fmt.Sprintf(`IMPORT FOREIGN SCHEMA %s FROM SERVER %s INTO %s`, quoteIdentifier(i.RemoteSchema), server, localSchema),
+	}
+}
@@ -0,0 +1,152 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/must"
+	"github.com/sapcc/go-bits/osext"
+)
+
+const (
+	// "local" or "container" (if empty, "local" is used if initdb and pg_ctl are available, "container" otherwise)
+	testDBBackendEnvVar = "GOBITS_TESTDB_BACKEND"
+	// the container image for the "container" backend
+	testDBImageEnvVar  = "GOBITS_TESTDB_IMAGE"
+	defaultTestDBImage = "docker.io/library/postgres:17-alpine"
+	// the container runtime for the "container" backend (if empty, "docker" or "podman" is used, whichever is available)
+	testDBContainerRuntimeEnvVar = "GOBITS_TESTDB_CONTAINER_RUNTIME"
+)
+
+// If WithTestDB() runs the database server in a container, this contains the command prefix
+// for executing commands within that container, e.g. {"docker", "exec", "gobits-testdb-12345"}.
+var testDBContainerExecPrefix []string
+
+// Decides whether WithTestDB() shall run the database server in a container.
+func useContainerForTestDB() (bool, error) {
+	switch backend := os.Getenv(testDBBackendEnvVar); backend {
+	case "local":
+		return false, nil
+	case "container":
+		return true, nil
+	case "":
+		for _, tool := range []string{"initdb", "pg_ctl"} {
+			if _, err := exec.LookPath(tool); err != nil {
+				logg.Info("running test database in a container because %s is not installed", tool)
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf(`invalid value for $%s: expected "local" or "container", but got %q`, testDBBackendEnvVar, backend)
+	}
+}
+
+func findContainerRuntime() (string, error) {
+	if runtime := os.Getenv(testDBContainerRuntimeEnvVar); runtime != "" {
+		return runtime, nil
+	}
+	for _, runtime := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(runtime); err == nil {
+			return runtime, nil
+		}
+	}
+	return "", errors.New("cannot run test database: neither initdb/pg_ctl nor a container runtime (docker or podman) is installed")
+}
+
+// The alternative implementation of WithTestDB() that uses a disposable container.
+func withContainerizedTestDB(action func() int) int {
+	runtime := must.Return(findContainerRuntime())
+	image := osext.GetenvOrDefault(testDBImageEnvVar, defaultTestDBImage)
+	containerName := fmt.Sprintf("gobits-testdb-%d", os.Getpid())
+
+	// start container (the container is removed automatically once it is stopped)
+	port := must.Return(findFreePort())
+	cmd := exec.Command(runtime, "run", "--rm", "--detach", //nolint:gosec // rule G204 is overly broad
+		"--name", containerName,
+		"--publish", fmt.Sprintf("127.0.0.1:%d:5432", port),
+		"--env", "POSTGRES_HOST_AUTH_METHOD=trust",
+		image,
+	)
+	cmd.Stdin = nil
+	cmd.Stdout = nil // would only contain the container ID
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		logg.Fatal("could not start test database container with %s: %s", runtime, err.Error())
+	}
+	testDBContainerExecPrefix = []string{runtime, "exec", containerName}
+
+	// wait for database server to accept connections (we need to check the TCP
+	// listener specifically: during its first start, the container runs a
+	// temporary server for initialization that only listens on a Unix socket)
+	err = waitForContainerizedTestDB()
+	if err == nil {
+		must.Succeed(os.Setenv(testDBPortEnvVar, strconv.Itoa(port)))
+	}
+
+	// run tests
+	exitCode := 1
+	if err == nil {
+		hasTestDB = true
+		exitCode = action()
+		hasTestDB = false
+	} else {
+		logg.Error(err.Error())
+	}
+
+	// stop container (regardless of whether tests succeeded or failed!)
+	cmd = exec.Command(runtime, "stop", containerName) //nolint:gosec // rule G204 is overly broad
+	cmd.Stdin = nil
+	cmd.Stdout = nil // would only contain the container name
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		logg.Fatal("could not stop test database container with %s: %s", runtime, err.Error())
+	}
+
+	return exitCode
+}
+
+func waitForContainerizedTestDB() error {
+	const timeout = 60 * time.Second
+	deadline := time.Now().Add(timeout)
+	for {
+		args := slices.Concat(testDBContainerExecPrefix[1:], []string{"pg_isready", "--quiet", "-h", "127.0.0.1", "-U", "postgres"})
+		output, err := exec.Command(testDBContainerExecPrefix[0], args...).CombinedOutput() //nolint:gosec // rule G204 is overly broad
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("test database container did not become ready within %s: %w (output: %q)",
+				timeout, err, strings.TrimSpace(string(output)))
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
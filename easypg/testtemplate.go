@@ -0,0 +1,154 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	url "net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sapcc/go-bits/sqlext"
+)
+
+var (
+	// names of template databases that have been verified to exist within this process
+	readyTemplateDatabases   = make(map[string]bool)
+	readyTemplateDatabasesMu sync.Mutex
+)
+
+// Called by ConnectForTest() before connecting to the test database.
+// If the test database does not exist yet, it is created as a copy of a template database
+// that has all migrations applied already. This is much faster than applying all migrations
+// in each test database separately, esp. for applications with a long migration history.
+func prepareTestDatabase(dbURL url.URL, dbName string, cfg Configuration) error {
+	driverName := cfg.OverrideDriverName
+	if driverName == "" {
+		driverName = "postgres"
+	}
+	adminURL := dbURL
+	adminURL.Path = "/"
+	adminDB, err := sql.Open(driverName, adminURL.String())
+	if err != nil {
+		return fmt.Errorf("while connecting to Postgres: %w", err)
+	}
+	defer adminDB.Close()
+
+	exists, err := databaseExists(adminDB, dbName)
+	if err != nil || exists {
+		return err
+	}
+
+	templateName, err := ensureTemplateDatabase(adminDB, dbURL, cfg)
+	if err != nil {
+		return fmt.Errorf("while preparing template database: %w", err)
+	}
+	_, err = adminDB.Exec(fmt.Sprintf(`CREATE DATABASE "%s" TEMPLATE "%s"`, dbName, templateName))
+	if err != nil {
+		return fmt.Errorf("while creating database %q from template %q: %w", dbName, templateName, err)
+	}
+	return nil
+}
+
+// Returns the name of the template database for the given configuration, and creates it if it does not exist yet.
+//
+// The name of the template database contains a hash of all SQL migrations and
+// of the versions of all Go migrations, so a new template database is created
+// automatically whenever the migrations change. Since the code of Go migrations
+// cannot be hashed, changing the body of a Go migration does not produce a new
+// template database; it needs to be moved to a new version number instead.
+func ensureTemplateDatabase(adminDB *sql.DB, dbURL url.URL, cfg Configuration) (string, error) {
+	migrations, err := cfg.allMigrations()
+	if err != nil {
+		return "", err
+	}
+	templateName := templateDatabaseName(migrations, slices.Sorted(maps.Keys(cfg.GoMigrations)))
+	tmpName := templateName + "_tmp"
+	registerTestDatabaseName(templateName)
+	registerTestDatabaseName(tmpName)
+
+	readyTemplateDatabasesMu.Lock()
+	defer readyTemplateDatabasesMu.Unlock()
+	if readyTemplateDatabases[templateName] {
+		return templateName, nil
+	}
+
+	// the template database might persist from an earlier test run
+	exists, err := databaseExists(adminDB, templateName)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		// to avoid leaving a half-migrated template behind when the test run
+		// gets interrupted, the template is created under a temporary name first
+		_, err = adminDB.Exec(fmt.Sprintf(`DROP DATABASE IF EXISTS "%s"`, tmpName))
+		if err != nil {
+			return "", err
+		}
+		tmpURL := dbURL
+		tmpURL.Path = "/" + tmpName
+		db, err := Connect(tmpURL, cfg)
+		if err != nil {
+			return "", err
+		}
+		err = db.Close()
+		if err != nil {
+			return "", err
+		}
+		_, err = adminDB.Exec(fmt.Sprintf(`ALTER DATABASE "%s" RENAME TO "%s"`, tmpName, templateName))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	readyTemplateDatabases[templateName] = true
+	return templateName, nil
+}
+
+func templateDatabaseName(migrations map[string]string, goMigrationVersions []uint) string {
+	hash := sha256.New()
+	for _, name := range slices.Sorted(maps.Keys(migrations)) {
+		// the NUL bytes ensure that the boundaries between names and contents are unambiguous
+		fmt.Fprintf(hash, "%s\x00%s\x00", name, strings.TrimSpace(migrations[name]))
+	}
+	for _, version := range goMigrationVersions {
+		// the "go:" prefix cannot occur in migration file names, so this cannot collide with the SQL migrations
+		fmt.Fprintf(hash, "go:%d\x00", version)
+	}
+	return "gobits_template_" + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+var databaseExistsQuery = sqlext.SimplifyWhitespace(`
+	SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)
+`)
+
+func databaseExists(adminDB *sql.DB, dbName string) (bool, error) {
+	var exists bool
+	err := adminDB.QueryRow(databaseExistsQuery, dbName).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("while checking if database %q exists: %w", dbName, err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,58 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestTemplateDatabaseName(t *testing.T) {
+	migrations := map[string]string{
+		"001_initial.up.sql":   "CREATE TABLE foo (id BIGSERIAL NOT NULL PRIMARY KEY);",
+		"001_initial.down.sql": "DROP TABLE foo;",
+	}
+	name := templateDatabaseName(migrations, nil)
+	if !regexp.MustCompile(`^gobits_template_[0-9a-f]{16}$`).MatchString(name) {
+		t.Errorf("unexpected template database name: %q", name)
+	}
+
+	// surrounding whitespace does not matter, since it is stripped before the migrations are applied
+	migrations["001_initial.down.sql"] = "\n\tDROP TABLE foo;\n"
+	if actual := templateDatabaseName(migrations, nil); actual != name {
+		t.Errorf("expected template database name to stay at %q, but got %q", name, actual)
+	}
+
+	// any actual change to the migrations produces a new template database
+	migrations["002_add_bar.up.sql"] = "CREATE TABLE bar (id BIGSERIAL NOT NULL PRIMARY KEY);"
+	if actual := templateDatabaseName(migrations, nil); actual == name {
+		t.Errorf("expected template database name to change, but got %q again", actual)
+	}
+
+	// adding a Go migration produces a new template database as well
+	name = templateDatabaseName(migrations, nil)
+	nameWithGo := templateDatabaseName(migrations, []uint{3})
+	if nameWithGo == name {
+		t.Errorf("expected template database name to change when adding a Go migration, but got %q again", nameWithGo)
+	}
+	if actual := templateDatabaseName(migrations, []uint{4}); actual == nameWithGo {
+		t.Errorf("expected template database name to change when moving a Go migration to a new version, but got %q again", actual)
+	}
+}
@@ -0,0 +1,62 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/sapcc/go-bits/sqlext"
+)
+
+// WithTransaction runs `action` inside a transaction, and commits the
+// transaction if `action` returns no error. If `action` returns an error or
+// panics, the transaction is rolled back instead, and the error (or panic) is
+// passed on to the caller. Failures during rollback are logged, but not
+// returned since the original error is usually more relevant.
+//
+//	err := easypg.WithTransaction(ctx, db, func(tx *sql.Tx) error {
+//		_, err := tx.ExecContext(ctx, `DELETE FROM projects WHERE id = $1`, projectID)
+//		if err != nil {
+//			return err
+//		}
+//		_, err = tx.ExecContext(ctx, `INSERT INTO audit_log (project_id) VALUES ($1)`, projectID)
+//		return err
+//	})
+//
+// Use RetrySerializable() instead if the transaction needs isolation level
+// SERIALIZABLE.
+func WithTransaction(ctx context.Context, db *sql.DB, action func(*sql.Tx) error) error {
+	return runTransaction(ctx, db, nil, action)
+}
+
+func runTransaction(ctx context.Context, db *sql.DB, txOpts *sql.TxOptions, action func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer sqlext.RollbackUnlessCommitted(tx)
+
+	err = action(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,97 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package easypg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+// A database/sql driver that does not support any queries, and only records
+// which transaction operations were executed.
+type txRecordingDriver struct {
+	events []string
+}
+
+func (d *txRecordingDriver) Open(string) (driver.Conn, error) { return txRecordingConn{d}, nil }
+
+// txRecordingDriver also implements driver.Connector, so that it can be used with sql.OpenDB()
+// without having to be registered globally (which panics when the test runs multiple times).
+func (d *txRecordingDriver) Connect(context.Context) (driver.Conn, error) { return d.Open("") }
+func (d *txRecordingDriver) Driver() driver.Driver                        { return d }
+
+type txRecordingConn struct{ d *txRecordingDriver }
+
+func (c txRecordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c txRecordingConn) Close() error {
+	c.d.events = append(c.d.events, "CLOSE")
+	return nil
+}
+func (c txRecordingConn) Begin() (driver.Tx, error) {
+	c.d.events = append(c.d.events, "BEGIN")
+	return txRecordingTx(c), nil
+}
+
+type txRecordingTx struct{ d *txRecordingDriver }
+
+func (t txRecordingTx) Commit() error {
+	t.d.events = append(t.d.events, "COMMIT")
+	return nil
+}
+func (t txRecordingTx) Rollback() error {
+	t.d.events = append(t.d.events, "ROLLBACK")
+	return nil
+}
+
+func TestWithTransaction(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	d := &txRecordingDriver{}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	// success -> commit
+	err := WithTransaction(ctx, db, func(tx *sql.Tx) error { return nil })
+	assert.DeepEqual(t, "error", err, nil)
+	assert.DeepEqual(t, "events", d.events, []string{"BEGIN", "COMMIT"})
+
+	// error -> rollback, and error is passed on
+	d.events = nil
+	actionErr := errors.New("datacenter on fire")
+	err = WithTransaction(ctx, db, func(tx *sql.Tx) error { return actionErr })
+	assert.DeepEqual(t, "error", err, actionErr)
+	assert.DeepEqual(t, "events", d.events, []string{"BEGIN", "ROLLBACK"})
+
+	// panic -> rollback, and panic is passed on
+	d.events = nil
+	func() {
+		defer func() {
+			assert.DeepEqual(t, "recovered panic", recover(), any("datacenter on fire"))
+		}()
+		_ = WithTransaction(ctx, db, func(tx *sql.Tx) error { panic("datacenter on fire") })
+	}()
+	assert.DeepEqual(t, "events", d.events, []string{"BEGIN", "ROLLBACK"})
+}
@@ -20,10 +20,14 @@
 package easypg
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
 
 	"github.com/sapcc/go-api-declarations/bininfo"
 )
@@ -31,13 +35,24 @@ import (
 // URLParts contains the arguments for func URLFrom(), see documentation over
 // there.
 type URLParts struct {
-	HostName               string            // required
+	HostName               string            // required (unless SocketDirectory or ServiceName is given)
+	SocketDirectory        string            // optional (absolute path of the directory containing the Unix socket of the server, e.g. "/var/run/postgresql"; cannot be combined with HostName)
+	ServiceName            string            // optional (name of a service definition in pg_service.conf; only supported by the pgx driver, see const PgxDriverName)
 	Port                   string            // optional (default value = 5432 for postgres:// scheme)
 	UserName               string            // required
 	Password               string            // optional
+	PasswordFile           string            // optional (path to a file containing the password, e.g. a mounted secret; cannot be combined with Password)
 	ConnectionOptions      string            // optional (usually used for options coming in via config)
 	ExtraConnectionOptions map[string]string // optional (usually used for options coming in via code)
 	DatabaseName           string            // required
+
+	// Optional paths to files for TLS. These are put into the connection options
+	// "sslcert", "sslkey" and "sslrootcert", respectively. SSLCertFile and
+	// SSLKeyFile must be given together. To have the server certificate verified
+	// against SSLRootCertFile, set "sslmode=verify-full" in the connection options.
+	SSLCertFile     string
+	SSLKeyFile      string
+	SSLRootCertFile string
 }
 
 // This will be modified during unit tests to replace os.Hostname() with a test double.
@@ -56,6 +71,9 @@ var osHostname = os.Hostname
 //	}))
 //	db := must.Return(easypg.Connect(dbURL, easypg.Configuration{ ... }))
 //
+// All files referenced in URLParts must exist. The password from PasswordFile
+// is read once when URLFrom() is called, with trailing newlines removed.
+//
 // We provide URLFrom() as a separate function, instead of just putting the
 // fields of URLParts into the Configuration struct, to accommodate applications
 // that may want to accept a fully-formed postgres:// URL from outside instead
@@ -77,21 +95,302 @@ func URLFrom(parts URLParts) (url.URL, error) {
 		connOpts.Set(k, v)
 	}
 
+	err = parts.applyTLSOptions(connOpts)
+	if err != nil {
+		return url.URL{}, err
+	}
+	password, err := parts.getPassword()
+	if err != nil {
+		return url.URL{}, err
+	}
+	err = parts.applyHostOptions(connOpts)
+	if err != nil {
+		return url.URL{}, err
+	}
+
 	result := url.URL{
 		Scheme:   "postgres",
 		Host:     parts.HostName,
-		Path:     parts.DatabaseName,
+		Path:     "/" + strings.TrimPrefix(parts.DatabaseName, "/"),
 		RawQuery: connOpts.Encode(),
 	}
 
-	if parts.Password == "" {
+	if password == "" {
 		result.User = url.User(parts.UserName)
 	} else {
-		result.User = url.UserPassword(parts.UserName, parts.Password)
+		result.User = url.UserPassword(parts.UserName, password)
 	}
-	if parts.Port != "" {
+	if parts.Port != "" && parts.HostName != "" {
 		result.Host = net.JoinHostPort(parts.HostName, parts.Port)
 	}
 
 	return result, nil
 }
+
+// When connecting through a Unix socket or a service definition, there is no
+// host name for the URL, so the respective settings go into the connection options.
+func (parts URLParts) applyHostOptions(connOpts url.Values) error {
+	switch {
+	case parts.SocketDirectory != "" && parts.HostName != "":
+		return errors.New("invalid DB connection parameters: HostName and SocketDirectory cannot be given at the same time")
+	case parts.SocketDirectory != "" && !filepath.IsAbs(parts.SocketDirectory):
+		return fmt.Errorf("invalid DB connection parameters: SocketDirectory must be an absolute path, but is %q", parts.SocketDirectory)
+	case parts.HostName == "" && parts.SocketDirectory == "" && parts.ServiceName == "":
+		return errors.New("invalid DB connection parameters: one of HostName, SocketDirectory or ServiceName must be given")
+	}
+
+	if parts.SocketDirectory != "" {
+		connOpts.Set("host", parts.SocketDirectory)
+	}
+	if parts.ServiceName != "" {
+		connOpts.Set("service", parts.ServiceName)
+	}
+	if parts.HostName == "" && parts.Port != "" {
+		connOpts.Set("port", parts.Port)
+	}
+	return nil
+}
+
+// URLFromDSN is like URLFrom, but takes a connection string in the libpq
+// keyword/value format, as it is commonly used in configuration files and by
+// tools like pgbouncer. For example:
+//
+//	dbURL, err := easypg.URLFromDSN("host=/var/run/postgresql port=6432 dbname=foobar user=foobar sslmode=disable")
+//
+// The keywords "host", "port", "user", "password" and "dbname" are mapped to
+// the respective fields of URLParts (a host starting with a slash is mapped to
+// SocketDirectory), and "service" is mapped to ServiceName. If "passfile" is
+// given and "password" is not, the password is looked up in that file, which
+// must be in the .pgpass format described at
+// <https://www.postgresql.org/docs/current/libpq-pgpass.html>. If no entry
+// matches, no password is used. All other keywords are passed through as
+// connection options. Like with
+// URLFrom, the "application_name" option is filled automatically unless
+// given explicitly.
+//
+// See <https://www.postgresql.org/docs/current/libpq-connect.html#LIBPQ-CONNSTRING-KEYWORD-VALUE>
+// for the syntax.
+func URLFromDSN(dsn string) (url.URL, error) {
+	options, err := parseKeywordValueDSN(dsn)
+	if err != nil {
+		return url.URL{}, fmt.Errorf("cannot parse DB connection string: %w", err)
+	}
+
+	var (
+		parts    URLParts
+		passfile string
+	)
+	fields := map[string]*string{
+		"port":     &parts.Port,
+		"user":     &parts.UserName,
+		"password": &parts.Password,
+		"passfile": &passfile,
+		"dbname":   &parts.DatabaseName,
+		"service":  &parts.ServiceName,
+	}
+	for key, value := range options {
+		if key == "host" {
+			if strings.HasPrefix(value, "/") {
+				parts.SocketDirectory = value
+			} else {
+				parts.HostName = value
+			}
+		} else if field, ok := fields[key]; ok {
+			*field = value
+		} else {
+			if parts.ExtraConnectionOptions == nil {
+				parts.ExtraConnectionOptions = make(map[string]string)
+			}
+			parts.ExtraConnectionOptions[key] = value
+		}
+	}
+
+	if passfile != "" && parts.Password == "" {
+		parts.Password, err = passwordFromPassfile(passfile, parts)
+		if err != nil {
+			return url.URL{}, err
+		}
+	}
+	return URLFrom(parts)
+}
+
+// Returns the password from the first matching entry in a file in the .pgpass
+// format, or "" if no entry matches.
+func passwordFromPassfile(path string, parts URLParts) (string, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid DB connection parameters: cannot read passfile: %w", err)
+	}
+
+	// fill in the same defaults that libpq uses for matching
+	host := parts.HostName
+	if host == "" {
+		host = "localhost"
+	}
+	port := parts.Port
+	if port == "" {
+		port = "5432"
+	}
+	dbName := parts.DatabaseName
+	if dbName == "" {
+		dbName = parts.UserName
+	}
+	wanted := []string{host, port, dbName, parts.UserName}
+
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitPassfileLine(line)
+		if len(fields) != 5 {
+			continue // malformed lines are ignored, like in libpq
+		}
+		isMatch := true
+		for idx, value := range wanted {
+			if fields[idx] != "*" && fields[idx] != value {
+				isMatch = false
+				break
+			}
+		}
+		if isMatch {
+			return fields[4], nil
+		}
+	}
+	return "", nil
+}
+
+// Splits a line from a .pgpass file at colons, with backslash escaping the next character.
+func splitPassfileLine(line string) []string {
+	var (
+		fields  []string
+		current strings.Builder
+	)
+	input := []rune(line)
+	for pos := 0; pos < len(input); pos++ {
+		switch c := input[pos]; {
+		case c == '\\' && pos+1 < len(input):
+			pos++
+			current.WriteRune(input[pos])
+		case c == ':':
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	return append(fields, current.String())
+}
+
+// Parses a libpq connection string in keyword/value format like "host=localhost dbname='my db'".
+func parseKeywordValueDSN(dsn string) (map[string]string, error) {
+	result := make(map[string]string)
+	input := []rune(dsn)
+	pos := 0
+	skipSpaces := func() {
+		for pos < len(input) && unicode.IsSpace(input[pos]) {
+			pos++
+		}
+	}
+
+	for {
+		skipSpaces()
+		if pos >= len(input) {
+			return result, nil
+		}
+
+		// read keyword
+		start := pos
+		for pos < len(input) && input[pos] != '=' && !unicode.IsSpace(input[pos]) {
+			pos++
+		}
+		keyword := string(input[start:pos])
+		skipSpaces()
+		if pos >= len(input) || input[pos] != '=' {
+			return nil, fmt.Errorf("missing \"=\" after %q", keyword)
+		}
+		pos++ // skip '='
+		skipSpaces()
+
+		// read value (either single-quoted, or up to the next whitespace; backslash escapes the next character)
+		var value strings.Builder
+		quoted := pos < len(input) && input[pos] == '\''
+		if quoted {
+			pos++
+		}
+		for {
+			if pos >= len(input) {
+				if quoted {
+					return nil, fmt.Errorf("unterminated quoted value for %q", keyword)
+				}
+				break
+			}
+			c := input[pos]
+			if quoted && c == '\'' {
+				pos++
+				break
+			}
+			if !quoted && unicode.IsSpace(c) {
+				break
+			}
+			if c == '\\' && pos+1 < len(input) {
+				pos++
+				c = input[pos]
+			}
+			value.WriteRune(c)
+			pos++
+		}
+		result[keyword] = value.String()
+	}
+}
+
+func (parts URLParts) applyTLSOptions(connOpts url.Values) error {
+	if (parts.SSLCertFile == "") != (parts.SSLKeyFile == "") {
+		return errors.New("invalid DB connection parameters: SSLCertFile and SSLKeyFile must be given together")
+	}
+
+	fileOpts := []struct {
+		Field  string
+		Option string
+		Path   string
+	}{
+		{"SSLCertFile", "sslcert", parts.SSLCertFile},
+		{"SSLKeyFile", "sslkey", parts.SSLKeyFile},
+		{"SSLRootCertFile", "sslrootcert", parts.SSLRootCertFile},
+	}
+	for _, opt := range fileOpts {
+		if opt.Path == "" {
+			continue
+		}
+		if connOpts.Has(opt.Option) {
+			return fmt.Errorf("invalid DB connection parameters: %s conflicts with %q in the connection options", opt.Field, opt.Option)
+		}
+		if connOpts.Get("sslmode") == "disable" {
+			return fmt.Errorf("invalid DB connection parameters: %s cannot be used with sslmode=disable", opt.Field)
+		}
+		_, err := os.Stat(opt.Path)
+		if err != nil {
+			return fmt.Errorf("invalid DB connection parameters: cannot use %s: %w", opt.Field, err)
+		}
+		connOpts.Set(opt.Option, opt.Path)
+	}
+	return nil
+}
+
+func (parts URLParts) getPassword() (string, error) {
+	if parts.PasswordFile == "" {
+		return parts.Password, nil
+	}
+	if parts.Password != "" {
+		return "", errors.New("invalid DB connection parameters: Password and PasswordFile cannot be given at the same time")
+	}
+	buf, err := os.ReadFile(parts.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("invalid DB connection parameters: cannot read PasswordFile: %w", err)
+	}
+	password := strings.TrimRight(string(buf), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("invalid DB connection parameters: PasswordFile %s is empty", parts.PasswordFile)
+	}
+	return password, nil
+}
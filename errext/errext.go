@@ -20,7 +20,10 @@
 // Package errext contains convenience functions for handling and propagating errors.
 package errext
 
-import "errors"
+import (
+	"errors"
+	"iter"
+)
 
 // As is a variant of errors.As() that leverages generics to present a nicer interface.
 //
@@ -50,3 +53,67 @@ func IsOfType[T error](err error) bool {
 	_, ok := As[T](err)
 	return ok
 }
+
+// Flatten returns the individual errors contained in an error that was built
+// by errors.Join() or ErrorSet.JoinedError(), or in general, any error that
+// implements the `Unwrap() []error` interface. Nested joined errors are
+// flattened recursively. Errors that wrap only a single error (e.g. by
+// fmt.Errorf() with a single %w verb) are not unwrapped, since their message
+// contains relevant context.
+//
+//	err := errors.Join(err1, errors.Join(err2, err3))
+//	errs := errext.Flatten(err) // returns []error{err1, err2, err3}
+//
+// If err is nil, nil is returned. Otherwise, the result can be used as an
+// ErrorSet to further process the individual errors.
+func Flatten(err error) []error {
+	if err == nil {
+		return nil
+	}
+	multi, ok := err.(interface{ Unwrap() []error }) //nolint:errorlint // we are implementing unwrapping ourselves
+	if !ok {
+		return []error{err}
+	}
+	var result []error
+	for _, inner := range multi.Unwrap() {
+		result = append(result, Flatten(inner)...)
+	}
+	return result
+}
+
+// Walk returns an iterator over all errors in the tree of wrapped errors
+// below err, in the same depth-first pre-order that errors.Is() and
+// errors.As() use. The iterator yields err itself first, followed by all
+// errors that it wraps either through `Unwrap() error` or `Unwrap() []error`.
+//
+//	for e := range errext.Walk(err) {
+//		if code, ok := e.(interface{ StatusCode() int }); ok {
+//			return code.StatusCode()
+//		}
+//	}
+func Walk(err error) iter.Seq[error] {
+	return func(yield func(error) bool) {
+		walk(err, yield)
+	}
+}
+
+// Implementation of Walk(). Returns false if iteration shall stop.
+func walk(err error, yield func(error) bool) bool {
+	if err == nil {
+		return true
+	}
+	if !yield(err) {
+		return false
+	}
+	switch e := err.(type) { //nolint:errorlint // we are implementing unwrapping ourselves
+	case interface{ Unwrap() error }:
+		return walk(e.Unwrap(), yield)
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			if !walk(inner, yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -20,7 +20,9 @@
 package errext
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/sapcc/go-bits/assert"
@@ -69,3 +71,77 @@ type barError struct{ Data int }
 
 func (fooError) Error() string { return "foo" }
 func (barError) Error() string { return "bar" }
+
+func TestSyncErrorSet(t *testing.T) {
+	var errs SyncErrorSet
+	assert.DeepEqual(t, "IsEmpty", errs.IsEmpty(), true)
+	assert.DeepEqual(t, "ToErrorSet", errs.ToErrorSet(), ErrorSet(nil))
+
+	// add errors from many goroutines at once (this is mostly useful with `go test -race`)
+	var wg sync.WaitGroup
+	for idx := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs.Add(nil) // ignored
+			errs.Addf("error %d", idx)
+		}()
+	}
+	wg.Wait()
+	assert.DeepEqual(t, "IsEmpty", errs.IsEmpty(), false)
+	assert.DeepEqual(t, "len(ToErrorSet)", len(errs.ToErrorSet()), 50)
+
+	// collect errors from a channel
+	var errs2 SyncErrorSet
+	errChan := make(chan error)
+	go func() {
+		errChan <- errors.New("foo")
+		errChan <- nil
+		errChan <- errors.New("bar")
+		close(errChan)
+	}()
+	errs2.Collect(errChan)
+	errs2.Append(ErrorSet{errors.New("qux")})
+	assert.DeepEqual(t, "Join", errs2.Join(", "), "foo, bar, qux")
+}
+
+func TestJoinedErrors(t *testing.T) {
+	errFoo := fooError{23}
+	errBar := errors.New("bar")
+
+	// ErrorSet.JoinedError() interoperates with errors.Is() and errors.As()
+	var errs ErrorSet
+	assert.DeepEqual(t, "JoinedError", errs.JoinedError(", "), nil)
+	errs.Add(fmt.Errorf("while doing foo: %w", errFoo))
+	errs.Add(errBar)
+	err := errs.JoinedError(", ")
+	assert.DeepEqual(t, "Error", err.Error(), "while doing foo: foo, bar")
+	assert.DeepEqual(t, "errors.Is", errors.Is(err, errBar), true)
+	ferr, ok := As[fooError](err)
+	assert.DeepEqual(t, "As", ok, true)
+	assert.DeepEqual(t, "As", ferr.Data, 23)
+
+	// Flatten() unpacks nested joined errors, but not wrapped errors
+	errQux := errors.New("qux")
+	tree := errors.Join(err, errors.Join(errQux, nil))
+	assert.DeepEqual(t, "Flatten", Flatten(tree), []error{errs[0], errBar, errQux})
+	assert.DeepEqual(t, "Flatten", Flatten(errQux), []error{errQux})
+	assert.DeepEqual(t, "Flatten", Flatten(nil), []error(nil))
+
+	// Walk() visits all errors in the tree, in pre-order
+	var visited []error
+	for e := range Walk(tree) {
+		visited = append(visited, e)
+	}
+	assert.DeepEqual(t, "Walk", visited, []error{tree, err, errs[0], errFoo, errBar, errors.Join(errQux), errQux})
+
+	// Walk() stops when asked to
+	visited = nil
+	for e := range Walk(tree) {
+		visited = append(visited, e)
+		if e == errFoo { //nolint:errorlint // testing exact identity
+			break
+		}
+	}
+	assert.DeepEqual(t, "Walk", len(visited), 4)
+}
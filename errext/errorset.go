@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/sapcc/go-bits/logg"
 )
@@ -64,6 +65,34 @@ func (errs ErrorSet) Join(sep string) string {
 	return strings.Join(msgs, sep)
 }
 
+// JoinedError returns an error whose message is built like Join(sep). If the
+// set is empty, nil is returned.
+//
+// Like the result of errors.Join(), the returned error implements the
+// `Unwrap() []error` interface, so the errors in this set can be inspected
+// with errors.Is() and errors.As(), as well as with As() and IsOfType().
+func (errs ErrorSet) JoinedError(sep string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return joinedError{errs: append(ErrorSet(nil), errs...), sep: sep}
+}
+
+type joinedError struct {
+	errs ErrorSet
+	sep  string
+}
+
+// Error implements the builtin/error interface.
+func (e joinedError) Error() string {
+	return e.errs.Join(e.sep)
+}
+
+// Unwrap implements the interface implied by the standard library's errors.Is() and errors.As().
+func (e joinedError) Unwrap() []error {
+	return e.errs
+}
+
 // LogFatalIfError reports all errors in this set on level FATAL, thus dying if
 // there are any errors.
 func (errs ErrorSet) LogFatalIfError() {
@@ -76,3 +105,89 @@ func (errs ErrorSet) LogFatalIfError() {
 		os.Exit(1)
 	}
 }
+
+// SyncErrorSet is a variant of ErrorSet that is safe for concurrent use, e.g.
+// when errors are reported by multiple worker goroutines. The zero value is
+// an empty set that is ready to use. A SyncErrorSet must not be copied after
+// first use.
+type SyncErrorSet struct {
+	mutex sync.Mutex
+	errs  ErrorSet
+}
+
+// Add adds the given error to the set if it is non-nil.
+func (s *SyncErrorSet) Add(err error) {
+	if err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.errs.Add(err)
+}
+
+// Addf is a shorthand for s.Add(fmt.Errorf(...)).
+func (s *SyncErrorSet) Addf(msg string, args ...any) {
+	s.Add(fmt.Errorf(msg, args...))
+}
+
+// Append adds all errors from the `other` ErrorSet to this one.
+func (s *SyncErrorSet) Append(other ErrorSet) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.errs.Append(other)
+}
+
+// Collect adds all non-nil errors received from the given channel to this set.
+// It returns once the channel is closed. For example:
+//
+//	errChan := make(chan error)
+//	for _, item := range items {
+//		go func() { errChan <- process(item) }()
+//	}
+//	go func() {
+//		wg.Wait() // wait for all workers to finish (details omitted)
+//		close(errChan)
+//	}()
+//	var errs errext.SyncErrorSet
+//	errs.Collect(errChan)
+func (s *SyncErrorSet) Collect(errChan <-chan error) {
+	for err := range errChan {
+		s.Add(err)
+	}
+}
+
+// IsEmpty returns true if no errors are in the set.
+func (s *SyncErrorSet) IsEmpty() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.errs.IsEmpty()
+}
+
+// Join joins the messages of all errors in this set using the provided separator.
+// If the set is empty, an empty string is returned.
+func (s *SyncErrorSet) Join(sep string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.errs.Join(sep)
+}
+
+// JoinedError is like ErrorSet.JoinedError.
+func (s *SyncErrorSet) JoinedError(sep string) error {
+	return s.ToErrorSet().JoinedError(sep)
+}
+
+// LogFatalIfError reports all errors in this set on level FATAL, thus dying if
+// there are any errors.
+func (s *SyncErrorSet) LogFatalIfError() {
+	s.ToErrorSet().LogFatalIfError()
+}
+
+// ToErrorSet returns a copy of the errors currently in this set.
+func (s *SyncErrorSet) ToErrorSet() ErrorSet {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.errs == nil {
+		return nil
+	}
+	return append(ErrorSet(nil), s.errs...)
+}
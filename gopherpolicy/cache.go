@@ -22,35 +22,136 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// InMemoryCacherOption is an optional argument to InMemoryCacher().
+type InMemoryCacherOption func(*inMemoryCacherParams)
+
+type inMemoryCacherParams struct {
+	size        int
+	ttl         time.Duration
+	registerer  prometheus.Registerer
+	withMetrics bool
+}
+
+// WithCacheSize is an InMemoryCacherOption that sets the maximum number of
+// token payloads in the cache. When the cache is full, the least recently used
+// entry is evicted. The default size is 256. Panics if size is not positive.
+func WithCacheSize(size int) InMemoryCacherOption {
+	if size <= 0 {
+		panic("WithCacheSize() called with non-positive size")
+	}
+	return func(p *inMemoryCacherParams) { p.size = size }
+}
+
+// WithCacheTTL is an InMemoryCacherOption that limits how long a token payload
+// stays in the cache after it has been stored. Expired entries are treated as
+// absent. By default, entries stay in the cache until they are evicted.
+//
+// Note that TokenValidator.CacheMaxAge has a similar effect for all types of
+// Cacher. This option is mostly useful for bounding the lifetime of cached
+// credentials in memory independently of the validation logic.
+func WithCacheTTL(ttl time.Duration) InMemoryCacherOption {
+	return func(p *inMemoryCacherParams) { p.ttl = ttl }
+}
+
+// WithCacheMetrics is an InMemoryCacherOption that enables the following
+// metrics, which are registered with the given registerer (or with
+// prometheus.DefaultRegisterer if nil):
+//
+//   - "gopherpolicy_token_cache_hits" (counter): incremented whenever a token
+//     payload is found in the cache.
+//   - "gopherpolicy_token_cache_misses" (counter): incremented whenever a token
+//     payload is not found in the cache, or has expired.
+func WithCacheMetrics(registerer prometheus.Registerer) InMemoryCacherOption {
+	return func(p *inMemoryCacherParams) {
+		p.withMetrics = true
+		p.registerer = registerer
+	}
+}
+
 type inMemoryCacher struct {
-	*lru.Cache[string, []byte]
+	cache       *lru.Cache[string, inMemoryCacheEntry]
+	ttl         time.Duration
+	hitCounter  prometheus.Counter
+	missCounter prometheus.Counter
+	now         func() time.Time
 }
 
-// InMemoryCacher builds a Cacher that stores token payloads in memory. At most
-// 256 token payloads will be cached, so this will never use more than 4-8 MiB
-// of memory.
-func InMemoryCacher() Cacher {
-	// lru.New() only fails if a non-negative size is given, so it's safe to
-	// ignore the error here
+type inMemoryCacheEntry struct {
+	Payload  []byte
+	StoredAt time.Time
+}
+
+// InMemoryCacher builds a Cacher that stores token payloads in memory. By
+// default, at most 256 token payloads will be cached, so this will never use
+// more than 4-8 MiB of memory. The cache is keyed by a hash of the token, so
+// tokens are never held in memory in cleartext.
+//
+// The returned Cacher also implements CacheInvalidator.
+func InMemoryCacher(opts ...InMemoryCacherOption) Cacher {
+	params := inMemoryCacherParams{size: 256}
+	for _, opt := range opts {
+		opt(&params)
+	}
+
+	// lru.New() only fails if a non-positive size is given, which WithCacheSize() rejects
 	//nolint:errcheck
-	c, _ := lru.New[string, []byte](256)
-	return inMemoryCacher{c}
+	c, _ := lru.New[string, inMemoryCacheEntry](params.size)
+	result := &inMemoryCacher{cache: c, ttl: params.ttl, now: time.Now}
+
+	if params.withMetrics {
+		registerer := params.registerer
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+		result.hitCounter = prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gopherpolicy_token_cache_hits",
+			Help: "Counter for token payloads that were found in the in-memory token cache.",
+		})
+		result.missCounter = prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gopherpolicy_token_cache_misses",
+			Help: "Counter for token payloads that were not found in the in-memory token cache.",
+		})
+		registerer.MustRegister(result.hitCounter)
+		registerer.MustRegister(result.missCounter)
+	}
+	return result
 }
 
-func (c inMemoryCacher) StoreTokenPayload(_ context.Context, token string, payload []byte) {
-	c.Add(cacheKeyFor(token), payload)
+// StoreTokenPayload implements the Cacher interface.
+func (c *inMemoryCacher) StoreTokenPayload(_ context.Context, token string, payload []byte) {
+	c.cache.Add(cacheKeyFor(token), inMemoryCacheEntry{payload, c.now()})
 }
 
-func (c inMemoryCacher) LoadTokenPayload(_ context.Context, token string) []byte {
-	payload, ok := c.Get(cacheKeyFor(token))
+// LoadTokenPayload implements the Cacher interface.
+func (c *inMemoryCacher) LoadTokenPayload(_ context.Context, token string) []byte {
+	key := cacheKeyFor(token)
+	entry, ok := c.cache.Get(key)
+	if ok && c.ttl > 0 && c.now().Sub(entry.StoredAt) >= c.ttl {
+		c.cache.Remove(key)
+		ok = false
+	}
+
 	if !ok {
+		if c.missCounter != nil {
+			c.missCounter.Inc()
+		}
 		return nil
 	}
-	return payload
+	if c.hitCounter != nil {
+		c.hitCounter.Inc()
+	}
+	return entry.Payload
+}
+
+// InvalidateTokenPayload implements the CacheInvalidator interface.
+func (c *inMemoryCacher) InvalidateTokenPayload(_ context.Context, token string) {
+	c.cache.Remove(cacheKeyFor(token))
 }
 
 func cacheKeyFor(token string) string {
@@ -0,0 +1,242 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func makeCacheTestToken(userName string, cachedAt time.Time) serializableToken {
+	return serializableToken{
+		Token:     tokens.Token{ID: "token", ExpiresAt: time.Now().Add(24 * time.Hour)},
+		TokenData: keystoneToken{User: keystoneTokenThingInDomain{keystoneTokenThing: keystoneTokenThing{ID: "user", Name: userName}}},
+		CachedAt:  cachedAt,
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	v := &TokenValidator{
+		IdentityV3:           &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}},
+		Cacher:               InMemoryCacher(),
+		CacheMaxAge:          time.Hour,
+		StaleWhileRevalidate: time.Hour,
+	}
+	storeInCache := func(s serializableToken) {
+		payload, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		v.Cacher.StoreTokenPayload(ctx, "key", payload)
+	}
+
+	// the check function returns a token with a different user name than the cached ones,
+	// so that we can see where the token came from
+	var (
+		checkCount atomic.Int32
+		checkDone  = make(chan struct{}, 1)
+	)
+	check := func() TokenResult {
+		checkCount.Add(1)
+		defer func() { checkDone <- struct{}{} }()
+		return makeCacheTestToken("from-keystone", time.Time{})
+	}
+
+	// fresh cached token: no check
+	storeInCache(makeCacheTestToken("from-cache", time.Now().Add(-30*time.Minute)))
+	token := v.CheckCredentials(ctx, "key", check)
+	assert.DeepEqual(t, "user name", token.UserName(), "from-cache")
+	assert.DeepEqual(t, "check count", checkCount.Load(), int32(0))
+
+	// stale cached token: served from cache, but revalidated in the background
+	storeInCache(makeCacheTestToken("from-cache", time.Now().Add(-90*time.Minute)))
+	token = v.CheckCredentials(ctx, "key", check)
+	assert.DeepEqual(t, "user name", token.UserName(), "from-cache")
+	<-checkDone
+	assert.DeepEqual(t, "check count", checkCount.Load(), int32(1))
+	for range 100 {
+		// wait for the background goroutine to finish storing the result
+		_, isRunning := v.revalidating.Load("key")
+		if !isRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	token = v.CheckCredentials(ctx, "key", check)
+	assert.DeepEqual(t, "user name", token.UserName(), "from-keystone")
+	assert.DeepEqual(t, "check count", checkCount.Load(), int32(1))
+
+	// cached token beyond the stale window: synchronous check
+	storeInCache(makeCacheTestToken("from-cache", time.Now().Add(-150*time.Minute)))
+	token = v.CheckCredentials(ctx, "key", check)
+	<-checkDone
+	assert.DeepEqual(t, "user name", token.UserName(), "from-keystone")
+	assert.DeepEqual(t, "check count", checkCount.Load(), int32(2))
+}
+
+func TestStaleWhileRevalidateWithConcurrentInvalidation(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	v := &TokenValidator{
+		IdentityV3:           &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}},
+		Cacher:               InMemoryCacher(),
+		CacheMaxAge:          time.Hour,
+		StaleWhileRevalidate: time.Hour,
+	}
+
+	// this check blocks until the test has invalidated the credentials
+	var (
+		checkStarted = make(chan struct{})
+		releaseCheck = make(chan struct{})
+	)
+	check := func() TokenResult {
+		close(checkStarted)
+		<-releaseCheck
+		return makeCacheTestToken("from-keystone", time.Time{})
+	}
+
+	// stale cached token: served from cache, and revalidated in the background
+	s := makeCacheTestToken("from-cache", time.Now().Add(-90*time.Minute))
+	v.Cacher.StoreTokenPayload(ctx, "key", must.ReturnT(json.Marshal(s))(t))
+	token := v.CheckCredentials(ctx, "key", check)
+	assert.DeepEqual(t, "user name", token.UserName(), "from-cache")
+
+	// invalidate while the revalidation is in flight
+	<-checkStarted
+	v.InvalidateCredentials(ctx, "key")
+	close(releaseCheck)
+	for range 100 {
+		// wait for the background goroutine to finish
+		_, isRunning := v.revalidating.Load("key")
+		if !isRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the result of the revalidation must not have been put back into the cache
+	assert.DeepEqual(t, "cached payload", v.Cacher.LoadTokenPayload(ctx, "key"), []byte(nil))
+}
+
+func TestStaleWhileRevalidateWithRevokedToken(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	// this Keystone has revoked the token that we have in the cache
+	var requestCount atomic.Int32
+	keystone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		http.Error(w, "token not found", http.StatusNotFound)
+	}))
+	defer keystone.Close()
+
+	v := &TokenValidator{
+		IdentityV3: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{HTTPClient: *keystone.Client()},
+			Endpoint:       keystone.URL + "/v3/",
+		},
+		Cacher:               InMemoryCacher(),
+		CacheMaxAge:          time.Hour,
+		StaleWhileRevalidate: time.Hour,
+	}
+	checkToken := func() *Token {
+		r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		r.Header.Set("X-Auth-Token", "token")
+		return v.CheckToken(r)
+	}
+
+	// fresh cached token: accepted without asking Keystone
+	s := makeCacheTestToken("from-cache", time.Now().Add(-30*time.Minute))
+	v.Cacher.StoreTokenPayload(ctx, "token", must.ReturnT(json.Marshal(s))(t))
+	token := checkToken()
+	assert.DeepEqual(t, "token error", token.Err, nil)
+	assert.DeepEqual(t, "request count", requestCount.Load(), int32(0))
+
+	// stale cached token: still accepted, but the background revalidation learns that the token was revoked
+	s = makeCacheTestToken("from-cache", time.Now().Add(-90*time.Minute))
+	v.Cacher.StoreTokenPayload(ctx, "token", must.ReturnT(json.Marshal(s))(t))
+	token = checkToken()
+	assert.DeepEqual(t, "token error", token.Err, nil)
+	for range 100 {
+		// wait for the background goroutine to finish
+		_, isRunning := v.revalidating.Load("token")
+		if !isRunning && requestCount.Load() > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.DeepEqual(t, "request count", requestCount.Load(), int32(1))
+
+	// the revoked token must not be served from the cache anymore
+	token = checkToken()
+	if token.Err == nil {
+		t.Error("expected revoked token to be rejected, but it was accepted")
+	}
+	assert.DeepEqual(t, "request count", requestCount.Load(), int32(2))
+}
+
+func TestInMemoryCacher(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	registry := prometheus.NewPedanticRegistry()
+	c := InMemoryCacher(WithCacheSize(2), WithCacheTTL(time.Minute), WithCacheMetrics(registry)).(*inMemoryCacher)
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+
+	// least recently used entries are evicted when the cache is full
+	c.StoreTokenPayload(ctx, "first", []byte("1"))
+	c.StoreTokenPayload(ctx, "second", []byte("2"))
+	c.StoreTokenPayload(ctx, "third", []byte("3"))
+	assert.DeepEqual(t, "first payload", c.LoadTokenPayload(ctx, "first"), []byte(nil))
+	assert.DeepEqual(t, "second payload", c.LoadTokenPayload(ctx, "second"), []byte("2"))
+
+	// entries expire after the TTL
+	now = now.Add(30 * time.Second)
+	c.StoreTokenPayload(ctx, "third", []byte("3"))
+	now = now.Add(45 * time.Second)
+	assert.DeepEqual(t, "second payload", c.LoadTokenPayload(ctx, "second"), []byte(nil))
+	assert.DeepEqual(t, "third payload", c.LoadTokenPayload(ctx, "third"), []byte("3"))
+
+	// entries can be invalidated explicitly through the TokenValidator
+	v := &TokenValidator{Cacher: c}
+	v.InvalidateCredentials(ctx, "third")
+	assert.DeepEqual(t, "third payload", c.LoadTokenPayload(ctx, "third"), []byte(nil))
+
+	// check metrics
+	actual := make(map[string]float64)
+	for _, family := range must.ReturnT(registry.Gather())(t) {
+		actual[family.GetName()] = family.GetMetric()[0].GetCounter().GetValue()
+	}
+	expected := map[string]float64{
+		"gopherpolicy_token_cache_hits":   2,
+		"gopherpolicy_token_cache_misses": 3,
+	}
+	assert.DeepEqual(t, "metrics", actual, expected)
+}
@@ -0,0 +1,127 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	policy "github.com/databus23/goslo.policy"
+)
+
+// CoverageRecorder is an Enforcer that wraps another Enforcer and records
+// which policy rules have been evaluated through it. It is intended for use in
+// tests, to find policy rules that are not checked by any API handler (e.g.
+// because of a typo in the rule name, or because the handler was removed).
+//
+//	rules, err := gopherpolicy.ReadPolicyFile("policy.yaml", yaml.Unmarshal)
+//	enforcer, err := policy.NewEnforcer(rules)
+//	recorder := gopherpolicy.NewCoverageRecorder(enforcer)
+//	// ...use `recorder` as Enforcer in all tests of the test suite...
+//	if uncovered := recorder.UnevaluatedRules(rules); len(uncovered) > 0 {
+//		t.Errorf("policy rules not covered by tests: %v", uncovered)
+//	}
+//
+// It is safe to use from multiple goroutines at once.
+type CoverageRecorder struct {
+	inner     Enforcer
+	mutex     sync.Mutex
+	evaluated map[string]uint64
+}
+
+// NewCoverageRecorder wraps the given Enforcer in a CoverageRecorder.
+func NewCoverageRecorder(inner Enforcer) *CoverageRecorder {
+	if inner == nil {
+		panic("NewCoverageRecorder called with inner == nil!")
+	}
+	return &CoverageRecorder{
+		inner:     inner,
+		evaluated: make(map[string]uint64),
+	}
+}
+
+// Enforce implements the Enforcer interface.
+func (c *CoverageRecorder) Enforce(rule string, ctx policy.Context) bool {
+	c.mutex.Lock()
+	c.evaluated[rule]++
+	c.mutex.Unlock()
+	return c.inner.Enforce(rule, ctx)
+}
+
+// EvaluationCounts returns how often each policy rule has been evaluated so far.
+// Rules that were never evaluated are not included in the result.
+func (c *CoverageRecorder) EvaluationCounts() map[string]uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	result := make(map[string]uint64, len(c.evaluated))
+	for rule, count := range c.evaluated {
+		result[rule] = count
+	}
+	return result
+}
+
+var ruleReferenceRx = regexp.MustCompile(`\brule:([^\s()]+)`)
+
+// UnevaluatedRules takes the rules from the policy file (as returned by
+// ReadPolicyFile), and returns a sorted list of those rule names that have not
+// been evaluated through this CoverageRecorder so far.
+//
+// Rules that are referenced by other rules through the "rule:" syntax (e.g.
+// "context_is_admin" in "rule:context_is_admin or role:member") are not
+// reported, since those are usually only used as building blocks for other
+// rules and not evaluated directly.
+func (c *CoverageRecorder) UnevaluatedRules(rules map[string]string) []string {
+	referenced := make(map[string]bool)
+	for _, expr := range rules {
+		for _, match := range ruleReferenceRx.FindAllStringSubmatch(expr, -1) {
+			referenced[strings.Trim(match[1], `"'`)] = true
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var result []string
+	for rule := range rules {
+		if c.evaluated[rule] == 0 && !referenced[rule] {
+			result = append(result, rule)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+// UnknownRules returns a sorted list of those rule names that have been
+// evaluated through this CoverageRecorder, but do not appear in the given
+// rules from the policy file. This usually indicates a typo in the rule name
+// within an API handler.
+func (c *CoverageRecorder) UnknownRules(rules map[string]string) []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var result []string
+	for rule := range c.evaluated {
+		if _, exists := rules[rule]; !exists {
+			result = append(result, rule)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
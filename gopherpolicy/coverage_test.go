@@ -0,0 +1,69 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	policy "github.com/databus23/goslo.policy"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestCoverageRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(path, []byte(`{
+		"context_is_admin": "role:admin",
+		"project:show": "rule:context_is_admin or role:member",
+		"project:edit": "rule:context_is_admin",
+		"project:delete": "rule:context_is_admin"
+	}`), 0o666)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	rules, err := ReadPolicyFile(path, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	enforcer, err := policy.NewEnforcer(rules)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	recorder := NewCoverageRecorder(enforcer)
+
+	// check that enforcement is passed through to the inner Enforcer
+	ctx := policy.Context{Roles: []string{"member"}}
+	assert.DeepEqual(t, "Enforce(project:show)", recorder.Enforce("project:show", ctx), true)
+	assert.DeepEqual(t, "Enforce(project:show)", recorder.Enforce("project:show", ctx), true)
+	assert.DeepEqual(t, "Enforce(project:edit)", recorder.Enforce("project:edit", ctx), false)
+	assert.DeepEqual(t, "Enforce(project:frobnicate)", recorder.Enforce("project:frobnicate", ctx), false)
+
+	// check coverage report
+	assert.DeepEqual(t, "EvaluationCounts", recorder.EvaluationCounts(), map[string]uint64{
+		"project:show":       2,
+		"project:edit":       1,
+		"project:frobnicate": 1,
+	})
+	assert.DeepEqual(t, "UnevaluatedRules", recorder.UnevaluatedRules(rules), []string{"project:delete"})
+	assert.DeepEqual(t, "UnknownRules", recorder.UnknownRules(rules), []string{"project:frobnicate"})
+}
@@ -0,0 +1,160 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	policy "github.com/databus23/goslo.policy"
+)
+
+const (
+	// The prefix for keys in policy.Context.Auth that describe the impersonator.
+	impersonatorPrefix = "impersonator_"
+	// The key in policy.Context.Auth that marks tokens obtained through Impersonate().
+	impersonatedAuthKey = "impersonated"
+)
+
+// Prefixes of keys in policy.Context.Auth that can only be filled by this
+// package from validated tokens, and therefore must not be taken from the
+// target context in Impersonate().
+var reservedAuthKeyPrefixes = []string{impersonatorPrefix, serviceTokenPrefix, impersonatedAuthKey}
+
+var errNestedImpersonation = errors.New("cannot impersonate another user with a token that is already impersonated")
+
+// Impersonate returns a Token that acts on behalf of the user described by
+// `target`, e.g. when a service performs an action on behalf of a user whose
+// policy context was forwarded to it by another service.
+//
+// The returned token has the identity, scope and roles of the target user, so
+// policy checks are evaluated for that user. The identity of the original
+// token (the impersonator) is recorded in the policy context with the prefix
+// "impersonator_" (e.g. "impersonator_user_id" or "impersonator_project_id"),
+// and its roles are recorded as a comma-separated list in
+// "impersonator_roles". Furthermore, "impersonated" is set to "true". Policy
+// rules can use these to restrict actions taken through impersonation. When the
+// returned token is used in audit events, the impersonator is reported in an
+// attachment of the initiator (see AsInitiator).
+//
+// The caller is responsible for checking that the impersonator is allowed to
+// impersonate other users, usually by checking a dedicated policy rule on the
+// original token beforehand:
+//
+//	token := validator.CheckToken(r)
+//	if !token.Require(w, "impersonate") {
+//		return
+//	}
+//	token = token.ImpersonateFromCompactJSON(forwardedContext)
+//	if !token.Require(w, "project:show") {
+//		return
+//	}
+//
+// Impersonation cannot be nested: If this token was itself obtained through
+// Impersonate(), the returned token has an error, since only one impersonator
+// could be recorded.
+//
+// The returned token does not have a ProviderClient. If this token has an
+// error, the returned token has the same error.
+func (t *Token) Impersonate(target policy.Context) *Token {
+	if t.Err != nil {
+		return &Token{Err: t.Err}
+	}
+	if t.IsImpersonated() {
+		return &Token{Err: errNestedImpersonation}
+	}
+
+	auth := make(map[string]string, len(target.Auth)+len(identityAuthKeys)+1)
+	for key, value := range target.Auth {
+		// the target context shall not be able to forge impersonator or service token information
+		isReserved := slices.ContainsFunc(reservedAuthKeyPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(key, prefix)
+		})
+		if !isReserved {
+			auth[key] = value
+		}
+	}
+	for _, key := range identityAuthKeys {
+		if value := t.Context.Auth[key]; value != "" {
+			auth[impersonatorPrefix+key] = value
+		}
+	}
+	auth[impersonatorPrefix+"roles"] = strings.Join(t.Context.Roles, ",")
+	auth[impersonatedAuthKey] = "true"
+
+	roles := slices.Clone(target.Roles)
+	if roles == nil {
+		roles = []string{}
+	}
+	return &Token{
+		Enforcer: t.Enforcer,
+		Context: policy.Context{
+			Auth:    auth,
+			Roles:   roles,
+			Request: map[string]string{},
+			Logger:  t.Context.Logger,
+		},
+		metrics: t.metrics,
+	}
+}
+
+// ImpersonateFromCompactJSON is like Impersonate, but takes the policy context
+// of the target user in the format produced by SerializeCompactContextToJSON.
+// If the context cannot be deserialized, the returned token has an error.
+func (t *Token) ImpersonateFromCompactJSON(buf []byte) *Token {
+	if t.Err != nil {
+		return &Token{Err: t.Err}
+	}
+	target, err := DeserializeCompactContextFromJSON(buf)
+	if err != nil {
+		return &Token{Err: fmt.Errorf("while deserializing policy context for impersonation: %w", err)}
+	}
+	return t.Impersonate(target)
+}
+
+// IsImpersonated returns whether this token was obtained through Impersonate().
+func (t *Token) IsImpersonated() bool {
+	return t.Context.Auth[impersonatedAuthKey] == "true"
+}
+
+// ImpersonatorUserUUID returns the UUID of the user who obtained this token
+// through Impersonate(), or "" if this token is not impersonated.
+func (t *Token) ImpersonatorUserUUID() string {
+	return t.Context.Auth[impersonatorPrefix+"user_id"]
+}
+
+// ImpersonatorUserName returns the name of the user who obtained this token
+// through Impersonate(), or "" if this token is not impersonated.
+func (t *Token) ImpersonatorUserName() string {
+	return t.Context.Auth[impersonatorPrefix+"user_name"]
+}
+
+// Returns a token that describes the impersonator of this token, for use in AsInitiator().
+func (t *Token) impersonator() *Token {
+	auth := make(map[string]string)
+	for key, value := range t.Context.Auth {
+		if unprefixedKey, ok := strings.CutPrefix(key, impersonatorPrefix); ok {
+			auth[unprefixedKey] = value
+		}
+	}
+	return &Token{Context: policy.Context{Auth: auth}}
+}
@@ -0,0 +1,138 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"encoding/json"
+	"testing"
+
+	policy "github.com/databus23/goslo.policy"
+	"github.com/sapcc/go-api-declarations/cadf"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestImpersonation(t *testing.T) {
+	enforcer := must.ReturnT(newEnforcer(map[string]string{
+		"impersonate":    "role:cloud_admin",
+		"project:show":   "role:member and not impersonator_user_id:evil-admin",
+		"project:delete": "service_roles:service",
+	}))(t)
+	admin := &Token{
+		Enforcer: enforcer,
+		Context: policy.Context{
+			Auth: map[string]string{
+				"user_id":          "admin-id",
+				"user_name":        "admin",
+				"user_domain_name": "Default",
+				"project_id":       "admin-project-id",
+			},
+			Roles: []string{"cloud_admin"},
+		},
+	}
+	targetJSON := must.ReturnT(SerializeCompactContextToJSON(policy.Context{
+		Auth: map[string]string{
+			"user_id":             "alice-id",
+			"user_name":           "alice",
+			"user_domain_id":      "domain-id",
+			"user_domain_name":    "Default",
+			"project_id":          "project-id",
+			"project_name":        "alice-project",
+			"project_domain_id":   "domain-id",
+			"project_domain_name": "Default",
+		},
+		Roles: []string{"member"},
+	}))(t)
+
+	assert.DeepEqual(t, "Check(impersonate)", admin.Check("impersonate"), true)
+	token := admin.ImpersonateFromCompactJSON(targetJSON)
+	if token.Err != nil {
+		t.Fatal(token.Err.Error())
+	}
+
+	// policy checks are evaluated for the target user
+	assert.DeepEqual(t, "Check(impersonate)", token.Check("impersonate"), false)
+	assert.DeepEqual(t, "Check(project:show)", token.Check("project:show"), true)
+	assert.DeepEqual(t, "UserName", token.UserName(), "alice")
+	assert.DeepEqual(t, "ProjectScopeUUID", token.ProjectScopeUUID(), "project-id")
+
+	// the impersonator is recorded
+	assert.DeepEqual(t, "IsImpersonated", token.IsImpersonated(), true)
+	assert.DeepEqual(t, "IsImpersonated on admin", admin.IsImpersonated(), false)
+	assert.DeepEqual(t, "ImpersonatorUserUUID", token.ImpersonatorUserUUID(), "admin-id")
+	assert.DeepEqual(t, "ImpersonatorUserName", token.ImpersonatorUserName(), "admin")
+	assert.DeepEqual(t, "impersonator_project_id", token.Context.Auth["impersonator_project_id"], "admin-project-id")
+	assert.DeepEqual(t, "impersonator_roles", token.Context.Auth["impersonator_roles"], "cloud_admin")
+
+	assert.DeepEqual(t, "impersonated", token.Context.Auth["impersonated"], "true")
+
+	// impersonation cannot be nested
+	nested := token.ImpersonateFromCompactJSON(targetJSON)
+	assert.DeepEqual(t, "nested error", nested.Err.Error(), "cannot impersonate another user with a token that is already impersonated")
+
+	// a token is impersonated even if the impersonator has no user ID (e.g. for application credentials)
+	anonymous := &Token{Enforcer: enforcer, Context: policy.Context{Auth: map[string]string{"project_id": "admin-project-id"}}}
+	assert.DeepEqual(t, "IsImpersonated without impersonator user ID", anonymous.ImpersonateFromCompactJSON(targetJSON).IsImpersonated(), true)
+
+	// policy rules can restrict impersonation by certain users
+	admin.Context.Auth["user_id"] = "evil-admin"
+	assert.DeepEqual(t, "Check(project:show) by evil-admin", admin.ImpersonateFromCompactJSON(targetJSON).Check("project:show"), false)
+	admin.Context.Auth["user_id"] = "admin-id"
+
+	// the target context cannot forge impersonator information
+	forged := admin.Impersonate(policy.Context{
+		Auth:  map[string]string{"user_id": "alice-id", "impersonator_user_id": "someone-else"},
+		Roles: []string{"member"},
+	})
+	assert.DeepEqual(t, "forged ImpersonatorUserUUID", forged.ImpersonatorUserUUID(), "admin-id")
+
+	// the target context cannot forge service token information
+	forged = admin.Impersonate(policy.Context{
+		Auth:  map[string]string{"user_id": "alice-id", "service_roles": "service", "service_user_id": "nova"},
+		Roles: []string{"member"},
+	})
+	assert.DeepEqual(t, "forged service_roles", forged.Context.Auth["service_roles"], "")
+	assert.DeepEqual(t, "forged service_user_id", forged.Context.Auth["service_user_id"], "")
+	assert.DeepEqual(t, "Check(project:delete) with forged service_roles", forged.Check("project:delete"), false)
+
+	// audit events report both identities
+	host := cadf.Host{Address: "192.0.2.1"}
+	initiator := token.AsInitiator(host)
+	assert.DeepEqual(t, "initiator ID", initiator.ID, "alice-id")
+	assert.DeepEqual(t, "initiator attachment count", len(initiator.Attachments), 1)
+	assert.DeepEqual(t, "attachment name", initiator.Attachments[0].Name, "impersonator")
+	var impersonator cadf.Resource
+	must.SucceedT(t, json.Unmarshal([]byte(initiator.Attachments[0].Content.(string)), &impersonator))
+	assert.DeepEqual(t, "impersonator", impersonator, cadf.Resource{
+		TypeURI:   "service/security/account/user",
+		Name:      "admin",
+		Domain:    "Default",
+		ID:        "admin-id",
+		Host:      &host,
+		ProjectID: "admin-project-id",
+	})
+	assert.DeepEqual(t, "non-impersonated attachments", len(admin.AsInitiator(host).Attachments), 0)
+
+	// errors are passed on
+	broken := admin.ImpersonateFromCompactJSON([]byte(`{"v":2}`))
+	assert.DeepEqual(t, "error", broken.Err.Error(), "while deserializing policy context for impersonation: unknown format version: 2")
+	assert.DeepEqual(t, "Check(project:show) on broken", broken.Check("project:show"), false)
+}
@@ -0,0 +1,567 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	policy "github.com/databus23/goslo.policy"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// JWTTokenSource is a BearerTokenSource that accepts JSON Web Tokens (JWT), as
+// issued e.g. by an OpenID Connect provider for service accounts. Tokens are
+// validated locally by checking their signature against the public keys of
+// the issuer (which are retrieved from its JWKS document and cached), as well
+// as their "iss", "aud", "exp" and "nbf" claims.
+//
+// The claims of valid tokens are mapped into a policy.Context as described
+// for the fields ClaimMapping and RolesClaim, so that the same policy rules
+// can be used as for Keystone tokens. Additionally, the Auth key
+// "token_source" is always set to "jwt", so that rules can tell JWTs apart
+// from Keystone tokens (e.g. "role:admin and not token_source:jwt" for
+// operations that shall only be available to Keystone users).
+//
+//	v := &gopherpolicy.TokenValidator{
+//		IdentityV3: identityV3,
+//		BearerTokenSource: &gopherpolicy.JWTTokenSource{
+//			Issuer:   "https://oidc.example.com",
+//			Audience: "my-service",
+//			ClaimMapping: map[string]string{
+//				"user_id":    "sub",
+//				"project_id": "project",
+//			},
+//		},
+//	}
+//
+// The signing algorithms RS256, RS384, RS512, PS256, PS384, PS512, ES256,
+// ES384 and ES512 are supported.
+type JWTTokenSource struct {
+	// The expected value of the "iss" claim. Required.
+	Issuer string
+	// A value that the "aud" claim must contain. Required.
+	Audience string
+	// The URL of the JWKS document containing the public keys of the issuer.
+	// If empty, the URL is taken from the OpenID Connect discovery document
+	// at Issuer + "/.well-known/openid-configuration".
+	JWKSURL string
+	// The HTTP client used for retrieving the JWKS document. Defaults to http.DefaultClient.
+	// Each retrieval is aborted after 30 seconds, regardless of the request
+	// context of the validation that triggered it.
+	HTTPClient *http.Client
+	// How long retrieved keys are used before the JWKS document is retrieved
+	// again. Defaults to one hour. Regardless of this setting, the JWKS
+	// document is retrieved again (at most once per minute) when a token was
+	// signed by an unknown key.
+	KeyCacheMaxAge time.Duration
+	// The tolerance for clock skew when checking "exp" and "nbf". Defaults to zero.
+	Leeway time.Duration
+
+	// Maps keys in policy.Context.Auth (e.g. "user_id" or "project_id") to the
+	// names of the claims that provide their values. Claims that are missing
+	// or not strings are ignored. If nil, "user_id" is taken from "sub" and
+	// "user_name" is taken from "preferred_username".
+	ClaimMapping map[string]string
+	// The name of the claim containing the role names for policy.Context.Roles,
+	// either as a list of strings or as a space-separated string. Defaults to "roles".
+	RolesClaim string
+
+	// the mutex protects the fields below, but is not held while talking to the
+	// issuer, so that token validations do not queue up behind a slow issuer
+	mutex             sync.Mutex
+	discoveredJWKSURL string
+	keys              map[string]jwtSigningKey // key = "kid" value
+	keysFetchedAt     time.Time
+	lastFetchAttempt  time.Time
+	pendingFetch      *jwksFetch       // non-nil while the JWKS is being retrieved
+	now               func() time.Time // for unit tests
+}
+
+// An ongoing retrieval of the JWKS document. Concurrent validations that need
+// the result wait for `done` to be closed instead of starting their own retrieval.
+type jwksFetch struct {
+	done chan struct{}
+	err  error // only valid after `done` has been closed
+}
+
+var defaultJWTClaimMapping = map[string]string{
+	"user_id":   "sub",
+	"user_name": "preferred_username",
+}
+
+// Returned by JWTTokenSource for expired tokens. This is recognized by AuthMetrics.
+var errTokenExpired = errors.New("token has expired")
+
+const (
+	// The minimum time between two retrievals of the JWKS document.
+	jwksMinRefreshInterval = time.Minute
+	// The maximum duration of a retrieval of the JWKS document.
+	jwksFetchTimeout = 30 * time.Second
+	// The maximum size of the discovery document and JWKS document.
+	jwksMaxResponseSize = 1 << 20
+)
+
+type jwtSigningKey struct {
+	Algorithm string // from the "alg" field of the JWK, may be empty
+	PublicKey crypto.PublicKey
+}
+
+// CheckBearerToken implements the BearerTokenSource interface.
+func (s *JWTTokenSource) CheckBearerToken(ctx context.Context, token string) (policy.Context, error) {
+	if s.Issuer == "" || s.Audience == "" {
+		return policy.Context{}, errors.New("JWTTokenSource is missing required configuration (Issuer and Audience)")
+	}
+	claims, err := s.verify(ctx, token)
+	if err != nil {
+		return policy.Context{}, fmt.Errorf("while validating JWT: %w", err)
+	}
+	return s.contextFromClaims(claims), nil
+}
+
+// Checks the signature and the registered claims of the given token, and returns its claims.
+func (s *JWTTokenSource) verify(ctx context.Context, token string) (map[string]any, error) {
+	headerStr, rest, ok1 := strings.Cut(token, ".")
+	payloadStr, signatureStr, ok2 := strings.Cut(rest, ".")
+	if !ok1 || !ok2 || strings.Contains(signatureStr, ".") {
+		return nil, errors.New("malformed token: expected three segments")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(headerStr)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(payloadStr)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(signatureStr)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	// check signature
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	key, err := s.getSigningKey(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+		return nil, fmt.Errorf("token uses algorithm %q, but key %q is for algorithm %q", header.Algorithm, header.KeyID, key.Algorithm)
+	}
+	err = verifyJWTSignature(header.Algorithm, key.PublicKey, []byte(headerStr+"."+payloadStr), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// check claims
+	var claims map[string]any
+	dec := json.NewDecoder(bytes.NewReader(payloadJSON))
+	dec.UseNumber()
+	err = dec.Decode(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); iss != s.Issuer {
+		return nil, fmt.Errorf("token has issuer %q, expected %q", iss, s.Issuer)
+	}
+	if !jwtAudienceContains(claims["aud"], s.Audience) {
+		return nil, fmt.Errorf("token is not intended for audience %q", s.Audience)
+	}
+	now := s.currentTime()
+	exp, ok := jwtTimeClaim(claims["exp"])
+	if !ok {
+		return nil, errors.New(`token does not have a valid "exp" claim`)
+	}
+	if !now.Before(exp.Add(s.Leeway)) {
+		return nil, errTokenExpired
+	}
+	if nbf, ok := jwtTimeClaim(claims["nbf"]); ok && now.Add(s.Leeway).Before(nbf) {
+		return nil, errors.New("token is not valid yet")
+	}
+	return claims, nil
+}
+
+func (s *JWTTokenSource) contextFromClaims(claims map[string]any) policy.Context {
+	c := policy.Context{
+		Auth:    make(map[string]string),
+		Request: map[string]string{},
+	}
+	mapping := s.ClaimMapping
+	if mapping == nil {
+		mapping = defaultJWTClaimMapping
+	}
+	for authKey, claimName := range mapping {
+		if value, ok := claims[claimName].(string); ok && value != "" {
+			c.Auth[authKey] = value
+		}
+	}
+	c.Auth["token_source"] = "jwt" // cannot be overridden by ClaimMapping
+
+	switch roles := claims[cmp.Or(s.RolesClaim, "roles")].(type) {
+	case string:
+		c.Roles = strings.Fields(roles)
+	case []any:
+		for _, role := range roles {
+			if roleStr, ok := role.(string); ok {
+				c.Roles = append(c.Roles, roleStr)
+			}
+		}
+	}
+	if c.Roles == nil {
+		c.Roles = []string{}
+	}
+	return c
+}
+
+func (s *JWTTokenSource) currentTime() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+func jwtAudienceContains(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		return slices.Contains(aud, any(audience))
+	default:
+		return false
+	}
+}
+
+func jwtTimeClaim(value any) (time.Time, bool) {
+	num, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := num.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, 0).Add(time.Duration(seconds * float64(time.Second))), true
+}
+
+func verifyJWTSignature(algorithm string, publicKey crypto.PublicKey, signingInput, signature []byte) error {
+	var hash crypto.Hash
+	switch algorithm {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm: %q", algorithm)
+	}
+	hasher := hash.New()
+	hasher.Write(signingInput)
+	digest := hasher.Sum(nil)
+
+	var err error
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		switch algorithm[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(key, hash, digest, signature)
+		case "PS":
+			err = rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		default:
+			return fmt.Errorf("cannot use RSA key with algorithm %q", algorithm)
+		}
+	case *ecdsa.PublicKey:
+		// the curve is tied to the algorithm, e.g. ES256 requires P-256
+		curveName := "P-" + strings.TrimPrefix(strings.Replace(algorithm, "512", "521", 1), "ES")
+		if !strings.HasPrefix(algorithm, "ES") || key.Curve.Params().Name != curveName {
+			return fmt.Errorf("cannot use ECDSA key on curve %s with algorithm %q", key.Curve.Params().Name, algorithm)
+		}
+		// signature is the concatenation of R and S, see RFC 7518, section 3.4
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			err = errors.New("verification failed")
+		}
+	default:
+		return fmt.Errorf("unsupported key type: %T", publicKey)
+	}
+	if err != nil {
+		return errors.New("invalid token signature")
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// JWKS retrieval
+
+// Returns the key with the given key ID, retrieving the JWKS document if necessary.
+func (s *JWTTokenSource) getSigningKey(ctx context.Context, keyID string) (jwtSigningKey, error) {
+	s.mutex.Lock()
+	key, found := s.findSigningKey(keyID)
+	now := s.currentTime()
+	isStale := now.Sub(s.keysFetchedAt) > cmp.Or(s.KeyCacheMaxAge, time.Hour)
+	mayRefresh := now.Sub(s.lastFetchAttempt) >= jwksMinRefreshInterval
+	fetch := s.pendingFetch
+	isOwnFetch := false
+	if fetch == nil && (isStale || !found) && mayRefresh {
+		s.lastFetchAttempt = now
+		fetch = &jwksFetch{done: make(chan struct{})}
+		s.pendingFetch = fetch
+		isOwnFetch = true
+	}
+	discoveredJWKSURL := s.discoveredJWKSURL
+	s.mutex.Unlock()
+
+	// the retrieval is shared by all validations waiting for it, so it must not
+	// be aborted when the validation that started it is canceled
+	if isOwnFetch {
+		go s.runFetch(context.WithoutCancel(ctx), fetch, discoveredJWKSURL, now)
+	}
+
+	if fetch != nil && !found {
+		// wait for the retrieval of the JWKS, since we need its result
+		select {
+		case <-fetch.done:
+		case <-ctx.Done():
+			return jwtSigningKey{}, ctx.Err()
+		}
+		s.mutex.Lock()
+		key, found = s.findSigningKey(keyID)
+		s.mutex.Unlock()
+		if fetch.err != nil && !found {
+			return jwtSigningKey{}, fetch.err
+		}
+	}
+	// otherwise, if the key is known, keep using it while the JWKS is being refreshed
+
+	if !found {
+		return jwtSigningKey{}, fmt.Errorf("no signing key found for key ID %q", keyID)
+	}
+	return key, nil
+}
+
+// Retrieves the JWKS document without holding s.mutex, then stores the result
+// and wakes up all validations that are waiting for it.
+func (s *JWTTokenSource) runFetch(ctx context.Context, fetch *jwksFetch, discoveredJWKSURL string, startedAt time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, jwksFetchTimeout)
+	defer cancel()
+	keys, discoveredJWKSURL, err := s.fetchSigningKeys(ctx, discoveredJWKSURL)
+
+	s.mutex.Lock()
+	if err == nil {
+		s.keys = keys
+		s.keysFetchedAt = startedAt
+	} else if len(s.keys) > 0 {
+		logg.Error("could not refresh JWKS for issuer %s (will keep using the previous keys): %s", s.Issuer, err.Error())
+	}
+	s.discoveredJWKSURL = discoveredJWKSURL
+	fetch.err = err
+	s.pendingFetch = nil
+	s.mutex.Unlock()
+	close(fetch.done)
+}
+
+func (s *JWTTokenSource) findSigningKey(keyID string) (jwtSigningKey, bool) {
+	key, found := s.keys[keyID]
+	if !found && keyID == "" && len(s.keys) == 1 {
+		// tokens without "kid" can be used if the issuer only has one key
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	return key, found
+}
+
+// Retrieves the JWKS document. If neither s.JWKSURL nor `discoveredJWKSURL`
+// is set, the JWKS location is discovered through the OIDC discovery document
+// and returned for reuse in later calls.
+func (s *JWTTokenSource) fetchSigningKeys(ctx context.Context, discoveredJWKSURL string) (map[string]jwtSigningKey, string, error) {
+	jwksURL := cmp.Or(s.JWKSURL, discoveredJWKSURL)
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURL string `json:"jwks_uri"`
+		}
+		discoveryURL := strings.TrimSuffix(s.Issuer, "/") + "/.well-known/openid-configuration"
+		err := s.getJSON(ctx, discoveryURL, &discovery)
+		if err != nil {
+			return nil, "", err
+		}
+		if discovery.JWKSURL == "" {
+			return nil, "", fmt.Errorf("no jwks_uri found in %s", discoveryURL)
+		}
+		discoveredJWKSURL = discovery.JWKSURL
+		jwksURL = discovery.JWKSURL
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err := s.getJSON(ctx, jwksURL, &jwks)
+	if err != nil {
+		return nil, discoveredJWKSURL, err
+	}
+	result := make(map[string]jwtSigningKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			// one broken key shall not prevent the use of all other keys
+			logg.Error("ignoring key %q from %s: %s", jwk.KeyID, jwksURL, err.Error())
+			continue
+		}
+		if publicKey != nil {
+			result[jwk.KeyID] = jwtSigningKey{Algorithm: jwk.Algorithm, PublicKey: publicKey}
+		}
+	}
+	return result, discoveredJWKSURL, nil
+}
+
+func (s *JWTTokenSource) getJSON(ctx context.Context, url string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("while preparing GET %s: %w", url, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := cmp.Or(s.HTTPClient, http.DefaultClient).Do(req)
+	if err != nil {
+		return fmt.Errorf("during GET %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, jwksMaxResponseSize+1))
+	if err != nil {
+		return fmt.Errorf("during GET %s: %w", url, err)
+	}
+	if len(body) > jwksMaxResponseSize {
+		return fmt.Errorf("during GET %s: response is larger than %d bytes", url, jwksMaxResponseSize)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("during GET %s: expected 200 OK, but got %s", url, resp.Status)
+	}
+	err = json.Unmarshal(body, target)
+	if err != nil {
+		return fmt.Errorf("while parsing response from GET %s: %w", url, err)
+	}
+	return nil
+}
+
+// jsonWebKey contains the fields of a JWK (see RFC 7517) that we need for signature verification.
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// for RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// for EC keys
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// PublicKey returns the public key described by this JWK, or nil if the key type is not supported.
+func (k jsonWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA parameters")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+
+	case "EC":
+		var (
+			curve     elliptic.Curve
+			ecdhCurve ecdh.Curve
+		)
+		switch k.Curve {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		// crypto/ecdh checks that the point is on the curve
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		_, err = ecdhCurve.NewPublicKey(slices.Concat([]byte{4}, x, y))
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC point: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	default:
+		// ignore key types that we do not support (e.g. symmetric keys, which
+		// would not be published anyway)
+		return nil, nil
+	}
+}
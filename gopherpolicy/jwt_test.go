@@ -0,0 +1,369 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	policy "github.com/databus23/goslo.policy"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+type jwtTestIssuer struct {
+	Server     *httptest.Server
+	RSAKey     *rsa.PrivateKey
+	ECKey      *ecdsa.PrivateKey
+	FetchCount atomic.Int32
+	// if set, retrievals of the JWKS block until this channel is closed
+	KeysGate atomic.Pointer[chan struct{}]
+}
+
+func newJWTTestIssuer(t *testing.T) *jwtTestIssuer {
+	iss := &jwtTestIssuer{
+		RSAKey: must.ReturnT(rsa.GenerateKey(rand.Reader, 2048))(t),
+		ECKey:  must.ReturnT(ecdsa.GenerateKey(elliptic.P256(), rand.Reader))(t),
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	ecPoint := must.ReturnT(iss.ECKey.PublicKey.ECDH())(t).Bytes() // 0x04 || X || Y
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(must.Return(json.Marshal(map[string]string{"jwks_uri": iss.Server.URL + "/keys"})))
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		iss.FetchCount.Add(1)
+		if gate := iss.KeysGate.Load(); gate != nil {
+			<-*gate
+		}
+		w.Header().Set("Content-Type", "application/json")
+		keys := []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa", "use": "sig", "alg": "RS256",
+				"n": b64(iss.RSAKey.N.Bytes()),
+				"e": b64(big.NewInt(int64(iss.RSAKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec", "crv": "P-256",
+				"x": b64(ecPoint[1:33]),
+				"y": b64(ecPoint[33:]),
+			},
+			{"kty": "oct", "kid": "ignored", "k": "c2VjcmV0"},
+			// a broken key must not prevent the use of the other keys
+			{"kty": "RSA", "kid": "broken", "n": "not base64!", "e": "AQAB"},
+		}
+		w.Write(must.Return(json.Marshal(map[string]any{"keys": keys})))
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Server.Close)
+	return iss
+}
+
+func (iss *jwtTestIssuer) Sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	header := must.ReturnT(json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}))(t)
+	payload := must.ReturnT(json.Marshal(claims))(t)
+	signingInput := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		signature = must.ReturnT(rsa.SignPKCS1v15(rand.Reader, iss.RSAKey, crypto.SHA256, digest[:]))(t)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, iss.ECKey, digest[:])
+		must.SucceedT(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		signature = []byte("not a signature")
+	}
+	return signingInput + "." + b64(signature)
+}
+
+func TestJWTTokenSource(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	iss := newJWTTestIssuer(t)
+	now := time.Unix(1700000000, 0)
+	source := &JWTTokenSource{
+		Issuer:   iss.Server.URL,
+		Audience: "my-service",
+		ClaimMapping: map[string]string{
+			"user_id":    "sub",
+			"project_id": "project",
+		},
+		now: func() time.Time { return now },
+	}
+	makeClaims := func(overrides map[string]any) map[string]any {
+		claims := map[string]any{
+			"iss":     iss.Server.URL,
+			"aud":     []string{"other-service", "my-service"},
+			"sub":     "service-account-1",
+			"project": "project-1",
+			"roles":   "reader writer",
+			"exp":     now.Add(time.Hour).Unix(),
+		}
+		for key, value := range overrides {
+			if value == nil {
+				delete(claims, key)
+			} else {
+				claims[key] = value
+			}
+		}
+		return claims
+	}
+
+	// valid tokens with either type of key produce a policy.Context (the JWKS location is discovered)
+	for alg, kid := range map[string]string{"RS256": "rsa", "ES256": "ec"} {
+		token := iss.Sign(t, alg, kid, makeClaims(nil))
+		c, err := source.CheckBearerToken(ctx, token)
+		if err != nil {
+			t.Fatalf("unexpected error for %s token: %s", alg, err.Error())
+		}
+		assert.DeepEqual(t, "Auth for "+alg, c.Auth, map[string]string{
+			"user_id":      "service-account-1",
+			"project_id":   "project-1",
+			"token_source": "jwt",
+		})
+		assert.DeepEqual(t, "Roles for "+alg, c.Roles, []string{"reader", "writer"})
+	}
+	assert.DeepEqual(t, "JWKS fetch count", iss.FetchCount.Load(), int32(1))
+
+	// invalid tokens are rejected
+	expectError := func(token, expected string) {
+		t.Helper()
+		_, err := source.CheckBearerToken(ctx, token)
+		if err == nil {
+			t.Errorf("expected error %q, but token was accepted", expected)
+		} else if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q, but got %q", expected, err.Error())
+		}
+	}
+	expectError("foo.bar", "malformed token")
+	expectError(iss.Sign(t, "none", "rsa", makeClaims(nil)), `token uses algorithm "none", but key "rsa" is for algorithm "RS256"`)
+	expectError(iss.Sign(t, "ES256", "rsa", makeClaims(nil)), `token uses algorithm "ES256"`)
+	expectError(iss.Sign(t, "ES256", "ignored", makeClaims(nil)), `no signing key found for key ID "ignored"`)
+	expectError(iss.Sign(t, "RS256", "broken", makeClaims(nil)), `no signing key found for key ID "broken"`)
+	expectError(iss.Sign(t, "RS256", "rsa", makeClaims(map[string]any{"iss": "https://evil.example.com"})), "token has issuer")
+	expectError(iss.Sign(t, "RS256", "rsa", makeClaims(map[string]any{"aud": "other-service"})), `token is not intended for audience "my-service"`)
+	expectError(iss.Sign(t, "RS256", "rsa", makeClaims(map[string]any{"exp": nil})), `token does not have a valid "exp" claim`)
+	expectError(iss.Sign(t, "RS256", "rsa", makeClaims(map[string]any{"exp": now.Add(-time.Minute).Unix()})), "token has expired")
+	expectError(iss.Sign(t, "RS256", "rsa", makeClaims(map[string]any{"nbf": now.Add(time.Minute).Unix()})), "token is not valid yet")
+
+	// a tampered payload does not match the signature
+	token := iss.Sign(t, "RS256", "rsa", makeClaims(nil))
+	parts := strings.Split(token, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString(must.ReturnT(json.Marshal(makeClaims(map[string]any{"sub": "admin"})))(t))
+	expectError(strings.Join(parts, "."), "invalid token signature")
+
+	// unknown key IDs trigger a refresh of the JWKS, but at most once per minute
+	expectError(iss.Sign(t, "RS256", "unknown", makeClaims(nil)), `no signing key found for key ID "unknown"`)
+	assert.DeepEqual(t, "JWKS fetch count", iss.FetchCount.Load(), int32(1))
+	now = now.Add(2 * time.Minute)
+	expectError(iss.Sign(t, "RS256", "unknown", makeClaims(nil)), `no signing key found for key ID "unknown"`)
+	assert.DeepEqual(t, "JWKS fetch count", iss.FetchCount.Load(), int32(2))
+}
+
+func TestJWTTokenSourceWithSlowIssuer(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	iss := newJWTTestIssuer(t)
+	var now atomic.Pointer[time.Time]
+	start := time.Unix(1700000000, 0)
+	now.Store(&start)
+	source := &JWTTokenSource{
+		Issuer:   iss.Server.URL,
+		Audience: "my-service",
+		now:      func() time.Time { return *now.Load() },
+	}
+	makeToken := func(alg, kid string) string {
+		return iss.Sign(t, alg, kid, map[string]any{
+			"iss": iss.Server.URL,
+			"aud": "my-service",
+			"sub": "service-account-1",
+			"exp": now.Load().Add(24 * time.Hour).Unix(),
+		})
+	}
+	rsaToken, ecToken := makeToken("RS256", "rsa"), makeToken("ES256", "ec")
+	_, err := source.CheckBearerToken(ctx, rsaToken)
+	must.SucceedT(t, err)
+
+	// when the keys are stale, one validation refreshes them from an issuer that is very slow to respond...
+	later := now.Load().Add(2 * time.Hour)
+	now.Store(&later)
+	gate := make(chan struct{})
+	iss.KeysGate.Store(&gate)
+	refreshDone := make(chan error)
+	go func() {
+		_, err := source.CheckBearerToken(ctx, rsaToken)
+		refreshDone <- err
+	}()
+	for iss.FetchCount.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// ...but meanwhile, other validations continue to use the known keys without waiting
+	otherDone := make(chan error)
+	go func() {
+		_, err := source.CheckBearerToken(ctx, ecToken)
+		otherDone <- err
+	}()
+	select {
+	case err := <-otherDone:
+		must.SucceedT(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("validation with known key is blocked by the JWKS refresh")
+	}
+
+	close(gate)
+	must.SucceedT(t, <-refreshDone)
+	assert.DeepEqual(t, "JWKS fetch count", iss.FetchCount.Load(), int32(2))
+}
+
+func TestJWTTokenSourceWithCanceledValidation(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	iss := newJWTTestIssuer(t)
+	source := &JWTTokenSource{
+		Issuer:   iss.Server.URL,
+		Audience: "my-service",
+		JWKSURL:  iss.Server.URL + "/keys",
+	}
+	token := iss.Sign(t, "RS256", "rsa", map[string]any{
+		"iss": iss.Server.URL,
+		"aud": "my-service",
+		"sub": "service-account-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	gate := make(chan struct{})
+	iss.KeysGate.Store(&gate)
+
+	// the validation that starts the JWKS retrieval is canceled while waiting for the slow issuer...
+	canceledCtx, cancel := context.WithCancel(ctx)
+	canceledDone := make(chan error)
+	go func() {
+		_, err := source.CheckBearerToken(canceledCtx, token)
+		canceledDone <- err
+	}()
+	for iss.FetchCount.Load() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	otherDone := make(chan error)
+	go func() {
+		_, err := source.CheckBearerToken(ctx, token)
+		otherDone <- err
+	}()
+	cancel()
+	err := <-canceledDone
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, but got %v", err)
+	}
+
+	// ...but the retrieval continues on behalf of the other validation
+	close(gate)
+	must.SucceedT(t, <-otherDone)
+	assert.DeepEqual(t, "JWKS fetch count", iss.FetchCount.Load(), int32(1))
+}
+
+func TestJWTTokenSourceClaimMapping(t *testing.T) {
+	// the token source marker cannot be overridden through the claims
+	source := &JWTTokenSource{ClaimMapping: map[string]string{"token_source": "src"}}
+	c := source.contextFromClaims(map[string]any{"src": "keystone"})
+	assert.DeepEqual(t, "Auth", c.Auth, map[string]string{"token_source": "jwt"})
+}
+
+func TestJWTTokenSourceWithOversizedResponse(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[],"padding":"` + strings.Repeat("x", jwksMaxResponseSize) + `"}`))
+	}))
+	defer server.Close()
+
+	source := &JWTTokenSource{JWKSURL: server.URL}
+	_, _, err := source.fetchSigningKeys(ctx, "")
+	expected := fmt.Sprintf("during GET %s: response is larger than %d bytes", server.URL, jwksMaxResponseSize)
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestTokenValidatorWithBearerTokenSource(t *testing.T) {
+	iss := newJWTTestIssuer(t)
+	v := &TokenValidator{
+		Enforcer: must.ReturnT(policy.NewEnforcer(map[string]string{"project:show": "role:reader and project_id:project-1"}))(t),
+		BearerTokenSource: &JWTTokenSource{
+			Issuer:   iss.Server.URL,
+			Audience: "my-service",
+			JWKSURL:  iss.Server.URL + "/keys",
+			ClaimMapping: map[string]string{
+				"user_id":    "sub",
+				"project_id": "project",
+			},
+		},
+	}
+	token := iss.Sign(t, "RS256", "rsa", map[string]any{
+		"iss":     iss.Server.URL,
+		"aud":     "my-service",
+		"sub":     "service-account-1",
+		"project": "project-1",
+		"roles":   []string{"reader"},
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+
+	checkToken := func(header, value string) *Token {
+		r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		r.Header.Set(header, value)
+		return v.CheckToken(r)
+	}
+
+	// a valid bearer token is accepted and can be used for policy checks
+	tok := checkToken("Authorization", "Bearer "+token)
+	if tok.Err != nil {
+		t.Fatal(tok.Err.Error())
+	}
+	assert.DeepEqual(t, "UserUUID", tok.UserUUID(), "service-account-1")
+	assert.DeepEqual(t, "Check(project:show)", tok.Check("project:show"), true)
+
+	// an invalid bearer token is rejected
+	tok = checkToken("Authorization", "Bearer "+token+"x")
+	assert.DeepEqual(t, "Check(project:show)", tok.Check("project:show"), false)
+	if tok.Err == nil {
+		t.Error("expected error for invalid bearer token, but got none")
+	}
+
+	// other authorization schemes are not handled by the BearerTokenSource
+	tok = checkToken("Authorization", "Basic Zm9vOmJhcg==")
+	assert.DeepEqual(t, "error for Basic auth", tok.Err.Error(), "X-Auth-Token header missing")
+}
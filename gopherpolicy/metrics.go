@@ -0,0 +1,130 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AuthMetrics tracks the outcomes of token validations and policy checks, as
+// well as the latency of token validations in Keystone. This is intended for
+// alerting on spikes of authentication errors.
+//
+// Construct it with NewAuthMetrics() and put it in TokenValidator.Metrics:
+//
+//	validator := &gopherpolicy.TokenValidator{
+//		IdentityV3: identityV3,
+//		Metrics:    gopherpolicy.NewAuthMetrics(nil),
+//	}
+type AuthMetrics struct {
+	validationCounter  *prometheus.CounterVec
+	policyCheckCounter *prometheus.CounterVec
+	keystoneDuration   prometheus.Histogram
+}
+
+// NewAuthMetrics creates an AuthMetrics instance and registers its metrics
+// with the given registerer, or with the default registerer if nil is given.
+// The following metrics are registered:
+//
+//   - "gopherpolicy_token_validations" (counter, labels: "result"): incremented
+//     for each token checked by TokenValidator.CheckToken() and for each set of
+//     credentials checked by TokenValidator.CheckCredentials(), with result
+//     "success", "missing" (if the request did not contain any token),
+//     "expired" (if Keystone does not know the token, which is what it reports
+//     for expired or revoked tokens, or if a bearer token has expired) or
+//     "failure" (for all other errors, e.g. unreachable Keystone).
+//   - "gopherpolicy_policy_checks" (counter, labels: "rule", "result"):
+//     incremented by Token.Require() and Token.Check() for tokens that were
+//     validated successfully, with result "allowed" or "denied".
+//   - "gopherpolicy_keystone_request_duration_seconds" (histogram): the
+//     duration of each token validation that went to Keystone (i.e. that was
+//     not answered from the cache).
+func NewAuthMetrics(registerer prometheus.Registerer) *AuthMetrics {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	m := &AuthMetrics{
+		validationCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gopherpolicy_token_validations",
+			Help: "Counter for token validations, by result.",
+		}, []string{"result"}),
+		policyCheckCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gopherpolicy_policy_checks",
+			Help: "Counter for policy checks on validated tokens, by rule name and result.",
+		}, []string{"rule", "result"}),
+		keystoneDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "gopherpolicy_keystone_request_duration_seconds",
+			Help:    "Duration of token validations in Keystone.",
+			Buckets: prometheus.DefBuckets,
+		}),
+	}
+	registerer.MustRegister(m.validationCounter)
+	registerer.MustRegister(m.policyCheckCounter)
+	registerer.MustRegister(m.keystoneDuration)
+
+	// make sure that the series exist, so that rate() works from the start
+	for _, result := range []string{"success", "missing", "expired", "failure"} {
+		m.validationCounter.WithLabelValues(result).Add(0)
+	}
+	return m
+}
+
+// All methods accept a nil *AuthMetrics and do nothing in that case.
+
+func (m *AuthMetrics) observeValidation(t *Token) {
+	if m == nil {
+		return
+	}
+	var result string
+	switch {
+	case t.Err == nil:
+		result = "success"
+	case errors.Is(t.Err, errTokenMissing):
+		result = "missing"
+	case gophercloud.ResponseCodeIs(t.Err, http.StatusNotFound) || errors.Is(t.Err, errTokenExpired):
+		result = "expired"
+	default:
+		result = "failure"
+	}
+	m.validationCounter.WithLabelValues(result).Inc()
+}
+
+func (m *AuthMetrics) observePolicyCheck(rule string, allowed bool) {
+	if m == nil {
+		return
+	}
+	result := "denied"
+	if allowed {
+		result = "allowed"
+	}
+	m.policyCheckCounter.WithLabelValues(rule, result).Inc()
+}
+
+func (m *AuthMetrics) observeKeystoneRequest(duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.keystoneDuration.Observe(duration.Seconds())
+}
@@ -0,0 +1,121 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestAuthMetrics(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	// this Keystone does not know any tokens
+	keystone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "token not found", http.StatusNotFound)
+	}))
+	defer keystone.Close()
+
+	registry := prometheus.NewPedanticRegistry()
+	v := &TokenValidator{
+		IdentityV3: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{HTTPClient: *keystone.Client()},
+			Endpoint:       keystone.URL + "/v3/",
+		},
+		Enforcer: must.ReturnT(newEnforcer(map[string]string{
+			"project:show":   "role:member",
+			"project:delete": "role:admin",
+		}))(t),
+		Cacher:  InMemoryCacher(),
+		Metrics: NewAuthMetrics(registry),
+	}
+
+	// a valid token is put into the cache, so that we do not need Keystone for it
+	s := serializableToken{
+		Token:     tokens.Token{ID: "valid-token", ExpiresAt: time.Now().Add(time.Hour)},
+		TokenData: keystoneToken{Roles: []keystoneTokenThing{{ID: "role1", Name: "member"}}},
+		CachedAt:  time.Now(),
+	}
+	v.Cacher.StoreTokenPayload(ctx, "valid-token", must.ReturnT(json.Marshal(s))(t))
+
+	checkToken := func(tokenStr string) *Token {
+		r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		if tokenStr != "" {
+			r.Header.Set("X-Auth-Token", tokenStr)
+		}
+		return v.CheckToken(r)
+	}
+	token := checkToken("valid-token")
+	assert.DeepEqual(t, "Check(project:show)", token.Check("project:show"), true)
+	assert.DeepEqual(t, "Check(project:show)", token.Check("project:show"), true)
+	assert.DeepEqual(t, "Check(project:delete)", token.Check("project:delete"), false)
+	token = checkToken("unknown-token")
+	if token.Err == nil {
+		t.Error("expected error for unknown token, but got none")
+	}
+	assert.DeepEqual(t, "Check(project:show)", token.Check("project:show"), false)
+	_ = checkToken("")
+
+	// credentials checked without a request are counted as well
+	token = v.CheckCredentials(ctx, "credentials", func() TokenResult {
+		var result tokens.CreateResult
+		result.Err = errors.New("Keystone is down")
+		return result
+	})
+	assert.DeepEqual(t, "CheckCredentials error", token.Err.Error(), "Keystone is down")
+
+	values := make(map[string]float64)
+	for _, family := range must.ReturnT(registry.Gather())(t) {
+		for _, metric := range family.GetMetric() {
+			labels := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			key := family.GetName() + "{" + strings.Join(labels, ",") + "}"
+			if family.GetType().String() == "HISTOGRAM" {
+				values[key+" count"] = float64(metric.GetHistogram().GetSampleCount())
+			} else {
+				values[key] = metric.GetCounter().GetValue()
+			}
+		}
+	}
+	assert.DeepEqual(t, "metric values", values, map[string]float64{
+		"gopherpolicy_token_validations{result=success}":                1,
+		"gopherpolicy_token_validations{result=expired}":                1,
+		"gopherpolicy_token_validations{result=missing}":                1,
+		"gopherpolicy_token_validations{result=failure}":                1,
+		"gopherpolicy_policy_checks{result=allowed,rule=project:show}":  2,
+		"gopherpolicy_policy_checks{result=denied,rule=project:delete}": 1,
+		"gopherpolicy_keystone_request_duration_seconds{} count":        1,
+	})
+}
@@ -0,0 +1,84 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+type tokenContextKey struct{}
+
+// TokenMiddleware returns a middleware that makes the request's token
+// available to handlers through TokenFromRequest() and Require(). This
+// avoids the boilerplate of calling CheckToken() at the start of every
+// handler. With package httpapi, it can be used like this:
+//
+//	handler := httpapi.Compose(
+//		myAPI,
+//		httpapi.WithGlobalMiddleware(gopherpolicy.TokenMiddleware(validator)),
+//	)
+//
+//	func (a *MyAPI) handleGetThing(w http.ResponseWriter, r *http.Request) {
+//		token, ok := gopherpolicy.Require(w, r, "thing:show")
+//		if !ok {
+//			return
+//		}
+//		...
+//	}
+//
+// The token is only checked when a handler asks for it for the first time,
+// so endpoints that do not require authentication (e.g. health checks) do not
+// cause any requests to Keystone.
+func TokenMiddleware(v Validator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			getToken := sync.OnceValue(func() *Token { return v.CheckToken(r) })
+			ctx := context.WithValue(r.Context(), tokenContextKey{}, getToken)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// TokenFromRequest returns the token for a request that went through
+// TokenMiddleware(). The token is checked on the first call for each request,
+// and the same token is returned by all subsequent calls.
+//
+// If the request did not go through TokenMiddleware(), a Token with a non-nil
+// Err is returned, so that authorization checks fail safely.
+func TokenFromRequest(r *http.Request) *Token {
+	getToken, ok := r.Context().Value(tokenContextKey{}).(func() *Token)
+	if !ok {
+		return &Token{Err: errors.New("request did not go through gopherpolicy.TokenMiddleware()")}
+	}
+	return getToken()
+}
+
+// Require is a shorthand for TokenFromRequest(r).Require(w, rule). If the
+// token is invalid or does not have the required permission, an error
+// response is written (401 or 403, respectively) and false is returned. The
+// token is returned in either case, so that handlers can use it for further
+// checks or to obtain information about the user.
+func Require(w http.ResponseWriter, r *http.Request, rule string) (*Token, bool) {
+	token := TokenFromRequest(r)
+	return token, token.Require(w, rule)
+}
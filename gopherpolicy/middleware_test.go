@@ -0,0 +1,89 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	policy "github.com/databus23/goslo.policy"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+type countingValidator struct {
+	Enforcer Enforcer
+	Calls    int
+}
+
+func (v *countingValidator) CheckToken(r *http.Request) *Token {
+	v.Calls++
+	roles := []string{r.Header.Get("X-Test-Role")}
+	return &Token{Enforcer: v.Enforcer, Context: policy.Context{Roles: roles}}
+}
+
+func TestTokenMiddleware(t *testing.T) {
+	enforcer, err := policy.NewEnforcer(map[string]string{"thing:show": "role:member"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	validator := &countingValidator{Enforcer: enforcer}
+
+	handler := TokenMiddleware(validator)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthcheck" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, ok := Require(w, r, "thing:show")
+		if !ok {
+			return
+		}
+		// the token is only checked once per request
+		_ = TokenFromRequest(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		Path           string
+		Role           string
+		ExpectedStatus int
+		ExpectedCalls  int
+	}{
+		// endpoints that do not ask for the token do not cause a token check
+		{"/healthcheck", "", http.StatusNoContent, 0},
+		{"/things", "member", http.StatusOK, 1},
+		{"/things", "reader", http.StatusForbidden, 2},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, tc.Path, http.NoBody)
+		req.Header.Set("X-Test-Role", tc.Role)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.DeepEqual(t, "status for "+tc.Role, rec.Code, tc.ExpectedStatus)
+		assert.DeepEqual(t, "CheckToken calls", validator.Calls, tc.ExpectedCalls)
+	}
+
+	// without the middleware, requests are rejected as unauthorized
+	rec := httptest.NewRecorder()
+	_, ok := Require(rec, httptest.NewRequest(http.MethodGet, "/things", http.NoBody), "thing:show")
+	assert.DeepEqual(t, "Require result", ok, false)
+	assert.DeepEqual(t, "status without middleware", rec.Code, http.StatusUnauthorized)
+}
@@ -29,6 +29,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	policy "github.com/databus23/goslo.policy"
@@ -61,6 +62,25 @@ type Cacher interface {
 	LoadTokenPayload(ctx context.Context, credentials string) []byte
 }
 
+// CacheInvalidator is an optional interface for a Cacher that can remove
+// individual entries from the cache. It is implemented by InMemoryCacher().
+// See TokenValidator.InvalidateCredentials() for how it is used.
+type CacheInvalidator interface {
+	// InvalidateTokenPayload removes the payload for the given credentials from
+	// the cache, if there is one.
+	InvalidateTokenPayload(ctx context.Context, credentials string)
+}
+
+// BearerTokenSource is the interface for validating tokens that are not issued
+// by Keystone, but presented in an "Authorization: Bearer" header. It is
+// implemented by JWTTokenSource. See TokenValidator.BearerTokenSource for how
+// it is used.
+type BearerTokenSource interface {
+	// CheckBearerToken checks the validity of the given token, and returns the
+	// policy.Context describing its owner for the evaluation of policy rules.
+	CheckBearerToken(ctx context.Context, token string) (policy.Context, error)
+}
+
 // TokenValidator combines an Identity v3 client to validate tokens (AuthN), and
 // a policy.Enforcer to check access permissions (AuthZ).
 type TokenValidator struct {
@@ -69,6 +89,41 @@ type TokenValidator struct {
 	Enforcer Enforcer
 	// Cacher can be used to cache validated tokens.
 	Cacher Cacher
+	// BearerTokenSource can be set to also accept tokens from a different
+	// identity provider (e.g. OIDC service accounts via JWTTokenSource). If
+	// set, requests without X-Auth-Token, but with an "Authorization: Bearer"
+	// header are validated through it instead of through Keystone. Tokens
+	// obtained this way do not have a ProviderClient and are not cached.
+	BearerTokenSource BearerTokenSource
+	// Metrics can be set to record the outcomes of token validations and
+	// policy checks in Prometheus metrics (see NewAuthMetrics() for details).
+	Metrics *AuthMetrics
+
+	// If non-zero, each request to Keystone in CheckToken() is aborted if it
+	// takes longer than this. (In CheckCredentials(), the provided callback is
+	// responsible for enforcing timeouts.)
+	ValidationTimeout time.Duration
+	// If non-zero, cached tokens are only used for this long after they were
+	// validated. Afterwards, they are validated again. By default, cached
+	// tokens are used until they expire.
+	CacheMaxAge time.Duration
+	// If non-zero, cached tokens that are older than CacheMaxAge, but not older
+	// than CacheMaxAge + StaleWhileRevalidate, are still accepted, while the
+	// token is revalidated in the background. This keeps API latency stable
+	// when Keystone is slow, at the cost of accepting tokens that may have been
+	// revoked within this time span. Ignored if CacheMaxAge is zero.
+	StaleWhileRevalidate time.Duration
+
+	// cache keys for which a background revalidation is currently running (values are of type *revalidation)
+	revalidating sync.Map
+}
+
+// State of a background revalidation in TokenValidator.revalidating.
+type revalidation struct {
+	mutex sync.Mutex
+	// set by InvalidateCredentials(), so that the revalidation does not put the
+	// invalidated credentials back into the cache
+	invalidated bool
 }
 
 // LoadPolicyFile creates v.Enforcer from the given policy file.
@@ -80,48 +135,109 @@ type TokenValidator struct {
 // If `yamlUnmarshal` is given as nil, `json.Unmarshal` from the standard
 // library will be used, so only policy.json files will be understood.
 func (v *TokenValidator) LoadPolicyFile(path string, yamlUnmarshal func(in []byte, out any) error) error {
+	rules, err := ReadPolicyFile(path, yamlUnmarshal)
+	if err != nil {
+		return err
+	}
+	v.Enforcer, err = newEnforcer(rules)
+	if err != nil {
+		return fmt.Errorf("while parsing policy rules found in %s: %w", path, err)
+	}
+	return nil
+}
+
+// ReadPolicyFile reads the rules from the given policy file without building
+// an Enforcer from them. This is used by LoadPolicyFile, but can also be used
+// in tests together with CoverageRecorder.
+//
+// The second argument has the same meaning as for LoadPolicyFile.
+func ReadPolicyFile(path string, yamlUnmarshal func(in []byte, out any) error) (map[string]string, error) {
 	unmarshal := yamlUnmarshal
 	if yamlUnmarshal == nil {
 		unmarshal = json.Unmarshal
 		if strings.HasSuffix(path, ".yaml") {
-			return fmt.Errorf("LoadPolicyFile cannot parse %s because YAML support is not available", path)
+			return nil, fmt.Errorf("cannot parse %s because YAML support is not available", path)
 		}
 	}
 
 	bytes, err := os.ReadFile(path)
 	if err != nil {
-		return err // no fmt.Errorf() necessary, errors from package os are already very descriptive
+		return nil, err // no fmt.Errorf() necessary, errors from package os are already very descriptive
 	}
 	var rules map[string]string
 	err = unmarshal(bytes, &rules)
 	if err != nil {
-		return fmt.Errorf("while parsing structure of %s: %w", path, err)
-	}
-	v.Enforcer, err = policy.NewEnforcer(rules)
-	if err != nil {
-		return fmt.Errorf("while parsing policy rules found in %s: %w", path, err)
+		return nil, fmt.Errorf("while parsing structure of %s: %w", path, err)
 	}
-	return nil
+	return rules, nil
 }
 
 // CheckToken checks the validity of the request's X-Auth-Token in Keystone, and
 // returns a Token instance for checking authorization. Any errors that occur
 // during this function are deferred until Require() is called.
+//
+// If the request also has an X-Service-Token header, that token is validated
+// as well, and its identity is added to the token's policy context (see
+// ServiceRolesCheck for details).
+//
+// If v.BearerTokenSource is set, requests with an "Authorization: Bearer"
+// header instead of X-Auth-Token are validated through it.
 func (v *TokenValidator) CheckToken(r *http.Request) *Token {
+	token := v.checkToken(r)
+	v.Metrics.observeValidation(token)
+	return token
+}
+
+// Returned by CheckToken() for requests without any token. This is recognized by AuthMetrics.
+var errTokenMissing = errors.New("X-Auth-Token header missing")
+
+func (v *TokenValidator) checkToken(r *http.Request) *Token {
 	tokenStr := r.Header.Get("X-Auth-Token")
+	if tokenStr == "" && v.BearerTokenSource != nil {
+		bearerToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok {
+			return v.checkBearerToken(r.Context(), bearerToken)
+		}
+	}
 	if tokenStr == "" {
-		return &Token{Err: errors.New("X-Auth-Token header missing")}
+		return &Token{Err: errTokenMissing}
 	}
 
-	token := v.CheckCredentials(r.Context(), tokenStr, func() TokenResult {
-		return tokens.Get(r.Context(), v.IdentityV3, tokenStr)
-	})
+	token := v.checkCredentials(r.Context(), tokenStr, v.keystoneTokenCheck(tokenStr))
+	if serviceTokenStr := r.Header.Get("X-Service-Token"); serviceTokenStr != "" && token.Err == nil {
+		token = v.addServiceToken(r.Context(), token, serviceTokenStr)
+	}
 	token.Context.Logger = logg.Debug
 	logg.Debug("token has auth = %v", token.Context.Auth)
 	logg.Debug("token has roles = %v", token.Context.Roles)
 	return token
 }
 
+// Returns the check function for validating the given token string in Keystone.
+func (v *TokenValidator) keystoneTokenCheck(tokenStr string) func(context.Context) TokenResult {
+	return func(ctx context.Context) TokenResult {
+		if v.ValidationTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, v.ValidationTimeout)
+			defer cancel()
+		}
+		start := time.Now()
+		defer func() { v.Metrics.observeKeystoneRequest(time.Since(start)) }()
+		return tokens.Get(ctx, v.IdentityV3, tokenStr)
+	}
+}
+
+func (v *TokenValidator) checkBearerToken(ctx context.Context, tokenStr string) *Token {
+	c, err := v.BearerTokenSource.CheckBearerToken(ctx, tokenStr)
+	if err != nil {
+		return &Token{Err: err}
+	}
+	c.Logger = logg.Debug
+	logg.Debug("bearer token has auth = %v", c.Auth)
+	logg.Debug("bearer token has roles = %v", c.Roles)
+	return &Token{Enforcer: v.Enforcer, Context: c, metrics: v.Metrics}
+}
+
 // CheckCredentials is a more generic version of CheckToken that can also be
 // used when the user supplies credentials instead of a Keystone token.
 //
@@ -132,7 +248,37 @@ func (v *TokenValidator) CheckToken(r *http.Request) *Token {
 // The `cacheKey` argument shall be a string that identifies the given
 // credentials. This key is used for caching the TokenResult in `v.Cacher` if
 // that is non-nil.
+//
+// If `v.StaleWhileRevalidate` is used, `check` may be called in a background
+// goroutine after this function has returned.
 func (v *TokenValidator) CheckCredentials(ctx context.Context, cacheKey string, check func() TokenResult) *Token {
+	token := v.checkCredentials(ctx, cacheKey, func(context.Context) TokenResult { return check() })
+	v.Metrics.observeValidation(token)
+	return token
+}
+
+// InvalidateCredentials removes the cached token payload for the given cache
+// key (i.e. the token string for tokens checked with CheckToken(), or the
+// cacheKey given to CheckCredentials()) from `v.Cacher`, so that the next
+// check goes to Keystone again. This is useful e.g. when a token is known to
+// have been revoked.
+//
+// This has no effect if `v.Cacher` is nil or does not implement
+// CacheInvalidator. If a background revalidation (see StaleWhileRevalidate)
+// is running for the same cache key, its result will not be stored in the cache.
+func (v *TokenValidator) InvalidateCredentials(ctx context.Context, cacheKey string) {
+	if rv, ok := v.revalidating.Load(cacheKey); ok {
+		rv := rv.(*revalidation)
+		rv.mutex.Lock()
+		rv.invalidated = true
+		rv.mutex.Unlock()
+	}
+	if c, ok := v.Cacher.(CacheInvalidator); ok {
+		c.InvalidateTokenPayload(ctx, cacheKey)
+	}
+}
+
+func (v *TokenValidator) checkCredentials(ctx context.Context, cacheKey string, check func(context.Context) TokenResult) *Token {
 	// prefer cached token payload over actually talking to Keystone (but fallback
 	// to Keystone if the token payload deserialization fails)
 	if v.Cacher != nil {
@@ -140,21 +286,45 @@ func (v *TokenValidator) CheckCredentials(ctx context.Context, cacheKey string,
 		if payload != nil {
 			var s serializableToken
 			err := json.Unmarshal(payload, &s)
-			if err == nil && s.Token.ExpiresAt.After(time.Now()) {
-				t := v.TokenFromGophercloudResult(s)
-				if t.Err == nil {
-					return t
+			now := time.Now()
+			if err == nil && s.Token.ExpiresAt.After(now) {
+				isFresh := v.CacheMaxAge == 0 || now.Before(s.CachedAt.Add(v.CacheMaxAge))
+				isUsable := isFresh || now.Before(s.CachedAt.Add(v.CacheMaxAge+v.StaleWhileRevalidate))
+				if isUsable {
+					t := v.TokenFromGophercloudResult(s)
+					if t.Err == nil {
+						if !isFresh {
+							v.revalidateInBackground(ctx, cacheKey, check)
+						}
+						return t
+					}
 				}
 			}
 		}
 	}
 
-	t := v.TokenFromGophercloudResult(check())
+	return v.validateAndStore(ctx, cacheKey, check, nil)
+}
+
+// If `rv` is not nil, the result is not stored if the revalidation was invalidated in the meantime.
+func (v *TokenValidator) validateAndStore(ctx context.Context, cacheKey string, check func(context.Context) TokenResult, rv *revalidation) *Token {
+	t := v.TokenFromGophercloudResult(check(ctx))
 
 	// cache token payload if valid
 	if t.Err == nil && v.Cacher != nil {
-		payload, err := json.Marshal(t.serializable)
+		s := t.serializable
+		s.CachedAt = time.Now()
+		payload, err := json.Marshal(s)
 		if err == nil {
+			if rv != nil {
+				// holding the lock while storing ensures that a concurrent
+				// InvalidateCredentials() either prevents the store or removes the stored payload
+				rv.mutex.Lock()
+				defer rv.mutex.Unlock()
+				if rv.invalidated {
+					return t
+				}
+			}
 			v.Cacher.StoreTokenPayload(ctx, cacheKey, payload)
 		}
 	}
@@ -162,6 +332,39 @@ func (v *TokenValidator) CheckCredentials(ctx context.Context, cacheKey string,
 	return t
 }
 
+func (v *TokenValidator) revalidateInBackground(ctx context.Context, cacheKey string, check func(context.Context) TokenResult) {
+	// only one revalidation at a time for each cache key
+	rv := &revalidation{}
+	_, isRunning := v.revalidating.LoadOrStore(cacheKey, rv)
+	if isRunning {
+		return
+	}
+
+	// the revalidation shall not be canceled when the original request is done
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer v.revalidating.Delete(cacheKey)
+		t := v.validateAndStore(ctx, cacheKey, check, rv)
+		if t.Err != nil {
+			logg.Debug("background revalidation of cached token failed: %s", t.Err.Error())
+			// if Keystone rejected the token (e.g. because it was revoked), the stale
+			// cache entry must not be used any further; on other errors (e.g. Keystone
+			// being unreachable), keep serving it until the stale window has passed
+			if isAuthFailure(t.Err) {
+				v.InvalidateCredentials(ctx, cacheKey)
+			}
+		}
+	}()
+}
+
+// isAuthFailure returns whether the given error indicates that Keystone has
+// rejected the checked credentials.
+func isAuthFailure(err error) bool {
+	return gophercloud.ResponseCodeIs(err, http.StatusUnauthorized) ||
+		gophercloud.ResponseCodeIs(err, http.StatusForbidden) ||
+		gophercloud.ResponseCodeIs(err, http.StatusNotFound)
+}
+
 // TokenFromGophercloudResult creates a Token instance from a gophercloud Result
 // from the tokens.Create() or tokens.Get() requests from package
 // github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens.
@@ -194,6 +397,7 @@ func (v *TokenValidator) TokenFromGophercloudResult(result TokenResult) *Token {
 				return openstack.V3EndpointURL(catalog, opts)
 			},
 		},
+		metrics: v.Metrics,
 		serializable: serializableToken{
 			Token:          *token,
 			TokenData:      tokenData,
@@ -0,0 +1,168 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"maps"
+	"slices"
+
+	policy "github.com/databus23/goslo.policy"
+)
+
+// TestingT is the subset of *testing.T that is used by PolicyTest.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// PolicyFixture describes a token for use in a PolicyTest. The fields
+// correspond to the attributes of a Keystone token that are visible to policy
+// rules. Fields that are left empty are not present in the policy context.
+type PolicyFixture struct {
+	Roles []string
+
+	UserID         string
+	UserName       string
+	UserDomainID   string
+	UserDomainName string
+
+	// for project-scoped tokens
+	ProjectID         string
+	ProjectName       string
+	ProjectDomainID   string
+	ProjectDomainName string
+
+	// for domain-scoped tokens
+	DomainID   string
+	DomainName string
+
+	// request variables that are referenced by policy rules (e.g. "target.project.id")
+	Request map[string]string
+}
+
+// Context returns the policy context that a token with these attributes would
+// have. This is the same context that is built by TokenValidator for a token
+// returned by Keystone.
+func (f PolicyFixture) Context() policy.Context {
+	t := keystoneToken{
+		DomainScope: keystoneTokenThing{ID: f.DomainID, Name: f.DomainName},
+		ProjectScope: keystoneTokenThingInDomain{
+			keystoneTokenThing: keystoneTokenThing{ID: f.ProjectID, Name: f.ProjectName},
+			Domain:             keystoneTokenThing{ID: f.ProjectDomainID, Name: f.ProjectDomainName},
+		},
+		User: keystoneTokenThingInDomain{
+			keystoneTokenThing: keystoneTokenThing{ID: f.UserID, Name: f.UserName},
+			Domain:             keystoneTokenThing{ID: f.UserDomainID, Name: f.UserDomainName},
+		},
+	}
+	for _, role := range f.Roles {
+		t.Roles = append(t.Roles, keystoneTokenThing{Name: role})
+	}
+	c := t.ToContext()
+	maps.Copy(c.Request, f.Request)
+	return c
+}
+
+// PolicyTest is a small DSL for unit tests of policy files. It checks the
+// outcomes of policy rules for a set of named token fixtures, so that changes
+// to the policy file can be reviewed together with the accompanying changes
+// in expected outcomes.
+//
+//	rules, err := gopherpolicy.ReadPolicyFile("policy.yaml", yaml.Unmarshal)
+//	enforcer, err := policy.NewEnforcer(rules)
+//	pt := gopherpolicy.NewPolicyTest(t, enforcer, map[string]gopherpolicy.PolicyFixture{
+//		"admin":          {Roles: []string{"admin"}, ProjectID: "p1"},
+//		"member":         {Roles: []string{"member"}, ProjectID: "p1"},
+//		"foreign-member": {Roles: []string{"member"}, ProjectID: "p2"},
+//	})
+//	pt.AssertAllowed("project:show", "admin", "member")
+//	pt.AssertForbidden("project:delete", "member")
+//	pt.AssertAllowedExactly("project:edit", "admin")
+//
+// The enforcer can be a CoverageRecorder to additionally check that the
+// policy test covers all rules from the policy file.
+type PolicyTest struct {
+	t        TestingT
+	enforcer Enforcer
+	fixtures map[string]PolicyFixture
+}
+
+// NewPolicyTest builds a PolicyTest for the given enforcer and fixtures.
+func NewPolicyTest(t TestingT, enforcer Enforcer, fixtures map[string]PolicyFixture) *PolicyTest {
+	if enforcer == nil {
+		panic("NewPolicyTest called with enforcer == nil!")
+	}
+	return &PolicyTest{t, enforcer, fixtures}
+}
+
+// AssertAllowed checks that the given rule allows access for each of the
+// given fixtures, and generates a test error for each fixture where it does not.
+func (pt *PolicyTest) AssertAllowed(rule string, fixtureNames ...string) {
+	pt.t.Helper()
+	for _, name := range fixtureNames {
+		pt.check(rule, name, true)
+	}
+}
+
+// AssertForbidden checks that the given rule denies access for each of the
+// given fixtures, and generates a test error for each fixture where it does not.
+func (pt *PolicyTest) AssertForbidden(rule string, fixtureNames ...string) {
+	pt.t.Helper()
+	for _, name := range fixtureNames {
+		pt.check(rule, name, false)
+	}
+}
+
+// AssertAllowedExactly checks that the given rule allows access for the given
+// fixtures, and denies access for all other fixtures of this PolicyTest.
+// This is the most thorough assertion, since it also catches policy changes
+// that unintentionally grant access to more users.
+func (pt *PolicyTest) AssertAllowedExactly(rule string, fixtureNames ...string) {
+	pt.t.Helper()
+	for _, name := range fixtureNames {
+		pt.check(rule, name, true)
+	}
+	for _, name := range slices.Sorted(maps.Keys(pt.fixtures)) {
+		if !slices.Contains(fixtureNames, name) {
+			pt.check(rule, name, false)
+		}
+	}
+}
+
+func (pt *PolicyTest) check(rule, fixtureName string, expected bool) {
+	pt.t.Helper()
+	fixture, exists := pt.fixtures[fixtureName]
+	if !exists {
+		pt.t.Errorf("policy rule %q: unknown fixture %q", rule, fixtureName)
+		return
+	}
+	actual := pt.enforcer.Enforce(rule, fixture.Context())
+	if actual != expected {
+		pt.t.Errorf("policy rule %q: expected fixture %q to be %s, but it was %s",
+			rule, fixtureName, describePolicyOutcome(expected), describePolicyOutcome(actual))
+	}
+}
+
+func describePolicyOutcome(allowed bool) string {
+	if allowed {
+		return "allowed"
+	}
+	return "forbidden"
+}
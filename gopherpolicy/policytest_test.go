@@ -0,0 +1,87 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"fmt"
+	"testing"
+
+	policy "github.com/databus23/goslo.policy"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+type recordingTestingT struct {
+	errors []string
+}
+
+func (t *recordingTestingT) Helper() {}
+
+func (t *recordingTestingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestPolicyTest(t *testing.T) {
+	enforcer, err := policy.NewEnforcer(map[string]string{
+		"context_is_admin":   "role:admin",
+		"project_member":     "role:member and project_id:%(target.project.id)s",
+		"project:show":       "rule:context_is_admin or rule:project_member",
+		"project:edit":       "rule:context_is_admin",
+		"project:frobnicate": "@",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	fixtures := map[string]PolicyFixture{
+		"admin":          {Roles: []string{"admin"}, ProjectID: "p1"},
+		"member":         {Roles: []string{"member"}, ProjectID: "p1", Request: map[string]string{"target.project.id": "p1"}},
+		"foreign-member": {Roles: []string{"member"}, ProjectID: "p2", Request: map[string]string{"target.project.id": "p1"}},
+	}
+
+	// the fixture is converted into the same policy context as a real token
+	assert.DeepEqual(t, "Context()", fixtures["member"].Context(), policy.Context{
+		Roles: []string{"member"},
+		Auth: map[string]string{
+			"project_id": "p1",
+			"tenant_id":  "p1",
+		},
+		Request: map[string]string{"target.project.id": "p1"},
+	})
+
+	// assertions that hold do not generate errors
+	pt := NewPolicyTest(t, enforcer, fixtures)
+	pt.AssertAllowed("project:show", "admin", "member")
+	pt.AssertForbidden("project:show", "foreign-member")
+	pt.AssertAllowedExactly("project:edit", "admin")
+	pt.AssertAllowedExactly("project:frobnicate", "admin", "member", "foreign-member")
+
+	// assertions that do not hold generate errors
+	rt := &recordingTestingT{}
+	pt = NewPolicyTest(rt, enforcer, fixtures)
+	pt.AssertAllowed("project:edit", "member", "nobody")
+	pt.AssertForbidden("project:show", "admin")
+	pt.AssertAllowedExactly("project:show", "admin")
+	assert.DeepEqual(t, "errors", rt.errors, []string{
+		`policy rule "project:edit": expected fixture "member" to be allowed, but it was forbidden`,
+		`policy rule "project:edit": unknown fixture "nobody"`,
+		`policy rule "project:show": expected fixture "admin" to be forbidden, but it was allowed`,
+		`policy rule "project:show": expected fixture "member" to be forbidden, but it was allowed`,
+	})
+}
@@ -0,0 +1,191 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	policy "github.com/databus23/goslo.policy"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// ReloadingEnforcer is an Enforcer that is backed by a policy file, and that
+// can replace its rules with the current contents of that file at runtime.
+// This allows policy changes to be rolled out without restarting the service.
+// Construct it with NewReloadingEnforcer(), and call Run() to have it reload
+// automatically:
+//
+//	enforcer, err := gopherpolicy.NewReloadingEnforcer("/etc/myservice/policy.yaml", yaml.Unmarshal, nil)
+//	if err != nil {
+//		logg.Fatal(err.Error())
+//	}
+//	go enforcer.Run(ctx, 30*time.Second)
+//	validator := gopherpolicy.TokenValidator{Enforcer: enforcer, ...}
+//
+// If the reloaded policy file cannot be read or parsed, the previous rules
+// remain in effect. Requests that are being authorized while a reload happens
+// see either the old or the new rules, never a mixture of both.
+//
+// The following metric is registered with the registerer given to
+// NewReloadingEnforcer() (or with prometheus.DefaultRegisterer if nil):
+//
+//   - "gopherpolicy_policy_reloads" (counter, labels: "result"): incremented
+//     whenever a reload is attempted, with result "success" or "failure".
+type ReloadingEnforcer struct {
+	path          string
+	yamlUnmarshal func(in []byte, out any) error
+	current       atomic.Pointer[policy.Enforcer]
+	reloadCounter *prometheus.CounterVec
+
+	// the state of the policy file as of the last reload attempt
+	mutex        sync.Mutex
+	lastFileInfo os.FileInfo
+}
+
+// NewReloadingEnforcer builds a ReloadingEnforcer for the given policy file.
+// The second argument has the same meaning as for
+// TokenValidator.LoadPolicyFile(). The policy file is loaded immediately, and
+// an error is returned if that fails.
+func NewReloadingEnforcer(path string, yamlUnmarshal func(in []byte, out any) error, registerer prometheus.Registerer) (*ReloadingEnforcer, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	e := &ReloadingEnforcer{
+		path:          path,
+		yamlUnmarshal: yamlUnmarshal,
+		reloadCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gopherpolicy_policy_reloads",
+			Help: "Counter for attempts to reload the policy file.",
+		}, []string{"result"}),
+	}
+
+	err := e.reload()
+	if err != nil {
+		return nil, err
+	}
+	registerer.MustRegister(e.reloadCounter)
+	return e, nil
+}
+
+// Enforce implements the Enforcer interface.
+func (e *ReloadingEnforcer) Enforce(rule string, c policy.Context) bool {
+	return e.current.Load().Enforce(rule, c)
+}
+
+// Reload reads the policy file again, and replaces the current rules if the
+// file could be read and parsed successfully. Otherwise, the current rules
+// remain in effect and an error is returned.
+func (e *ReloadingEnforcer) Reload() error {
+	err := e.reload()
+	if err == nil {
+		e.reloadCounter.WithLabelValues("success").Inc()
+	} else {
+		e.reloadCounter.WithLabelValues("failure").Inc()
+	}
+	return err
+}
+
+func (e *ReloadingEnforcer) reload() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// remember the file state before reading, so that a concurrent modification
+	// will be picked up by the next check in Run()
+	fileInfo, err := os.Stat(e.path)
+	if err != nil {
+		return err // no fmt.Errorf() necessary, errors from package os are already very descriptive
+	}
+	e.lastFileInfo = fileInfo
+
+	rules, err := ReadPolicyFile(e.path, e.yamlUnmarshal)
+	if err != nil {
+		return err
+	}
+	enforcer, err := newEnforcer(rules)
+	if err != nil {
+		return fmt.Errorf("while parsing policy rules found in %s: %w", e.path, err)
+	}
+	e.current.Store(enforcer)
+	return nil
+}
+
+// Returns whether the policy file has changed since the last reload attempt,
+// judging by its size and modification time.
+func (e *ReloadingEnforcer) hasChanged() bool {
+	fileInfo, err := os.Stat(e.path)
+	if err != nil {
+		// the file may be in the middle of being replaced; try again next time
+		return false
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	last := e.lastFileInfo
+	return last == nil || !fileInfo.ModTime().Equal(last.ModTime()) || fileInfo.Size() != last.Size()
+}
+
+// Run reloads the policy file whenever the process receives SIGHUP, and
+// whenever the policy file is found to have changed when checking it every
+// `interval` (if `interval` is not zero). The outcome of each reload is
+// logged. This function blocks until the given context expires, so it is
+// usually called in a separate goroutine.
+func (e *ReloadingEnforcer) Run(ctx context.Context, interval time.Duration) {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGHUP)
+	defer signal.Stop(signalChan)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signalChan:
+			e.reloadAndLog("SIGHUP received")
+		case <-tick:
+			if e.hasChanged() {
+				e.reloadAndLog("policy file has changed")
+			}
+		}
+	}
+}
+
+func (e *ReloadingEnforcer) reloadAndLog(reason string) {
+	err := e.Reload()
+	if err == nil {
+		logg.Info("reloaded policy from %s (%s)", e.path, reason)
+	} else {
+		logg.Error("could not reload policy from %s (%s), keeping previous policy: %s", e.path, reason, err.Error())
+	}
+}
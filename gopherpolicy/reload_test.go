@@ -0,0 +1,87 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	policy "github.com/databus23/goslo.policy"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestReloadingEnforcer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy := func(contents string, modTime time.Time) {
+		t.Helper()
+		err := os.WriteFile(path, []byte(contents), 0o666)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		// set the mtime explicitly, since the filesystem's clock may be too coarse to observe the change
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	startTime := time.Now().Add(-time.Hour)
+	writePolicy(`{"project:show": "role:member"}`, startTime)
+
+	registry := prometheus.NewPedanticRegistry()
+	enforcer, err := NewReloadingEnforcer(path, nil, registry)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx := policy.Context{Roles: []string{"member"}}
+	assert.DeepEqual(t, "Enforce(project:show)", enforcer.Enforce("project:show", ctx), true)
+	assert.DeepEqual(t, "hasChanged", enforcer.hasChanged(), false)
+
+	// a broken policy file is rejected, and the previous rules remain in effect
+	writePolicy(`{"project:show": `, startTime.Add(time.Minute))
+	assert.DeepEqual(t, "hasChanged", enforcer.hasChanged(), true)
+	if enforcer.Reload() == nil {
+		t.Error("expected Reload() to fail on broken policy file, but it succeeded")
+	}
+	assert.DeepEqual(t, "Enforce(project:show)", enforcer.Enforce("project:show", ctx), true)
+	assert.DeepEqual(t, "hasChanged", enforcer.hasChanged(), false)
+
+	// a valid policy file replaces the previous rules
+	writePolicy(`{"project:show": "role:admin"}`, startTime.Add(2*time.Minute))
+	assert.DeepEqual(t, "hasChanged", enforcer.hasChanged(), true)
+	if err := enforcer.Reload(); err != nil {
+		t.Error(err.Error())
+	}
+	assert.DeepEqual(t, "Enforce(project:show)", enforcer.Enforce("project:show", ctx), false)
+
+	// check metrics
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	actual := make(map[string]float64)
+	for _, metric := range families[0].GetMetric() {
+		actual[metric.GetLabel()[0].GetValue()] = metric.GetCounter().GetValue()
+	}
+	assert.DeepEqual(t, "reload counts", actual, map[string]float64{"success": 1, "failure": 1})
+}
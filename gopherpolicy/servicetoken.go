@@ -0,0 +1,96 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	policy "github.com/databus23/goslo.policy"
+)
+
+// The keys in policy.Context.Auth that describe the identity of a token. When
+// a policy context describes more than one identity, the secondary identity is
+// added with a prefix (see addServiceToken and Token.Impersonate).
+var identityAuthKeys = []string{
+	"user_id",
+	"user_name",
+	"user_domain_id",
+	"user_domain_name",
+	"project_id",
+	"project_name",
+	"project_domain_id",
+	"project_domain_name",
+	"domain_id",
+	"domain_name",
+	"application_credential_id",
+	"application_credential_name",
+}
+
+// The prefix for keys in policy.Context.Auth that describe the service token.
+const serviceTokenPrefix = "service_"
+
+// Validates the given service token (from the X-Service-Token header), and
+// adds its identity to the policy context of the given user token.
+func (v *TokenValidator) addServiceToken(ctx context.Context, token *Token, serviceTokenStr string) *Token {
+	serviceToken := v.checkCredentials(ctx, serviceTokenStr, v.keystoneTokenCheck(serviceTokenStr))
+	if serviceToken.Err != nil {
+		return &Token{Err: fmt.Errorf("while validating X-Service-Token: %w", serviceToken.Err)}
+	}
+
+	for _, key := range identityAuthKeys {
+		if value := serviceToken.Context.Auth[key]; value != "" {
+			token.Context.Auth[serviceTokenPrefix+key] = value
+		}
+	}
+	token.Context.Auth[serviceTokenPrefix+"roles"] = strings.Join(serviceToken.Context.Roles, ",")
+	return token
+}
+
+// ServiceRolesCheck is a check for policy rules of the form
+// "service_roles:<role>", which match if the request has an X-Service-Token
+// with the given role. Enforcers built by this package (through
+// TokenValidator.LoadPolicyFile or NewReloadingEnforcer) have this check
+// registered already. Other enforcers need to register it explicitly:
+//
+//	enforcer, err := policy.NewEnforcer(rules)
+//	enforcer.AddCheck("service_roles", gopherpolicy.ServiceRolesCheck)
+//
+// This matches the behavior of oslo.policy, where rules like
+// "service_roles:service" are commonly used for service-to-service
+// elevation. Besides the service roles, the identity of the service token is
+// available in the policy context under keys like "service_user_id" or
+// "service_project_id", e.g. for rules like "service_user_id:%(target.user_id)s".
+func ServiceRolesCheck(c policy.Context, key, match string) bool {
+	roles := c.Auth[serviceTokenPrefix+"roles"]
+	return roles != "" && slices.Contains(strings.Split(roles, ","), match)
+}
+
+// Like policy.NewEnforcer, but also registers the checks provided by this package.
+func newEnforcer(rules map[string]string) (*policy.Enforcer, error) {
+	enforcer, err := policy.NewEnforcer(rules)
+	if err != nil {
+		return nil, err
+	}
+	enforcer.AddCheck("service_roles", ServiceRolesCheck)
+	return enforcer, nil
+}
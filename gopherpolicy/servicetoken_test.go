@@ -0,0 +1,110 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package gopherpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestServiceToken(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	v := &TokenValidator{
+		IdentityV3: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}},
+		Enforcer: must.ReturnT(newEnforcer(map[string]string{
+			"project:show":   "role:member",
+			"project:repair": "role:member and service_roles:service",
+		}))(t),
+		Cacher: InMemoryCacher(),
+	}
+
+	// put both tokens into the cache, so that we do not need to talk to Keystone
+	storeInCache := func(cacheKey string, data keystoneToken) {
+		s := serializableToken{
+			Token:     tokens.Token{ID: cacheKey, ExpiresAt: time.Now().Add(time.Hour)},
+			TokenData: data,
+			CachedAt:  time.Now(),
+		}
+		v.Cacher.StoreTokenPayload(ctx, cacheKey, must.ReturnT(json.Marshal(s))(t))
+	}
+	thing := func(id, name string) keystoneTokenThing {
+		return keystoneTokenThing{ID: id, Name: name}
+	}
+	thingInDomain := func(id, name string) keystoneTokenThingInDomain {
+		return keystoneTokenThingInDomain{keystoneTokenThing: thing(id, name), Domain: thing("domain1", "Default")}
+	}
+	storeInCache("user-token", keystoneToken{
+		User:         thingInDomain("user1", "alice"),
+		ProjectScope: thingInDomain("project1", "alice-project"),
+		Roles:        []keystoneTokenThing{thing("role1", "member")},
+	})
+	storeInCache("service-token", keystoneToken{
+		User:         thingInDomain("user2", "nova"),
+		ProjectScope: thingInDomain("project2", "service"),
+		Roles:        []keystoneTokenThing{thing("role2", "service"), thing("role3", "admin")},
+	})
+
+	checkToken := func(serviceToken string) *Token {
+		r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		r.Header.Set("X-Auth-Token", "user-token")
+		if serviceToken != "" {
+			r.Header.Set("X-Service-Token", serviceToken)
+		}
+		return v.CheckToken(r)
+	}
+
+	// without service token, elevated rules do not match
+	token := checkToken("")
+	if token.Err != nil {
+		t.Fatal(token.Err.Error())
+	}
+	assert.DeepEqual(t, "Check(project:show)", token.Check("project:show"), true)
+	assert.DeepEqual(t, "Check(project:repair)", token.Check("project:repair"), false)
+
+	// with service token, both identities are in the policy context
+	token = checkToken("service-token")
+	if token.Err != nil {
+		t.Fatal(token.Err.Error())
+	}
+	assert.DeepEqual(t, "Check(project:show)", token.Check("project:show"), true)
+	assert.DeepEqual(t, "Check(project:repair)", token.Check("project:repair"), true)
+	assert.DeepEqual(t, "UserName", token.UserName(), "alice")
+	assert.DeepEqual(t, "service_user_name", token.Context.Auth["service_user_name"], "nova")
+	assert.DeepEqual(t, "service_project_id", token.Context.Auth["service_project_id"], "project2")
+	assert.DeepEqual(t, "service_roles", token.Context.Auth["service_roles"], "service,admin")
+	assert.DeepEqual(t, "Roles", token.Context.Roles, []string{"member"})
+
+	// an invalid service token invalidates the whole request
+	token = checkToken("invalid-token")
+	if token.Err == nil {
+		t.Error("expected error for invalid X-Service-Token, but got none")
+	}
+	assert.DeepEqual(t, "Check(project:show)", token.Check("project:show"), false)
+}
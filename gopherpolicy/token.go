@@ -22,6 +22,7 @@ package gopherpolicy
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	policy "github.com/databus23/goslo.policy"
 	"github.com/gophercloud/gophercloud/v2"
@@ -48,8 +49,11 @@ type Token struct {
 	// When AuthN succeeds, contains information about the client token which can
 	// be used to check access permissions.
 	Context policy.Context
-	// When AuthN succeeds, contains a fully-initialized ProviderClient with which
-	// this process can use the OpenStack API on behalf of the authenticated user.
+	// When AuthN with a Keystone token succeeds, contains a fully-initialized
+	// ProviderClient with which this process can use the OpenStack API on behalf
+	// of the authenticated user. This is nil for tokens that were not issued by
+	// Keystone (i.e. tokens from a BearerTokenSource) and for tokens obtained
+	// through Impersonate(), so callers must check for nil before using it.
 	ProviderClient *gophercloud.ProviderClient
 	// When AuthN fails, contains the deferred AuthN error.
 	Err error
@@ -57,6 +61,8 @@ type Token struct {
 	// When AuthN succeeds, contains all the information needed to serialize this
 	// token in SerializeTokenForCache.
 	serializable serializableToken
+	// If not nil, policy checks are recorded here. Inherited from struct TokenValidator.
+	metrics *AuthMetrics
 }
 
 // Require checks if the given token has the given permission according to the
@@ -71,7 +77,7 @@ func (t *Token) Require(w http.ResponseWriter, rule string) bool {
 		return false
 	}
 
-	if !t.Enforcer.Enforce(rule, t.Context) {
+	if !t.enforce(rule) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return false
 	}
@@ -80,7 +86,13 @@ func (t *Token) Require(w http.ResponseWriter, rule string) bool {
 
 // Check is like Require, but does not write error responses.
 func (t *Token) Check(rule string) bool {
-	return t.Err == nil && t.Enforcer.Enforce(rule, t.Context)
+	return t.Err == nil && t.enforce(rule)
+}
+
+func (t *Token) enforce(rule string) bool {
+	allowed := t.Enforcer.Enforce(rule, t.Context)
+	t.metrics.observePolicyCheck(rule, allowed)
+	return allowed
 }
 
 // UserUUID returns the UUID of the user for whom this token was issued, or ""
@@ -151,8 +163,12 @@ func (t *Token) ApplicationCredentialID() string {
 }
 
 // AsInitiator implements the audittools.UserInfo interface.
+//
+// If this token was obtained through Impersonate(), the initiator describes
+// the impersonated user, and has an attachment named "impersonator" that
+// describes the impersonator in the same format.
 func (t *Token) AsInitiator(host cadf.Host) cadf.Resource {
-	return cadf.Resource{
+	initiator := cadf.Resource{
 		TypeURI: internal.StandardUserInfoTypeURI,
 		// information about user
 		Name:   t.UserName(),
@@ -167,6 +183,14 @@ func (t *Token) AsInitiator(host cadf.Host) cadf.Resource {
 		ProjectDomainName: t.ProjectScopeDomainName(),
 		AppCredentialID:   t.ApplicationCredentialID(),
 	}
+
+	if t.IsImpersonated() {
+		attachment, err := cadf.NewJSONAttachment("impersonator", t.impersonator().AsInitiator(host))
+		if err == nil { // cannot fail, since cadf.Resource is always serializable
+			initiator.Attachments = append(initiator.Attachments, attachment)
+		}
+	}
+	return initiator
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -176,6 +200,8 @@ type serializableToken struct {
 	Token          tokens.Token          `json:"token_id"`
 	TokenData      keystoneToken         `json:"token_data"`
 	ServiceCatalog []tokens.CatalogEntry `json:"catalog"`
+	// only set in payloads stored in a Cacher
+	CachedAt time.Time `json:"cached_at"`
 }
 
 // ExtractInto implements the TokenResult interface.
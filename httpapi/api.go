@@ -19,6 +19,7 @@
 package httpapi
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -95,10 +96,64 @@ func WithoutLogging() API {
 // similar effect to using mux.Router.Use() inside an API's AddTo() method, but
 // explicitly declaring a global middleware like this is clearer than hiding it
 // in one specific API implementation.
+//
+// This is equivalent to WithMiddleware(globalMiddleware, MiddlewareBeforeRouting).
 func WithGlobalMiddleware(globalMiddleware func(http.Handler) http.Handler) API {
+	return WithMiddleware(globalMiddleware, MiddlewareBeforeRouting)
+}
+
+// MiddlewarePosition is the type of the position argument of WithMiddleware().
+//
+// The http.Handler returned by Compose() processes requests in the following order:
+//
+//  1. middlewares given to WithMiddleware() with position MiddlewareOutsideLogging
+//  2. the builtin middleware of this package (logging, metrics, audit events, load shedding)
+//  3. middlewares given to WithMiddleware() with position MiddlewareBeforeRouting
+//  4. routing (matching the request to an endpoint of one of the APIs)
+//  5. middlewares given to WithMiddleware() with position MiddlewareAfterRouting
+//  6. the request handler of the matched endpoint
+type MiddlewarePosition int
+
+const (
+	// MiddlewareOutsideLogging inserts a middleware around the builtin
+	// middleware. Requests that are answered by this middleware without calling
+	// the next handler will not be logged or counted in metrics.
+	MiddlewareOutsideLogging MiddlewarePosition = iota
+	// MiddlewareBeforeRouting inserts a middleware between the builtin
+	// middleware and the router. The middleware sees all requests, including
+	// those that do not match any endpoint.
+	MiddlewareBeforeRouting
+	// MiddlewareAfterRouting inserts a middleware between the router and the
+	// request handler, using mux.Router.Use(). The middleware only sees
+	// requests that match an endpoint, and can inspect the matched route with
+	// mux.CurrentRoute() and mux.Vars().
+	MiddlewareAfterRouting
+)
+
+// WithMiddleware can be given as an argument to Compose() to insert a
+// middleware into the entire http.Handler returned by Compose(), at a defined
+// position (see type MiddlewarePosition for details).
+//
+// If multiple middlewares are inserted at the same position, the one that was
+// given to Compose() last will be the outermost one, i.e. it will see the
+// request first.
+func WithMiddleware(mw func(http.Handler) http.Handler, position MiddlewarePosition) API {
+	if mw == nil {
+		panic("WithMiddleware called with mw == nil!")
+	}
+
 	return pseudoAPI{
 		configure: func(m *middleware) {
-			m.inner = globalMiddleware(m.inner)
+			switch position {
+			case MiddlewareOutsideLogging:
+				m.outerMiddlewares = append(m.outerMiddlewares, mw)
+			case MiddlewareBeforeRouting:
+				m.inner = mw(m.inner)
+			case MiddlewareAfterRouting:
+				m.routerMiddlewares = append(m.routerMiddlewares, mw)
+			default:
+				panic(fmt.Sprintf("WithMiddleware called with unknown position: %d", position))
+			}
 		},
 	}
 }
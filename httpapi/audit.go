@@ -0,0 +1,119 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sapcc/go-api-declarations/cadf"
+
+	"github.com/sapcc/go-bits/audittools"
+)
+
+// AuditClassifier is the type of the callback that is given to WithAuditTrail().
+//
+// It is called once for each mutating request (POST, PUT, PATCH or DELETE)
+// after the request handler has finished, and decides which action was
+// attempted on which target object. The final status code of the response is
+// provided for reference. If no audit event shall be emitted for this request,
+// a nil Target shall be returned.
+//
+// The request given to the classifier is the one that was given to
+// SetAuditUser(), so router variables like mux.Vars(r) can be inspected.
+type AuditClassifier func(r *http.Request, statusCode int) (cadf.Action, audittools.Target)
+
+// WithAuditTrail can be given as an argument to Compose() to emit audit events
+// for all mutating requests (POST, PUT, PATCH and DELETE) served by the
+// http.Handler returned by Compose().
+//
+// The action and target of each event are determined by the provided
+// classifier function. The user that initiated the request must be reported
+// by the request handler by calling SetAuditUser(), usually directly after
+// successful token validation. Requests where no user has been reported (e.g.
+// because the token was missing or invalid) will not generate audit events.
+func WithAuditTrail(auditor audittools.Auditor, classify AuditClassifier) API {
+	if auditor == nil {
+		panic("WithAuditTrail called with auditor == nil!")
+	}
+	if classify == nil {
+		panic("WithAuditTrail called with classify == nil!")
+	}
+
+	return pseudoAPI{
+		configure: func(m *middleware) {
+			m.auditor = auditor
+			m.auditClassifier = classify
+		},
+	}
+}
+
+// SetAuditUser reports the user that initiated this request. This is only
+// required for requests served by a http.Handler that was built with
+// WithAuditTrail() and is otherwise a no-op. The user is usually a
+// *gopherpolicy.Token instance, for example:
+//
+//	token := validator.CheckToken(r)
+//	if !token.Require(w, "object:create") {
+//		return
+//	}
+//	httpapi.SetAuditUser(r, token)
+func SetAuditUser(r *http.Request, user audittools.UserInfo) {
+	fn, ok := r.Context().Value(oobFunctionKey).(func(oobMessage))
+	if !ok {
+		panic("httpapi.SetAuditUser called from request handler outside of httpapi.Compose()!")
+	}
+	fn(oobMessage{
+		AuditUser:    user,
+		AuditRequest: r,
+	})
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// Called by the middleware after the request has been served.
+func (m middleware) recordAuditEvent(r *http.Request, statusCode int, user audittools.UserInfo) {
+	if m.auditor == nil || user == nil || r == nil || !isMutatingMethod(r.Method) {
+		return
+	}
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	action, target := m.auditClassifier(r, statusCode)
+	if target == nil {
+		return
+	}
+	m.auditor.Record(audittools.Event{
+		Time:       time.Now(),
+		Request:    r,
+		User:       user,
+		ReasonCode: statusCode,
+		Action:     action,
+		Target:     target,
+	})
+}
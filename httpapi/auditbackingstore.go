@@ -0,0 +1,79 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sapcc/go-bits/audittools"
+	"github.com/sapcc/go-bits/respondwith"
+)
+
+// AuditBackingStoreAPI is an API with one endpoint, "GET
+// /debug/audit-backing-store", that reports how many audit events are
+// currently buffered in the given backing store, without removing them (see
+// audittools.InspectBackingStore() for details). The response body is a
+// JSON-encoded audittools.BackingStoreSummary, for example:
+//
+//	{"event_count":42,"total_bytes":51234,"oldest_write_time":"2025-01-02T03:04:05.678Z","newest_write_time":"2025-01-02T04:05:06.789Z"}
+//
+// The Store must implement audittools.InspectableBackingStore, otherwise
+// requests fail with status 500.
+//
+// This allows operators to gauge the backlog of undelivered audit events
+// during an outage of the message broker.
+//
+// Only requests for which IsAuthorized returns true are served. Since the
+// summary reveals information about user activity, this should usually be
+// restricted to requests from localhost, e.g. with
+// pprofapi.IsRequestFromLocalhost. Requests to this endpoint are never logged.
+type AuditBackingStoreAPI struct {
+	Store        audittools.BackingStore
+	IsAuthorized func(r *http.Request) bool
+}
+
+// AddTo implements the API interface.
+func (a AuditBackingStoreAPI) AddTo(r *mux.Router) {
+	if a.Store == nil {
+		panic("AuditBackingStoreAPI.AddTo() called with Store == nil!")
+	}
+	if a.IsAuthorized == nil {
+		panic("AuditBackingStoreAPI.AddTo() called with IsAuthorized == nil!")
+	}
+
+	r.Methods("GET").Path("/debug/audit-backing-store").HandlerFunc(a.handleGet)
+}
+
+func (a AuditBackingStoreAPI) handleGet(w http.ResponseWriter, r *http.Request) {
+	IdentifyEndpoint(r, "/debug/audit-backing-store")
+	SkipRequestLog(r)
+	if !a.IsAuthorized(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	summary, err := audittools.InspectBackingStore(a.Store)
+	if respondwith.ErrorText(w, err) {
+		return
+	}
+	respondwith.JSON(w, http.StatusOK, summary)
+}
@@ -22,6 +22,8 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+
+	"github.com/sapcc/go-bits/audittools"
 )
 
 // Compose constructs an http.Handler serving all the provided APIs. The Handler
@@ -33,16 +35,41 @@ func Compose(apis ...API) http.Handler {
 	r := mux.NewRouter()
 	m := middleware{inner: r}
 
+	var documentedAPIs []DocumentedAPI
 	for _, a := range apis {
 		switch a := a.(type) {
 		case pseudoAPI:
 			a.configure(&m)
 		default:
 			a.AddTo(r)
+			if da, ok := a.(DocumentedAPI); ok {
+				documentedAPIs = append(documentedAPIs, da)
+			}
 		}
 	}
 
+	if m.openAPIInfo != nil {
+		addOpenAPIDocumentTo(r, *m.openAPIInfo, documentedAPIs)
+	}
+
+	if m.automaticMethodHandling {
+		r.MethodNotAllowedHandler = methodNotAllowedHandler{r}
+	}
+	if m.automaticMethodHandling || m.trailingSlashPolicy != TrailingSlashStrict {
+		// if one of the APIs has configured a NotFoundHandler, it is used for requests that we do not handle ourselves
+		r.NotFoundHandler = notFoundHandler{r, m.automaticMethodHandling, m.trailingSlashPolicy, r.NotFoundHandler}
+	}
+
+	// the middleware that was given last shall be the outermost one,
+	// but the router runs its middlewares in order (first is outermost)
+	for idx := len(m.routerMiddlewares) - 1; idx >= 0; idx-- {
+		r.Use(m.routerMiddlewares[idx])
+	}
+
 	h := http.Handler(m)
+	for _, mw := range m.outerMiddlewares {
+		h = mw(h)
+	}
 	return h
 }
 
@@ -53,8 +80,10 @@ const oobFunctionKey oobKey = "gobits-httpapi-oob"
 // An out-of-band message that can be sent from the middleware to the request
 // through one of the functions below.
 type oobMessage struct {
-	SkipLog    bool
-	EndpointID string
+	SkipLog      bool
+	EndpointID   string
+	AuditUser    audittools.UserInfo
+	AuditRequest *http.Request
 }
 
 // SkipRequestLog indicates that this request shall not have a
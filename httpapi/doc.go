@@ -33,17 +33,52 @@
 // package logg (by default, to stderr) using the special log level "REQUEST".
 //
 // To suppress logging of specific requests, call SkipRequestLog() somewhere
-// inside the handler.
+// inside the handler. To suppress or downgrade log lines at runtime (including
+// the request log), add LogLevelOverridesAPI to Compose(). To redact parts of
+// the log line or add extra fields to it, use WithRequestLogCustomizer(). To
+// only log a fraction of successful requests for high-traffic endpoints, use
+// WithRequestLogSampling().
 //
 // # Metrics
 //
 // Each HTTP request counts towards the following histogram metrics:
 // "httpmux_first_byte_seconds", "httpmux_response_duration_seconds",
 // "httpmux_request_size_bytes" and "httpmux_response_size_bytes".
+// If WithLoadShedding() is used, requests rejected because of overload are
+// counted in the counter metric "httpmux_shed_requests_total".
+// Long-lived connections like WebSockets or Server-Sent Events can be moved out
+// of the histogram metrics with WithStreamingMetrics().
 //
 // The buckets for these histogram metrics, as well as the application name
 // reported in the labels on these metrics, can be configured if
 // ConfigureMetrics() is called before Compose(). Otherwise, a default choice of
 // buckets will be applied and the application name will be read from the
 // Component() method of package github.com/sapcc/go-api-declarations/bininfo.
+//
+// # Static files
+//
+// Embedded static assets (e.g. a small dashboard or API documentation) can be
+// served with StaticFilesAPI(). Responses carry an ETag and a Cache-Control
+// header, and are covered by the logging and metrics described above, with all
+// files being counted under the endpoint ID "<prefix>/*".
+//
+// # Audit events
+//
+// If WithAuditTrail() is given to Compose(), an audit event is recorded for
+// each mutating request (POST, PUT, PATCH, DELETE) whose handler has reported
+// the requesting user by calling SetAuditUser().
+//
+// # Error reporting
+//
+// If WithErrorReporter() is given to Compose(), server errors and panics in
+// request handlers are forwarded to an error tracking service, e.g. Sentry
+// through SentryReporter. Panics are then also recovered by the middleware.
+//
+// # API documentation
+//
+// APIs can describe their routes by implementing the DocumentedAPI interface.
+// If WithOpenAPIDocument() is given to Compose(), an OpenAPI 3 document
+// describing these routes is served at "GET /openapi.json". Since Compose()
+// checks that each documented route exists in the router, the document cannot
+// drift away from the actual set of endpoints.
 package httpapi
@@ -0,0 +1,156 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// DynamicAPI is an API whose endpoints can be changed while the http.Handler
+// returned by Compose() is already serving requests. This is useful for
+// plugin-style services that load endpoint modules based on configuration
+// that can be reloaded at runtime:
+//
+//	dynAPI := httpapi.NewDynamicAPI()
+//	handler := httpapi.Compose(staticAPI, dynAPI)
+//	go httpext.ListenAndServeContext(ctx, ":8080", handler)
+//
+//	// later, after a configuration reload
+//	dynAPI.Register("foo", fooAPI)
+//	dynAPI.Unregister("bar")
+//
+// Each API group is identified by a name that is chosen by the caller.
+// Endpoints of the statically registered APIs take precedence over those of
+// the DynamicAPI if they are given to Compose() before the DynamicAPI.
+//
+// When the set of API groups changes, all endpoints are registered in a new
+// router that replaces the previous one atomically. Each request is matched
+// and served by the same router, so requests that arrive during the change
+// are served either entirely by the old or entirely by the new set of API
+// groups, and requests that are already being served are not affected.
+//
+// Requests for a path of a dynamic endpoint with a method that the endpoint
+// does not support are answered with "404 Not Found" instead of "405 Method
+// Not Allowed", because the router of the DynamicAPI is not visible to the
+// outer router. For the same reason, WithAutomaticMethodHandling() does not
+// cover dynamic endpoints: They do not get automatic answers to OPTIONS
+// requests, and do not get an Allow header.
+type DynamicAPI struct {
+	mutex  sync.RWMutex
+	apis   map[string]API
+	router *mux.Router
+}
+
+// NewDynamicAPI creates a new DynamicAPI without any API groups.
+func NewDynamicAPI() *DynamicAPI {
+	return &DynamicAPI{
+		apis:   make(map[string]API),
+		router: mux.NewRouter(),
+	}
+}
+
+// AddTo implements the API interface.
+func (d *DynamicAPI) AddTo(r *mux.Router) {
+	// The router is selected once during matching and then used as the handler
+	// for this request, so that a concurrent Register() or Unregister() cannot
+	// cause the request to be matched by one router, but served by another.
+	// The route does not get a handler of its own, since mux.Router would
+	// prefer that one over match.Handler in some cases.
+	r.MatcherFunc(func(req *http.Request, match *mux.RouteMatch) bool {
+		router := d.currentRouter()
+		var innerMatch mux.RouteMatch
+		if !router.Match(req, &innerMatch) {
+			return false
+		}
+		match.Handler = router
+		return true
+	})
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (d *DynamicAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.currentRouter().ServeHTTP(w, r)
+}
+
+func (d *DynamicAPI) currentRouter() *mux.Router {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.router
+}
+
+// Register adds the given API group under the given name. If an API group
+// with the same name was already registered, it is replaced.
+//
+// The given API must not be one of the special APIs like WithoutLogging()
+// that configure the http.Handler returned by Compose().
+func (d *DynamicAPI) Register(name string, api API) {
+	if _, ok := api.(pseudoAPI); ok {
+		panic("DynamicAPI.Register called with an API that can only be given to Compose() directly!")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.apis[name] = api
+	d.rebuildRouter()
+}
+
+// Unregister removes the API group with the given name. Returns false if no
+// such API group was registered.
+func (d *DynamicAPI) Unregister(name string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, exists := d.apis[name]
+	if exists {
+		delete(d.apis, name)
+		d.rebuildRouter()
+	}
+	return exists
+}
+
+// RegisteredNames returns the names of all registered API groups in sorted order.
+func (d *DynamicAPI) RegisteredNames() []string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	names := make([]string, 0, len(d.apis))
+	for name := range d.apis {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Must be called with d.mutex held for writing.
+func (d *DynamicAPI) rebuildRouter() {
+	names := make([]string, 0, len(d.apis))
+	for name := range d.apis {
+		names = append(names, name)
+	}
+	slices.Sort(names) // for deterministic precedence between API groups
+
+	r := mux.NewRouter()
+	for _, name := range names {
+		d.apis[name].AddTo(r)
+	}
+	d.router = r
+}
@@ -0,0 +1,173 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// ErrorReport describes a server error or a panic that occurred while serving
+// a request. It is given to ErrorReporter.ReportError().
+type ErrorReport struct {
+	// The request that was being served. Its context is the request context,
+	// which may already be canceled by the time the report is delivered.
+	Request *http.Request
+	// The endpoint ID as reported by the handler through IdentifyEndpoint(),
+	// or "unknown" if the handler did not report it.
+	EndpointID string
+	// The request URL (path and query) as it appears in the request log line,
+	// i.e. after the changes made by WithRequestLogCustomizer().
+	URL string
+	// The value of the X-Request-Id or X-Openstack-Request-Id header on either
+	// the request or the response, or the empty string if there is none.
+	RequestID string
+	// The status code of the response.
+	StatusCode int
+	// For server errors, the response body (as it also appears in the log).
+	// For panics, a string representation of the panic value.
+	Message string
+	// Whether the error was a panic in the request handler.
+	IsPanic bool
+	// For panics, the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// ErrorReporter is the type of the reporter that is given to WithErrorReporter().
+//
+// ReportError is called synchronously by the middleware after the request
+// handler has returned. Implementations that talk to a remote service should
+// deliver the report in the background to avoid delaying the response.
+type ErrorReporter interface {
+	ReportError(report ErrorReport)
+}
+
+// WithErrorReporter can be given as an argument to Compose() to forward server
+// errors and panics to an error tracking service. SentryReporter is provided
+// as an implementation for Sentry and Sentry-compatible services.
+//
+// A report is sent for each request whose response has a 5xx status code and a
+// non-empty body, i.e. for all requests that generate a server error log line.
+//
+// Furthermore, panics in request handlers are recovered: The panic is logged
+// with a stack trace and reported, and if the handler has not written a
+// response yet, a generic 500 response is sent. If the handler has already
+// started writing its response, the middleware panics with
+// http.ErrAbortHandler after reporting, so that net/http aborts the connection
+// instead of presenting the truncated response as a successful one. Panics with
+// http.ErrAbortHandler in the handler are passed through unchanged, since they
+// are used to abort a response on purpose.
+func WithErrorReporter(reporter ErrorReporter) API {
+	if reporter == nil {
+		panic("WithErrorReporter called with reporter == nil!")
+	}
+
+	return pseudoAPI{
+		configure: func(m *middleware) {
+			m.errorReporter = reporter
+		},
+	}
+}
+
+// Information about a panic that was recovered by serveRecoveringPanic().
+type recoveredPanic struct {
+	Value any
+	Stack []byte
+	// If true, the response was already started when the panic occurred, so the
+	// connection needs to be aborted.
+	MustAbort bool
+}
+
+// Calls `serve` and, if it panics, recovers the panic and writes a generic
+// error response if possible.
+func serveRecoveringPanic(w *responseWriter, r *http.Request, serve func(http.ResponseWriter, *http.Request)) (result *recoveredPanic) {
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		err, ok := value.(error)
+		if ok && errors.Is(err, http.ErrAbortHandler) {
+			panic(value)
+		}
+
+		result = &recoveredPanic{Value: value, Stack: debug.Stack()}
+		logg.Error(`panic during "%s %s": %v\n%s`, r.Method, r.URL.String(), value, result.Stack)
+		switch {
+		case w.hijackedConn != nil:
+			// the handler has taken over the connection, so there is nothing we can do
+		case w.headersWritten:
+			result.MustAbort = true
+		default:
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			// do not report this generic message as a separate server error
+			w.errorMessageBuf.Reset()
+		}
+	}()
+
+	serve(w, r)
+	return nil
+}
+
+func (m middleware) reportError(r *http.Request, w *responseWriter, endpointID string, p *recoveredPanic) {
+	if m.errorReporter == nil {
+		return
+	}
+	report := ErrorReport{
+		Request:    r,
+		EndpointID: endpointID,
+		URL:        m.buildRequestLogLine(r, w.statusCode, w.bytesWritten, 0, "").URL,
+		RequestID:  findRequestID(r.Header, w.Header()),
+		StatusCode: w.statusCode,
+	}
+
+	switch {
+	case p != nil:
+		report.IsPanic = true
+		report.Message = fmt.Sprint(p.Value)
+		report.Stack = p.Stack
+		if report.StatusCode == 0 {
+			report.StatusCode = http.StatusInternalServerError
+		}
+	case w.errorMessageBuf.Len() > 0:
+		report.Message = strings.TrimSpace(w.errorMessageBuf.String())
+	default:
+		return
+	}
+	m.errorReporter.ReportError(report)
+}
+
+var requestIDHeaders = []string{"X-Request-Id", "X-Openstack-Request-Id"}
+
+func findRequestID(headerSets ...http.Header) string {
+	for _, hdr := range headerSets {
+		for _, key := range requestIDHeaders {
+			if value := hdr.Get(key); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// StrongETag computes a strong entity tag (e.g. `"0123456789abcdef"`) for the
+// given response payload. Strong ETags shall be used when the payload is
+// byte-for-byte identical for identical ETags.
+func StrongETag(payload []byte) string {
+	hash := sha256.Sum256(payload)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// WeakETag computes a weak entity tag (e.g. `W/"0123456789abcdef"`) for the
+// given payload. Weak ETags shall be used when payloads with the same ETag
+// are only semantically equivalent, e.g. when the payload is a representation
+// of the resource that is not itself sent in the response.
+func WeakETag(payload []byte) string {
+	return "W/" + StrongETag(payload)
+}
+
+// CheckConditionalRequest evaluates the If-Match and If-None-Match headers of
+// the given request against the current ETag of the requested resource, as
+// described in RFC 9110, section 13. The ETag is also written into the
+// response headers.
+//
+// If the request shall not be processed further, an appropriate response is
+// written (304 Not Modified or 412 Precondition Failed) and false is returned.
+// Otherwise, nothing is written and true is returned. Idiomatic usage looks
+// like this:
+//
+//	buf, err := json.Marshal(object)
+//	if respondwith.ErrorText(w, err) {
+//		return
+//	}
+//	if !httpapi.CheckConditionalRequest(w, r, httpapi.StrongETag(buf)) {
+//		return
+//	}
+//
+// For write requests like PUT or DELETE, this implements optimistic
+// concurrency: If the client sends the ETag of the resource as it knows it in
+// the If-Match header, the request will be rejected if the resource has been
+// changed in the meantime.
+//
+// If the resource does not exist, an empty string shall be given as etag.
+func CheckConditionalRequest(w http.ResponseWriter, r *http.Request, etag string) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+
+	// If-Match uses strong comparison (RFC 9110, section 13.1.1)
+	if header := r.Header.Get("If-Match"); header != "" {
+		if !matchesETagList(header, etag, true) {
+			http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+			return false
+		}
+	}
+
+	// If-None-Match uses weak comparison (RFC 9110, section 13.1.2)
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		if matchesETagList(header, etag, false) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotModified)
+			} else {
+				http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+			}
+			return false
+		}
+	}
+
+	return true
+}
+
+// Checks whether the value of an If-Match or If-None-Match header matches the given ETag.
+func matchesETagList(header, etag string, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return etag != ""
+	}
+	if etag == "" {
+		return false
+	}
+
+	for {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			return false
+		}
+		var candidate string
+		candidate, header = scanETag(header)
+		if candidate == "" {
+			return false // malformed header
+		}
+		if compareETags(candidate, etag, strong) {
+			return true
+		}
+	}
+}
+
+// Splits the first entity tag off the given string.
+// Returns an empty ETag if the input does not start with a well-formed ETag.
+func scanETag(input string) (etag, rest string) {
+	start := 0
+	if strings.HasPrefix(input, "W/") {
+		start = 2
+	}
+	if len(input) <= start || input[start] != '"' {
+		return "", input
+	}
+	end := strings.IndexByte(input[start+1:], '"')
+	if end < 0 {
+		return "", input
+	}
+	end += start + 2
+	return input[:end], input[end:]
+}
+
+func compareETags(a, b string, strong bool) bool {
+	aIsWeak := strings.HasPrefix(a, "W/")
+	bIsWeak := strings.HasPrefix(b, "W/")
+	if strong && (aIsWeak || bIsWeak) {
+		return false
+	}
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
@@ -20,24 +20,32 @@ package httpapi
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sapcc/go-api-declarations/cadf"
 
 	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/audittools"
+	"github.com/sapcc/go-bits/internal"
 	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/must"
 	"github.com/sapcc/go-bits/respondwith"
 )
 
@@ -193,8 +201,15 @@ func TestMetrics(t *testing.T) {
 		Method:       "GET",
 		Path:         "/metrics",
 		ExpectStatus: http.StatusOK,
-		ExpectBody:   assert.FixtureFile("fixtures/metrics.prom"),
-	}.Check(t, promhttpNormalizer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+		ExpectBody: assert.NormalizedFixtureFile{
+			Path: "fixtures/metrics.prom",
+			// remove the undeterministic values for the `..._seconds_sum` metrics
+			Normalize: assert.NormalizeByReplacing(assert.Replacement{
+				Regexp:      regexp.MustCompile(`(seconds_sum{[^{}]*}) \d*\.\d*(?m:$)`),
+				Replacement: "$1 VARYING",
+			}),
+		},
+	}.Check(t, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 }
 
 type metricsTestingAPI struct{}
@@ -220,28 +235,1271 @@ func (m metricsTestingAPI) handleRequest(w http.ResponseWriter, r *http.Request)
 	w.Write(bytes.Repeat([]byte("."), count)) //nolint:errcheck
 }
 
-func promhttpNormalizer(inner http.Handler) http.Handler {
-	// This middleware first collects a complete `GET /metrics` response, then
-	// does one very specific rewrite for test reproducability.
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// slurp the response from `GET /metrics`
-		rec := httptest.NewRecorder()
-		inner.ServeHTTP(rec, r)
-		resp := rec.Result()
+func TestAuditTrail(t *testing.T) {
+	auditor := audittools.NewMockAuditor()
+	h := Compose(
+		auditTestingAPI{},
+		WithAuditTrail(auditor, func(r *http.Request, statusCode int) (cadf.Action, audittools.Target) {
+			if strings.HasPrefix(r.URL.Path, "/unaudited/") {
+				return "", nil
+			}
+			return cadf.UpdateAction, auditTestingTarget(mux.Vars(r)["id"])
+		}),
+		WithoutLogging(),
+	)
+
+	// non-mutating requests do not generate events
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/objects/foo",
+		ExpectStatus: http.StatusNoContent,
+	}.Check(t, h)
+	auditor.ExpectEvents(t /*, nothing */)
+
+	// mutating requests generate events, including for failed requests
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/objects/foo",
+		ExpectStatus: http.StatusNoContent,
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/objects/bar",
+		Header:       map[string]string{"X-Fail": "yes"},
+		ExpectStatus: http.StatusConflict,
+		ExpectBody:   assert.StringData("conflict\n"),
+	}.Check(t, h)
+	auditor.ExpectEvents(t,
+		cadf.Event{
+			Action:      cadf.UpdateAction,
+			Outcome:     cadf.SuccessOutcome,
+			Reason:      cadf.Reason{ReasonType: "HTTP", ReasonCode: "204"},
+			Target:      cadf.Resource{TypeURI: "test/object", ID: "foo"},
+			RequestPath: "/objects/foo",
+		},
+		cadf.Event{
+			Action:      cadf.UpdateAction,
+			Outcome:     cadf.FailureOutcome,
+			Reason:      cadf.Reason{ReasonType: "HTTP", ReasonCode: "409"},
+			Target:      cadf.Resource{TypeURI: "test/object", ID: "bar"},
+			RequestPath: "/objects/bar",
+		},
+	)
+
+	// no event is generated if the classifier declines or if no user was reported
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/unaudited/foo",
+		ExpectStatus: http.StatusNoContent,
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/objects/foo",
+		Header:       map[string]string{"X-Anonymous": "yes"},
+		ExpectStatus: http.StatusNoContent,
+	}.Check(t, h)
+	auditor.ExpectEvents(t /*, nothing */)
+}
+
+type auditTestingAPI struct{}
+
+func (a auditTestingAPI) AddTo(r *mux.Router) {
+	r.Methods("GET", "PUT").Path("/objects/{id}").HandlerFunc(a.handleRequest)
+	r.Methods("PUT").Path("/unaudited/{id}").HandlerFunc(a.handleRequest)
+}
+
+func (a auditTestingAPI) handleRequest(w http.ResponseWriter, r *http.Request) {
+	IdentifyEndpoint(r, "/objects/:id")
+	if r.Header.Get("X-Anonymous") == "" {
+		SetAuditUser(r, auditTestingUser{})
+	}
+	if r.Header.Get("X-Fail") != "" {
+		http.Error(w, "conflict", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type auditTestingUser struct{}
+
+func (auditTestingUser) AsInitiator(host cadf.Host) cadf.Resource {
+	return cadf.Resource{TypeURI: internal.StandardUserInfoTypeURI, Name: "testuser", Host: &host}
+}
+
+type auditTestingTarget string
+
+func (t auditTestingTarget) Render() cadf.Resource {
+	return cadf.Resource{TypeURI: "test/object", ID: string(t)}
+}
+
+func TestAuditBackingStoreAPI(t *testing.T) {
+	store := must.Return(audittools.NewFileBackingStore(audittools.FileBackingStoreOpts{
+		Directory: t.TempDir(),
+		Registry:  prometheus.NewRegistry(),
+	}))
+	isAuthorized := func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" }
+	h := Compose(AuditBackingStoreAPI{Store: store, IsAuthorized: isAuthorized})
+
+	// unauthorized requests are rejected
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/debug/audit-backing-store",
+		ExpectStatus: http.StatusForbidden,
+		ExpectBody:   assert.StringData("forbidden\n"),
+	}.Check(t, h)
+
+	// empty store
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/debug/audit-backing-store",
+		Header:       map[string]string{"X-Admin": "yes"},
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.JSONObject{"event_count": 0, "total_bytes": 0},
+	}.Check(t, h)
+
+	// inspecting the store does not consume its events
+	must.Succeed(store.Write(cadf.Event{ID: "1", Action: cadf.CreateAction, EventTime: "2025-01-02T03:04:05.678+00:00"}))
+	must.Succeed(store.Write(cadf.Event{ID: "2", Action: cadf.DeleteAction, EventTime: "2025-01-02T03:04:06.789+00:00"}))
+	must.Succeed(store.Write(cadf.Event{ID: "3", Action: cadf.CreateAction, EventTime: "2025-01-02T03:04:07.890+00:00"}))
+	expected := must.Return(audittools.InspectBackingStore(store))
+	for range 2 {
+		_, body := assert.HTTPRequest{
+			Method:       "GET",
+			Path:         "/debug/audit-backing-store",
+			Header:       map[string]string{"X-Admin": "yes"},
+			ExpectStatus: http.StatusOK,
+		}.Check(t, h)
+		var summary audittools.BackingStoreSummary
+		must.Succeed(json.Unmarshal(body, &summary))
+		assert.DeepEqual(t, "event count", summary.EventCount, 3)
+		assert.DeepEqual(t, "total bytes", summary.TotalBytes, expected.TotalBytes)
+		assert.DeepEqual(t, "oldest write time", summary.OldestWriteTime.Equal(*expected.OldestWriteTime), true)
+		assert.DeepEqual(t, "newest write time", summary.NewestWriteTime.Equal(*expected.NewestWriteTime), true)
+	}
+}
+
+func TestLogLevelOverrides(t *testing.T) {
+	var buf bytes.Buffer
+	logg.SetLogger(log.New(&buf, "", 0))
+	defer logg.SetLevelOverrides(nil)
+
+	isAuthorized := func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" }
+	h := Compose(HealthCheckAPI{}, LogLevelOverridesAPI{IsAuthorized: isAuthorized})
+
+	// unauthorized requests are rejected
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/debug/log-level-overrides",
+		ExpectStatus: http.StatusForbidden,
+		ExpectBody:   assert.StringData("forbidden\n"),
+	}.Check(t, h)
 
-		// remove the undeterministic values for the `..._seconds_sum` metrics
-		buf, err := io.ReadAll(resp.Body)
-		if respondwith.ErrorText(w, err) {
+	// initially, there are no overrides
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/debug/log-level-overrides",
+		Header:       map[string]string{"X-Admin": "yes"},
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("[]"),
+	}.Check(t, h)
+
+	// suppress the request log and downgrade a specific error message
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/debug/log-level-overrides",
+		Header:       map[string]string{"X-Admin": "yes"},
+		Body:         assert.StringData(`[{"level":"REQUEST"},{"level":"ERROR","prefix":"known noise:","new_level":"INFO"}]`),
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData(`[{"level":"REQUEST","prefix":"","new_level":""},{"level":"ERROR","prefix":"known noise:","new_level":"INFO"}]`),
+	}.Check(t, h)
+
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/healthcheck",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("ok\n"),
+	}.Check(t, h)
+	logg.Error("known noise: %d", 42)
+	logg.Error("something else")
+	assert.DeepEqual(t, "log", buf.String(), "INFO: known noise: 42\nERROR: something else\n")
+
+	// malformed input is rejected without changing the overrides
+	buf.Reset()
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/debug/log-level-overrides",
+		Header:       map[string]string{"X-Admin": "yes"},
+		Body:         assert.StringData(`{`),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody:   assert.StringData("request body is not valid JSON: unexpected EOF\n"),
+	}.Check(t, h)
+	assert.DeepEqual(t, "override count", len(logg.GetLevelOverrides()), 2)
+	assert.DeepEqual(t, "log", buf.String(), "")
+}
+
+func TestConditionalRequests(t *testing.T) {
+	api := &etagTestingAPI{value: "foo"}
+	h := Compose(api, WithoutLogging())
+	etagFoo := StrongETag([]byte("foo"))
+	etagBar := StrongETag([]byte("bar"))
+
+	// unconditional request
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/value",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("foo"),
+		ExpectHeader: map[string]string{"ETag": etagFoo},
+	}.Check(t, h)
+
+	// If-None-Match for caching (weak comparison, so weak ETags also match)
+	for _, header := range []string{etagFoo, "W/" + etagFoo, "*", `"other", ` + etagFoo} {
+		assert.HTTPRequest{
+			Method:       "GET",
+			Path:         "/value",
+			Header:       map[string]string{"If-None-Match": header},
+			ExpectStatus: http.StatusNotModified,
+			ExpectBody:   assert.StringData(""),
+		}.Check(t, h)
+	}
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/value",
+		Header:       map[string]string{"If-None-Match": etagBar},
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("foo"),
+	}.Check(t, h)
+
+	// If-Match for optimistic concurrency (strong comparison, so weak ETags do not match)
+	for _, header := range []string{etagBar, "W/" + etagFoo, "garbage"} {
+		assert.HTTPRequest{
+			Method:       "PUT",
+			Path:         "/value",
+			Header:       map[string]string{"If-Match": header},
+			Body:         assert.StringData("qux"),
+			ExpectStatus: http.StatusPreconditionFailed,
+			ExpectBody:   assert.StringData("precondition failed\n"),
+		}.Check(t, h)
+	}
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/value",
+		Header:       map[string]string{"If-Match": etagFoo},
+		Body:         assert.StringData("bar"),
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("bar"),
+		ExpectHeader: map[string]string{"ETag": etagBar},
+	}.Check(t, h)
+
+	// If-None-Match on a write request is used to prevent overwriting an existing resource
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/value",
+		Header:       map[string]string{"If-None-Match": "*"},
+		Body:         assert.StringData("qux"),
+		ExpectStatus: http.StatusPreconditionFailed,
+		ExpectBody:   assert.StringData("precondition failed\n"),
+	}.Check(t, h)
+	assert.DeepEqual(t, "value", api.value, "bar")
+}
+
+type etagTestingAPI struct {
+	value string
+}
+
+func (a *etagTestingAPI) AddTo(r *mux.Router) {
+	r.Methods("GET", "PUT").Path("/value").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !CheckConditionalRequest(w, r, StrongETag([]byte(a.value))) {
 			return
 		}
-		rx := regexp.MustCompile(`(seconds_sum{[^{}]*}) \d*\.\d*(?m:$)`)
-		buf = rx.ReplaceAll(buf, []byte("$1 VARYING"))
+		if r.Method == http.MethodPut {
+			buf, err := io.ReadAll(r.Body)
+			if respondwith.ErrorText(w, err) {
+				return
+			}
+			a.value = string(buf)
+			w.Header().Set("ETag", StrongETag(buf))
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(a.value))
+	})
+}
+
+func TestRequestLogCustomizer(t *testing.T) {
+	var buf bytes.Buffer
+	logg.SetLogger(log.New(&buf, "", 0))
 
-		// replay the edited response into the actual ResponseWriter
-		for k, v := range resp.Header {
-			w.Header()[k] = v
+	h := Compose(
+		HealthCheckAPI{},
+		WithRequestLogCustomizer(RedactQueryParameters("token")),
+		WithRequestLogCustomizer(func(r *http.Request, line *RequestLogLine) {
+			line.UserAgent = "-"
+			line.ExtraFields = map[string]string{"request_id": r.Header.Get("X-Request-Id"), "env": "test"}
+		}),
+	)
+
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/healthcheck?token=secret&zoo=1&foo=a%2Fb&tok%65n=other",
+		Header:       map[string]string{"User-Agent": "unit-test/1.0", "X-Request-Id": "abc"},
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("ok\n"),
+	}.Check(t, h)
+
+	rx := regexp.MustCompile(`^REQUEST: 192.0.2.1 - - "GET /healthcheck\?token=REDACTED&zoo=1&foo=a%2Fb&tok%65n=REDACTED HTTP/1.1" 200 3 "-" "-" 0.\d{3}s env="test" request_id="abc"\n$`)
+	if !rx.MatchString(buf.String()) {
+		t.Errorf("expected log that matches %q, but got %q", rx.String(), buf.String())
+	}
+}
+
+func TestDynamicAPI(t *testing.T) {
+	dynAPI := NewDynamicAPI()
+	h := Compose(HealthCheckAPI{}, dynAPI, WithoutLogging())
+
+	// before any registration, only the static API is served
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/healthcheck",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("ok\n"),
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/greet/world",
+		ExpectStatus: http.StatusNotFound,
+	}.Check(t, h)
+
+	// register an API group at runtime
+	dynAPI.Register("greeter", greeterTestingAPI{Greeting: "Hello"})
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/greet/world",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("Hello, world!\n"),
+	}.Check(t, h)
+
+	// replace it
+	dynAPI.Register("greeter", greeterTestingAPI{Greeting: "Bonjour"})
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/greet/monde",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("Bonjour, monde!\n"),
+	}.Check(t, h)
+	assert.DeepEqual(t, "RegisteredNames", dynAPI.RegisteredNames(), []string{"greeter"})
+
+	// unregister it
+	assert.DeepEqual(t, "Unregister", dynAPI.Unregister("greeter"), true)
+	assert.DeepEqual(t, "Unregister", dynAPI.Unregister("greeter"), false)
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/greet/world",
+		ExpectStatus: http.StatusNotFound,
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/healthcheck",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("ok\n"),
+	}.Check(t, h)
+}
+
+// An API that unregisters itself from a DynamicAPI while its route is being matched.
+type selfUnregisteringTestingAPI struct {
+	greeterTestingAPI
+	dynAPI *DynamicAPI
+}
+
+func (a selfUnregisteringTestingAPI) AddTo(r *mux.Router) {
+	r.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
+		a.dynAPI.Unregister("greeter")
+		return false
+	})
+	a.greeterTestingAPI.AddTo(r)
+}
+
+func TestDynamicAPIWithConcurrentChange(t *testing.T) {
+	dynAPI := NewDynamicAPI()
+	h := Compose(dynAPI, WithoutLogging())
+	dynAPI.Register("greeter", selfUnregisteringTestingAPI{greeterTestingAPI{Greeting: "Hello"}, dynAPI})
+
+	// the request is served by the router that matched it, even though that
+	// router is replaced while the request is being matched
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/greet/world",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("Hello, world!\n"),
+	}.Check(t, h)
+	assert.DeepEqual(t, "RegisteredNames", dynAPI.RegisteredNames(), []string{})
+
+	// later requests see the change
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/greet/world",
+		ExpectStatus: http.StatusNotFound,
+	}.Check(t, h)
+}
+
+type greeterTestingAPI struct {
+	Greeting string
+}
+
+func (a greeterTestingAPI) AddTo(r *mux.Router) {
+	r.Methods("GET").Path("/greet/{name}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		IdentifyEndpoint(r, "/greet/:name")
+		http.Error(w, fmt.Sprintf("%s, %s!", a.Greeting, mux.Vars(r)["name"]), http.StatusOK)
+	})
+}
+
+func TestLoadShedding(t *testing.T) {
+	testSetRegisterer(prometheus.NewRegistry())
+
+	// this API blocks requests to /block until `unblock` is closed
+	unblock := make(chan struct{})
+	blocking := make(chan struct{}, 10)
+	api := blockingTestingAPI{blocking, unblock}
+
+	h := Compose(HealthCheckAPI{}, api, WithoutLogging(), WithLoadShedding(LoadSheddingConfig{
+		MaxInFlightRequests: 1,
+		RetryAfter:          1500 * time.Millisecond,
+		Prioritize: func(r *http.Request) RequestPriority {
+			if r.URL.Path == "/healthcheck" {
+				return PriorityCritical
+			}
+			return PriorityNormal
+		},
+	}))
+
+	// occupy the only available slot
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.HTTPRequest{
+			Method:       "GET",
+			Path:         "/block",
+			ExpectStatus: http.StatusOK,
+			ExpectBody:   assert.StringData("unblocked\n"),
+		}.Check(t, h)
+	}()
+	<-blocking
+
+	// further requests are rejected, except for critical ones
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/block",
+		ExpectStatus: http.StatusServiceUnavailable,
+		ExpectHeader: map[string]string{"Retry-After": "2"},
+		ExpectBody:   assert.StringData("server is overloaded, please retry later\n"),
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/healthcheck",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("ok\n"),
+	}.Check(t, h)
+
+	// after the slot is freed, requests are accepted again
+	close(unblock)
+	<-done
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/block",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("unblocked\n"),
+	}.Check(t, h)
+}
+
+func TestLoadSheddingByLatency(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := &loadShedder{
+		cfg: LoadSheddingConfig{
+			MaxP99Latency:       time.Second,
+			LatencyWindowSize:   100,
+			LatencyWindowMaxAge: time.Minute,
+			Prioritize: func(r *http.Request) RequestPriority {
+				return RequestPriority(must.Return(strconv.Atoi(r.Header.Get("X-Priority"))))
+			},
+		},
+		now: func() time.Time { return now },
+	}
+	req := func(p RequestPriority) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		r.Header.Set("X-Priority", strconv.Itoa(int(p)))
+		return r
+	}
+
+	// 98 fast requests and 2 slow requests make the p99 latency exceed the threshold
+	for idx := range 100 {
+		_, _, ok := s.admit(req(PriorityNormal))
+		assert.DeepEqual(t, "admitted", ok, true)
+		if idx < 98 {
+			s.done(10 * time.Millisecond)
+		} else {
+			s.done(5 * time.Second)
 		}
-		w.WriteHeader(resp.StatusCode)
-		w.Write(buf) //nolint:errcheck
+	}
+
+	// low-priority requests are now rejected, but others are not
+	_, reason, ok := s.admit(req(PriorityLow))
+	assert.DeepEqual(t, "low priority admitted", ok, false)
+	assert.DeepEqual(t, "low priority rejection reason", reason, "latency")
+	_, _, ok = s.admit(req(PriorityNormal))
+	assert.DeepEqual(t, "normal priority admitted", ok, true)
+	s.done(10 * time.Millisecond)
+
+	// while only low-priority requests come in, no new samples are recorded,
+	// but once the slow requests have aged out of the window, shedding is lifted
+	now = now.Add(30 * time.Second)
+	_, _, ok = s.admit(req(PriorityLow))
+	assert.DeepEqual(t, "low priority admitted within window", ok, false)
+	now = now.Add(45 * time.Second)
+	_, _, ok = s.admit(req(PriorityLow))
+	assert.DeepEqual(t, "low priority admitted after window", ok, true)
+}
+
+type blockingTestingAPI struct {
+	blocking chan<- struct{}
+	unblock  <-chan struct{}
+}
+
+func (a blockingTestingAPI) AddTo(r *mux.Router) {
+	r.Methods("GET").Path("/block").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		IdentifyEndpoint(r, "/block")
+		a.blocking <- struct{}{}
+		<-a.unblock
+		http.Error(w, "unblocked", http.StatusOK)
 	})
 }
+
+func TestStaticFilesAPI(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("<html>app</html>")},
+		"assets/app.js":   {Data: []byte("console.log(42);")},
+		"assets/app.css":  {Data: []byte("body{}")},
+		"docs/index.html": {Data: []byte("<html>docs</html>")},
+	}
+	h := Compose(StaticFilesAPI(fsys, "/ui/"), WithoutLogging())
+
+	// files are served with content type and cache headers
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/ui/assets/app.js",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("console.log(42);"),
+		ExpectHeader: map[string]string{
+			"Content-Type":  "text/javascript; charset=utf-8",
+			"Cache-Control": "public, max-age=3600",
+			"ETag":          StrongETag([]byte("console.log(42);")),
+		},
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/ui/assets/app.js",
+		Header:       map[string]string{"If-None-Match": StrongETag([]byte("console.log(42);"))},
+		ExpectStatus: http.StatusNotModified,
+	}.Check(t, h)
+
+	// directories are served with their index.html
+	for path, body := range map[string]string{"/ui/": "<html>app</html>", "/ui/docs/": "<html>docs</html>"} {
+		assert.HTTPRequest{
+			Method:       "GET",
+			Path:         path,
+			ExpectStatus: http.StatusOK,
+			ExpectBody:   assert.StringData(body),
+			ExpectHeader: map[string]string{"Content-Type": "text/html; charset=utf-8", "Cache-Control": "no-cache"},
+		}.Check(t, h)
+	}
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/ui",
+		ExpectStatus: http.StatusMovedPermanently,
+		ExpectHeader: map[string]string{"Location": "/ui/"},
+	}.Check(t, h)
+
+	// unknown routes fall back to the root index.html, but unknown assets do not
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/ui/some/client/route",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("<html>app</html>"),
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/ui/assets/missing.js",
+		ExpectStatus: http.StatusNotFound,
+		ExpectBody:   assert.StringData("not found\n"),
+	}.Check(t, h)
+
+	// paths with ".." are normalized by redirecting (so path traversal is not possible)
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/ui/assets/../../secret.txt",
+		ExpectStatus: http.StatusMovedPermanently,
+		ExpectHeader: map[string]string{"Location": "/secret.txt"},
+	}.Check(t, h)
+}
+
+func TestStreamingConnections(t *testing.T) {
+	var buf bytes.Buffer
+	logg.SetLogger(log.New(&buf, "", 0))
+	testSetRegisterer(prometheus.NewRegistry())
+
+	handlerDone := make(chan struct{}, 1)
+	h := Compose(streamingTestingAPI{}, WithStreamingMetrics())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		handlerDone <- struct{}{}
+	}))
+	defer server.Close()
+
+	// test a connection upgrade through http.Hijacker
+	conn := must.Return(net.Dial("tcp", server.Listener.Addr().String()))
+	_ = must.Return(conn.Write([]byte("GET /upgrade HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nhello")))
+	response := string(must.Return(io.ReadAll(conn)))
+	must.Succeed(conn.Close())
+	<-handlerDone
+	assert.DeepEqual(t, "upgrade response", response, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nhello")
+
+	rx := regexp.MustCompile(`^REQUEST: 127.0.0.1 - - "GET /upgrade HTTP/1.1" 101 0 "-" "-" 0.\d{3}s stream="opened"\n` +
+		`REQUEST: 127.0.0.1 - - "GET /upgrade HTTP/1.1" 101 77 "-" "-" 0.\d{3}s stream="closed"\n$`)
+	if !rx.MatchString(buf.String()) {
+		t.Errorf("expected log that matches %q, but got %q", rx.String(), buf.String())
+	}
+	buf.Reset()
+
+	// test Server-Sent Events
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/events",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("data: 1\n\ndata: 2\n\n"),
+	}.Check(t, h)
+	rx = regexp.MustCompile(`^REQUEST: 192.0.2.1 - - "GET /events HTTP/1.1" 200 0 "-" "-" 0.\d{3}s stream="opened"\n` +
+		`REQUEST: 192.0.2.1 - - "GET /events HTTP/1.1" 200 18 "-" "-" 0.\d{3}s stream="closed"\n$`)
+	if !rx.MatchString(buf.String()) {
+		t.Errorf("expected log that matches %q, but got %q", rx.String(), buf.String())
+	}
+
+	// streams are not included in the histogram metrics
+	families := must.Return(metricsRegisterer.(*prometheus.Registry).Gather())
+	for _, family := range families {
+		if family.GetName() == "httpmux_response_duration_seconds" {
+			t.Errorf("expected no observations for streams, but got %v", family)
+		}
+		if family.GetName() == "httpmux_open_streams" {
+			for _, metric := range family.GetMetric() {
+				assert.DeepEqual(t, "httpmux_open_streams", metric.GetGauge().GetValue(), 0.0)
+			}
+		}
+	}
+}
+
+type streamingTestingAPI struct{}
+
+func (streamingTestingAPI) AddTo(r *mux.Router) {
+	r.Methods("GET").Path("/upgrade").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		IdentifyEndpoint(r, "/upgrade")
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		payload := make([]byte, 5)
+		_, err = io.ReadFull(rw, payload)
+		if err == nil {
+			_, _ = rw.Write(payload)
+		}
+		_ = rw.Flush()
+	})
+	r.Methods("GET").Path("/events").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		IdentifyEndpoint(r, "/events")
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for idx := range 2 {
+			fmt.Fprintf(w, "data: %d\n\n", idx+1)
+			_ = http.NewResponseController(w).Flush()
+		}
+	})
+}
+
+func TestMiddlewareOrdering(t *testing.T) {
+	var buf bytes.Buffer
+	logg.SetLogger(log.New(&buf, "", 0))
+
+	var trace []string
+	tracer := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				msg := name
+				if route := mux.CurrentRoute(r); route != nil {
+					msg += " (route matched)"
+				}
+				trace = append(trace, msg)
+				if r.Header.Get("X-Reject") == name {
+					http.Error(w, "rejected by "+name, http.StatusTeapot)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	h := Compose(
+		HealthCheckAPI{},
+		WithMiddleware(tracer("after-routing-1"), MiddlewareAfterRouting),
+		WithMiddleware(tracer("after-routing-2"), MiddlewareAfterRouting),
+		WithMiddleware(tracer("outside-logging"), MiddlewareOutsideLogging),
+		WithGlobalMiddleware(tracer("before-routing")),
+	)
+
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/healthcheck",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("ok\n"),
+	}.Check(t, h)
+	assert.DeepEqual(t, "trace", trace, []string{
+		"outside-logging",
+		"before-routing",
+		"after-routing-2 (route matched)",
+		"after-routing-1 (route matched)",
+	})
+	if !strings.Contains(buf.String(), `"GET /healthcheck HTTP/1.1" 200`) {
+		t.Errorf("expected request to be logged, but got log: %q", buf.String())
+	}
+
+	// requests rejected outside of the logging middleware are not logged
+	trace = nil
+	buf.Reset()
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/healthcheck",
+		Header:       map[string]string{"X-Reject": "outside-logging"},
+		ExpectStatus: http.StatusTeapot,
+		ExpectBody:   assert.StringData("rejected by outside-logging\n"),
+	}.Check(t, h)
+	assert.DeepEqual(t, "trace", trace, []string{"outside-logging"})
+	assert.DeepEqual(t, "log", buf.String(), "")
+
+	// middlewares after routing do not see unmatched requests
+	trace = nil
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/does-not-exist",
+		ExpectStatus: http.StatusNotFound,
+	}.Check(t, h)
+	assert.DeepEqual(t, "trace", trace, []string{"outside-logging", "before-routing"})
+}
+
+func TestAutomaticMethodHandling(t *testing.T) {
+	h := Compose(HealthCheckAPI{}, &etagTestingAPI{value: "foo"}, WithAutomaticMethodHandling(), WithoutLogging())
+
+	// OPTIONS requests are answered automatically
+	assert.HTTPRequest{
+		Method:       "OPTIONS",
+		Path:         "/value",
+		ExpectStatus: http.StatusNoContent,
+		ExpectHeader: map[string]string{"Allow": "GET, OPTIONS, PUT"},
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "OPTIONS",
+		Path:         "/healthcheck",
+		ExpectStatus: http.StatusNoContent,
+		ExpectHeader: map[string]string{"Allow": "GET, HEAD, OPTIONS"},
+	}.Check(t, h)
+
+	// unsupported methods get a 405 with Allow header
+	assert.HTTPRequest{
+		Method:       "DELETE",
+		Path:         "/value",
+		ExpectStatus: http.StatusMethodNotAllowed,
+		ExpectHeader: map[string]string{"Allow": "GET, PUT"},
+		ExpectBody:   assert.StringData("method not allowed\n"),
+	}.Check(t, h)
+	// this also works when a later route matches the method, but not the path
+	// (mux.Router does not report a method mismatch in this case)
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/healthcheck",
+		ExpectStatus: http.StatusMethodNotAllowed,
+		ExpectHeader: map[string]string{"Allow": "GET, HEAD"},
+	}.Check(t, h)
+
+	// unknown paths still get a 404
+	assert.HTTPRequest{
+		Method:       "OPTIONS",
+		Path:         "/does-not-exist",
+		ExpectStatus: http.StatusNotFound,
+	}.Check(t, h)
+}
+
+func TestTrailingSlashPolicy(t *testing.T) {
+	// by default, trailing slashes must match exactly
+	h := Compose(&etagTestingAPI{value: "foo"}, WithoutLogging())
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/value/",
+		ExpectStatus: http.StatusNotFound,
+	}.Check(t, h)
+
+	h = Compose(HealthCheckAPI{}, &etagTestingAPI{value: "foo"}, WithTrailingSlashPolicy(TrailingSlashRedirect), WithoutLogging())
+
+	// matching paths are not affected
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/value",
+		ExpectStatus: http.StatusOK,
+	}.Check(t, h)
+
+	// mismatching trailing slashes are redirected, preserving the query
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/value/?foo=bar",
+		ExpectStatus: http.StatusPermanentRedirect,
+		ExpectHeader: map[string]string{"Location": "/value?foo=bar"},
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "PUT",
+		Path:         "/healthcheck/",
+		ExpectStatus: http.StatusPermanentRedirect,
+		ExpectHeader: map[string]string{"Location": "/healthcheck"},
+	}.Check(t, h)
+
+	// unknown paths still get a 404
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/does-not-exist/",
+		ExpectStatus: http.StatusNotFound,
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/",
+		ExpectStatus: http.StatusNotFound,
+	}.Check(t, h)
+}
+
+type customNotFoundTestingAPI struct{}
+
+func (customNotFoundTestingAPI) AddTo(r *mux.Router) {
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such thing: "+r.URL.Path, http.StatusNotFound)
+	})
+}
+
+func TestTrailingSlashPolicyWithCustomNotFoundHandler(t *testing.T) {
+	// a NotFoundHandler configured by one of the APIs is not overwritten
+	h := Compose(customNotFoundTestingAPI{}, &etagTestingAPI{value: "foo"}, WithTrailingSlashPolicy(TrailingSlashRedirect), WithoutLogging())
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/value/",
+		ExpectStatus: http.StatusPermanentRedirect,
+		ExpectHeader: map[string]string{"Location": "/value"},
+	}.Check(t, h)
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/does-not-exist",
+		ExpectStatus: http.StatusNotFound,
+		ExpectBody:   assert.StringData("no such thing: /does-not-exist\n"),
+	}.Check(t, h)
+}
+
+func TestRequestLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logg.SetLogger(log.New(&buf, "", 0))
+
+	// "/ping" is served without IdentifyEndpoint(), so sampling must match on the request path
+	pingMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/ping" {
+				_, _ = w.Write([]byte("pong"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	h := Compose(
+		HealthCheckAPI{},
+		WithMiddleware(pingMiddleware, MiddlewareBeforeRouting),
+		WithRequestLogSampling("/healthcheck", 3),
+		WithRequestLogSampling("/ping", 2),
+	)
+
+	for range 7 {
+		assert.HTTPRequest{
+			Method:       "GET",
+			Path:         "/healthcheck",
+			ExpectStatus: http.StatusOK,
+			ExpectBody:   assert.StringData("ok\n"),
+		}.Check(t, h)
+	}
+	for range 3 {
+		assert.HTTPRequest{
+			Method:       "GET",
+			Path:         "/ping",
+			ExpectStatus: http.StatusOK,
+			ExpectBody:   assert.StringData("pong"),
+		}.Check(t, h)
+	}
+	// failed requests are always logged
+	assert.HTTPRequest{
+		Method:       "POST",
+		Path:         "/healthcheck",
+		ExpectStatus: http.StatusMethodNotAllowed,
+	}.Check(t, h)
+
+	counts := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		fields := strings.Fields(line)
+		counts[fields[4]+" "+fields[5]+" "+fields[7]]++
+	}
+	assert.DeepEqual(t, "log line counts", counts, map[string]int{
+		`"GET /healthcheck 200`:  3, // requests 1, 4, 7
+		`"GET /ping 200`:         2, // requests 1, 3
+		`"POST /healthcheck 405`: 1,
+	})
+}
+
+type openAPITestingObject struct {
+	ID        int                   `json:"id"`
+	Name      string                `json:"name"`
+	Labels    map[string]string     `json:"labels,omitempty"`
+	CreatedAt time.Time             `json:"created_at"`
+	Parent    *openAPITestingObject `json:"parent,omitempty"`
+}
+
+type openAPITestingAPI struct {
+	routes []OpenAPIRoute
+}
+
+func (a openAPITestingAPI) AddTo(r *mux.Router) {
+	r.Methods("GET").Path("/v1/objects/{id:[0-9]+}").HandlerFunc(http.NotFound)
+	r.Methods("PUT").Path("/v1/objects/{id:[0-9]+}").HandlerFunc(http.NotFound)
+}
+
+func (a openAPITestingAPI) OpenAPIRoutes() []OpenAPIRoute {
+	return a.routes
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	api := openAPITestingAPI{routes: []OpenAPIRoute{
+		{
+			Method:      "GET",
+			Path:        "/v1/objects/{id:[0-9]+}",
+			OperationID: "getObject",
+			Summary:     "Show an object.",
+			Parameters: []OpenAPIParameter{{
+				Name:     "verbose",
+				In:       "query",
+				Required: false,
+				Type:     false,
+			}},
+			Responses: map[int]OpenAPIResponse{
+				http.StatusOK:       {Body: openAPITestingObject{}},
+				http.StatusNotFound: {Description: "No such object."},
+			},
+		},
+		{
+			Method:      "PUT",
+			Path:        "/v1/objects/{id:[0-9]+}",
+			RequestBody: openAPITestingObject{},
+			Responses: map[int]OpenAPIResponse{
+				http.StatusNoContent: {},
+			},
+		},
+	}}
+	h := Compose(api, HealthCheckAPI{}, WithOpenAPIDocument(OpenAPIInfo{Title: "Test API", Version: "1.0"}), WithoutLogging())
+
+	objectRef := assert.JSONObject{"$ref": "#/components/schemas/openAPITestingObject"}
+	idParam := assert.JSONObject{"name": "id", "in": "path", "required": true, "schema": assert.JSONObject{"type": "string"}}
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/openapi.json",
+		ExpectStatus: http.StatusOK,
+		ExpectBody: assert.JSONObject{
+			"openapi": "3.0.3",
+			"info":    assert.JSONObject{"title": "Test API", "version": "1.0"},
+			"paths": assert.JSONObject{
+				"/v1/objects/{id}": assert.JSONObject{
+					"get": assert.JSONObject{
+						"operationId": "getObject",
+						"summary":     "Show an object.",
+						"parameters": []assert.JSONObject{
+							idParam,
+							{"name": "verbose", "in": "query", "schema": assert.JSONObject{"type": "boolean"}},
+						},
+						"responses": assert.JSONObject{
+							"200": assert.JSONObject{
+								"description": "OK",
+								"content":     assert.JSONObject{"application/json": assert.JSONObject{"schema": objectRef}},
+							},
+							"404": assert.JSONObject{"description": "No such object."},
+						},
+					},
+					"put": assert.JSONObject{
+						"parameters": []assert.JSONObject{idParam},
+						"requestBody": assert.JSONObject{
+							"required": true,
+							"content":  assert.JSONObject{"application/json": assert.JSONObject{"schema": objectRef}},
+						},
+						"responses": assert.JSONObject{
+							"204": assert.JSONObject{"description": "No Content"},
+						},
+					},
+				},
+			},
+			"components": assert.JSONObject{
+				"schemas": assert.JSONObject{
+					"openAPITestingObject": assert.JSONObject{
+						"type": "object",
+						"properties": assert.JSONObject{
+							"id":         assert.JSONObject{"type": "integer"},
+							"name":       assert.JSONObject{"type": "string"},
+							"labels":     assert.JSONObject{"type": "object", "additionalProperties": assert.JSONObject{"type": "string"}},
+							"created_at": assert.JSONObject{"type": "string", "format": "date-time"},
+							"parent":     objectRef,
+						},
+						"required": []string{"id", "name", "created_at"},
+					},
+				},
+			},
+		},
+	}.Check(t, h)
+
+	// documenting a route that does not exist in the router is a programming error
+	api.routes = append(api.routes, OpenAPIRoute{Method: "DELETE", Path: "/v1/objects/{id:[0-9]+}"})
+	func() {
+		defer func() {
+			msg := fmt.Sprint(recover())
+			expected := "OpenAPI route DELETE /v1/objects/{id:[0-9]+} is documented, but does not exist in the router"
+			assert.DeepEqual(t, "panic message", msg, expected)
+		}()
+		Compose(api, WithOpenAPIDocument(OpenAPIInfo{Title: "Test API", Version: "1.0"}), WithoutLogging())
+	}()
+}
+
+type recordingErrorReporter struct {
+	reports []ErrorReport
+}
+
+func (r *recordingErrorReporter) ReportError(report ErrorReport) {
+	report.Request = nil // not compared in the test
+	if report.Stack != nil {
+		report.Stack = []byte("<stack>")
+	}
+	r.reports = append(r.reports, report)
+}
+
+type errorTestingAPI struct{}
+
+func (errorTestingAPI) AddTo(r *mux.Router) {
+	r.Methods("GET").Path("/fail").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		IdentifyEndpoint(r, "/fail")
+		respondwith.ErrorText(w, errors.New("datacenter on fire"))
+	})
+	r.Methods("GET").Path("/panic").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		IdentifyEndpoint(r, "/panic")
+		panic("something went horribly wrong")
+	})
+	r.Methods("GET").Path("/panic-after-write").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		IdentifyEndpoint(r, "/panic-after-write")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("partial"))
+		panic("something went horribly wrong midway")
+	})
+	r.Methods("GET").Path("/conflict").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		IdentifyEndpoint(r, "/conflict")
+		http.Error(w, "conflict", http.StatusConflict)
+	})
+}
+
+func TestErrorReporter(t *testing.T) {
+	var buf bytes.Buffer
+	logg.SetLogger(log.New(&buf, "", 0))
+
+	reporter := &recordingErrorReporter{}
+	h := Compose(
+		errorTestingAPI{},
+		WithErrorReporter(reporter),
+		WithRequestLogCustomizer(RedactQueryParameters("token")),
+		WithoutLogging(),
+	)
+
+	// client errors are not reported
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/conflict",
+		ExpectStatus: http.StatusConflict,
+	}.Check(t, h)
+	assert.DeepEqual(t, "reports", len(reporter.reports), 0)
+
+	// server errors are reported
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/fail?token=secret",
+		Header:       map[string]string{"X-Openstack-Request-Id": "req-123"},
+		ExpectStatus: http.StatusInternalServerError,
+		ExpectBody:   assert.StringData("datacenter on fire\n"),
+	}.Check(t, h)
+
+	// panics are recovered and reported
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/panic",
+		ExpectStatus: http.StatusInternalServerError,
+		ExpectBody:   assert.StringData("internal server error\n"),
+	}.Check(t, h)
+
+	// panics after the response was started are reported, and then the response is aborted
+	func() {
+		defer func() {
+			assert.DeepEqual(t, "panic value", recover(), any(http.ErrAbortHandler))
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic-after-write", http.NoBody))
+		t.Error("expected middleware to abort the response, but it returned normally")
+	}()
+
+	assert.DeepEqual(t, "reports", reporter.reports, []ErrorReport{
+		{
+			EndpointID: "/fail",
+			URL:        "/fail?token=REDACTED",
+			RequestID:  "req-123",
+			StatusCode: http.StatusInternalServerError,
+			Message:    "datacenter on fire",
+		},
+		{
+			EndpointID: "/panic",
+			URL:        "/panic",
+			StatusCode: http.StatusInternalServerError,
+			Message:    "something went horribly wrong",
+			IsPanic:    true,
+			Stack:      []byte("<stack>"),
+		},
+		{
+			EndpointID: "/panic-after-write",
+			URL:        "/panic-after-write",
+			StatusCode: http.StatusOK,
+			Message:    "something went horribly wrong midway",
+			IsPanic:    true,
+			Stack:      []byte("<stack>"),
+		},
+	})
+	if !strings.Contains(buf.String(), `ERROR: panic during "GET /panic": something went horribly wrong`) {
+		t.Errorf("expected panic to be logged, but got log: %q", buf.String())
+	}
+}
+
+func TestSentryReporter(t *testing.T) {
+	// setup a fake Sentry that records all submitted envelopes
+	var (
+		envelopes  []string
+		authHeader string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/sentry/api/42/envelope/" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		authHeader = r.Header.Get("X-Sentry-Auth")
+		envelopes = append(envelopes, string(must.Return(io.ReadAll(r.Body))))
+	}))
+	defer server.Close()
+
+	// check DSN validation
+	for _, dsn := range []string{"", "ftp://key@example.com/1", "https://example.com/1", "https://key@example.com/"} {
+		_, err := NewSentryReporter(SentryReporterOpts{DSN: dsn})
+		if err == nil {
+			t.Errorf("expected error for DSN %q, but got none", dsn)
+		}
+	}
+
+	dsn := strings.Replace(server.URL, "://", "://publickey@", 1) + "/sentry/42"
+	reporter := must.Return(NewSentryReporter(SentryReporterOpts{
+		DSN:         dsn,
+		Environment: "test",
+		Release:     "1.2.3",
+	}))
+	reporter.serverName = "testhost"
+
+	// submit a report and check that it arrives
+	req := httptest.NewRequest(http.MethodGet, "/fail", http.NoBody)
+	req.Header.Set("User-Agent", "unit-test/1.0")
+	req.Header.Set("X-Auth-Token", "secret")
+	reporter.ReportError(ErrorReport{
+		Request:    req,
+		EndpointID: "/fail",
+		URL:        "/fail",
+		RequestID:  "req-123",
+		StatusCode: http.StatusInternalServerError,
+		Message:    "datacenter on fire",
+	})
+	reporter.Flush()
+
+	assert.DeepEqual(t, "auth header", authHeader, "Sentry sentry_version=7, sentry_client=sapcc-go-bits/1.0, sentry_key=publickey")
+	if len(envelopes) != 1 {
+		t.Fatalf("expected 1 envelope, but got %d", len(envelopes))
+	}
+	lines := strings.Split(strings.TrimSuffix(envelopes[0], "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected envelope with 3 lines, but got %q", envelopes[0])
+	}
+
+	// timestamps and event IDs are random, so we need to normalize them before comparing
+	eventIDRx := regexp.MustCompile(`"event_id":"[0-9a-f]{32}"`)
+	timestampRx := regexp.MustCompile(`"(sent_at|timestamp)":"[0-9T:.Z-]+"`)
+	normalize := func(s string) string {
+		s = eventIDRx.ReplaceAllString(s, `"event_id":"<id>"`)
+		return timestampRx.ReplaceAllString(s, `"$1":"<time>"`)
+	}
+	assert.DeepEqual(t, "envelope header", normalize(lines[0]),
+		fmt.Sprintf(`{"dsn":%q,"event_id":"<id>","sent_at":"<time>"}`, dsn))
+	assert.DeepEqual(t, "item header", lines[1], fmt.Sprintf(`{"length":%d,"type":"event"}`, len(lines[2])))
+	assert.DeepEqual(t, "event", normalize(lines[2]),
+		`{"event_id":"<id>","timestamp":"<time>","platform":"go","level":"error","logger":"httpapi",`+
+			`"server_name":"testhost","release":"1.2.3","environment":"test","transaction":"GET /fail",`+
+			`"message":{"formatted":"datacenter on fire"},"request":{"method":"GET","url":"/fail","headers":{"User-Agent":"unit-test/1.0"}},`+
+			`"tags":{"endpoint":"/fail","request_id":"req-123","status_code":"500"}}`)
+}
+
+func TestSentryReporterDropsEventsWhenQueueIsFull(t *testing.T) {
+	// setup a fake Sentry that blocks until we release it
+	var (
+		mutex     sync.Mutex
+		delivered int
+	)
+	received := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		mutex.Lock()
+		delivered++
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	reporter := must.Return(NewSentryReporter(SentryReporterOpts{
+		DSN:       strings.Replace(server.URL, "://", "://publickey@", 1) + "/42",
+		QueueSize: 2,
+	}))
+	report := ErrorReport{
+		Request:    httptest.NewRequest(http.MethodGet, "/fail", http.NoBody),
+		StatusCode: http.StatusInternalServerError,
+		Message:    "datacenter on fire",
+	}
+
+	// once the first event is being delivered, the queue has room for two more
+	// events, and everything beyond that is dropped
+	reporter.ReportError(report)
+	<-received
+	for range 4 {
+		reporter.ReportError(report)
+	}
+	assert.DeepEqual(t, "dropped events", reporter.DroppedEvents(), uint64(2))
+
+	close(release)
+	reporter.Flush()
+	assert.DeepEqual(t, "delivered events", delivered, 3)
+}
@@ -0,0 +1,217 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RequestPriority is used by WithLoadShedding() to decide which requests to
+// reject first when the server is overloaded.
+type RequestPriority int
+
+const (
+	// PriorityLow is for requests that can be rejected as soon as the server is
+	// under pressure, e.g. expensive reports or background synchronization.
+	PriorityLow RequestPriority = iota
+	// PriorityNormal is the default priority for all requests.
+	PriorityNormal
+	// PriorityCritical is for requests that must never be rejected, e.g.
+	// healthchecks or metrics scrapes.
+	PriorityCritical
+)
+
+// String returns the name of this priority, as used in metric labels.
+func (p RequestPriority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return strconv.Itoa(int(p))
+	}
+}
+
+// LoadSheddingConfig contains configuration options for WithLoadShedding().
+type LoadSheddingConfig struct {
+	// If the number of requests being served concurrently reaches this
+	// threshold, all further requests except for those with PriorityCritical
+	// are rejected. Zero disables this check.
+	MaxInFlightRequests int
+	// If the 99th percentile of the response durations of recent requests
+	// exceeds this threshold, requests with PriorityLow are rejected.
+	// Zero disables this check.
+	MaxP99Latency time.Duration
+	// How many recent requests are considered for computing the 99th percentile
+	// of response durations. Defaults to 1000.
+	LatencyWindowSize int
+	// Response durations older than this are not considered for computing the
+	// 99th percentile anymore. Since PriorityLow requests that are rejected do
+	// not contribute new samples, this ensures that load shedding is lifted
+	// once the slow requests have passed. Defaults to 1 minute.
+	LatencyWindowMaxAge time.Duration
+	// The value for the Retry-After header on rejected requests.
+	// Defaults to 1 second.
+	RetryAfter time.Duration
+	// Classifies requests by priority. If nil, all requests have PriorityNormal.
+	Prioritize func(r *http.Request) RequestPriority
+}
+
+// WithLoadShedding can be given as an argument to Compose() to reject requests
+// with "503 Service Unavailable" and a Retry-After header when the server is
+// overloaded, instead of making all requests slower. The thresholds for
+// rejecting requests are described in type LoadSheddingConfig.
+//
+// Rejected requests are counted in the metric "httpmux_shed_requests_total".
+func WithLoadShedding(cfg LoadSheddingConfig) API {
+	if cfg.LatencyWindowSize <= 0 {
+		cfg.LatencyWindowSize = 1000
+	}
+	if cfg.LatencyWindowMaxAge <= 0 {
+		cfg.LatencyWindowMaxAge = time.Minute
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	if cfg.Prioritize == nil {
+		cfg.Prioritize = func(*http.Request) RequestPriority { return PriorityNormal }
+	}
+
+	return pseudoAPI{
+		configure: func(m *middleware) {
+			m.loadShedder = &loadShedder{
+				cfg:       cfg,
+				durations: make([]latencySample, 0, cfg.LatencyWindowSize),
+				now:       time.Now,
+			}
+		},
+	}
+}
+
+type loadShedder struct {
+	cfg   LoadSheddingConfig
+	mutex sync.Mutex
+	// number of requests being served right now
+	inFlight int
+	// ring buffer with the response durations of recent requests
+	durations     []latencySample
+	nextIndex     int
+	p99Latency    time.Duration
+	p99ComputedAt time.Time
+	// replaceable for unit tests
+	now func() time.Time
+}
+
+type latencySample struct {
+	Duration   time.Duration
+	FinishedAt time.Time
+}
+
+// Serves the given request through the inner handler, unless it needs to be
+// rejected because of overload.
+func (s *loadShedder) serve(w http.ResponseWriter, r *http.Request, inner http.Handler) {
+	priority, reason, ok := s.admit(r)
+	if !ok {
+		s.reject(w, priority, reason)
+		return
+	}
+
+	startedAt := s.now()
+	defer func() { s.done(s.now().Sub(startedAt)) }()
+	inner.ServeHTTP(w, r)
+}
+
+// Decides whether the given request may be served. If true is returned, the
+// caller must call done() with the response duration after serving it.
+func (s *loadShedder) admit(r *http.Request) (priority RequestPriority, reason string, ok bool) {
+	priority = s.cfg.Prioritize(r)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if priority < PriorityCritical {
+		if s.cfg.MaxInFlightRequests > 0 && s.inFlight >= s.cfg.MaxInFlightRequests {
+			return priority, "in_flight", false
+		}
+		if priority < PriorityNormal && s.cfg.MaxP99Latency > 0 && s.currentP99Latency() > s.cfg.MaxP99Latency {
+			return priority, "latency", false
+		}
+	}
+	s.inFlight++
+	return priority, "", true
+}
+
+func (s *loadShedder) done(duration time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inFlight--
+
+	sample := latencySample{duration, s.now()}
+	if len(s.durations) < s.cfg.LatencyWindowSize {
+		s.durations = append(s.durations, sample)
+	} else {
+		s.durations[s.nextIndex] = sample
+		s.nextIndex = (s.nextIndex + 1) % s.cfg.LatencyWindowSize
+	}
+}
+
+// Must be called with s.mutex held. To keep the cost per request low, the
+// percentile is only recomputed once per second.
+func (s *loadShedder) currentP99Latency() time.Duration {
+	now := s.now()
+	if now.Sub(s.p99ComputedAt) < time.Second {
+		return s.p99Latency
+	}
+	s.p99ComputedAt = now
+
+	sorted := make([]time.Duration, 0, len(s.durations))
+	for _, sample := range s.durations {
+		if now.Sub(sample.FinishedAt) <= s.cfg.LatencyWindowMaxAge {
+			sorted = append(sorted, sample.Duration)
+		}
+	}
+	if len(sorted) == 0 {
+		s.p99Latency = 0
+		return 0
+	}
+	slices.Sort(sorted)
+	s.p99Latency = sorted[(len(sorted)-1)*99/100]
+	return s.p99Latency
+}
+
+func (s *loadShedder) reject(w http.ResponseWriter, priority RequestPriority, reason string) {
+	metricShedRequests.With(prometheus.Labels{
+		"app":      metricsAppName,
+		"priority": priority.String(),
+		"reason":   reason,
+	}).Inc()
+
+	retryAfterSecs := int((s.cfg.RetryAfter + time.Second - 1) / time.Second) // round up
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSecs))
+	http.Error(w, "server is overloaded, please retry later", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,76 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/respondwith"
+)
+
+// LogLevelOverridesAPI is an API with two endpoints, "GET
+// /debug/log-level-overrides" and "PUT /debug/log-level-overrides", that
+// allow inspecting and replacing the set of log level overrides at runtime
+// (see logg.SetLevelOverrides() for details). Both endpoints accept and
+// return a JSON-encoded list of logg.LevelOverride objects.
+//
+// This can be used to temporarily silence a known-noisy log message without
+// redeploying. Since the request log written by this package uses the level
+// "REQUEST", this also covers suppressing the request log for a while.
+//
+// Only requests for which IsAuthorized returns true are served. Requests to
+// these endpoints are never logged.
+type LogLevelOverridesAPI struct {
+	IsAuthorized func(r *http.Request) bool
+}
+
+// AddTo implements the API interface.
+func (a LogLevelOverridesAPI) AddTo(r *mux.Router) {
+	if a.IsAuthorized == nil {
+		panic("LogLevelOverridesAPI.AddTo() called with IsAuthorized == nil!")
+	}
+
+	r.Methods("GET", "PUT").Path("/debug/log-level-overrides").HandlerFunc(a.handleRequest)
+}
+
+func (a LogLevelOverridesAPI) handleRequest(w http.ResponseWriter, r *http.Request) {
+	IdentifyEndpoint(r, "/debug/log-level-overrides")
+	SkipRequestLog(r)
+	if !a.IsAuthorized(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var list []logg.LevelOverride
+		err := json.NewDecoder(r.Body).Decode(&list)
+		if err != nil {
+			http.Error(w, "request body is not valid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		logg.SetLevelOverrides(list)
+	}
+
+	respondwith.JSON(w, http.StatusOK, logg.GetLevelOverrides())
+}
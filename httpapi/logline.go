@@ -0,0 +1,141 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RequestLogLine contains the fields of the log line that is written for each
+// request (see package documentation for details). Its fields can be modified
+// by a customization hook registered with WithRequestLogCustomizer().
+type RequestLogLine struct {
+	RemoteAddr   string
+	Method       string
+	URL          string // path and query, as in r.URL.String()
+	Proto        string
+	StatusCode   int
+	BytesWritten uint64
+	Referer      string // "-" if not given
+	UserAgent    string // "-" if not given
+	Duration     time.Duration
+
+	// Additional fields to be appended to the log line as `key="value"`.
+	// Fields are rendered in the order of their keys.
+	ExtraFields map[string]string
+}
+
+// RequestLogCustomizer is the type of the callback that is given to
+// WithRequestLogCustomizer().
+type RequestLogCustomizer func(r *http.Request, line *RequestLogLine)
+
+// WithRequestLogCustomizer can be given as an argument to Compose() to
+// register a hook that is called right before each request log line is
+// written. The hook can modify the log line, e.g. to redact sensitive parts of
+// the request path or query, or to add extra fields.
+//
+// If multiple customizers are registered, they run in the order in which they
+// were given to Compose(). The URL as modified by the customizers is also used
+// in the log line for server errors.
+func WithRequestLogCustomizer(customize RequestLogCustomizer) API {
+	if customize == nil {
+		panic("WithRequestLogCustomizer called with customize == nil!")
+	}
+
+	return pseudoAPI{
+		configure: func(m *middleware) {
+			m.logCustomizers = append(m.logCustomizers, customize)
+		},
+	}
+}
+
+// RedactQueryParameters returns a RequestLogCustomizer that replaces the values
+// of the given query parameters with "REDACTED" in request log lines.
+// For example:
+//
+//	h := httpapi.Compose(
+//		myAPI,
+//		httpapi.WithRequestLogCustomizer(httpapi.RedactQueryParameters("token", "secret")),
+//	)
+func RedactQueryParameters(keys ...string) RequestLogCustomizer {
+	return func(r *http.Request, line *RequestLogLine) {
+		u, err := url.Parse(line.URL)
+		if err != nil || u.RawQuery == "" {
+			return
+		}
+
+		// the query is edited in place (instead of through url.Values), so that
+		// the order and encoding of all other parameters are preserved
+		params := strings.Split(u.RawQuery, "&")
+		changed := false
+		for idx, param := range params {
+			rawKey, _, _ := strings.Cut(param, "=")
+			key, err := url.QueryUnescape(rawKey)
+			if err == nil && slices.Contains(keys, key) {
+				params[idx] = rawKey + "=REDACTED"
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = strings.Join(params, "&")
+			line.URL = u.String()
+		}
+	}
+}
+
+func newRequestLogLine(r *http.Request, remoteAddr string, statusCode int, bytesWritten uint64, duration time.Duration) RequestLogLine {
+	return RequestLogLine{
+		RemoteAddr:   remoteAddr,
+		Method:       r.Method,
+		URL:          r.URL.String(),
+		Proto:        r.Proto,
+		StatusCode:   statusCode,
+		BytesWritten: bytesWritten,
+		Referer:      stringOrDefault("-", r.Header.Get("Referer")),
+		UserAgent:    stringOrDefault("-", r.Header.Get("User-Agent")),
+		Duration:     duration,
+	}
+}
+
+// Renders the log line (without the "REQUEST: " prefix). The format is similar
+// to nginx's "combined" log format, but the timestamp is at the front (added
+// by the logger) to ensure consistency with the rest of the log.
+func (l RequestLogLine) render() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `%s - - "%s %s %s" %03d %d "%s" "%s" %.3fs`,
+		l.RemoteAddr, l.Method, l.URL, l.Proto, l.StatusCode, l.BytesWritten,
+		l.Referer, l.UserAgent, l.Duration.Seconds(),
+	)
+
+	keys := make([]string, 0, len(l.ExtraFields))
+	for key := range l.ExtraFields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&sb, " %s=%q", key, l.ExtraFields[key])
+	}
+	return sb.String()
+}
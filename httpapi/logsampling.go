@@ -0,0 +1,81 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// WithRequestLogSampling can be given as an argument to Compose() to reduce
+// the volume of request logs for high-traffic endpoints like health checks or
+// metrics scrapes. For successful requests (status codes below 400) to the
+// given endpoint, only one out of every `n` requests gets a log line.
+// Requests that fail are always logged.
+//
+// The endpoint is matched against the endpoint ID given to IdentifyEndpoint()
+// by the request handler, or against the request path if the handler does not
+// call IdentifyEndpoint(). For example:
+//
+//	h := httpapi.Compose(
+//		httpapi.HealthCheckAPI{},
+//		myAPI,
+//		httpapi.WithRequestLogSampling("/healthcheck", 100),
+//		httpapi.WithRequestLogSampling("/metrics", 10),
+//	)
+//
+// Log lines for long-lived connections (see WithStreamingMetrics) are never
+// sampled. If this option is given multiple times for the same endpoint, the
+// last one wins.
+func WithRequestLogSampling(endpoint string, n uint64) API {
+	if n == 0 {
+		panic("WithRequestLogSampling called with n == 0!")
+	}
+
+	return pseudoAPI{
+		configure: func(m *middleware) {
+			if m.logSamplers == nil {
+				m.logSamplers = make(map[string]*logSampler)
+			}
+			m.logSamplers[endpoint] = &logSampler{n: n}
+		},
+	}
+}
+
+type logSampler struct {
+	n       uint64
+	counter atomic.Uint64
+}
+
+// Called by the middleware before writing the final log line for a request.
+func (m middleware) isSampledOut(r *http.Request, endpointID string, statusCode int, isStream bool) bool {
+	if len(m.logSamplers) == 0 || isStream || statusCode >= 400 {
+		return false
+	}
+	sampler, ok := m.logSamplers[endpointID]
+	if !ok {
+		sampler, ok = m.logSamplers[r.URL.Path]
+		if !ok {
+			return false
+		}
+	}
+	// the first request in each group of `n` is logged
+	return sampler.counter.Add(1)%sampler.n != 1%sampler.n
+}
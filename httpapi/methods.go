@@ -0,0 +1,92 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// WithAutomaticMethodHandling can be given as an argument to Compose() to
+// improve the handling of requests whose path matches an endpoint, but whose
+// method does not:
+//
+//   - OPTIONS requests are answered with "204 No Content" and an Allow header
+//     listing all methods that are supported for this path.
+//   - Requests with other methods are answered with "405 Method Not Allowed"
+//     and the same Allow header.
+//
+// Without this option, such requests are answered with a plain 405 response
+// without an Allow header. Endpoints that explicitly declare OPTIONS as one of
+// their methods continue to handle OPTIONS requests by themselves.
+func WithAutomaticMethodHandling() API {
+	return pseudoAPI{
+		configure: func(m *middleware) {
+			m.automaticMethodHandling = true
+		},
+	}
+}
+
+// Implements WithAutomaticMethodHandling() as mux.Router.MethodNotAllowedHandler.
+type methodNotAllowedHandler struct {
+	router *mux.Router
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h methodNotAllowedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	allowedMethods := h.allowedMethodsFor(r)
+	if r.Method == http.MethodOptions {
+		allowedMethods = append(allowedMethods, http.MethodOptions)
+		slices.Sort(allowedMethods)
+		allowedMethods = slices.Compact(allowedMethods)
+	}
+	w.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Returns all methods for which a route exists that matches the request path.
+func (h methodNotAllowedHandler) allowedMethodsFor(r *http.Request) []string {
+	var result []string
+	_ = h.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error { //nolint:errcheck // our callback does not return errors
+		methods, err := route.GetMethods()
+		if err != nil {
+			// this route has no method restriction, so it cannot have caused a method mismatch
+			return nil
+		}
+		// check if the route would match with the first of its methods
+		probe := r.Clone(r.Context())
+		probe.Method = methods[0]
+		var match mux.RouteMatch
+		if route.Match(probe, &match) && match.MatchErr == nil {
+			result = append(result, methods...)
+		}
+		return nil
+	})
+	slices.Sort(result)
+	return slices.Compact(result)
+}
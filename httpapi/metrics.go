@@ -39,6 +39,8 @@ var (
 	metricResponseDuration  *prometheus.HistogramVec
 	metricRequestBodySize   *prometheus.HistogramVec
 	metricResponseBodySize  *prometheus.HistogramVec
+	metricShedRequests      *prometheus.CounterVec
+	metricOpenStreams       *prometheus.GaugeVec
 
 	// interface for tests only
 	metricsRegisterer = prometheus.DefaultRegisterer
@@ -90,10 +92,22 @@ func ConfigureMetrics(cfg MetricsConfig) {
 		Buckets: cfg.ResponseBodySizeBuckets,
 	}, labelNames)
 
+	metricShedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "httpmux_shed_requests_total",
+		Help: "Counter for HTTP requests that were rejected by the application because of overload.",
+	}, []string{"app", "priority", "reason"})
+
+	metricOpenStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "httpmux_open_streams",
+		Help: "Number of long-lived connections (e.g. WebSockets or Server-Sent Events) that are currently being served by the application.",
+	}, []string{"app", "endpoint"})
+
 	metricsRegisterer.MustRegister(metricFirstByteDuration)
 	metricsRegisterer.MustRegister(metricResponseDuration)
 	metricsRegisterer.MustRegister(metricRequestBodySize)
 	metricsRegisterer.MustRegister(metricResponseBodySize)
+	metricsRegisterer.MustRegister(metricShedRequests)
+	metricsRegisterer.MustRegister(metricOpenStreams)
 }
 
 var (
@@ -29,20 +29,39 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/sapcc/go-bits/audittools"
 	"github.com/sapcc/go-bits/httpext"
 	"github.com/sapcc/go-bits/logg"
 )
 
 // A http.Handler middleware that adds all the special behavior for this package.
 type middleware struct {
-	inner       http.Handler
-	skipAllLogs bool
+	inner                   http.Handler
+	skipAllLogs             bool
+	auditor                 audittools.Auditor
+	auditClassifier         AuditClassifier
+	logCustomizers          []RequestLogCustomizer
+	logSamplers             map[string]*logSampler
+	loadShedder             *loadShedder
+	streamingMetrics        bool
+	automaticMethodHandling bool
+	trailingSlashPolicy     TrailingSlashPolicy
+	openAPIInfo             *OpenAPIInfo
+	errorReporter           ErrorReporter
+
+	// these are applied by Compose() (see WithMiddleware)
+	outerMiddlewares  []func(http.Handler) http.Handler
+	routerMiddlewares []func(http.Handler) http.Handler
 }
 
 // ServeHTTP implements the http.Handler interface.
 func (m middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	skipLog := false
 	endpointID := "unknown"
+	var (
+		auditUser    audittools.UserInfo
+		auditRequest *http.Request
+	)
 
 	// provide a back-channel for our custom out-of-band messages to the request handler
 	// (this is used by SkipRequestLog etc.)
@@ -53,49 +72,101 @@ func (m middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if msg.EndpointID != "" {
 			endpointID = msg.EndpointID
 		}
+		if msg.AuditUser != nil {
+			auditUser = msg.AuditUser
+			auditRequest = msg.AuditRequest
+		}
 	})
 	r = r.WithContext(ctx)
 
 	// setup interception of response metadata
 	startedAt := time.Now()
 	writer := responseWriter{original: w}
+	var streamLabels prometheus.Labels
+	writer.onStreamStart = func() {
+		if m.streamingMetrics {
+			streamLabels = prometheus.Labels{"app": metricsAppName, "endpoint": endpointID}
+			metricOpenStreams.With(streamLabels).Inc()
+		}
+		if !m.skipAllLogs && !skipLog {
+			line := m.buildRequestLogLine(r, writer.statusCode, 0, time.Since(startedAt), "opened")
+			logg.Other("REQUEST", "%s", line.render())
+		}
+	}
 
-	// forward request to actual handler
-	m.inner.ServeHTTP(&writer, r)
+	// forward request to actual handler (unless it is rejected because of overload)
+	serve := m.inner.ServeHTTP
+	if m.loadShedder != nil {
+		serve = func(w http.ResponseWriter, r *http.Request) { m.loadShedder.serve(w, r, m.inner) }
+	}
+	var panicInfo *recoveredPanic
+	if m.errorReporter == nil {
+		serve(&writer, r)
+	} else {
+		panicInfo = serveRecoveringPanic(&writer, r, serve)
+	}
 	duration := time.Since(startedAt)
+	if writer.hijackedConn != nil {
+		writer.bytesWritten += writer.hijackedConn.bytesWritten.Load()
+	}
+
+	// forward server errors to error reporter (if enabled)
+	m.reportError(r, &writer, endpointID, panicInfo)
+
+	// emit audit event (if enabled)
+	m.recordAuditEvent(auditRequest, writer.statusCode, auditUser)
 
 	// emit metrics
-	labels := getLabels(writer.statusCode, endpointID, r)
-	metricResponseDuration.With(labels).Observe(time.Since(startedAt).Seconds())
-	if writer.firstByteSentAt != nil {
-		metricFirstByteDuration.With(labels).Observe(writer.firstByteSentAt.Sub(startedAt).Seconds())
+	if streamLabels != nil {
+		metricOpenStreams.With(streamLabels).Dec()
 	}
-	metricResponseBodySize.With(labels).Observe(float64(writer.bytesWritten))
-	if r.ContentLength != -1 {
-		metricRequestBodySize.With(labels).Observe(float64(r.ContentLength))
+	if !writer.isStream || !m.streamingMetrics {
+		labels := getLabels(writer.statusCode, endpointID, r)
+		metricResponseDuration.With(labels).Observe(time.Since(startedAt).Seconds())
+		if writer.firstByteSentAt != nil {
+			metricFirstByteDuration.With(labels).Observe(writer.firstByteSentAt.Sub(startedAt).Seconds())
+		}
+		metricResponseBodySize.With(labels).Observe(float64(writer.bytesWritten))
+		if r.ContentLength != -1 {
+			metricRequestBodySize.With(labels).Observe(float64(r.ContentLength))
+		}
 	}
 
-	// write log line (the format is similar to nginx's "combined" log format, but
-	// the timestamp is at the front to ensure consistency with the rest of the
-	// log)
-	if !m.skipAllLogs {
+	// write log line
+	if !m.skipAllLogs && !m.isSampledOut(r, endpointID, writer.statusCode, writer.isStream) {
+		streamState := ""
+		if writer.isStream {
+			streamState = "closed"
+		}
+		line := m.buildRequestLogLine(r, writer.statusCode, writer.bytesWritten, duration, streamState)
+
 		if !skipLog || writer.statusCode >= 500 {
-			logg.Other(
-				"REQUEST", `%s - - "%s %s %s" %03d %d "%s" "%s" %.3fs`,
-				httpext.GetRequesterIPFor(r),
-				r.Method, r.URL.String(), r.Proto,
-				writer.statusCode, writer.bytesWritten,
-				stringOrDefault("-", r.Header.Get("Referer")),
-				stringOrDefault("-", r.Header.Get("User-Agent")),
-				duration.Seconds(),
-			)
+			logg.Other("REQUEST", "%s", line.render())
 		}
 		if writer.errorMessageBuf.Len() > 0 {
 			logg.Error(`during "%s %s": %s`,
-				r.Method, r.URL.String(), strings.TrimSpace(writer.errorMessageBuf.String()),
+				line.Method, line.URL, strings.TrimSpace(writer.errorMessageBuf.String()),
 			)
 		}
 	}
+
+	// if a panic interrupted a response that was already started, make net/http
+	// abort the connection, so that the client does not mistake the truncated
+	// response for a complete one
+	if panicInfo != nil && panicInfo.MustAbort {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (m middleware) buildRequestLogLine(r *http.Request, statusCode int, bytesWritten uint64, duration time.Duration, streamState string) RequestLogLine {
+	line := newRequestLogLine(r, httpext.GetRequesterIPFor(r), statusCode, bytesWritten, duration)
+	if streamState != "" {
+		line.ExtraFields = map[string]string{"stream": streamState}
+	}
+	for _, customize := range m.logCustomizers {
+		customize(r, &line)
+	}
+	return line
 }
 
 func getLabels(statusCode int, endpointID string, r *http.Request) prometheus.Labels {
@@ -130,6 +201,11 @@ type responseWriter struct {
 	statusCode      int
 	errorMessageBuf bytes.Buffer
 	firstByteSentAt *time.Time
+
+	// for long-lived connections (see WithStreamingMetrics)
+	hijackedConn  *countingConn
+	isStream      bool
+	onStreamStart func()
 }
 
 // Header implements the http.ResponseWriter interface.
@@ -164,6 +240,9 @@ func (w *responseWriter) WriteHeader(status int) {
 		w.original.WriteHeader(status)
 		w.statusCode = status
 		w.headersWritten = true
+		if isEventStream(w.Header()) {
+			w.startStream()
+		}
 	}
 }
 
@@ -0,0 +1,254 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sapcc/go-bits/respondwith"
+)
+
+// DocumentedAPI is an optional extension of the API interface. If an API
+// implements it, and WithOpenAPIDocument() is given to Compose(), the routes
+// declared here will appear in the generated OpenAPI document.
+type DocumentedAPI interface {
+	API
+	// OpenAPIRoutes returns metadata about all routes that AddTo() registers.
+	OpenAPIRoutes() []OpenAPIRoute
+}
+
+// OpenAPIRoute contains metadata about a single route of a DocumentedAPI.
+type OpenAPIRoute struct {
+	// The HTTP method and path template, exactly as given to mux.Router
+	// (e.g. "GET" and "/v1/objects/{id}"). Path parameters are derived from
+	// the path template automatically.
+	Method string
+	Path   string
+
+	OperationID string
+	Summary     string
+	Description string
+	Tags        []string
+
+	// Query parameters and headers accepted by this route.
+	Parameters []OpenAPIParameter
+	// If not nil, the request body is expected to contain a JSON
+	// representation of this value. The schema is derived from the type of
+	// this value using reflection, so a zero value is sufficient, e.g.
+	// `RequestBody: MyRequest{}`.
+	RequestBody any
+	// The possible responses of this route, keyed by status code.
+	Responses map[int]OpenAPIResponse
+}
+
+// OpenAPIParameter describes a query parameter or header of an OpenAPIRoute.
+type OpenAPIParameter struct {
+	Name        string
+	In          string // either "query" or "header"
+	Description string
+	Required    bool
+	// Like OpenAPIRoute.RequestBody. If nil, the parameter is declared as a string.
+	Type any
+}
+
+// OpenAPIResponse describes a response of an OpenAPIRoute.
+type OpenAPIResponse struct {
+	Description string
+	// Like OpenAPIRoute.RequestBody. If nil, the response is declared without body.
+	Body any
+}
+
+// OpenAPIInfo is the argument type for WithOpenAPIDocument().
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// WithOpenAPIDocument can be given as an argument to Compose() to serve an
+// OpenAPI 3 document at "GET /openapi.json". The document is generated from
+// the routes declared by all APIs implementing the DocumentedAPI interface.
+//
+// To keep the document in sync with the actual router, Compose() will panic
+// if a documented route does not match any route that was registered in the
+// router.
+func WithOpenAPIDocument(info OpenAPIInfo) API {
+	return pseudoAPI{
+		configure: func(m *middleware) {
+			m.openAPIInfo = &info
+		},
+	}
+}
+
+// Called by Compose() after all APIs have been added to the router.
+func addOpenAPIDocumentTo(r *mux.Router, info OpenAPIInfo, apis []DocumentedAPI) {
+	var routes []OpenAPIRoute
+	for _, a := range apis {
+		routes = append(routes, a.OpenAPIRoutes()...)
+	}
+
+	err := checkDocumentedRoutesExist(r, routes)
+	if err != nil {
+		panic(err.Error())
+	}
+	doc := buildOpenAPIDocument(info, routes)
+
+	r.Methods("GET").Path("/openapi.json").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		IdentifyEndpoint(r, "/openapi.json")
+		respondwith.JSON(w, http.StatusOK, doc)
+	})
+}
+
+func checkDocumentedRoutesExist(r *mux.Router, routes []OpenAPIRoute) error {
+	registered := make(map[string]bool)
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil //nolint:nilerr // routes without path template cannot be documented
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil //nolint:nilerr // same as above
+		}
+		for _, method := range methods {
+			registered[method+" "+tmpl] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		if !registered[route.Method+" "+route.Path] {
+			return fmt.Errorf("OpenAPI route %s %s is documented, but does not exist in the router", route.Method, route.Path)
+		}
+	}
+	return nil
+}
+
+// Matches path parameters like "{id}" or "{id:[0-9]+}".
+var pathParamRx = regexp.MustCompile(`\{([^{}:]+)(?::[^{}]*)?\}`)
+
+func buildOpenAPIDocument(info OpenAPIInfo, routes []OpenAPIRoute) map[string]any {
+	sb := newSchemaBuilder()
+	paths := make(map[string]map[string]any)
+
+	for _, route := range routes {
+		// convert path template into OpenAPI syntax (i.e. without regexes)
+		path := pathParamRx.ReplaceAllString(route.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+
+		op := make(map[string]any)
+		if route.OperationID != "" {
+			op["operationId"] = route.OperationID
+		}
+		if route.Summary != "" {
+			op["summary"] = route.Summary
+		}
+		if route.Description != "" {
+			op["description"] = route.Description
+		}
+		if len(route.Tags) > 0 {
+			op["tags"] = route.Tags
+		}
+
+		var params []map[string]any
+		for _, match := range pathParamRx.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, map[string]any{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range route.Parameters {
+			param := map[string]any{
+				"name":   p.Name,
+				"in":     p.In,
+				"schema": map[string]any{"type": "string"},
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			if p.Required {
+				param["required"] = true
+			}
+			if p.Type != nil {
+				param["schema"] = sb.schemaForValue(p.Type)
+			}
+			params = append(params, param)
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if route.RequestBody != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": sb.schemaForValue(route.RequestBody)}},
+			}
+		}
+
+		responses := make(map[string]any)
+		for _, code := range slices.Sorted(maps.Keys(route.Responses)) {
+			resp := route.Responses[code]
+			description := resp.Description
+			if description == "" {
+				description = http.StatusText(code)
+			}
+			r := map[string]any{"description": description}
+			if resp.Body != nil {
+				r["content"] = map[string]any{"application/json": map[string]any{"schema": sb.schemaForValue(resp.Body)}}
+			}
+			responses[strconv.Itoa(code)] = r
+		}
+		if len(responses) == 0 {
+			responses["default"] = map[string]any{"description": "response"}
+		}
+		op["responses"] = responses
+
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	infoObj := map[string]any{"title": info.Title, "version": info.Version}
+	if info.Description != "" {
+		infoObj["description"] = info.Description
+	}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info":    infoObj,
+		"paths":   paths,
+	}
+	if len(sb.components) > 0 {
+		doc["components"] = map[string]any{"schemas": sb.components}
+	}
+	return doc
+}
@@ -0,0 +1,177 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType           = reflect.TypeFor[time.Time]()
+	jsonMarshalerType  = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType  = reflect.TypeFor[encoding.TextMarshaler]()
+	rawJSONMessageType = reflect.TypeFor[json.RawMessage]()
+	emptyInterfaceType = reflect.TypeFor[any]()
+)
+
+// schemaBuilder derives OpenAPI schemas from Go types using reflection.
+// Named struct types are placed in the "components/schemas" section of the
+// document and referenced from there.
+type schemaBuilder struct {
+	components map[string]any
+	// names of struct types that we have already started to process, to break
+	// infinite recursion on self-referential types
+	seen map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		components: make(map[string]any),
+		seen:       make(map[reflect.Type]string),
+	}
+}
+
+func (sb *schemaBuilder) schemaForValue(value any) map[string]any {
+	return sb.schemaForType(reflect.TypeOf(value))
+}
+
+func (sb *schemaBuilder) schemaForType(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawJSONMessageType || t == emptyInterfaceType:
+		return map[string]any{}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// we cannot know what the custom marshaling produces
+		return map[string]any{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes []byte as base64
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": sb.schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": sb.schemaForType(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sb.objectSchemaForStruct(t)
+		}
+		name, ok := sb.seen[t]
+		if !ok {
+			name = sb.componentNameFor(t)
+			sb.seen[t] = name
+			sb.components[name] = nil // reserve the name while recursing into the fields
+			sb.components[name] = sb.objectSchemaForStruct(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+// Chooses a unique name for a named struct type within components/schemas.
+func (sb *schemaBuilder) componentNameFor(t reflect.Type) string {
+	name := t.Name()
+	// generic instantiations have names like "Foo[some/package.Bar]"
+	name, _, _ = strings.Cut(name, "[")
+	candidate := name
+	for idx := 2; ; idx++ {
+		if _, exists := sb.components[candidate]; !exists {
+			return candidate
+		}
+		candidate = name + strconv.Itoa(idx)
+	}
+}
+
+func (sb *schemaBuilder) objectSchemaForStruct(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	sb.collectFields(t, properties, &required)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (sb *schemaBuilder) collectFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for idx := range t.NumField() {
+		field := t.Field(idx)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// embedded structs without explicit name are flattened like in encoding/json
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				sb.collectFields(ft, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = sb.schemaForType(field.Type)
+
+		isOptional := field.Type.Kind() == reflect.Pointer
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "omitempty" || opt == "omitzero" {
+				isOptional = true
+			}
+		}
+		if !isOptional {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -18,13 +18,16 @@
 *******************************************************************************/
 
 // Package pprofapi provides a httpapi.API wrapper for the net/http/pprof
-// package. This is in a separate package and not the main httpapi package
-// because importing net/http/pprof tampers with http.DefaultServeMux, so
-// importing this package is only safe if the application does not use
-// the http.DefaultServeMux instance.
+// package, as well as for other debugging facilities like the expvar package.
+// This is in a separate package and not the main httpapi package because
+// importing net/http/pprof and expvar tampers with http.DefaultServeMux, so
+// importing this package is only safe if the application does not use the
+// http.DefaultServeMux instance.
 package pprofapi
 
 import (
+	"crypto/subtle"
+	"expvar"
 	"net/http"
 	"net/http/pprof"
 	"os"
@@ -39,13 +42,23 @@ import (
 
 // API is a httpapi.API wrapping net/http/pprof. Unlike the default facility in
 // net/http/pprof, the respective endpoints are only accessible to admin users.
+// Requests for which IsAuthorized returns false are rejected with "401 Unauthorized".
 //
 // As an extension of the interface provided by net/http/pprof, the additional
 // endpoint `GET /debug/pprof/exe` responds with the process's own executable.
 // This can be given to `go tool pprof` when processing any of the pprof
 // reports obtained through the other endpoints.
+//
+// Further debugging endpoints can be enabled with the respective opt-in flags:
+//
+//   - `GET /debug/vars` serves the variables published through package expvar.
+//   - `GET /debug/runtime` serves a JSON document with information about the
+//     Go runtime and the build of the process (see type RuntimeInfo).
 type API struct {
 	IsAuthorized func(r *http.Request) bool
+
+	ExposeVars        bool
+	ExposeRuntimeInfo bool
 }
 
 // AddTo implements the httpapi.API interface.
@@ -55,13 +68,18 @@ func (a API) AddTo(r *mux.Router) {
 	}
 
 	r.Methods("GET").Path("/debug/pprof/{operation}").HandlerFunc(a.handler)
+	if a.ExposeVars {
+		r.Methods("GET").Path("/debug/vars").HandlerFunc(a.handleGetVars)
+	}
+	if a.ExposeRuntimeInfo {
+		r.Methods("GET").Path("/debug/runtime").HandlerFunc(a.handleGetRuntimeInfo)
+	}
 }
 
 func (a API) handler(w http.ResponseWriter, r *http.Request) {
 	httpapi.IdentifyEndpoint(r, "/debug/pprof/:operation")
 	httpapi.SkipRequestLog(r)
-	if !a.IsAuthorized(r) {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if !a.checkAuthorized(w, r) {
 		return
 	}
 
@@ -86,6 +104,26 @@ func (a API) handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a API) handleGetVars(w http.ResponseWriter, r *http.Request) {
+	httpapi.IdentifyEndpoint(r, "/debug/vars")
+	httpapi.SkipRequestLog(r)
+	if !a.checkAuthorized(w, r) {
+		return
+	}
+	expvar.Handler().ServeHTTP(w, r)
+}
+
+// Responds with "401 Unauthorized" and returns false if the request is not
+// authorized.
+func (a API) checkAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if a.IsAuthorized(r) {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+	return false
+}
+
 func dumpOwnExecutable(w http.ResponseWriter) {
 	path, err := os.Executable()
 	if err != nil {
@@ -113,3 +151,21 @@ func IsRequestFromLocalhost(r *http.Request) bool {
 	ip := httpext.GetRequesterIPFor(r)
 	return ip == "127.0.0.1" || ip == "::1"
 }
+
+// HasBearerToken returns a function that checks whether the given request
+// carries the given token in an "Authorization: Bearer <token>" header. It
+// satisfies the interface of API.IsAuthorized, and is useful for services
+// where debugging endpoints shall be reachable for operators from outside the
+// local host. The token is usually supplied through an environment variable.
+//
+// If the given token is empty, all requests are rejected.
+func HasBearerToken(token string) func(r *http.Request) bool {
+	expected := []byte("Bearer " + token)
+	return func(r *http.Request) bool {
+		if token == "" {
+			return false
+		}
+		actual := []byte(r.Header.Get("Authorization"))
+		return subtle.ConstantTimeCompare(actual, expected) == 1
+	}
+}
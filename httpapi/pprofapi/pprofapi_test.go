@@ -0,0 +1,133 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package pprofapi_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/httpapi"
+	"github.com/sapcc/go-bits/httpapi/pprofapi"
+)
+
+func TestHasBearerToken(t *testing.T) {
+	h := httpapi.Compose(
+		pprofapi.API{
+			IsAuthorized:      pprofapi.HasBearerToken("secret"),
+			ExposeVars:        true,
+			ExposeRuntimeInfo: true,
+		},
+		httpapi.WithoutLogging(),
+	)
+
+	for _, path := range []string{"/debug/pprof/cmdline", "/debug/vars", "/debug/runtime"} {
+		// requests without the correct token are rejected
+		for _, header := range []map[string]string{
+			nil,
+			{"Authorization": "Bearer wrong"},
+			{"Authorization": "Bearer secrets"},
+			{"Authorization": "Basic c2VjcmV0"},
+		} {
+			assert.HTTPRequest{
+				Method:       http.MethodGet,
+				Path:         path,
+				Header:       header,
+				ExpectStatus: http.StatusUnauthorized,
+				ExpectHeader: map[string]string{"WWW-Authenticate": "Bearer"},
+				ExpectBody:   assert.StringData("unauthorized\n"),
+			}.Check(t, h)
+		}
+
+		// requests with the correct token are accepted
+		assert.HTTPRequest{
+			Method:       http.MethodGet,
+			Path:         path,
+			Header:       map[string]string{"Authorization": "Bearer secret"},
+			ExpectStatus: http.StatusOK,
+		}.Check(t, h)
+	}
+}
+
+func TestHasBearerTokenWithEmptyToken(t *testing.T) {
+	// if no token is configured, all requests are rejected, even those with an empty token
+	h := httpapi.Compose(
+		pprofapi.API{IsAuthorized: pprofapi.HasBearerToken("")},
+		httpapi.WithoutLogging(),
+	)
+	for _, header := range []map[string]string{
+		nil,
+		{"Authorization": ""},
+		{"Authorization": "Bearer"},
+		{"Authorization": "Bearer "},
+	} {
+		assert.HTTPRequest{
+			Method:       http.MethodGet,
+			Path:         "/debug/pprof/cmdline",
+			Header:       header,
+			ExpectStatus: http.StatusUnauthorized,
+		}.Check(t, h)
+	}
+}
+
+func TestOptInEndpoints(t *testing.T) {
+	isAuthorized := func(r *http.Request) bool { return true }
+
+	// without the opt-in flags, only the pprof endpoints are available
+	h := httpapi.Compose(
+		pprofapi.API{IsAuthorized: isAuthorized},
+		httpapi.WithoutLogging(),
+	)
+	assert.HTTPRequest{Method: http.MethodGet, Path: "/debug/pprof/cmdline", ExpectStatus: http.StatusOK}.Check(t, h)
+	assert.HTTPRequest{Method: http.MethodGet, Path: "/debug/vars", ExpectStatus: http.StatusNotFound}.Check(t, h)
+	assert.HTTPRequest{Method: http.MethodGet, Path: "/debug/runtime", ExpectStatus: http.StatusNotFound}.Check(t, h)
+
+	// with ExposeVars, variables from package expvar are served
+	h = httpapi.Compose(
+		pprofapi.API{IsAuthorized: isAuthorized, ExposeVars: true, ExposeRuntimeInfo: true},
+		httpapi.WithoutLogging(),
+	)
+	expvar.NewInt("pprofapi_test_counter").Set(42)
+	_, body := assert.HTTPRequest{Method: http.MethodGet, Path: "/debug/vars", ExpectStatus: http.StatusOK}.Check(t, h)
+	var vars map[string]any
+	err := json.Unmarshal(body, &vars)
+	if err != nil {
+		t.Fatalf("could not parse response from GET /debug/vars: %s", err.Error())
+	}
+	assert.DeepEqual(t, "pprofapi_test_counter", vars["pprofapi_test_counter"], any(42.0))
+
+	// with ExposeRuntimeInfo, information about the Go runtime is served
+	_, body = assert.HTTPRequest{Method: http.MethodGet, Path: "/debug/runtime", ExpectStatus: http.StatusOK}.Check(t, h)
+	var info pprofapi.RuntimeInfo
+	err = json.Unmarshal(body, &info)
+	if err != nil {
+		t.Fatalf("could not parse response from GET /debug/runtime: %s", err.Error())
+	}
+	assert.DeepEqual(t, "go_version", info.GoVersion, runtime.Version())
+	assert.DeepEqual(t, "os", info.OS, runtime.GOOS)
+	assert.DeepEqual(t, "arch", info.Arch, runtime.GOARCH)
+	if info.NumGoroutine <= 0 || info.StartedAt <= 0 || !strings.HasPrefix(info.GoVersion, "go") {
+		t.Errorf("implausible runtime info: %#v", info)
+	}
+}
@@ -0,0 +1,79 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package pprofapi
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/sapcc/go-api-declarations/bininfo"
+
+	"github.com/sapcc/go-bits/httpapi"
+	"github.com/sapcc/go-bits/respondwith"
+)
+
+// RuntimeInfo is the response body of `GET /debug/runtime` (see type API).
+type RuntimeInfo struct {
+	Component     string `json:"component"`
+	Version       string `json:"version"`
+	Commit        string `json:"commit"`
+	BuildDate     string `json:"build_date"`
+	GoVersion     string `json:"go_version"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	NumCPU        int    `json:"num_cpu"`
+	GOMAXPROCS    int    `json:"gomaxprocs"`
+	NumGoroutine  int    `json:"num_goroutine"`
+	StartedAt     int64  `json:"started_at"` // UNIX timestamp
+	HeapAllocated uint64 `json:"heap_alloc_bytes"`
+	HeapObjects   uint64 `json:"heap_objects"`
+	NumGC         uint32 `json:"num_gc"`
+}
+
+// This is as close to the process start as we can get without parsing /proc.
+var processStartedAt = time.Now()
+
+func (a API) handleGetRuntimeInfo(w http.ResponseWriter, r *http.Request) {
+	httpapi.IdentifyEndpoint(r, "/debug/runtime")
+	httpapi.SkipRequestLog(r)
+	if !a.checkAuthorized(w, r) {
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	respondwith.JSON(w, http.StatusOK, RuntimeInfo{
+		Component:     bininfo.Component(),
+		Version:       bininfo.VersionOr("unknown"),
+		Commit:        bininfo.CommitOr("unknown"),
+		BuildDate:     bininfo.BuildDateOr("unknown"),
+		GoVersion:     runtime.Version(),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		NumCPU:        runtime.NumCPU(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		NumGoroutine:  runtime.NumGoroutine(),
+		StartedAt:     processStartedAt.Unix(),
+		HeapAllocated: mem.HeapAlloc,
+		HeapObjects:   mem.HeapObjects,
+		NumGC:         mem.NumGC,
+	})
+}
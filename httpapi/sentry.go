@@ -0,0 +1,335 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sapcc/go-api-declarations/bininfo"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// SentryReporterOpts contains configuration options for NewSentryReporter().
+type SentryReporterOpts struct {
+	// Required: The DSN of the Sentry project, as shown in the project settings
+	// (e.g. "https://<public-key>@sentry.example.com/<project-id>").
+	DSN string
+	// Optional: The environment name that is attached to each event
+	// (e.g. "production" or "staging").
+	Environment string
+	// Optional: The release that is attached to each event.
+	// Defaults to bininfo.Version().
+	Release string
+	// Optional: The HTTP client for submitting events.
+	// Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Optional: How long to wait for the delivery of a single event.
+	// Defaults to 10 seconds.
+	Timeout time.Duration
+	// Optional: How many events can wait for delivery at the same time.
+	// Further events are dropped until the queue has room again.
+	// Defaults to 100.
+	QueueSize int
+}
+
+// SentryReporter is an ErrorReporter that submits each error report as an
+// event to Sentry, or to any other error tracking service that accepts events
+// in Sentry's envelope format (e.g. GlitchTip).
+//
+// Events are delivered in the background by a single goroutine, one at a time.
+// Delivery errors are logged, but not retried. When errors are reported faster
+// than they can be delivered (e.g. during an outage of a backend service), the
+// queue of events waiting for delivery fills up and further events are
+// dropped. The number of dropped events is logged periodically, and can be
+// obtained through DroppedEvents(). Call Flush() before shutting down the
+// process to avoid losing events that are still waiting for delivery.
+type SentryReporter struct {
+	opts        SentryReporterOpts
+	envelopeURL string
+	authHeader  string
+	serverName  string
+	queue       chan sentryEnvelope
+	startWorker sync.Once
+	pending     sync.WaitGroup
+	dropped     atomic.Uint64
+}
+
+type sentryEnvelope struct {
+	EventID string
+	Payload []byte
+}
+
+// NewSentryReporter builds a SentryReporter. An error is returned if the
+// provided DSN is malformed.
+func NewSentryReporter(opts SentryReporterOpts) (*SentryReporter, error) {
+	dsn, err := url.Parse(opts.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing Sentry DSN: %w", err)
+	}
+	if dsn.Scheme != "http" && dsn.Scheme != "https" {
+		return nil, fmt.Errorf("invalid Sentry DSN: unsupported scheme %q", dsn.Scheme)
+	}
+	publicKey := dsn.User.Username()
+	if publicKey == "" {
+		return nil, errors.New("invalid Sentry DSN: missing public key")
+	}
+	pathPrefix, projectID, _ := cutLast(dsn.Path, "/")
+	if projectID == "" {
+		return nil, errors.New("invalid Sentry DSN: missing project ID")
+	}
+
+	if opts.Release == "" {
+		opts.Release = bininfo.Version()
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+	serverName, _ := os.Hostname() //nolint:errcheck // the server name is optional
+
+	envelopeURL := url.URL{
+		Scheme: dsn.Scheme,
+		Host:   dsn.Host,
+		Path:   fmt.Sprintf("%s/api/%s/envelope/", pathPrefix, projectID),
+	}
+	return &SentryReporter{
+		opts:        opts,
+		envelopeURL: envelopeURL.String(),
+		authHeader:  fmt.Sprintf("Sentry sentry_version=7, sentry_client=sapcc-go-bits/1.0, sentry_key=%s", publicKey),
+		serverName:  serverName,
+		queue:       make(chan sentryEnvelope, opts.QueueSize),
+	}, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	idx := strings.LastIndex(s, sep)
+	if idx < 0 {
+		return s, "", false
+	}
+	return s[:idx], s[idx+len(sep):], true
+}
+
+// ReportError implements the ErrorReporter interface.
+func (s *SentryReporter) ReportError(report ErrorReport) {
+	eventID, err := generateSentryEventID()
+	if err != nil {
+		logg.Error("cannot report error to Sentry: %s", err.Error())
+		return
+	}
+	envelope, err := s.buildEnvelope(eventID, report, time.Now())
+	if err != nil {
+		logg.Error("cannot report error to Sentry: %s", err.Error())
+		return
+	}
+
+	s.startWorker.Do(func() { go s.runWorker() })
+	s.pending.Add(1)
+	select {
+	case s.queue <- sentryEnvelope{eventID, envelope}:
+	default:
+		s.pending.Done()
+		s.dropped.Add(1)
+	}
+}
+
+// Delivers events from the queue, one at a time.
+func (s *SentryReporter) runWorker() {
+	var droppedBefore uint64
+	for envelope := range s.queue {
+		err := s.deliver(envelope.Payload)
+		if err != nil {
+			logg.Error("while reporting error to Sentry (event ID %s): %s", envelope.EventID, err.Error())
+		}
+
+		// report drops at most once per delivery, so that we do not flood the log
+		// during the sort of error storm that causes drops in the first place
+		if dropped := s.dropped.Load(); dropped > droppedBefore {
+			logg.Error("could not report %d errors to Sentry because too many errors were waiting for delivery", dropped-droppedBefore)
+			droppedBefore = dropped
+		}
+		s.pending.Done()
+	}
+}
+
+// Flush blocks until all events submitted so far have been delivered (or
+// until their delivery has failed).
+func (s *SentryReporter) Flush() {
+	s.pending.Wait()
+}
+
+// DroppedEvents returns how many events have been dropped so far because the
+// queue of events waiting for delivery was full.
+func (s *SentryReporter) DroppedEvents() uint64 {
+	return s.dropped.Load()
+}
+
+func generateSentryEventID() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("while generating event ID: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// The subset of Sentry's event payload that we generate.
+// Reference: <https://develop.sentry.dev/sdk/data-model/event-payloads/>
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Transaction string            `json:"transaction"`
+	Message     *sentryMessage    `json:"message,omitempty"`
+	Exception   *sentryException  `json:"exception,omitempty"`
+	Request     sentryRequest     `json:"request"`
+	Tags        map[string]string `json:"tags"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+type sentryMessage struct {
+	Formatted string `json:"formatted"`
+}
+
+type sentryException struct {
+	Values []sentryExceptionValue `json:"values"`
+}
+
+type sentryExceptionValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sentryRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (s *SentryReporter) buildEnvelope(eventID string, report ErrorReport, now time.Time) ([]byte, error) {
+	event := sentryEvent{
+		EventID:     eventID,
+		Timestamp:   now.UTC().Format(time.RFC3339Nano),
+		Platform:    "go",
+		Level:       "error",
+		Logger:      "httpapi",
+		ServerName:  s.serverName,
+		Release:     s.opts.Release,
+		Environment: s.opts.Environment,
+		Transaction: fmt.Sprintf("%s %s", report.Request.Method, report.EndpointID),
+		Request: sentryRequest{
+			Method: report.Request.Method,
+			URL:    report.URL,
+		},
+		Tags: map[string]string{
+			"endpoint":    report.EndpointID,
+			"status_code": strconv.Itoa(report.StatusCode),
+		},
+	}
+	// only forward headers that cannot contain credentials
+	for _, key := range []string{"User-Agent", "Referer"} {
+		if value := report.Request.Header.Get(key); value != "" {
+			if event.Request.Headers == nil {
+				event.Request.Headers = make(map[string]string)
+			}
+			event.Request.Headers[key] = value
+		}
+	}
+	if report.RequestID != "" {
+		event.Tags["request_id"] = report.RequestID
+	}
+	if report.IsPanic {
+		event.Level = "fatal"
+		event.Exception = &sentryException{Values: []sentryExceptionValue{{Type: "panic", Value: report.Message}}}
+		event.Extra = map[string]string{"stack": string(report.Stack)}
+	} else {
+		event.Message = &sentryMessage{Formatted: report.Message}
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	headerJSON, err := json.Marshal(map[string]string{
+		"event_id": eventID,
+		"sent_at":  now.UTC().Format(time.RFC3339Nano),
+		"dsn":      s.opts.DSN,
+	})
+	if err != nil {
+		return nil, err
+	}
+	itemHeaderJSON, err := json.Marshal(map[string]any{"type": "event", "length": len(eventJSON)})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, line := range [][]byte{headerJSON, itemHeaderJSON, eventJSON} {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *SentryReporter) deliver(envelope []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.envelopeURL, bytes.NewReader(envelope))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.authHeader)
+
+	resp, err := s.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected 200 OK, but got %s", resp.Status)
+	}
+	return nil
+}
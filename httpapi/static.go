@@ -0,0 +1,121 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// StaticFilesAPI returns an API that serves the files from the given
+// filesystem (usually an embed.FS) below the given path prefix, e.g. to serve
+// a single-page application frontend or API documentation:
+//
+//	//go:embed frontend/dist
+//	var frontendFS embed.FS
+//
+//	handler := httpapi.Compose(
+//		myAPI,
+//		httpapi.StaticFilesAPI(must.Return(fs.Sub(frontendFS, "frontend/dist")), "/ui"),
+//	)
+//
+// Files are served with a Content-Type based on their file extension, and
+// with an ETag to allow for efficient revalidation. Files named "index.html"
+// are served with "Cache-Control: no-cache", so that clients always check for
+// new versions of the application; all other files may be cached for one hour.
+//
+// Requests for directories are answered with the "index.html" file in that
+// directory. Requests for nonexistent paths without a file extension are
+// answered with the "index.html" file at the root of the filesystem, so that
+// single-page applications can do client-side routing.
+func StaticFilesAPI(fsys fs.FS, prefix string) API {
+	if fsys == nil {
+		panic("StaticFilesAPI called with fsys == nil!")
+	}
+	return staticFilesAPI{fsys, strings.TrimSuffix(prefix, "/")}
+}
+
+type staticFilesAPI struct {
+	fsys   fs.FS
+	prefix string
+}
+
+// AddTo implements the API interface.
+func (a staticFilesAPI) AddTo(r *mux.Router) {
+	r.Methods("GET", "HEAD").PathPrefix(a.prefix + "/").HandlerFunc(a.handleRequest)
+	if a.prefix != "" {
+		r.Methods("GET", "HEAD").Path(a.prefix).Handler(http.RedirectHandler(a.prefix+"/", http.StatusMovedPermanently))
+	}
+}
+
+func (a staticFilesAPI) handleRequest(w http.ResponseWriter, r *http.Request) {
+	IdentifyEndpoint(r, a.prefix+"/*")
+
+	// fs.FS paths are relative and must not contain ".." or empty segments
+	filePath := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, a.prefix)), "/")
+	if filePath == "" {
+		filePath = "."
+	}
+
+	name, content, err := a.findFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) && path.Ext(filePath) == "" {
+		name, content, err = a.findFile(".")
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if path.Base(name) == "index.html" {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	if !CheckConditionalRequest(w, r, StrongETag(content)) {
+		return
+	}
+	// ServeContent chooses the Content-Type based on the file name, and handles Range requests
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// Reads the file at the given path, or the index.html file if the path refers to a directory.
+// Returns the actual path of the file that was read.
+func (a staticFilesAPI) findFile(filePath string) (string, []byte, error) {
+	info, err := fs.Stat(a.fsys, filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	if info.IsDir() {
+		filePath = path.Join(filePath, "index.html")
+	}
+	content, err := fs.ReadFile(a.fsys, filePath)
+	return filePath, content, err
+}
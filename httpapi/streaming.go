@@ -0,0 +1,111 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// WithStreamingMetrics can be given as an argument to Compose() to change how
+// long-lived connections are reflected in the metrics emitted by this package.
+// This concerns connections that are taken over by the handler (e.g. for
+// WebSockets, see http.Hijacker) as well as Server-Sent Events (responses with
+// "Content-Type: text/event-stream").
+//
+// By default, such connections count towards the regular histogram metrics
+// just like any other request, which can skew the response duration metrics
+// heavily. With this option, they are instead counted in the gauge metric
+// "httpmux_open_streams" while they are open, and not included in the
+// histogram metrics at all.
+//
+// Regardless of this option, such connections produce two request log lines:
+// one when the connection is upgraded or the stream starts (with the extra
+// field `stream="opened"`), and one when the handler returns (with the extra
+// field `stream="closed"`).
+func WithStreamingMetrics() API {
+	return pseudoAPI{
+		configure: func(m *middleware) {
+			m.streamingMetrics = true
+		},
+	}
+}
+
+// Hijack implements the http.Hijacker interface.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.original.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("underlying http.ResponseWriter does not implement http.Hijacker")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the handler will usually write the 101 response by itself
+	if !w.headersWritten {
+		w.statusCode = http.StatusSwitchingProtocols
+		w.headersWritten = true
+	}
+
+	// count the bytes written into the hijacked connection (the bufio.Writer
+	// should always be empty at this point, but we do not want to discard data
+	// if it is not)
+	w.hijackedConn = &countingConn{Conn: conn}
+	if rw.Writer.Buffered() == 0 {
+		rw.Writer.Reset(w.hijackedConn)
+	}
+	w.startStream()
+	return w.hijackedConn, rw, nil
+}
+
+// Called when we notice that the response is going to be a long-lived stream.
+func (w *responseWriter) startStream() {
+	if w.isStream {
+		return
+	}
+	w.isStream = true
+	if w.onStreamStart != nil {
+		w.onStreamStart()
+	}
+}
+
+func isEventStream(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
+// A net.Conn that counts the bytes written into it.
+type countingConn struct {
+	net.Conn
+	bytesWritten atomic.Uint64
+}
+
+// Write implements the net.Conn interface.
+func (c *countingConn) Write(buf []byte) (int, error) {
+	n, err := c.Conn.Write(buf)
+	if n > 0 {
+		c.bytesWritten.Add(uint64(n))
+	}
+	return n, err
+}
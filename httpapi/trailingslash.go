@@ -0,0 +1,116 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// TrailingSlashPolicy is the type of the argument of WithTrailingSlashPolicy().
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashStrict is the default policy: A request path only matches an
+	// endpoint if it has a trailing slash exactly when the endpoint's path has
+	// one. Otherwise, the request is answered with "404 Not Found".
+	TrailingSlashStrict TrailingSlashPolicy = iota
+	// TrailingSlashRedirect answers requests whose path does not match any
+	// endpoint, but would match one after adding or removing a trailing slash,
+	// with "308 Permanent Redirect" to that path. Unlike the 301 redirect
+	// produced by mux.Router.StrictSlash(), this preserves the method and body
+	// of the request.
+	TrailingSlashRedirect
+)
+
+// WithTrailingSlashPolicy can be given as an argument to Compose() to choose
+// how request paths that differ from an endpoint's path only by a trailing
+// slash are handled. The policy applies uniformly to all APIs given to
+// Compose(). See the documentation on type TrailingSlashPolicy for the
+// available options.
+func WithTrailingSlashPolicy(policy TrailingSlashPolicy) API {
+	switch policy {
+	case TrailingSlashStrict, TrailingSlashRedirect:
+	default:
+		panic("WithTrailingSlashPolicy called with unknown policy!")
+	}
+	return pseudoAPI{
+		configure: func(m *middleware) {
+			m.trailingSlashPolicy = policy
+		},
+	}
+}
+
+// Implements mux.Router.NotFoundHandler for WithAutomaticMethodHandling() and
+// WithTrailingSlashPolicy(TrailingSlashRedirect).
+type notFoundHandler struct {
+	router                  *mux.Router
+	automaticMethodHandling bool
+	trailingSlashPolicy     TrailingSlashPolicy
+	fallback                http.Handler // if nil, http.NotFound() is used
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h notFoundHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// mux.Router does not detect all method mismatches (a later route that
+	// matches the method, but not the path, hides the mismatch of an earlier
+	// route), so some requests that deserve a 405 end up here
+	if h.automaticMethodHandling && h.hasRouteForPath(r) {
+		methodNotAllowedHandler{h.router}.ServeHTTP(w, r)
+		return
+	}
+
+	if h.trailingSlashPolicy == TrailingSlashRedirect && r.URL.Path != "/" {
+		probe := r.Clone(r.Context())
+		if strings.HasSuffix(r.URL.Path, "/") {
+			probe.URL.Path = strings.TrimSuffix(r.URL.Path, "/")
+		} else {
+			probe.URL.Path = r.URL.Path + "/"
+		}
+		probe.URL.RawPath = ""
+
+		// if the alternate path only has a method mismatch, redirect anyway to have the 405 generated there
+		if h.hasRouteForPath(probe) {
+			target := probe.URL.EscapedPath()
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+			return
+		}
+	}
+
+	if h.fallback != nil {
+		h.fallback.ServeHTTP(w, r)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// Returns whether any route matches the request, disregarding the request method.
+func (h notFoundHandler) hasRouteForPath(r *http.Request) bool {
+	var match mux.RouteMatch
+	if h.router.Match(r, &match) && match.MatchErr == nil {
+		return true
+	}
+	return len(methodNotAllowedHandler{h.router}.allowedMethodsFor(r)) > 0
+}
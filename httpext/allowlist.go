@@ -0,0 +1,314 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HostAllowlist is the argument type for RestrictHosts().
+type HostAllowlist struct {
+	// Host names that requests may be sent to. Entries starting with "*."
+	// match all subdomains of the given domain (but not the domain itself),
+	// e.g. "*.example.com" matches "foo.example.com", but not "example.com".
+	// Matching is case-insensitive and ignores the port.
+	HostNames []string
+	// IP ranges that requests may be sent to when the URL contains an IP
+	// address instead of a host name. Use netip.MustParsePrefix() to build
+	// these from CIDR notation, e.g. "192.0.2.0/24". Single addresses can be
+	// given as prefixes covering just that address, e.g. "192.0.2.1/32".
+	//
+	// These ranges are also consulted when an allowlisted host name resolves
+	// to a non-public address (see RestrictHosts() for details).
+	IPRanges []netip.Prefix
+}
+
+// Allows checks whether the given host (as in url.URL.Hostname()) is covered by this allowlist.
+func (a HostAllowlist) Allows(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err == nil {
+		addr = addr.Unmap().WithZone("")
+		for _, prefix := range a.IPRanges {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, pattern := range a.HostNames {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if suffix, isWildcard := strings.CutPrefix(pattern, "*"); isWildcard {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Address ranges that netip.Addr.IsPrivate() does not cover, but which can
+// still reach internal networks.
+var nonPublicRanges = []netip.Prefix{
+	// shared address space for carrier-grade NAT (RFC 6598)
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// NAT64 prefixes (RFC 6052, RFC 8215), which embed arbitrary IPv4 addresses (including private ones)
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// Returns whether the given address is publicly routable.
+func isPublicAddress(addr netip.Addr) bool {
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicRanges {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsDialing checks whether a connection to the given IP address may be
+// established for a request to an allowed host. Public addresses are always
+// allowed. Non-public addresses (loopback, link-local, private, carrier-grade
+// NAT, NAT64, etc.) are only allowed if they are covered by one of the IPRanges.
+func (a HostAllowlist) AllowsDialing(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	if isPublicAddress(addr) {
+		return true
+	}
+	for _, prefix := range a.IPRanges {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// HostNotAllowedError is returned by the RoundTripper from RestrictHosts()
+// when a request is blocked because its host is not covered by the allowlist.
+type HostNotAllowedError struct {
+	Host string
+	// If the host itself is allowed, but it resolved to an IP address that may
+	// not be dialed (see HostAllowlist.AllowsDialing), this contains that
+	// address. Otherwise, this is the zero value.
+	Address netip.Addr
+}
+
+// Error implements the builtin/error interface.
+func (e HostNotAllowedError) Error() string {
+	if e.Address.IsValid() {
+		return fmt.Sprintf("request to %q was blocked because this host resolved to %s, which is not on the allowlist for outgoing requests", e.Host, e.Address)
+	}
+	return fmt.Sprintf("request to %q was blocked because this host is not on the allowlist for outgoing requests", e.Host)
+}
+
+// RestrictHosts returns a RoundTripper wrapper that can be given to
+// WrappedTransport.Attach(). It blocks all outgoing requests to hosts that are
+// not covered by the given allowlist, by failing them with a
+// HostNotAllowedError before they reach the network.
+//
+// This is intended as a protection against server-side request forgery (SSRF)
+// in applications that fetch URLs supplied by users, e.g. for webhooks. When
+// following redirects, http.Client sends each redirected request through the
+// RoundTripper again, so redirects to hosts outside the allowlist are blocked
+// as well.
+//
+// If the wrapped RoundTripper is a *http.Transport, it is cloned and the clone
+// additionally checks every IP address that it connects to, in order to
+// prevent an allowlisted host name (esp. a wildcard) from being pointed at an
+// internal address. Connections to non-public addresses (see
+// HostAllowlist.AllowsDialing) are only allowed if the address is covered by
+// the allowlist's IPRanges. Since the check happens when dialing, it also
+// covers DNS responses that change between requests. Note that:
+//
+//   - Because of the cloning, changes to the wrapped *http.Transport that are
+//     made after RestrictHosts() was applied do not take effect.
+//   - If the transport has a custom Dial, DialContext, DialTLS or
+//     DialTLSContext function, the address is checked after the connection
+//     was established, but before any data is sent on it.
+//   - Requests that are sent through an HTTP proxy are not subject to this
+//     check, since the host name is resolved by the proxy in this case.
+//   - For any other type of RoundTripper, host names are checked by name only.
+//
+// The following metric is registered with the given registerer (or the
+// default registerer if nil is given):
+//
+//   - "httpext_blocked_requests" (counter, no labels): incremented whenever a
+//     request is blocked. The blocked host is not reported as a label since
+//     it is usually chosen by the user, and would thus allow unbounded
+//     cardinality. Use the HostNotAllowedError to log the host instead.
+//
+// For example:
+//
+//	client := &http.Client{Transport: httpext.RestrictHosts(httpext.HostAllowlist{
+//		HostNames: []string{"hooks.example.com", "*.hooks.example.org"},
+//	}, nil)(http.DefaultTransport)}
+func RestrictHosts(allowlist HostAllowlist, registerer prometheus.Registerer) func(http.RoundTripper) http.RoundTripper {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	blockedCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "httpext_blocked_requests",
+		Help: "Counter for outgoing HTTP requests that were blocked because their host is not on the allowlist.",
+	})
+	registerer.MustRegister(blockedCounter)
+
+	return func(inner http.RoundTripper) http.RoundTripper {
+		h := &hostAllowlistRoundTripper{inner: inner, allowlist: allowlist, blockedCounter: blockedCounter}
+		if t, ok := inner.(*http.Transport); ok {
+			h.proxy = t.Proxy
+			h.direct = t.Clone()
+			h.direct.Proxy = nil
+			switch {
+			case t.DialContext != nil:
+				h.direct.DialContext = h.checkDialedConn(t.DialContext)
+			case t.Dial != nil: //nolint:staticcheck // the deprecated field needs to be honored if set
+				h.direct.DialContext = h.checkDialedConn(withoutContext(t.Dial)) //nolint:staticcheck // same
+			default:
+				h.direct.DialContext = h.dialWithControl
+			}
+			switch {
+			case t.DialTLSContext != nil:
+				h.direct.DialTLSContext = h.checkDialedConn(t.DialTLSContext)
+			case t.DialTLS != nil: //nolint:staticcheck // the deprecated field needs to be honored if set
+				h.direct.DialTLSContext = h.checkDialedConn(withoutContext(t.DialTLS)) //nolint:staticcheck // same
+			}
+		}
+		return h
+	}
+}
+
+type hostAllowlistRoundTripper struct {
+	inner          http.RoundTripper
+	allowlist      HostAllowlist
+	blockedCounter prometheus.Counter
+	// only set if `inner` is a *http.Transport: `direct` is a clone of `inner`
+	// that checks all dialed addresses, and `proxy` is inner.Proxy
+	direct *http.Transport
+	proxy  func(*http.Request) (*url.URL, error)
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (h *hostAllowlistRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	host := r.URL.Hostname()
+	if !h.allowlist.Allows(host) {
+		h.blockedCounter.Inc()
+		if r.Body != nil {
+			r.Body.Close() // as required by the http.RoundTripper interface contract
+		}
+		return nil, HostNotAllowedError{Host: host}
+	}
+
+	if h.direct == nil {
+		return h.inner.RoundTrip(r)
+	}
+	if h.proxy != nil {
+		proxyURL, err := h.proxy(r)
+		if err != nil || proxyURL != nil {
+			// let the original transport deal with the proxy (or report the error)
+			return h.inner.RoundTrip(r)
+		}
+	}
+	resp, err := h.direct.RoundTrip(r)
+	var hnaErr HostNotAllowedError
+	if errors.As(err, &hnaErr) {
+		h.blockedCounter.Inc()
+	}
+	return resp, err
+}
+
+// Implements http.Transport.DialContext with the same dialer settings as
+// http.DefaultTransport, but checks all IP addresses before connecting to them.
+func (h *hostAllowlistRoundTripper) dialWithControl(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, dialedAddress string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(dialedAddress)
+			if err != nil {
+				return err
+			}
+			return h.checkDialedAddress(host, addrPort.Addr())
+		},
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// Wraps a custom DialContext function such that the remote address of each
+// established connection is checked before the connection is used.
+func (h *hostAllowlistRoundTripper) checkDialedConn(dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+		if err == nil {
+			err = h.checkDialedAddress(host, addrPort.Addr())
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+func withoutContext(dial func(string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(_ context.Context, network, address string) (net.Conn, error) {
+		return dial(network, address)
+	}
+}
+
+func (h *hostAllowlistRoundTripper) checkDialedAddress(host string, addr netip.Addr) error {
+	if h.allowlist.AllowsDialing(addr) {
+		return nil
+	}
+	return HostNotAllowedError{Host: host, Address: addr.Unmap().WithZone("")}
+}
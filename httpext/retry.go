@@ -0,0 +1,257 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpext
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RetryBudget is a token bucket that limits the rate of retries across all
+// HTTP clients in this process. Each retry takes one token from the bucket,
+// and the bucket is refilled at a constant rate up to its capacity. When the
+// bucket is empty, retries are skipped and the failed response or error is
+// returned to the caller right away.
+//
+// During a widespread outage, this ensures that retries are throttled
+// globally, instead of multiplying the load on the affected services.
+// The same budget should therefore be shared by all middlewares that retry
+// requests, e.g. by giving it to each instance of Retry(). Custom retry
+// loops can consult it through TryAcquire().
+type RetryBudget struct {
+	mutex      sync.Mutex
+	capacity   float64
+	refillRate float64 // tokens per second
+	tokens     float64
+	lastRefill time.Time
+	now        func() time.Time // for unit tests
+}
+
+// NewRetryBudget creates a RetryBudget that starts out full, holds at most
+// `capacity` tokens and is refilled with `refillPerSecond` tokens per second.
+//
+// The following metric is registered with the given registerer (or the
+// default registerer if nil is given):
+//
+//   - "httpext_retry_budget_remaining" (gauge): the number of retries that
+//     can currently be made before the budget is exhausted.
+//
+// Since this metric does not have any labels, only one RetryBudget can be
+// registered with each registerer. This is intentional: There should only be
+// one budget per process, which is shared by all HTTP clients.
+//
+// For example, to allow bursts of 100 retries, but no more than 10 retries
+// per second on average:
+//
+//	budget := httpext.NewRetryBudget(100, 10, nil)
+//	transport := httpext.WrapTransport(&http.DefaultTransport)
+//	transport.Attach(httpext.Retry(httpext.RetryPolicy{MaxRetries: 3, Budget: budget}))
+func NewRetryBudget(capacity int, refillPerSecond float64, registerer prometheus.Registerer) *RetryBudget {
+	if capacity <= 0 || refillPerSecond <= 0 {
+		panic("NewRetryBudget() called with non-positive capacity or refill rate")
+	}
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	b := &RetryBudget{
+		capacity:   float64(capacity),
+		refillRate: refillPerSecond,
+		tokens:     float64(capacity),
+		lastRefill: time.Now(),
+		now:        time.Now,
+	}
+	registerer.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "httpext_retry_budget_remaining",
+		Help: "Number of retries of outgoing HTTP requests that can currently be made before the retry budget is exhausted.",
+	}, b.Remaining))
+	return b
+}
+
+// TryAcquire takes one token from the budget, and returns whether this was
+// possible. If false is returned, the caller shall not retry.
+func (b *RetryBudget) TryAcquire() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Remaining returns the number of tokens currently in the budget.
+func (b *RetryBudget) Remaining() float64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill()
+	return b.tokens
+}
+
+func (b *RetryBudget) refill() {
+	now := b.now()
+	elapsed := now.Sub(b.lastRefill)
+	if elapsed > 0 {
+		b.tokens = min(b.capacity, b.tokens+elapsed.Seconds()*b.refillRate)
+		b.lastRefill = now
+	}
+}
+
+// RetryPolicy is the argument type for Retry().
+type RetryPolicy struct {
+	// How often each request is retried at most. Required.
+	MaxRetries int
+	// How long to wait before the first retry. Each further retry waits twice
+	// as long as the previous one, up to MaxBackoff. Default: 100 milliseconds.
+	InitialBackoff time.Duration
+	// The upper limit for the wait time between retries, including waits
+	// requested by the server through a Retry-After header. Default: 5 seconds.
+	MaxBackoff time.Duration
+	// If not nil, each retry needs to take a token from this budget.
+	// Retries are skipped while the budget is exhausted.
+	Budget *RetryBudget
+}
+
+// Retry returns a RoundTripper wrapper that can be given to
+// WrappedTransport.Attach(). It retries requests that failed with a network
+// error or with one of the statuses 502 (Bad Gateway), 503 (Service
+// Unavailable) or 504 (Gateway Timeout), according to the given policy.
+//
+// If a 503 response has a Retry-After header that asks for a longer wait than
+// the current backoff, the retry waits that long instead (but not longer than
+// MaxBackoff).
+//
+// Only requests with idempotent methods (GET, HEAD, OPTIONS, TRACE, PUT,
+// DELETE) or with an Idempotency-Key header are retried. Requests with a body
+// are only retried if the body can be obtained again through Request.GetBody,
+// which is the case for bodies given to http.NewRequest() as *bytes.Buffer,
+// *bytes.Reader or *strings.Reader.
+func Retry(policy RetryPolicy) func(http.RoundTripper) http.RoundTripper {
+	if policy.MaxRetries <= 0 {
+		panic("Retry() called with non-positive MaxRetries")
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = 100 * time.Millisecond
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 5 * time.Second
+	}
+	return func(inner http.RoundTripper) http.RoundTripper {
+		return &retryRoundTripper{inner, policy}
+	}
+}
+
+type retryRoundTripper struct {
+	inner  http.RoundTripper
+	policy RetryPolicy
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (rt *retryRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !isRetryableRequest(r) {
+		return rt.inner.RoundTrip(r)
+	}
+
+	backoff := rt.policy.InitialBackoff
+	for retry := 0; ; retry++ {
+		resp, err := rt.inner.RoundTrip(r)
+		if !isRetryableResult(resp, err) || retry >= rt.policy.MaxRetries || r.Context().Err() != nil {
+			return resp, err
+		}
+		if rt.policy.Budget != nil && !rt.policy.Budget.TryAcquire() {
+			return resp, err
+		}
+		wait := backoff
+		if resp != nil && resp.StatusCode == http.StatusServiceUnavailable {
+			retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			if ok {
+				wait = max(wait, min(retryAfter, rt.policy.MaxBackoff))
+			}
+		}
+
+		// rewind the request body (if any) before the retry
+		if r.Body != nil && r.Body != http.NoBody {
+			body, bodyErr := r.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			r = r.Clone(r.Context())
+			r.Body = body
+		}
+		if resp != nil {
+			// drain the body to allow reuse of the connection
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, rt.policy.MaxBackoff)
+	}
+}
+
+func isRetryableRequest(r *http.Request) bool {
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return r.Header.Get("Idempotency-Key") != ""
+	}
+}
+
+func isRetryableResult(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Parses the value of a Retry-After header, which can be either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	seconds, err := strconv.ParseUint(value, 10, 32)
+	if err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err == nil {
+		return max(0, date.Sub(now)), true
+	}
+	return 0, false
+}
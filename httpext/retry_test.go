@@ -0,0 +1,170 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpext
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestRetryBudget(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	budget := NewRetryBudget(2, 0.5, registry)
+	now := time.Now()
+	budget.now = func() time.Time { return now }
+	budget.lastRefill = now
+
+	assert.DeepEqual(t, "TryAcquire #1", budget.TryAcquire(), true)
+	assert.DeepEqual(t, "TryAcquire #2", budget.TryAcquire(), true)
+	assert.DeepEqual(t, "TryAcquire #3", budget.TryAcquire(), false)
+
+	// the budget is refilled over time, but not beyond its capacity
+	now = now.Add(time.Second)
+	assert.DeepEqual(t, "Remaining after 1s", budget.Remaining(), 0.5)
+	assert.DeepEqual(t, "TryAcquire after 1s", budget.TryAcquire(), false)
+	now = now.Add(time.Second)
+	assert.DeepEqual(t, "TryAcquire after 2s", budget.TryAcquire(), true)
+	now = now.Add(time.Hour)
+	assert.DeepEqual(t, "Remaining after 1h", budget.Remaining(), 2.0)
+
+	families := must.Return(registry.Gather())
+	assert.DeepEqual(t, "metric name", families[0].GetName(), "httpext_retry_budget_remaining")
+	assert.DeepEqual(t, "metric value", families[0].GetMetric()[0].GetGauge().GetValue(), 2.0)
+}
+
+func TestRetry(t *testing.T) {
+	// this server fails the first few requests for each path
+	var (
+		mutex        sync.Mutex
+		requestCount = make(map[string]int)
+		bodies       []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requestCount[r.URL.Path]++
+		body := must.Return(io.ReadAll(r.Body))
+		if len(body) > 0 {
+			bodies = append(bodies, string(body))
+		}
+		failures := must.Return(strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/fail-")))
+		if requestCount[r.URL.Path] <= failures {
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	budget := NewRetryBudget(3, 0.001, prometheus.NewRegistry())
+	rt := Retry(RetryPolicy{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		Budget:         budget,
+	})(&http.Transport{})
+
+	doRequest := func(method, path, body string) int {
+		t.Helper()
+		req := must.ReturnT(http.NewRequest(method, server.URL+path, strings.NewReader(body)))(t)
+		resp := must.ReturnT(rt.RoundTrip(req))(t)
+		must.SucceedT(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	// transient failures are retried (with the request body being sent again)
+	assert.DeepEqual(t, "status for fail-1", doRequest(http.MethodPut, "/fail-1", "hello"), http.StatusOK)
+	assert.DeepEqual(t, "bodies", bodies, []string{"hello", "hello"})
+
+	// not more than MaxRetries times
+	assert.DeepEqual(t, "status for fail-5", doRequest(http.MethodGet, "/fail-5", ""), http.StatusServiceUnavailable)
+	assert.DeepEqual(t, "request count for fail-5", requestCount["/fail-5"], 3)
+
+	// non-idempotent requests are not retried
+	assert.DeepEqual(t, "status for POST fail-4", doRequest(http.MethodPost, "/fail-4", ""), http.StatusServiceUnavailable)
+	assert.DeepEqual(t, "request count for fail-4", requestCount["/fail-4"], 1)
+
+	// once the budget is exhausted (3 retries were made above), retries are skipped
+	assert.DeepEqual(t, "budget", budget.TryAcquire(), false)
+	assert.DeepEqual(t, "status for fail-2", doRequest(http.MethodGet, "/fail-2", ""), http.StatusServiceUnavailable)
+	assert.DeepEqual(t, "request count for fail-2", requestCount["/fail-2"], 1)
+}
+
+func TestRetryWithRetryAfter(t *testing.T) {
+	// this server asks for a long wait before the first retry
+	var requestCount int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		if requestCount == 1 {
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// the requested wait is honored, but only up to MaxBackoff
+	rt := Retry(RetryPolicy{
+		MaxRetries:     1,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+	})(&http.Transport{})
+	start := time.Now()
+	req := must.ReturnT(http.NewRequest(http.MethodGet, server.URL, http.NoBody))(t)
+	resp := must.ReturnT(rt.RoundTrip(req))(t)
+	must.SucceedT(t, resp.Body.Close())
+	elapsed := time.Since(start)
+
+	assert.DeepEqual(t, "status", resp.StatusCode, http.StatusOK)
+	assert.DeepEqual(t, "request count", requestCount, 2)
+	if elapsed < 100*time.Millisecond || elapsed > 10*time.Second {
+		t.Errorf("expected retry to wait for MaxBackoff, but request took %s", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)
+	type result struct {
+		Duration time.Duration
+		OK       bool
+	}
+	for value, expected := range map[string]result{
+		"":                              {0, false},
+		"120":                           {2 * time.Minute, true},
+		"-5":                            {0, false},
+		"soon":                          {0, false},
+		"Fri, 31 Jan 2025 12:00:30 GMT": {30 * time.Second, true},
+		"Fri, 31 Jan 2025 11:00:00 GMT": {0, true},
+	} {
+		duration, ok := parseRetryAfter(value, now)
+		assert.DeepEqual(t, "parseRetryAfter("+value+")", result{duration, ok}, expected)
+	}
+}
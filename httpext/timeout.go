@@ -0,0 +1,125 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httpext
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultTimeout returns a RoundTripper wrapper that can be given to
+// WrappedTransport.Attach(). For outgoing requests whose context does not have
+// a deadline, it applies the given timeout to the whole request, including
+// reading the response body. Requests with a deadline are not changed.
+//
+// This is intended as a safety net against unbounded client calls, and as a
+// tool for finding them. The following metrics are registered with the given
+// registerer (or the default registerer if nil is given):
+//
+//   - "httpext_default_timeouts_applied" (counter, labels: "host"): incremented
+//     whenever the default timeout is applied to a request.
+//   - "httpext_default_timeouts_exceeded" (counter, labels: "host"): incremented
+//     whenever a request fails because the default timeout was exceeded.
+//
+// For example:
+//
+//	transport := httpext.WrapTransport(&http.DefaultTransport)
+//	transport.Attach(httpext.DefaultTimeout(2*time.Minute, nil))
+func DefaultTimeout(timeout time.Duration, registerer prometheus.Registerer) func(http.RoundTripper) http.RoundTripper {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	appliedCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "httpext_default_timeouts_applied",
+		Help: "Counter for outgoing HTTP requests without deadline that had a default timeout applied.",
+	}, []string{"host"})
+	exceededCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "httpext_default_timeouts_exceeded",
+		Help: "Counter for outgoing HTTP requests that failed because the default timeout was exceeded.",
+	}, []string{"host"})
+	registerer.MustRegister(appliedCounter)
+	registerer.MustRegister(exceededCounter)
+
+	return func(inner http.RoundTripper) http.RoundTripper {
+		return &defaultTimeoutRoundTripper{inner, timeout, appliedCounter, exceededCounter}
+	}
+}
+
+type defaultTimeoutRoundTripper struct {
+	inner           http.RoundTripper
+	timeout         time.Duration
+	appliedCounter  *prometheus.CounterVec
+	exceededCounter *prometheus.CounterVec
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (d *defaultTimeoutRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if _, hasDeadline := r.Context().Deadline(); hasDeadline {
+		return d.inner.RoundTrip(r)
+	}
+
+	labels := prometheus.Labels{"host": r.URL.Host}
+	d.appliedCounter.With(labels).Inc()
+	ctx, cancel := context.WithTimeout(r.Context(), d.timeout)
+	onError := func(err error) {
+		if errors.Is(err, context.DeadlineExceeded) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			d.exceededCounter.With(labels).Inc()
+		}
+	}
+
+	resp, err := d.inner.RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		onError(err)
+		cancel()
+		return nil, err
+	}
+
+	// the context must stay alive until the response body has been consumed
+	resp.Body = &cancelOnCloseBody{resp.Body, cancel, onError}
+	return resp, nil
+}
+
+// Wraps a response body to cancel the request context when the body is closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel  context.CancelFunc
+	onError func(error)
+}
+
+// Read implements the io.Reader interface.
+func (b *cancelOnCloseBody) Read(buf []byte) (int, error) {
+	n, err := b.ReadCloser.Read(buf)
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.onError(err)
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
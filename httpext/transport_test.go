@@ -23,11 +23,21 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
 )
 
 func TestSetInsecureSkipVerify(t *testing.T) {
@@ -142,3 +152,205 @@ func (h headerAdder) RoundTrip(r *http.Request) (*http.Response, error) {
 	r.Header.Set(h.Key, h.Value)
 	return h.Inner.RoundTrip(r)
 }
+
+func TestDefaultTimeout(t *testing.T) {
+	// this server responds slowly if requested
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("slow") {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	rt := http.RoundTripper(&http.Transport{})
+	wrap := WrapTransport(&rt)
+	wrap.Attach(DefaultTimeout(100*time.Millisecond, registry))
+	client := &http.Client{Transport: rt}
+
+	doRequest := func(ctx context.Context, query string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+query, http.NoBody)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	// fast request without deadline: default timeout is applied, but does not trigger
+	err := doRequest(context.Background(), "")
+	assert.DeepEqual(t, "error", err, nil)
+
+	// slow request without deadline: default timeout triggers
+	err = doRequest(context.Background(), "?slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, but got %v", err)
+	}
+
+	// request with explicit deadline: default timeout is not applied
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = doRequest(ctx, "")
+	assert.DeepEqual(t, "error", err, nil)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	counterValues := make(map[string]float64)
+	for _, family := range must.Return(registry.Gather()) {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "host" && label.GetValue() == host {
+					counterValues[family.GetName()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	assert.DeepEqual(t, "counter values", counterValues, map[string]float64{
+		"httpext_default_timeouts_applied":  2,
+		"httpext_default_timeouts_exceeded": 1,
+	})
+}
+
+func TestRestrictHosts(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	rt := RestrictHosts(HostAllowlist{
+		HostNames: []string{"example.com", "*.example.org."},
+		IPRanges:  []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("2001:db8::/32")},
+	}, registry)(dummyRoundTripper{})
+
+	testCases := map[string]bool{
+		"http://example.com/foo":         true,
+		"https://EXAMPLE.com:8443/foo":   true,
+		"http://example.com./":           true,
+		"http://www.example.com/":        false,
+		"http://foo.example.org/":        true,
+		"http://foo.bar.example.org/":    true,
+		"http://example.org/":            false,
+		"http://badexample.org/":         false,
+		"http://192.0.2.42/":             true,
+		"http://192.0.3.1/":              false,
+		"http://127.0.0.1:8080/":         false,
+		"http://[2001:db8::1]/":          true,
+		"http://[::ffff:192.0.2.1]/":     true,
+		"http://[::1]/":                  false,
+		"http://169.254.169.254/latest/": false,
+	}
+
+	blockedCount := 0
+	for url, expectedAllowed := range testCases {
+		req := must.ReturnT(http.NewRequest(http.MethodGet, url, http.NoBody))(t)
+		resp, err := rt.RoundTrip(req)
+		if expectedAllowed {
+			if err != nil {
+				t.Errorf("expected request to %s to be allowed, but got error: %s", url, err.Error())
+			} else {
+				resp.Body.Close()
+			}
+			continue
+		}
+
+		blockedCount++
+		var hnaErr HostNotAllowedError
+		if !errors.As(err, &hnaErr) {
+			t.Errorf("expected request to %s to fail with HostNotAllowedError, but got %v", url, err)
+			continue
+		}
+		assert.DeepEqual(t, "blocked host for "+url, hnaErr.Host, req.URL.Hostname())
+	}
+
+	counterValues := make(map[string]float64)
+	for _, family := range must.Return(registry.Gather()) {
+		for _, metric := range family.GetMetric() {
+			counterValues[family.GetName()] = metric.GetCounter().GetValue()
+		}
+	}
+	assert.DeepEqual(t, "counter values", counterValues, map[string]float64{
+		"httpext_blocked_requests": float64(blockedCount),
+	})
+}
+
+func TestRestrictHostsChecksDialedAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	port := must.ReturnT(netip.ParseAddrPort(strings.TrimPrefix(server.URL, "http://")))(t).Port()
+	url := fmt.Sprintf("http://localhost:%d/", port)
+
+	loopbackRanges := []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	customDialer := &net.Dialer{}
+	testCases := []struct {
+		Description     string
+		Transport       *http.Transport
+		IPRanges        []netip.Prefix
+		ExpectedAllowed bool
+	}{
+		{"default dialer", &http.Transport{}, nil, false},
+		{"default dialer with loopback allowed", &http.Transport{}, loopbackRanges, true},
+		{"custom dialer", &http.Transport{DialContext: customDialer.DialContext}, nil, false},
+		{"custom dialer with loopback allowed", &http.Transport{DialContext: customDialer.DialContext}, loopbackRanges, true},
+	}
+
+	for _, tc := range testCases {
+		registry := prometheus.NewRegistry()
+		// "localhost" is on the allowlist by name, but resolves to a loopback address
+		rt := RestrictHosts(HostAllowlist{
+			HostNames: []string{"localhost"},
+			IPRanges:  tc.IPRanges,
+		}, registry)(tc.Transport)
+
+		req := must.ReturnT(http.NewRequest(http.MethodGet, url, http.NoBody))(t)
+		resp, err := rt.RoundTrip(req)
+		if tc.ExpectedAllowed {
+			if err != nil {
+				t.Errorf("%s: expected request to be allowed, but got error: %s", tc.Description, err.Error())
+			} else {
+				resp.Body.Close()
+			}
+			continue
+		}
+
+		var hnaErr HostNotAllowedError
+		if !errors.As(err, &hnaErr) {
+			t.Errorf("%s: expected request to fail with HostNotAllowedError, but got %v", tc.Description, err)
+			continue
+		}
+		assert.DeepEqual(t, tc.Description+": blocked host", hnaErr.Host, "localhost")
+		assert.DeepEqual(t, tc.Description+": blocked address is loopback", hnaErr.Address.IsLoopback(), true)
+		families := must.ReturnT(registry.Gather())(t)
+		assert.DeepEqual(t, tc.Description+": blocked requests", families[0].GetMetric()[0].GetCounter().GetValue(), 1.0)
+	}
+
+	// public addresses are always allowed, non-public addresses only if covered by IPRanges
+	allowlist := HostAllowlist{IPRanges: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}}
+	for addr, expected := range map[string]bool{
+		"8.8.8.8":          true,
+		"2a00:1450::1":     true,
+		"::ffff:8.8.8.8":   true,
+		"10.1.2.3":         true,
+		"10.2.3.4":         false,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"0.0.0.0":          false,
+		"100.64.0.1":       false,
+		"100.128.0.1":      true,
+		"64:ff9b::a01:203": false, // NAT64 for 10.1.2.3
+		"64:ff9b::808:808": false, // NAT64 for 8.8.8.8
+		"64:ff9b:1::1":     false,
+	} {
+		assert.DeepEqual(t, "AllowsDialing("+addr+")", allowlist.AllowsDialing(netip.MustParseAddr(addr)), expected)
+	}
+}
@@ -0,0 +1,100 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// TestingT is implemented by *testing.T, and also satisfied by ginkgo.GinkgoT().
+type TestingT interface {
+	Errorf(format string, args ...any)
+	Helper()
+}
+
+// ExpectHeaders checks that the given response has the expected headers.
+// For each key in `expected`, the response must contain exactly the given
+// values for that header, in the same order. If the expected value list is
+// empty, the response must not contain that header at all. Headers that do
+// not appear in `expected` are not checked.
+//
+// If there is any mismatch, a test error is reported that lists all
+// mismatched headers, and false is returned.
+//
+//	resp := h.RespondTo(ctx, "GET /v1/objects/1")
+//	httptest.ExpectHeaders(t, resp, http.Header{
+//		"Content-Type":  {"application/json"},
+//		"Cache-Control": {"no-cache"},
+//		"Set-Cookie":    nil, // must not be present
+//	})
+func ExpectHeaders(t TestingT, resp *http.Response, expected http.Header) bool {
+	t.Helper()
+
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var diffs []string
+	for _, key := range keys {
+		expectedValues := expected[key]
+		actualValues := resp.Header.Values(key)
+		if slices.Equal(expectedValues, actualValues) {
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf("\t%s:\n\t\texpected = %s\n\t\t  actual = %s",
+			http.CanonicalHeaderKey(key), renderHeaderValues(expectedValues), renderHeaderValues(actualValues)))
+	}
+
+	if len(diffs) == 0 {
+		return true
+	}
+	t.Errorf("%s: unexpected response headers\n%s", describeRequest(resp), strings.Join(diffs, "\n"))
+	return false
+}
+
+// ExpectHeader is like ExpectHeaders, but checks only a single header which
+// is expected to have exactly one value.
+func ExpectHeader(t TestingT, resp *http.Response, key, value string) bool {
+	t.Helper()
+	return ExpectHeaders(t, resp, http.Header{key: {value}})
+}
+
+func renderHeaderValues(values []string) string {
+	if len(values) == 0 {
+		return "(not present)"
+	}
+	quoted := make([]string, len(values))
+	for idx, value := range values {
+		quoted[idx] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func describeRequest(resp *http.Response) string {
+	if resp.Request == nil {
+		return "response"
+	}
+	return resp.Request.Method + " " + resp.Request.URL.String()
+}
@@ -0,0 +1,77 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/httptest"
+)
+
+// A TestingT that records errors instead of failing the test.
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Helper() {}
+
+func TestExpectHeaders(t *testing.T) {
+	h := httptest.NewHandler(exampleHandler)
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	resp := h.RespondTo(ctx, "POST /reflect",
+		httptest.WithHeaders(http.Header{
+			"Foo":     {"bar"},
+			"Numbers": {"23", "42"},
+		}),
+	)
+
+	// check successful assertions
+	var rt recordingT
+	ok := httptest.ExpectHeaders(&rt, resp, http.Header{
+		"Reflected-Foo":     {"bar"},
+		"reflected-numbers": {"23", "42"},
+		"Reflected-Qux":     nil,
+	})
+	ok = httptest.ExpectHeader(&rt, resp, "Reflected-Foo", "bar") && ok
+	assert.DeepEqual(t, "result of successful assertions", ok, true)
+	assert.DeepEqual(t, "errors from successful assertions", rt.errors, []string(nil))
+
+	// check failing assertions
+	ok = httptest.ExpectHeaders(&rt, resp, http.Header{
+		"Reflected-Foo":     nil,
+		"Reflected-Numbers": {"42", "23"},
+		"Reflected-Qux":     {"qux"},
+	})
+	assert.DeepEqual(t, "result of failing assertions", ok, false)
+	assert.DeepEqual(t, "errors from failing assertions", rt.errors, []string{
+		"POST /reflect: unexpected response headers\n" +
+			"\tReflected-Foo:\n\t\texpected = (not present)\n\t\t  actual = \"bar\"\n" +
+			"\tReflected-Numbers:\n\t\texpected = \"42\", \"23\"\n\t\t  actual = \"23\", \"42\"\n" +
+			"\tReflected-Qux:\n\t\texpected = \"qux\"\n\t\t  actual = (not present)",
+	})
+}
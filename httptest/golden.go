@@ -0,0 +1,209 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/sapcc/go-bits/errext"
+	"github.com/sapcc/go-bits/osext"
+)
+
+// SessionRecorder records all requests executed through Handler.RespondTo()
+// into a Session. This can be used for snapshot tests of whole API flows: The
+// recorded session is written into a golden file once, and subsequent test
+// runs compare their recorded session against the golden file.
+//
+//	recorder := httptest.NewSessionRecorder()
+//	h := httptest.NewHandler(myHandler, httptest.WithSessionRecorder(recorder))
+//	// ...execute requests through h.RespondTo()...
+//	recorder.AssertGoldenFile(t, "fixtures/my-flow.json", nil, nil)
+//
+// The golden file is in the same format that LoadSession() understands, so it
+// can also be replayed against a handler with Handler.Replay().
+type SessionRecorder struct {
+	mutex   sync.Mutex
+	session Session
+}
+
+// NewSessionRecorder initializes a SessionRecorder with an empty session.
+func NewSessionRecorder() *SessionRecorder {
+	return &SessionRecorder{}
+}
+
+// WithSessionRecorder is a HandlerOption that records all requests executed
+// through RespondTo() into the given SessionRecorder.
+func WithSessionRecorder(r *SessionRecorder) HandlerOption {
+	return func(h *Handler) {
+		h.recorder = r
+	}
+}
+
+func (r *SessionRecorder) record(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) {
+	ex := Exchange{
+		Request: RecordedRequest{
+			Method:  req.Method,
+			Path:    req.URL.RequestURI(),
+			Headers: cloneHeaders(req.Header),
+			Body:    string(reqBody),
+		},
+		Response: RecordedResponse{
+			Status:  resp.StatusCode,
+			Headers: cloneHeaders(resp.Header),
+			Body:    string(respBody),
+		},
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.session.Exchanges = append(r.session.Exchanges, ex)
+}
+
+func cloneHeaders(hdr http.Header) http.Header {
+	if len(hdr) == 0 {
+		return nil
+	}
+	return hdr.Clone()
+}
+
+// Session returns a copy of the session recorded so far.
+func (r *SessionRecorder) Session() Session {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return Session{Exchanges: slices.Clone(r.session.Exchanges)}
+}
+
+// SaveTo writes the session recorded so far into a file.
+//
+// The second argument can be set to `yaml.Marshal` to write YAML instead of
+// JSON. If `yamlMarshal` is given as nil, the file will contain JSON.
+func (r *SessionRecorder) SaveTo(path string, yamlMarshal func(in any) ([]byte, error)) error {
+	marshal := yamlMarshal
+	if marshal == nil {
+		marshal = func(in any) ([]byte, error) {
+			buf, err := json.MarshalIndent(in, "", "  ")
+			return append(buf, '\n'), err
+		}
+	}
+	buf, err := marshal(r.Session())
+	if err != nil {
+		return fmt.Errorf("while serializing recorded session for %s: %w", path, err)
+	}
+	return os.WriteFile(path, buf, 0o666)
+}
+
+// CompareWith loads the session from the given file (using LoadSession), and
+// compares it against the session recorded so far. All differences are
+// reported in the returned error.
+//
+// Unlike Handler.Replay(), this compares requests and responses in full: All
+// request headers, request bodies and response headers must match exactly.
+// Response bodies are compared structurally if they contain JSON.
+func (r *SessionRecorder) CompareWith(path string, yamlUnmarshal func(in []byte, out any) error) error {
+	expected, err := LoadSession(path, yamlUnmarshal)
+	if err != nil {
+		return err
+	}
+	actual := r.Session()
+
+	var errs errext.ErrorSet
+	for idx := range max(len(expected.Exchanges), len(actual.Exchanges)) {
+		if idx >= len(expected.Exchanges) {
+			ex := actual.Exchanges[idx]
+			errs.Addf("exchange %d (%s %s) was not expected", idx+1, ex.Request.Method, ex.Request.Path)
+			continue
+		}
+		if idx >= len(actual.Exchanges) {
+			ex := expected.Exchanges[idx]
+			errs.Addf("exchange %d (%s %s) was expected, but did not occur", idx+1, ex.Request.Method, ex.Request.Path)
+			continue
+		}
+		errs.Append(compareExchanges(idx, expected.Exchanges[idx], actual.Exchanges[idx]))
+	}
+
+	if errs.IsEmpty() {
+		return nil
+	}
+	return errors.New(errs.Join("\n"))
+}
+
+func compareExchanges(idx int, expected, actual Exchange) (errs errext.ErrorSet) {
+	desc := fmt.Sprintf("exchange %d (%s %s)", idx+1, expected.Request.Method, expected.Request.Path)
+	if expected.Request.Method != actual.Request.Method || expected.Request.Path != actual.Request.Path {
+		errs.Addf("%s: expected request for %s %s, but got %s %s", desc,
+			expected.Request.Method, expected.Request.Path, actual.Request.Method, actual.Request.Path)
+		return errs
+	}
+	if !reflect.DeepEqual(expected.Request.Headers, actual.Request.Headers) {
+		errs.Addf("%s: expected request headers %v, but got %v", desc, expected.Request.Headers, actual.Request.Headers)
+	}
+	if !bodiesAreEquivalent([]byte(expected.Request.Body), []byte(actual.Request.Body)) {
+		errs.Addf("%s: expected request body %q, but got %q", desc, expected.Request.Body, actual.Request.Body)
+	}
+	if expected.Response.Status != actual.Response.Status {
+		errs.Addf("%s: expected status %d, but got %d", desc, expected.Response.Status, actual.Response.Status)
+	}
+	if !reflect.DeepEqual(expected.Response.Headers, actual.Response.Headers) {
+		errs.Addf("%s: expected response headers %v, but got %v", desc, expected.Response.Headers, actual.Response.Headers)
+	}
+	if !bodiesAreEquivalent([]byte(expected.Response.Body), []byte(actual.Response.Body)) {
+		errs.Addf("%s: expected response body %q, but got %q", desc, expected.Response.Body, actual.Response.Body)
+	}
+	return errs
+}
+
+// AssertGoldenFile compares the session recorded so far against the given
+// golden file, and reports a test error if there are differences.
+//
+// If the environment variable GOBITS_UPDATE_FIXTURES is set to a true value,
+// the golden file is (re)written from the recorded session instead. A missing
+// golden file is reported as a test error unless this update mode is active.
+//
+// The marshal and unmarshal functions have the same meaning as for SaveTo and
+// CompareWith, respectively.
+func (r *SessionRecorder) AssertGoldenFile(t TestingT, path string, yamlMarshal func(in any) ([]byte, error), yamlUnmarshal func(in []byte, out any) error) {
+	t.Helper()
+
+	if osext.GetenvBool("GOBITS_UPDATE_FIXTURES") {
+		err := r.SaveTo(path, yamlMarshal)
+		if err != nil {
+			t.Errorf("could not write golden file: %s", err.Error())
+		}
+		return
+	}
+
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Errorf("golden file %s does not exist (set GOBITS_UPDATE_FIXTURES=true to create it)", path)
+		return
+	}
+
+	err = r.CompareWith(path, yamlUnmarshal)
+	if err != nil {
+		t.Errorf("recorded session does not match %s (set GOBITS_UPDATE_FIXTURES=true to update):\n%s", path, err.Error())
+	}
+}
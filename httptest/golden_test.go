@@ -0,0 +1,107 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/httptest"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestGoldenFile(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	t.Setenv("GOBITS_UPDATE_FIXTURES", "")
+
+	runFlow := func(message string) *httptest.SessionRecorder {
+		recorder := httptest.NewSessionRecorder()
+		h := httptest.NewHandler(exampleHandler, httptest.WithSessionRecorder(recorder))
+		h.RespondTo(ctx, "POST /reflect", httptest.WithJSONBody(map[string]string{"message": message}))
+		h.RespondTo(ctx, "GET /not-found")
+		return recorder
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		path := filepath.Join(t.TempDir(), "session."+format)
+		var (
+			marshal   func(any) ([]byte, error)
+			unmarshal func([]byte, any) error
+		)
+		if format == "yaml" {
+			marshal, unmarshal = yaml.Marshal, yaml.Unmarshal
+		}
+
+		// a missing golden file is reported instead of being created silently
+		var rt recordingT
+		runFlow("hello").AssertGoldenFile(&rt, path, marshal, unmarshal)
+		assert.DeepEqual(t, "errors from run without golden file", rt.errors, []string{
+			fmt.Sprintf("golden file %s does not exist (set GOBITS_UPDATE_FIXTURES=true to create it)", path),
+		})
+		_, err := os.Stat(path)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected golden file to not be created, but got: %v", err)
+		}
+
+		// first run in update mode writes the golden file
+		rt.errors = nil
+		t.Setenv("GOBITS_UPDATE_FIXTURES", "true")
+		runFlow("hello").AssertGoldenFile(&rt, path, marshal, unmarshal)
+		t.Setenv("GOBITS_UPDATE_FIXTURES", "")
+		assert.DeepEqual(t, "errors from first run", rt.errors, []string(nil))
+		s := must.Return(httptest.LoadSession(path, unmarshal))
+		assert.DeepEqual(t, "recorded exchanges", len(s.Exchanges), 2)
+		assert.DeepEqual(t, "recorded request body", s.Exchanges[0].Request.Body, `{"message":"hello"}`)
+		assert.DeepEqual(t, "recorded response status", s.Exchanges[1].Response.Status, 404)
+
+		// second run with identical behavior matches the golden file
+		runFlow("hello").AssertGoldenFile(&rt, path, marshal, unmarshal)
+		assert.DeepEqual(t, "errors from second run", rt.errors, []string(nil))
+
+		// the golden file can also be replayed
+		err = httptest.NewHandler(exampleHandler).Replay(ctx, s)
+		if err != nil {
+			t.Errorf("expected replay to succeed, but got: %s", err.Error())
+		}
+
+		// third run with different behavior is reported
+		runFlow("world").AssertGoldenFile(&rt, path, marshal, unmarshal)
+		if len(rt.errors) != 1 || !strings.Contains(rt.errors[0], `exchange 1 (POST /reflect): expected request body "{\"message\":\"hello\"}", but got "{\"message\":\"world\"}"`) {
+			t.Errorf("unexpected errors from third run: %#v", rt.errors)
+		}
+
+		// updating the golden file is possible through the environment
+		t.Setenv("GOBITS_UPDATE_FIXTURES", "true")
+		runFlow("world").AssertGoldenFile(&rt, path, marshal, unmarshal)
+		t.Setenv("GOBITS_UPDATE_FIXTURES", "")
+		rt.errors = nil
+		runFlow("world").AssertGoldenFile(&rt, path, marshal, unmarshal)
+		assert.DeepEqual(t, "errors after update", rt.errors, []string(nil))
+		must.Succeed(os.Remove(path))
+	}
+}
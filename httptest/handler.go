@@ -23,12 +23,15 @@ package httptest
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strings"
 
@@ -37,12 +40,36 @@ import (
 
 // Handler is a wrapper around http.Handler providing convenience methods for use in tests.
 type Handler struct {
-	inner http.Handler
+	inner    http.Handler
+	jar      http.CookieJar
+	recorder *SessionRecorder
 }
 
 // NewHandler wraps the given http.Handler in type Handler to provide extra convenience methods.
-func NewHandler(inner http.Handler) Handler {
-	return Handler{inner}
+func NewHandler(inner http.Handler, options ...HandlerOption) Handler {
+	h := Handler{inner: inner}
+	for _, opt := range options {
+		opt(&h)
+	}
+	return h
+}
+
+// HandlerOption controls optional behavior in func NewHandler().
+type HandlerOption func(*Handler)
+
+// WithCookieJar is a HandlerOption that makes RespondTo() behave like a browser with regard to cookies:
+// Cookies from the jar are added to each request, and cookies set by the response are stored in the jar.
+// This is useful for testing session-based flows, e.g. logging in and then accessing a protected endpoint.
+//
+//	jar := must.Return(cookiejar.New(nil))
+//	h := httptest.NewHandler(myHandler, httptest.WithCookieJar(jar))
+//
+// Since requests in RespondTo() do not have a host name,
+// the jar will see all requests as going to the host "example.com".
+func WithCookieJar(jar http.CookieJar) HandlerOption {
+	return func(h *Handler) {
+		h.jar = jar
+	}
 }
 
 // ServeHTTP implements the http.Handler interface.
@@ -84,6 +111,53 @@ func (h Handler) RespondTo(ctx context.Context, methodAndPath string, options ..
 		}
 	}
 
+	req, params, reqBodyBytes, reason, err := h.buildRequest(ctx, methodAndPath, options)
+	if err != nil {
+		return makeErrorResponse(reason, err)
+	}
+
+	// obtain response
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req // like http.Client does
+	if h.jar != nil {
+		h.jar.SetCookies(jarURLOf(req), resp.Cookies())
+	}
+	if h.recorder != nil {
+		h.recorder.record(req, reqBodyBytes, resp, rec.Body.Bytes())
+	}
+
+	// parse response body (if requested)
+	if params.JSONTarget != nil && (resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		err := json.NewDecoder(resp.Body).Decode(params.JSONTarget)
+		if err == nil {
+			err = resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(nil))
+		}
+		if err != nil {
+			return makeErrorResponse("JSON Unmarshal Error", err)
+		}
+	}
+	if params.XMLTarget != nil && (resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		err := xml.NewDecoder(resp.Body).Decode(params.XMLTarget)
+		if err == nil {
+			err = resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(nil))
+		}
+		if err != nil {
+			return makeErrorResponse("XML Unmarshal Error", err)
+		}
+	}
+
+	return resp
+}
+
+// Builds the request for RespondTo() or RespondToStream(). If the request
+// body needs to be recorded, it is returned as well. If the request body
+// cannot be built, the reason phrase for the error response is returned
+// alongside the error.
+func (h Handler) buildRequest(ctx context.Context, methodAndPath string, options []RequestOption) (req *http.Request, params requestParams, reqBodyBytes []byte, reason string, err error) {
 	// parse methodAndPath
 	method, path, ok := strings.Cut(methodAndPath, " ")
 	if !ok {
@@ -91,48 +165,47 @@ func (h Handler) RespondTo(ctx context.Context, methodAndPath string, options ..
 	}
 
 	// collect options
-	params := requestParams{
+	params = requestParams{
 		Headers: make(http.Header),
+		Query:   make(url.Values),
 	}
 	for _, opt := range options {
 		opt(&params)
 	}
+	path = params.applyQueryTo(path)
 
 	// prepare request body, if any
-	reqBody := params.Body
-	if params.JSONBody != nil {
-		if reqBody != nil {
-			panic("cannot use both WithBody() and WithJSONBody() in the same request")
-		}
-		buf, err := json.Marshal(params.JSONBody)
+	reqBody, reason, err := params.buildBody()
+	if err != nil {
+		return nil, params, nil, reason, err
+	}
+
+	// if recording, keep a copy of the request body
+	if h.recorder != nil && reqBody != nil {
+		reqBodyBytes, err = io.ReadAll(reqBody)
 		if err != nil {
-			return makeErrorResponse("JSON Marshal Error", err)
+			return nil, params, nil, "Request Body Read Error", err
 		}
-		reqBody = bytes.NewReader(buf)
+		reqBody = bytes.NewReader(reqBodyBytes)
 	}
 
 	// build request
-	req := must.Return(http.NewRequestWithContext(ctx, method, path, reqBody))
+	req = must.Return(http.NewRequestWithContext(ctx, method, path, reqBody))
 	maps.Insert(req.Header, maps.All(params.Headers))
-
-	// obtain response
-	rec := httptest.NewRecorder()
-	h.ServeHTTP(rec, req)
-	resp := rec.Result()
-
-	// parse response body (if requested)
-	if params.JSONTarget != nil && (resp.StatusCode >= 200 && resp.StatusCode <= 299) {
-		err := json.NewDecoder(resp.Body).Decode(params.JSONTarget)
-		if err == nil {
-			err = resp.Body.Close()
-			resp.Body = io.NopCloser(bytes.NewReader(nil))
-		}
-		if err != nil {
-			return makeErrorResponse("JSON Unmarshal Error", err)
+	if h.jar != nil {
+		for _, cookie := range h.jar.Cookies(jarURLOf(req)) {
+			req.AddCookie(cookie)
 		}
 	}
+	for _, cookie := range params.Cookies {
+		req.AddCookie(cookie)
+	}
+	return req, params, reqBodyBytes, "", nil
+}
 
-	return resp
+// Returns the URL under which cookies for this request are stored in the cookie jar.
+func jarURLOf(req *http.Request) *url.URL {
+	return must.Return(url.Parse("http://example.com")).ResolveReference(req.URL)
 }
 
 // RequestOption controls optional behavior in func Handler.RespondTo().
@@ -140,9 +213,44 @@ type RequestOption func(*requestParams)
 
 type requestParams struct {
 	Headers    http.Header
+	Query      url.Values
+	Cookies    []*http.Cookie
 	Body       io.Reader
 	JSONBody   any
 	JSONTarget any
+	XMLBody    any
+	XMLTarget  any
+}
+
+// Builds the request body from WithBody(), WithJSONBody() or WithXMLBody().
+// If marshaling fails, the reason phrase for the error response is returned alongside the error.
+func (params requestParams) buildBody() (io.Reader, string, error) {
+	count := 0
+	for _, isSet := range []bool{params.Body != nil, params.JSONBody != nil, params.XMLBody != nil} {
+		if isSet {
+			count++
+		}
+	}
+	if count > 1 {
+		panic("cannot use more than one of WithBody(), WithJSONBody() and WithXMLBody() in the same request")
+	}
+
+	switch {
+	case params.JSONBody != nil:
+		buf, err := json.Marshal(params.JSONBody)
+		if err != nil {
+			return nil, "JSON Marshal Error", err
+		}
+		return bytes.NewReader(buf), "", nil
+	case params.XMLBody != nil:
+		buf, err := xml.Marshal(params.XMLBody)
+		if err != nil {
+			return nil, "XML Marshal Error", err
+		}
+		return bytes.NewReader(buf), "", nil
+	default:
+		return params.Body, "", nil
+	}
 }
 
 // WithBody adds a request body to an HTTP request.
@@ -171,6 +279,64 @@ func WithHeaders(hdr http.Header) RequestOption {
 	}
 }
 
+// WithBearerToken adds an "Authorization: Bearer" header to an HTTP request.
+func WithBearerToken(token string) RequestOption {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithBasicAuth adds an "Authorization: Basic" header to an HTTP request.
+func WithBasicAuth(username, password string) RequestOption {
+	return func(params *requestParams) {
+		creds := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		params.Headers.Set("Authorization", "Basic "+creds)
+	}
+}
+
+// WithOpenStackToken adds an "X-Auth-Token" header to an HTTP request,
+// as used for authenticating with a Keystone token (e.g. with gopherpolicy.TokenValidator).
+func WithOpenStackToken(token string) RequestOption {
+	return WithHeader("X-Auth-Token", token)
+}
+
+// WithQuery adds a query parameter to an HTTP request.
+// The value will be URL-encoded as necessary.
+// If the path given to RespondTo() already contains a query string, the parameter will be added to it.
+func WithQuery(key, value string) RequestOption {
+	return func(params *requestParams) {
+		params.Query.Add(key, value)
+	}
+}
+
+// WithQueryValues adds several query parameters to an HTTP request.
+// Like WithQuery(), these are added to any query string in the path given to RespondTo().
+func WithQueryValues(values url.Values) RequestOption {
+	return func(params *requestParams) {
+		for key, vals := range values {
+			for _, val := range vals {
+				params.Query.Add(key, val)
+			}
+		}
+	}
+}
+
+func (params requestParams) applyQueryTo(path string) string {
+	if len(params.Query) == 0 {
+		return path
+	}
+	if strings.Contains(path, "?") {
+		return path + "&" + params.Query.Encode()
+	}
+	return path + "?" + params.Query.Encode()
+}
+
+// WithCookie adds a cookie to an HTTP request.
+// If the Handler has a cookie jar (see WithCookieJar), this cookie is sent in addition to the cookies from the jar.
+func WithCookie(name, value string) RequestOption {
+	return func(params *requestParams) {
+		params.Cookies = append(params.Cookies, &http.Cookie{Name: name, Value: value})
+	}
+}
+
 // WithJSONBody adds a JSON request body to an HTTP request.
 // The provided payload will be serialized into JSON.
 //
@@ -184,6 +350,31 @@ func WithJSONBody(payload any) RequestOption {
 	}
 }
 
+// WithXMLBody adds an XML request body to an HTTP request.
+// The provided payload will be serialized into XML using encoding/xml.
+//
+// If the caller does not specify a Content-Type using WithHeader(), application/xml will be set.
+func WithXMLBody(payload any) RequestOption {
+	return func(params *requestParams) {
+		params.XMLBody = payload
+		if params.Headers.Get("Content-Type") == "" {
+			params.Headers.Set("Content-Type", "application/xml; charset=utf-8")
+		}
+	}
+}
+
+// WithFormBody adds a form-encoded request body to an HTTP request, as would be sent by a HTML form or a webhook.
+//
+// If the caller does not specify a Content-Type using WithHeader(), application/x-www-form-urlencoded will be set.
+func WithFormBody(values url.Values) RequestOption {
+	return func(params *requestParams) {
+		params.Body = strings.NewReader(values.Encode())
+		if params.Headers.Get("Content-Type") == "" {
+			params.Headers.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+}
+
 // ReceiveJSONInto adds parsing of a JSON response body to an HTTP request.
 // If the response has a 2xx status code, its response body will be unmarshaled into the provided target.
 // If unmarshaling fails, the response will have status code 999 and contain the error message as a response body.
@@ -202,3 +393,18 @@ func ReceiveJSONInto(target any) RequestOption {
 		params.JSONTarget = target
 	}
 }
+
+// ReceiveXMLInto adds parsing of an XML response body to an HTTP request.
+// It works exactly like ReceiveJSONInto(), except that encoding/xml is used for unmarshaling.
+func ReceiveXMLInto(target any) RequestOption {
+	// clear target, if any (see ReceiveJSONInto for rationale)
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer {
+		panic("argument for ReceiveXMLInto() must be a pointer")
+	}
+	reflect.Indirect(v).SetZero()
+
+	return func(params *requestParams) {
+		params.XMLTarget = target
+	}
+}
@@ -21,8 +21,11 @@ package httptest_test
 
 import (
 	"context"
+	"encoding/xml"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -156,3 +159,156 @@ func TestRespondTo(t *testing.T) {
 	buf = must.Return(io.ReadAll(resp.Body))
 	assert.DeepEqual(t, "Error Message In Body", string(buf), "json: cannot unmarshal string into Go value of type int")
 }
+
+func TestCookies(t *testing.T) {
+	// This handler implements a primitive login flow: "POST /login" sets a session cookie,
+	// and "GET /whoami" requires it.
+	sessionHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "alice", Path: "/"})
+			w.WriteHeader(http.StatusNoContent)
+		case "/whoami":
+			cookie, err := r.Cookie("session")
+			if err != nil {
+				http.Error(w, "not logged in", http.StatusUnauthorized)
+				return
+			}
+			extra := ""
+			if c, err := r.Cookie("extra"); err == nil {
+				extra = " with " + c.Value
+			}
+			_, _ = w.Write([]byte(cookie.Value + extra))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	// check WithCookie() on its own
+	h := httptest.NewHandler(sessionHandler)
+	resp := h.RespondTo(ctx, "GET /whoami")
+	assert.DeepEqual(t, "Status", resp.StatusCode, http.StatusUnauthorized)
+	resp = h.RespondTo(ctx, "GET /whoami", httptest.WithCookie("session", "bob"))
+	assert.DeepEqual(t, "Status", resp.StatusCode, http.StatusOK)
+	buf := must.Return(io.ReadAll(resp.Body))
+	assert.DeepEqual(t, "Body", string(buf), "bob")
+
+	// without a jar, cookies are not carried across requests
+	resp = h.RespondTo(ctx, "POST /login")
+	assert.DeepEqual(t, "Status", resp.StatusCode, http.StatusNoContent)
+	resp = h.RespondTo(ctx, "GET /whoami")
+	assert.DeepEqual(t, "Status", resp.StatusCode, http.StatusUnauthorized)
+
+	// with a jar, cookies are carried across requests
+	h = httptest.NewHandler(sessionHandler, httptest.WithCookieJar(must.Return(cookiejar.New(nil))))
+	resp = h.RespondTo(ctx, "POST /login")
+	assert.DeepEqual(t, "Status", resp.StatusCode, http.StatusNoContent)
+	resp = h.RespondTo(ctx, "GET /whoami", httptest.WithCookie("extra", "cake"))
+	assert.DeepEqual(t, "Status", resp.StatusCode, http.StatusOK)
+	buf = must.Return(io.ReadAll(resp.Body))
+	assert.DeepEqual(t, "Body", string(buf), "alice with cake")
+}
+
+func TestWithQuery(t *testing.T) {
+	// This handler echoes the query string of the request.
+	h := httptest.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RawQuery))
+	}))
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	testCases := []struct {
+		Path          string
+		Options       []httptest.RequestOption
+		ExpectedQuery string
+	}{
+		{"/foo", nil, ""},
+		{"/foo", []httptest.RequestOption{httptest.WithQuery("name", "a&b c")}, "name=a%26b+c"},
+		{"/foo?x=1", []httptest.RequestOption{httptest.WithQuery("y", "2")}, "x=1&y=2"},
+		{"/foo", []httptest.RequestOption{
+			httptest.WithQuery("a", "1"),
+			httptest.WithQueryValues(url.Values{"b": {"2", "3"}, "a": {"4"}}),
+		}, "a=1&a=4&b=2&b=3"},
+	}
+	for _, tc := range testCases {
+		resp := h.RespondTo(ctx, "GET "+tc.Path, tc.Options...)
+		buf := must.Return(io.ReadAll(resp.Body))
+		assert.DeepEqual(t, "query for "+tc.Path, string(buf), tc.ExpectedQuery)
+	}
+}
+
+func TestAuthOptions(t *testing.T) {
+	h := httptest.NewHandler(exampleHandler)
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	resp := h.RespondTo(ctx, "POST /reflect", httptest.WithBearerToken("secret"))
+	assert.DeepEqual(t, "Reflected-Authorization", resp.Header.Get("Reflected-Authorization"), "Bearer secret")
+
+	resp = h.RespondTo(ctx, "POST /reflect", httptest.WithOpenStackToken("secret"))
+	assert.DeepEqual(t, "Reflected-X-Auth-Token", resp.Header.Get("Reflected-X-Auth-Token"), "secret")
+
+	resp = h.RespondTo(ctx, "POST /reflect", httptest.WithBasicAuth("user", "pass"))
+	req := must.Return(http.NewRequest(http.MethodGet, "/", http.NoBody))
+	req.Header.Set("Authorization", resp.Header.Get("Reflected-Authorization"))
+	username, password, ok := req.BasicAuth()
+	assert.DeepEqual(t, "BasicAuth ok", ok, true)
+	assert.DeepEqual(t, "BasicAuth username", username, "user")
+	assert.DeepEqual(t, "BasicAuth password", password, "pass")
+}
+
+func TestWithFormBody(t *testing.T) {
+	// This handler echoes the Content-Type and the parsed form fields of the request.
+	h := httptest.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Content-Type") + " " + r.PostForm.Encode()))
+	}))
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	resp := h.RespondTo(ctx, "POST /webhook", httptest.WithFormBody(url.Values{"event": {"push"}, "id": {"1", "2"}}))
+	buf := must.Return(io.ReadAll(resp.Body))
+	assert.DeepEqual(t, "response body", string(buf), "application/x-www-form-urlencoded event=push&id=1&id=2")
+}
+
+type xmlTestingServer struct {
+	XMLName xml.Name `xml:"server"`
+	ID      string   `xml:"id,attr"`
+	Name    string   `xml:"name"`
+}
+
+func TestXMLBodies(t *testing.T) {
+	// This handler echoes the XML request body with an uppercased name.
+	h := httptest.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var s xmlTestingServer
+		err := xml.NewDecoder(r.Body).Decode(&s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.Name = strings.ToUpper(s.Name)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		must.Succeed(xml.NewEncoder(w).Encode(s))
+	}))
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	var result xmlTestingServer
+	resp := h.RespondTo(ctx, "POST /servers",
+		httptest.WithXMLBody(xmlTestingServer{ID: "42", Name: "foo"}),
+		httptest.ReceiveXMLInto(&result),
+	)
+	assert.DeepEqual(t, "status", resp.StatusCode, http.StatusOK)
+	assert.DeepEqual(t, "Content-Type", resp.Header.Get("Content-Type"), "application/xml; charset=utf-8")
+	assert.DeepEqual(t, "result", result, xmlTestingServer{XMLName: xml.Name{Local: "server"}, ID: "42", Name: "FOO"})
+
+	// unmarshaling errors are reported as a response with status 999
+	resp = h.RespondTo(ctx, "POST /servers",
+		httptest.WithBody(strings.NewReader(`<server id="1"><name>a</name></server>`)),
+		httptest.ReceiveXMLInto(&struct {
+			XMLName xml.Name `xml:"client"`
+		}{}),
+	)
+	assert.DeepEqual(t, "status", resp.Status, "999 XML Unmarshal Error")
+}
@@ -0,0 +1,145 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// NoopHandler is an http.Handler that does nothing, which results in an empty
+// response with status 200. It can be used as the "next" handler when
+// testing middleware for which the inner handler does not matter:
+//
+//	h := httptest.NewHandler(myMiddleware(httptest.NoopHandler{}))
+type NoopHandler struct{}
+
+// ServeHTTP implements the http.Handler interface.
+func (NoopHandler) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+// RecordingNextHandler is an http.Handler that records all requests that it
+// receives. It can be used as the "next" handler when testing middleware, to
+// check whether the middleware passed the request on, and what the request
+// looked like at that point (e.g. which headers or context values the
+// middleware added):
+//
+//	next := &httptest.RecordingNextHandler{}
+//	h := httptest.NewHandler(myAuthMiddleware(next))
+//
+//	resp := h.RespondTo(ctx, "GET /v1/objects", httptest.WithBearerToken("invalid"))
+//	httptest.ExpectHeader(t, resp, "Www-Authenticate", "Bearer")
+//	next.ExpectCalls(t, 0)
+//
+//	resp = h.RespondTo(ctx, "GET /v1/objects", httptest.WithBearerToken("valid"))
+//	if next.ExpectCalls(t, 1) {
+//		user := next.LastCall().Request.Context().Value(userContextKey)
+//		...
+//	}
+//
+// The zero value is ready to use, and responds to each request with an empty
+// 200 response. Set the Inner field to produce a different response.
+type RecordingNextHandler struct {
+	// Optional. If given, each request is passed on to this handler after
+	// recording, to produce the actual response.
+	Inner http.Handler
+
+	mutex sync.Mutex
+	calls []RecordedCall
+}
+
+// RecordedCall describes a request that was received by a RecordingNextHandler.
+type RecordedCall struct {
+	// The request as received by the RecordingNextHandler. Its body has been
+	// read into the Body field already; Request.Body contains a copy of that,
+	// which has been consumed if Inner was called.
+	Request *http.Request
+	// The full request body as received by the RecordingNextHandler.
+	Body []byte
+	// The ResponseWriter as received by the RecordingNextHandler. This can be
+	// used to check whether the middleware wrapped the ResponseWriter (e.g.
+	// whether it still implements http.Flusher), but it must not be written to
+	// after the request has completed.
+	ResponseWriter http.ResponseWriter
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *RecordingNextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "while reading request body in RecordingNextHandler: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	h.mutex.Lock()
+	h.calls = append(h.calls, RecordedCall{Request: r, Body: body, ResponseWriter: w})
+	h.mutex.Unlock()
+
+	if h.Inner != nil {
+		h.Inner.ServeHTTP(w, r)
+	}
+}
+
+// Calls returns all requests received by this handler so far, in order of arrival.
+func (h *RecordingNextHandler) Calls() []RecordedCall {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]RecordedCall(nil), h.calls...)
+}
+
+// LastCall returns the most recent request received by this handler.
+// It panics if no requests have been received yet.
+func (h *RecordingNextHandler) LastCall() RecordedCall {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.calls) == 0 {
+		panic("RecordingNextHandler.LastCall() called before any request was received")
+	}
+	return h.calls[len(h.calls)-1]
+}
+
+// Reset forgets all requests received by this handler so far.
+func (h *RecordingNextHandler) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.calls = nil
+}
+
+// ExpectCalls checks that this handler has received exactly the given number
+// of requests since it was created or last reset. If not, a test error is
+// reported and false is returned.
+func (h *RecordingNextHandler) ExpectCalls(t TestingT, count int) bool {
+	t.Helper()
+	h.mutex.Lock()
+	actual := len(h.calls)
+	h.mutex.Unlock()
+
+	if actual != count {
+		t.Errorf("expected next handler to be called %d times, but it was called %d times", count, actual)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/httptest"
+	"github.com/sapcc/go-bits/must"
+)
+
+type exampleContextKey struct{}
+
+// An example middleware that rejects requests without "X-Auth-Token", and
+// forwards the token to the next handler via the request context.
+func exampleAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Auth-Token")
+		if token == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), exampleContextKey{}, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func TestNoopHandler(t *testing.T) {
+	h := httptest.NewHandler(exampleAuthMiddleware(httptest.NoopHandler{}))
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	resp := h.RespondTo(ctx, "GET /")
+	assert.DeepEqual(t, "status without token", resp.StatusCode, http.StatusUnauthorized)
+	resp = h.RespondTo(ctx, "GET /", httptest.WithHeader("X-Auth-Token", "foo"))
+	assert.DeepEqual(t, "status with token", resp.StatusCode, http.StatusOK)
+}
+
+func TestRecordingNextHandler(t *testing.T) {
+	next := &httptest.RecordingNextHandler{}
+	h := httptest.NewHandler(exampleAuthMiddleware(next))
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	// rejected request does not reach the next handler
+	var rt recordingT
+	resp := h.RespondTo(ctx, "POST /foo", httptest.WithBody(strings.NewReader("hello")))
+	assert.DeepEqual(t, "status", resp.StatusCode, http.StatusUnauthorized)
+	assert.DeepEqual(t, "ExpectCalls result", next.ExpectCalls(&rt, 0), true)
+	assert.DeepEqual(t, "ExpectCalls result", next.ExpectCalls(&rt, 1), false)
+	assert.DeepEqual(t, "errors", rt.errors, []string{"expected next handler to be called 1 times, but it was called 0 times"})
+
+	// accepted request reaches the next handler with the context value
+	resp = h.RespondTo(ctx, "POST /foo",
+		httptest.WithHeader("X-Auth-Token", "secret"),
+		httptest.WithBody(strings.NewReader("hello")),
+	)
+	assert.DeepEqual(t, "status", resp.StatusCode, http.StatusOK)
+	next.ExpectCalls(t, 1)
+	call := next.LastCall()
+	assert.DeepEqual(t, "path", call.Request.URL.Path, "/foo")
+	assert.DeepEqual(t, "context value", call.Request.Context().Value(exampleContextKey{}), any("secret"))
+	assert.DeepEqual(t, "body", string(call.Body), "hello")
+
+	// Inner produces the actual response and can still read the body
+	next.Reset()
+	next.Inner = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = io.Copy(w, r.Body)
+	})
+	resp = h.RespondTo(ctx, "POST /bar",
+		httptest.WithHeader("X-Auth-Token", "secret"),
+		httptest.WithBody(strings.NewReader("world")),
+	)
+	assert.DeepEqual(t, "status", resp.StatusCode, http.StatusTeapot)
+	assert.DeepEqual(t, "response body", string(must.Return(io.ReadAll(resp.Body))), "world")
+	assert.DeepEqual(t, "call count", len(next.Calls()), 1)
+}
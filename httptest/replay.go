@@ -0,0 +1,320 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/go-bits/errext"
+)
+
+// Session is a recorded sequence of HTTP requests and their expected
+// responses. It can be loaded from a file with LoadSession(), and replayed
+// against a Handler with Handler.Replay().
+//
+// In YAML format, a session file looks like this:
+//
+//	exchanges:
+//	  - request:
+//	      method: POST
+//	      path: /v1/objects
+//	      headers: { Content-Type: [ application/json ] }
+//	      body: '{"name":"foo"}'
+//	    response:
+//	      status: 201
+//	      headers: { Location: [ /v1/objects/1 ] }
+//	      body: '{"id":1,"name":"foo"}'
+type Session struct {
+	Exchanges []Exchange `json:"exchanges" yaml:"exchanges"`
+}
+
+// Exchange is a single request-response pair within a Session.
+type Exchange struct {
+	Request  RecordedRequest  `json:"request" yaml:"request"`
+	Response RecordedResponse `json:"response" yaml:"response"`
+}
+
+// RecordedRequest is the request part of an Exchange.
+type RecordedRequest struct {
+	Method  string      `json:"method" yaml:"method"`
+	Path    string      `json:"path" yaml:"path"` // including query string, if any
+	Headers http.Header `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    string      `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// RecordedResponse is the response part of an Exchange.
+//
+// During replay, only the headers listed here are checked (with all their
+// values, in order). The body is only
+// checked if it is not empty. If both the expected and the actual body are
+// valid JSON, they are compared structurally (i.e. ignoring whitespace and
+// the order of object keys).
+type RecordedResponse struct {
+	Status  int         `json:"status" yaml:"status"`
+	Headers http.Header `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    string      `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// LoadSession reads a Session from a file. If the file name ends in ".har",
+// the file is parsed as an HTTP Archive (as exported by the developer tools
+// of most browsers). Otherwise, the file is expected to contain the format
+// shown in the documentation of type Session.
+//
+// When parsing an HTTP Archive, the headers in DefaultIgnoredHARHeaders are
+// not copied into the Session, since they usually differ between the
+// recording and the replay. A different list can be given with the
+// WithIgnoredHARHeaders() option.
+//
+// The second argument must be set to `yaml.Unmarshal` if you want to support
+// YAML files. This explicit dependency injection slot allows you to choose
+// whether to use gopkg.in/yaml.v2 or gopkg.in/yaml.v3 or anything else.
+// If `yamlUnmarshal` is given as nil, `json.Unmarshal` from the standard
+// library will be used instead.
+func LoadSession(path string, yamlUnmarshal func(in []byte, out any) error, options ...SessionOption) (Session, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return Session{}, err // no fmt.Errorf() necessary, errors from package os are already very descriptive
+	}
+
+	if strings.HasSuffix(path, ".har") {
+		params := sessionParams{IgnoredHARHeaders: DefaultIgnoredHARHeaders}
+		for _, opt := range options {
+			opt(&params)
+		}
+		s, err := parseHAR(buf, params)
+		if err != nil {
+			return Session{}, fmt.Errorf("while parsing %s: %w", path, err)
+		}
+		return s, nil
+	}
+
+	unmarshal := yamlUnmarshal
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+		if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+			return Session{}, fmt.Errorf("cannot parse %s because YAML support is not available", path)
+		}
+	}
+	var s Session
+	err = unmarshal(buf, &s)
+	if err != nil {
+		return Session{}, fmt.Errorf("while parsing %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Replay executes all requests in the given Session against this Handler in
+// order, and compares the responses against the recorded responses. All
+// mismatches are reported in the returned error.
+//
+// If the Handler has a cookie jar (see WithCookieJar), cookies are carried
+// across the replayed requests as usual.
+func (h Handler) Replay(ctx context.Context, s Session) error {
+	var errs errext.ErrorSet
+	for idx, ex := range s.Exchanges {
+		desc := fmt.Sprintf("exchange %d (%s %s)", idx+1, ex.Request.Method, ex.Request.Path)
+
+		opts := []RequestOption{WithHeaders(ex.Request.Headers.Clone())}
+		if ex.Request.Body != "" {
+			opts = append(opts, WithBody(strings.NewReader(ex.Request.Body)))
+		}
+		resp := h.RespondTo(ctx, ex.Request.Method+" "+ex.Request.Path, opts...)
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			errs.Addf("%s: could not read response body: %w", desc, err)
+			continue
+		}
+
+		if resp.StatusCode != ex.Response.Status {
+			errs.Addf("%s: expected status %d, but got %d", desc, ex.Response.Status, resp.StatusCode)
+		}
+		for key, expected := range ex.Response.Headers {
+			actual := resp.Header.Values(key)
+			if !slices.Equal(actual, expected) {
+				errs.Addf("%s: expected header %q to be %q, but got %q", desc, key, expected, actual)
+			}
+		}
+		if ex.Response.Body != "" && !bodiesAreEquivalent([]byte(ex.Response.Body), body) {
+			errs.Addf("%s: expected body %q, but got %q", desc, ex.Response.Body, string(body))
+		}
+	}
+
+	if errs.IsEmpty() {
+		return nil
+	}
+	return errors.New(errs.Join("\n"))
+}
+
+func bodiesAreEquivalent(expected, actual []byte) bool {
+	if bytes.Equal(expected, actual) {
+		return true
+	}
+	var expectedData, actualData any
+	if json.Unmarshal(expected, &expectedData) != nil || json.Unmarshal(actual, &actualData) != nil {
+		return false
+	}
+	return reflect.DeepEqual(expectedData, actualData)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// HAR parsing
+
+// Reference: <https://w3c.github.io/web-performance/specs/HAR/Overview.html>
+type harDocument struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method   string      `json:"method"`
+				URL      string      `json:"url"`
+				Headers  []harHeader `json:"headers"`
+				PostData *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status  int         `json:"status"`
+				Headers []harHeader `json:"headers"`
+				Content struct {
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// DefaultIgnoredHARHeaders lists the headers that LoadSession() does not copy
+// from HTTP Archives by default, either because they are generated by the
+// transport, or because their values vary between runs.
+var DefaultIgnoredHARHeaders = []string{
+	// generated by the transport
+	"Accept-Encoding",
+	"Connection",
+	"Content-Encoding", // HAR files contain the decoded response body
+	"Content-Length",
+	"Host",
+	"Keep-Alive",
+	"Transfer-Encoding",
+	// volatile
+	"Age",
+	"Cache-Control",
+	"Cookie",
+	"Date",
+	"Etag",
+	"Expires",
+	"Last-Modified",
+	"Server",
+	"Set-Cookie",
+	"X-Openstack-Request-Id",
+	"X-Request-Id",
+}
+
+// SessionOption controls optional behavior in func LoadSession().
+type SessionOption func(*sessionParams)
+
+type sessionParams struct {
+	IgnoredHARHeaders []string
+}
+
+// WithIgnoredHARHeaders is a SessionOption that replaces
+// DefaultIgnoredHARHeaders with the given list of header names. To extend
+// the default list instead, use:
+//
+//	httptest.WithIgnoredHARHeaders(append(slices.Clone(httptest.DefaultIgnoredHARHeaders), "X-My-Header")...)
+func WithIgnoredHARHeaders(names ...string) SessionOption {
+	return func(params *sessionParams) {
+		params.IgnoredHARHeaders = names
+	}
+}
+
+func parseHAR(buf []byte, params sessionParams) (Session, error) {
+	ignoredHeaders := make(map[string]bool, len(params.IgnoredHARHeaders))
+	for _, name := range params.IgnoredHARHeaders {
+		ignoredHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+
+	var doc harDocument
+	err := json.Unmarshal(buf, &doc)
+	if err != nil {
+		return Session{}, err
+	}
+
+	var s Session
+	for idx, entry := range doc.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return Session{}, fmt.Errorf("in entry %d: %w", idx+1, err)
+		}
+		var ex Exchange
+		ex.Request.Method = entry.Request.Method
+		ex.Request.Path = u.RequestURI()
+		ex.Request.Headers = convertHARHeaders(entry.Request.Headers, ignoredHeaders)
+		if entry.Request.PostData != nil {
+			ex.Request.Body = entry.Request.PostData.Text
+		}
+
+		ex.Response.Status = entry.Response.Status
+		ex.Response.Headers = convertHARHeaders(entry.Response.Headers, ignoredHeaders)
+		ex.Response.Body = entry.Response.Content.Text
+		if entry.Response.Content.Encoding == "base64" {
+			body, err := base64.StdEncoding.DecodeString(ex.Response.Body)
+			if err != nil {
+				return Session{}, fmt.Errorf("in entry %d: could not decode response body: %w", idx+1, err)
+			}
+			ex.Response.Body = string(body)
+		}
+		s.Exchanges = append(s.Exchanges, ex)
+	}
+	return s, nil
+}
+
+func convertHARHeaders(headers []harHeader, ignoredHeaders map[string]bool) http.Header {
+	result := make(http.Header, len(headers))
+	for _, hdr := range headers {
+		// skip HTTP/2 pseudo-headers like ":authority"
+		if strings.HasPrefix(hdr.Name, ":") {
+			continue
+		}
+		if !ignoredHeaders[http.CanonicalHeaderKey(hdr.Name)] {
+			result.Add(hdr.Name, hdr.Value)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
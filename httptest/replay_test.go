@@ -0,0 +1,155 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/httptest"
+	"github.com/sapcc/go-bits/must"
+)
+
+const sessionYAML = `
+exchanges:
+  - request:
+      method: POST
+      path: /reflect
+      headers: { Content-Type: [ application/json ] }
+      body: '{"foo":1,"bar":2}'
+    response:
+      status: 200
+      headers: { Reflected-Content-Type: [ application/json ] }
+      body: '{ "bar": 2, "foo": 1 }'
+  - request:
+      method: POST
+      path: /reflect
+      body: hello
+    response:
+      status: 200
+      body: hello
+`
+
+const sessionHAR = `{
+	"log": {
+		"entries": [
+			{
+				"request": {
+					"method": "POST",
+					"url": "https://example.org/reflect?foo=bar",
+					"headers": [
+						{ "name": ":authority", "value": "example.org" },
+						{ "name": "content-type", "value": "text/plain" },
+						{ "name": "content-length", "value": "5" },
+						{ "name": "accept", "value": "text/plain" },
+						{ "name": "accept", "value": "application/json" },
+						{ "name": "cookie", "value": "session=12345" },
+						{ "name": "x-request-id", "value": "req-123" }
+					],
+					"postData": { "mimeType": "text/plain", "text": "hello" }
+				},
+				"response": {
+					"status": 200,
+					"headers": [
+						{ "name": "date", "value": "Mon, 01 Jan 2024 00:00:00 GMT" },
+						{ "name": "etag", "value": "\"abc\"" },
+						{ "name": "set-cookie", "value": "session=12345" },
+						{ "name": "reflected-content-type", "value": "text/html" }
+					],
+					"content": { "size": 5, "text": "aGVsbG8=", "encoding": "base64" }
+				}
+			},
+			{
+				"request": { "method": "GET", "url": "https://example.org/does-not-exist", "headers": [] },
+				"response": { "status": 200, "headers": [], "content": { "size": 0 } }
+			}
+		]
+	}
+}`
+
+func TestReplaySession(t *testing.T) {
+	h := httptest.NewHandler(exampleHandler)
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	dir := t.TempDir()
+
+	// check YAML session without mismatches
+	yamlPath := filepath.Join(dir, "session.yaml")
+	must.Succeed(os.WriteFile(yamlPath, []byte(sessionYAML), 0o666))
+	_, err := httptest.LoadSession(yamlPath, nil)
+	assert.DeepEqual(t, "error without YAML support", err.Error(),
+		"cannot parse "+yamlPath+" because YAML support is not available")
+	s := must.Return(httptest.LoadSession(yamlPath, yaml.Unmarshal))
+	assert.DeepEqual(t, "number of exchanges", len(s.Exchanges), 2)
+	err = h.Replay(ctx, s)
+	if err != nil {
+		t.Errorf("expected no mismatches, but got: %s", err.Error())
+	}
+
+	// check HAR session with mismatches
+	harPath := filepath.Join(dir, "session.har")
+	must.Succeed(os.WriteFile(harPath, []byte(sessionHAR), 0o666))
+	s = must.Return(httptest.LoadSession(harPath, nil))
+	assert.DeepEqual(t, "parsed HAR", s, httptest.Session{
+		Exchanges: []httptest.Exchange{
+			{
+				Request: httptest.RecordedRequest{
+					Method:  "POST",
+					Path:    "/reflect?foo=bar",
+					Headers: http.Header{"Accept": {"text/plain", "application/json"}, "Content-Type": {"text/plain"}},
+					Body:    "hello",
+				},
+				Response: httptest.RecordedResponse{
+					Status:  200,
+					Headers: http.Header{"Reflected-Content-Type": {"text/html"}},
+					Body:    "hello",
+				},
+			},
+			{
+				Request:  httptest.RecordedRequest{Method: "GET", Path: "/does-not-exist"},
+				Response: httptest.RecordedResponse{Status: 200},
+			},
+		},
+	})
+	err = h.Replay(ctx, s)
+	expectedErr := `exchange 1 (POST /reflect?foo=bar): expected header "Reflected-Content-Type" to be ["text/html"], but got ["text/plain"]` + "\n" +
+		`exchange 2 (GET /does-not-exist): expected status 200, but got 404`
+	if err == nil {
+		t.Error("expected mismatches, but got none")
+	} else {
+		assert.DeepEqual(t, "mismatches", err.Error(), expectedErr)
+	}
+
+	// the list of ignored headers can be replaced
+	s = must.Return(httptest.LoadSession(harPath, nil, httptest.WithIgnoredHARHeaders("Accept", "Content-Length", "Date", "ETag", "Set-Cookie")))
+	assert.DeepEqual(t, "request headers with custom ignore list", s.Exchanges[0].Request.Headers, http.Header{
+		"Content-Type": {"text/plain"},
+		"Cookie":       {"session=12345"},
+		"X-Request-Id": {"req-123"},
+	})
+	assert.DeepEqual(t, "response headers with custom ignore list", s.Exchanges[0].Response.Headers, http.Header{
+		"Reflected-Content-Type": {"text/html"},
+	})
+}
@@ -0,0 +1,311 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Scenario is a sequence of requests that is executed in order against a
+// Handler. It is intended for long workflows (e.g. create an object, update
+// it, list it, delete it) where each step depends on the previous ones.
+//
+// Values can be captured from JSON response bodies into named variables, and
+// later steps can refer to these variables with placeholders like "${id}".
+// Placeholders are expanded in the request path, in string values of the
+// JSON request body, and in string values of ExpectJSON. Only the braced form
+// is recognized, so a literal "$" (e.g. in "$5" or "$ref") stays as it is.
+//
+// When a string in the JSON request body or in ExpectJSON consists of nothing
+// but a single placeholder, it is replaced by the captured value with its
+// original JSON type, e.g. "${id}" becomes the number 1 if a number was
+// captured. Inside longer strings, captured values that are not strings are
+// inserted in their JSON representation.
+//
+//	httptest.Scenario{Steps: []httptest.ScenarioStep{{
+//		Name:         "create object",
+//		Request:      "POST /v1/objects",
+//		JSONBody:     map[string]any{"name": "foo"},
+//		ExpectStatus: http.StatusCreated,
+//		Capture:      map[string]string{"id": "object.id"},
+//	}, {
+//		Name:         "show object",
+//		Request:      "GET /v1/objects/${id}",
+//		ExpectStatus: http.StatusOK,
+//		ExpectJSON:   map[string]any{"object.id": "${id}", "object.name": "foo"},
+//	}}}.Run(ctx, t, h)
+//
+// Execution stops at the first failing step, since the following steps
+// usually depend on it. The failure message names the failing step.
+type Scenario struct {
+	// Initial values for variables, in addition to those captured during the scenario.
+	Variables map[string]string
+	Steps     []ScenarioStep
+}
+
+// ScenarioStep is a single step in a Scenario.
+//
+// JSON paths (as used in ExpectJSON and Capture) are sequences of object keys
+// and array indexes, separated by dots, e.g. "objects.0.id".
+type ScenarioStep struct {
+	// A short description of this step, for use in failure messages.
+	Name string
+	// The request method and path, like in Handler.RespondTo(), e.g. "GET /v1/objects/${id}".
+	Request string
+	// Additional options for Handler.RespondTo().
+	Options []RequestOption
+	// If not nil, this is sent as a JSON request body (like with WithJSONBody()).
+	JSONBody any
+
+	// If not zero, the response must have this status code.
+	ExpectStatus int
+	// If not nil, the response must have these headers (like with ExpectHeaders()).
+	ExpectHeaders http.Header
+	// Each entry maps a JSON path to the value that is expected at that path in
+	// the response body.
+	ExpectJSON map[string]any
+	// Each entry maps a variable name to a JSON path. The value at that path in
+	// the response body is stored in the variable, retaining its JSON type.
+	Capture map[string]string
+	// Optional. Additional checks on the response, for anything not covered by
+	// the fields above. The response body has already been read into `body`.
+	Check func(resp *http.Response, body []byte) error
+}
+
+// Run executes the scenario. Each failure is reported on t, and true is
+// returned if and only if all steps succeeded.
+func (s Scenario) Run(ctx context.Context, t TestingT, h Handler) bool {
+	t.Helper()
+
+	vars := make(map[string]any, len(s.Variables))
+	for name, value := range s.Variables {
+		vars[name] = value
+	}
+
+	for idx, step := range s.Steps {
+		err := step.execute(ctx, h, vars)
+		if err != nil {
+			name := step.Name
+			if name == "" {
+				name = step.Request
+			}
+			t.Errorf("scenario step %d/%d (%s) failed: %s", idx+1, len(s.Steps), name, err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+func (step ScenarioStep) execute(ctx context.Context, h Handler, vars map[string]any) error {
+	methodAndPath, err := expandPlaceholders(step.Request, vars)
+	if err != nil {
+		return err
+	}
+	options := step.Options
+	if step.JSONBody != nil {
+		body, err := expandPlaceholdersInJSON(step.JSONBody, vars)
+		if err != nil {
+			return fmt.Errorf("in request body: %w", err)
+		}
+		options = append(options[:len(options):len(options)], WithJSONBody(body))
+	}
+
+	resp := h.RespondTo(ctx, methodAndPath, options...)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("while reading response body for %s: %w", methodAndPath, err)
+	}
+
+	if step.ExpectStatus != 0 && resp.StatusCode != step.ExpectStatus {
+		return fmt.Errorf("%s: expected status %d, but got %d with response body %q",
+			methodAndPath, step.ExpectStatus, resp.StatusCode, string(body))
+	}
+	if step.ExpectHeaders != nil {
+		var rec errorRecorder
+		if !ExpectHeaders(&rec, resp, step.ExpectHeaders) {
+			return errors.New(rec.message)
+		}
+	}
+
+	if len(step.ExpectJSON) > 0 || len(step.Capture) > 0 {
+		var data any
+		err := json.Unmarshal(body, &data)
+		if err != nil {
+			return fmt.Errorf("%s: cannot parse response body %q as JSON: %w", methodAndPath, string(body), err)
+		}
+
+		for _, path := range slices.Sorted(maps.Keys(step.ExpectJSON)) {
+			expected, err := expandPlaceholdersInJSON(step.ExpectJSON[path], vars)
+			if err != nil {
+				return fmt.Errorf("in expected value for %q: %w", path, err)
+			}
+			actual, err := lookupJSONPath(data, path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", methodAndPath, err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				return fmt.Errorf("%s: expected %s at %q, but got %s",
+					methodAndPath, renderJSONValue(expected), path, renderJSONValue(actual))
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(step.Capture)) {
+			value, err := lookupJSONPath(data, step.Capture[name])
+			if err != nil {
+				return fmt.Errorf("%s: cannot capture %q: %w", methodAndPath, name, err)
+			}
+			vars[name] = value
+		}
+	}
+
+	if step.Check != nil {
+		err := step.Check(resp, body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", methodAndPath, err)
+		}
+	}
+	return nil
+}
+
+var placeholderRx = regexp.MustCompile(`\$\{(\w+)\}`)
+
+func expandPlaceholders(input string, vars map[string]any) (string, error) {
+	var missing []string
+	result := placeholderRx.ReplaceAllStringFunc(input, func(placeholder string) string {
+		name := placeholderRx.FindStringSubmatch(placeholder)[1]
+		value, exists := vars[name]
+		if !exists {
+			missing = append(missing, name)
+			return placeholder
+		}
+		if str, ok := value.(string); ok {
+			return str
+		}
+		return renderJSONValue(value)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %q in %q", missing[0], input)
+	}
+	return result, nil
+}
+
+// Converts the given value into its generic JSON representation (as produced
+// by json.Unmarshal into an `any`), while expanding placeholders in all strings.
+func expandPlaceholdersInJSON(value any, vars map[string]any) (any, error) {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var data any
+	err = json.Unmarshal(buf, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	var expand func(any) (any, error)
+	expand = func(value any) (any, error) {
+		switch value := value.(type) {
+		case string:
+			// a string that is just a single placeholder takes on the type of the captured value
+			match := placeholderRx.FindStringSubmatchIndex(value)
+			if match != nil && match[0] == 0 && match[1] == len(value) {
+				captured, exists := vars[value[match[2]:match[3]]]
+				if exists {
+					return captured, nil
+				}
+			}
+			return expandPlaceholders(value, vars)
+		case []any:
+			for idx, elem := range value {
+				expanded, err := expand(elem)
+				if err != nil {
+					return nil, err
+				}
+				value[idx] = expanded
+			}
+			return value, nil
+		case map[string]any:
+			for key, elem := range value {
+				expanded, err := expand(elem)
+				if err != nil {
+					return nil, err
+				}
+				value[key] = expanded
+			}
+			return value, nil
+		default:
+			return value, nil
+		}
+	}
+	return expand(data)
+}
+
+func lookupJSONPath(data any, path string) (any, error) {
+	current := data
+	for _, segment := range strings.Split(path, ".") {
+		switch value := current.(type) {
+		case map[string]any:
+			next, exists := value[segment]
+			if !exists {
+				return nil, fmt.Errorf("no value at %q: object has no key %q", path, segment)
+			}
+			current = next
+		case []any:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(value) {
+				return nil, fmt.Errorf("no value at %q: invalid index %q for array of length %d", path, segment, len(value))
+			}
+			current = value[idx]
+		default:
+			return nil, fmt.Errorf("no value at %q: cannot descend into %s", path, renderJSONValue(value))
+		}
+	}
+	return current, nil
+}
+
+func renderJSONValue(value any) string {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%#v", value)
+	}
+	return string(buf)
+}
+
+// A TestingT that just remembers the error message.
+type errorRecorder struct {
+	message string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...any) {
+	r.message = fmt.Sprintf(format, args...)
+}
+
+func (r *errorRecorder) Helper() {}
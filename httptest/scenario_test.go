@@ -0,0 +1,172 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/httptest"
+)
+
+// A minimal CRUD API for objects with a name.
+func newObjectHandler() http.Handler {
+	objects := make(map[int]string)
+	nextID := 1
+	writeObject := func(w http.ResponseWriter, status, id int) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]any{"object": map[string]any{"id": id, "name": objects[id]}})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /objects", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		objects[nextID] = req.Name
+		writeObject(w, http.StatusCreated, nextID)
+		nextID++
+	})
+	mux.HandleFunc("GET /objects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if _, exists := objects[id]; err != nil || !exists {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeObject(w, http.StatusOK, id)
+	})
+	mux.HandleFunc("DELETE /objects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if _, exists := objects[id]; err != nil || !exists {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		delete(objects, id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func TestScenario(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	// successful scenario
+	h := httptest.NewHandler(newObjectHandler())
+	var checkedBody []byte
+	ok := httptest.Scenario{
+		Variables: map[string]string{"prefix": "my"},
+		Steps: []httptest.ScenarioStep{{
+			Name:         "create object",
+			Request:      "POST /objects",
+			JSONBody:     map[string]any{"name": "${prefix}-object"},
+			ExpectStatus: http.StatusCreated,
+			Capture:      map[string]string{"id": "object.id"},
+		}, {
+			Name:          "show object",
+			Request:       "GET /objects/${id}",
+			ExpectStatus:  http.StatusOK,
+			ExpectHeaders: http.Header{"Content-Type": {"application/json"}},
+			ExpectJSON:    map[string]any{"object.id": 1, "object.name": "${prefix}-object"},
+			Capture:       map[string]string{"name": "object.name"},
+			Check: func(resp *http.Response, body []byte) error {
+				checkedBody = body
+				return nil
+			},
+		}, {
+			Request:      "DELETE /objects/${id}",
+			ExpectStatus: http.StatusNoContent,
+		}, {
+			Name:         "create object with dollar signs",
+			Request:      "POST /objects",
+			JSONBody:     map[string]any{"name": "$5 for $name in ${prefix}"},
+			ExpectStatus: http.StatusCreated,
+			Capture:      map[string]string{"id": "object.id"},
+		}, {
+			// captured numbers stay numbers when used as a whole value
+			Name:         "show object with dollar signs",
+			Request:      "GET /objects/${id}",
+			ExpectStatus: http.StatusOK,
+			ExpectJSON:   map[string]any{"object": map[string]any{"id": "${id}", "name": "$5 for $name in my"}},
+		}},
+	}.Run(ctx, t, h)
+	assert.DeepEqual(t, "ok", ok, true)
+	assert.DeepEqual(t, "checked body", string(checkedBody), `{"object":{"id":1,"name":"my-object"}}`+"\n")
+
+	// failing scenarios report the failing step and stop there
+	testCases := []struct {
+		Steps           []httptest.ScenarioStep
+		ExpectedMessage string
+	}{
+		{
+			Steps: []httptest.ScenarioStep{
+				{Name: "show missing object", Request: "GET /objects/42", ExpectStatus: http.StatusOK},
+				{Name: "not executed", Request: "GET /objects/${undefined}"},
+			},
+			ExpectedMessage: `scenario step 1/2 (show missing object) failed: GET /objects/42: expected status 200, but got 404 with response body "not found\n"`,
+		},
+		{
+			Steps: []httptest.ScenarioStep{
+				{Request: "POST /objects", JSONBody: map[string]any{"name": "foo"}, Capture: map[string]string{"id": "object.id"}},
+				{Request: "GET /objects/${id}", ExpectJSON: map[string]any{"object.name": "bar"}},
+			},
+			ExpectedMessage: `scenario step 2/2 (GET /objects/${id}) failed: GET /objects/1: expected "bar" at "object.name", but got "foo"`,
+		},
+		{
+			Steps: []httptest.ScenarioStep{
+				{Request: "POST /objects", JSONBody: map[string]any{"name": "foo"}, Capture: map[string]string{"id": "object.uuid"}},
+			},
+			ExpectedMessage: `scenario step 1/1 (POST /objects) failed: POST /objects: cannot capture "id": no value at "object.uuid": object has no key "uuid"`,
+		},
+		{
+			Steps: []httptest.ScenarioStep{
+				{Name: "delete", Request: "DELETE /objects/${id}"},
+			},
+			ExpectedMessage: `scenario step 1/1 (delete) failed: undefined variable "id" in "DELETE /objects/${id}"`,
+		},
+		{
+			Steps: []httptest.ScenarioStep{{
+				Name:    "custom check",
+				Request: "GET /objects/42",
+				Check: func(resp *http.Response, body []byte) error {
+					return errors.New("custom failure")
+				},
+			}},
+			ExpectedMessage: `scenario step 1/1 (custom check) failed: GET /objects/42: custom failure`,
+		},
+	}
+	for _, tc := range testCases {
+		var rt recordingT
+		h := httptest.NewHandler(newObjectHandler())
+		ok := httptest.Scenario{Steps: tc.Steps}.Run(ctx, &rt, h)
+		assert.DeepEqual(t, "ok", ok, false)
+		assert.DeepEqual(t, "errors", rt.errors, []string{tc.ExpectedMessage})
+	}
+}
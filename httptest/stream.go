@@ -0,0 +1,304 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StreamingResponse is returned by Handler.RespondToStream(). Unlike the
+// http.Response returned by RespondTo(), the response body is not buffered
+// until the handler has returned, but can be consumed piece by piece while
+// the handler is still running.
+type StreamingResponse struct {
+	// Status code and headers, as written by the handler before the first
+	// chunk of the response body.
+	StatusCode int
+	Header     http.Header
+
+	chunks       <-chan []byte
+	cancel       context.CancelFunc
+	handlerDone  chan struct{}
+	handlerPanic any          // only valid once handlerDone is closed
+	eventBuf     bytes.Buffer // for NextEvent
+	eventsDone   bool
+}
+
+// RespondToStream is like RespondTo, but for endpoints that stream their
+// response body, e.g. using chunked transfer encoding or Server-Sent Events.
+// It returns as soon as the handler has written the response headers, and
+// the response body can then be read with NextChunk() or NextEvent().
+//
+// If the handler panics before writing the response headers, the panic is
+// propagated to the caller. If `ctx` expires before the handler has written
+// the response headers, the returned response has StatusCode 0.
+//
+// The request is canceled when Close() is called on the response, or when
+// `ctx` expires. Callers should always call Close() when done:
+//
+//	resp := h.RespondToStream(ctx, "GET /v1/events")
+//	defer resp.Close()
+//	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+//	for event, err := range resp.Events(5 * time.Second) {
+//		Expect(err).NotTo(HaveOccurred())
+//		Expect(event.Data).To(Equal("hello"))
+//		break
+//	}
+//
+// The ReceiveJSONInto() and ReceiveXMLInto() options are not supported here.
+// Marshaling errors from WithJSONBody() or WithXMLBody() cause a panic, since
+// there is no buffered response to report them in.
+func (h Handler) RespondToStream(ctx context.Context, methodAndPath string, options ...RequestOption) *StreamingResponse {
+	ctx, cancel := context.WithCancel(ctx)
+	req, params, _, _, err := h.buildRequest(ctx, methodAndPath, options)
+	if err != nil {
+		cancel()
+		panic(err.Error())
+	}
+	if params.JSONTarget != nil {
+		cancel()
+		panic("cannot use ReceiveJSONInto() with RespondToStream()")
+	}
+	if params.XMLTarget != nil {
+		cancel()
+		panic("cannot use ReceiveXMLInto() with RespondToStream()")
+	}
+
+	chunks := make(chan []byte)
+	w := &streamingResponseWriter{
+		ctx:         ctx,
+		header:      make(http.Header),
+		chunks:      chunks,
+		headerReady: make(chan struct{}),
+	}
+	resp := &StreamingResponse{
+		chunks:      chunks,
+		cancel:      cancel,
+		handlerDone: make(chan struct{}),
+	}
+	go func() {
+		defer close(resp.handlerDone)
+		defer close(chunks)
+		defer func() {
+			resp.handlerPanic = recover()
+		}()
+		h.ServeHTTP(w, req)
+		w.WriteHeader(http.StatusOK) // if the handler did not write anything
+	}()
+
+	// wait for the response headers (if the handler returns or panics, it
+	// either has written the headers or will never do so)
+	select {
+	case <-w.headerReady:
+	case <-resp.handlerDone:
+		if resp.handlerPanic != nil {
+			panic(resp.handlerPanic)
+		}
+	case <-ctx.Done():
+		return resp
+	}
+
+	resp.StatusCode = w.statusCode
+	resp.Header = w.headerSnapshot
+	if h.jar != nil {
+		h.jar.SetCookies(jarURLOf(req), (&http.Response{Header: resp.Header}).Cookies())
+	}
+	return resp
+}
+
+// Close cancels the request and waits for the handler to return.
+// If the handler panicked, the panic is propagated to the caller.
+func (s *StreamingResponse) Close() {
+	s.cancel()
+	//nolint:revive // drain remaining chunks to unblock the handler
+	for range s.chunks {
+	}
+	<-s.handlerDone
+	if s.handlerPanic != nil {
+		panic(s.handlerPanic)
+	}
+}
+
+// ErrStreamTimeout is returned by NextChunk() and NextEvent() if no data
+// arrives within the given timeout.
+var ErrStreamTimeout = errors.New("timed out while waiting for streamed response data")
+
+// NextChunk returns the data from the next Write() call of the handler.
+// If the handler returns without writing further data, io.EOF is returned.
+// If the timeout expires before new data arrives, ErrStreamTimeout is returned.
+func (s *StreamingResponse) NextChunk(timeout time.Duration) ([]byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case chunk, ok := <-s.chunks:
+		if !ok {
+			return nil, io.EOF
+		}
+		return chunk, nil
+	case <-timer.C:
+		return nil, ErrStreamTimeout
+	}
+}
+
+// Chunks returns an iterator over the chunks of the response body (see
+// NextChunk). Iteration ends when the handler returns. If the timeout expires
+// while waiting for the next chunk, the iterator yields ErrStreamTimeout and
+// ends.
+func (s *StreamingResponse) Chunks(timeout time.Duration) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for {
+			chunk, err := s.NextChunk(timeout)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if !yield(chunk, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ServerSentEvent is an event received by StreamingResponse.NextEvent().
+type ServerSentEvent struct {
+	// Contents of the "event:" field, or "" if not given.
+	Type string
+	// Contents of the "data:" fields, joined with newlines.
+	Data string
+	// Contents of the "id:" field, or "" if not given.
+	ID string
+}
+
+// NextEvent parses the response body as a stream of Server-Sent Events and
+// returns the next event. Comment lines are skipped. Errors are returned
+// in the same way as for NextChunk(). The timeout applies to each individual
+// chunk of data that is awaited.
+//
+// NextChunk() and NextEvent() should not be mixed on the same response.
+func (s *StreamingResponse) NextEvent(timeout time.Duration) (ServerSentEvent, error) {
+	for {
+		// is there a full event in the buffer?
+		buf := s.eventBuf.Bytes()
+		idx := bytes.Index(buf, []byte("\n\n"))
+		if idx >= 0 {
+			block := string(buf[:idx])
+			s.eventBuf.Next(idx + 2)
+			event, ok := parseServerSentEvent(block)
+			if ok {
+				return event, nil
+			}
+			continue
+		}
+
+		// if not, read more data
+		chunk, err := s.NextChunk(timeout)
+		if err != nil {
+			return ServerSentEvent{}, err
+		}
+		s.eventBuf.Write(bytes.ReplaceAll(chunk, []byte("\r\n"), []byte("\n")))
+	}
+}
+
+// Events returns an iterator over the Server-Sent Events in the response
+// body (see NextEvent), with the same ending behavior as Chunks().
+func (s *StreamingResponse) Events(timeout time.Duration) iter.Seq2[ServerSentEvent, error] {
+	return func(yield func(ServerSentEvent, error) bool) {
+		for {
+			event, err := s.NextEvent(timeout)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if !yield(event, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Reference: <https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation>
+func parseServerSentEvent(block string) (event ServerSentEvent, ok bool) {
+	var dataLines []string
+	hasData := false
+	for _, line := range strings.Split(block, "\n") {
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Type = value
+		case "data":
+			dataLines = append(dataLines, value)
+			hasData = true
+		case "id":
+			event.ID = value
+		}
+	}
+	event.Data = strings.Join(dataLines, "\n")
+	return event, hasData || event.Type != ""
+}
+
+// The http.ResponseWriter used by RespondToStream().
+type streamingResponseWriter struct {
+	ctx            context.Context
+	header         http.Header
+	headerSnapshot http.Header
+	statusCode     int
+	chunks         chan<- []byte
+	headerReady    chan struct{}
+}
+
+// Header implements the http.ResponseWriter interface.
+func (w *streamingResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (w *streamingResponseWriter) WriteHeader(statusCode int) {
+	if w.headerSnapshot != nil {
+		return
+	}
+	w.statusCode = statusCode
+	w.headerSnapshot = w.header.Clone()
+	close(w.headerReady)
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *streamingResponseWriter) Write(buf []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	select {
+	case w.chunks <- bytes.Clone(buf):
+		return len(buf), nil
+	case <-w.ctx.Done():
+		return 0, w.ctx.Err()
+	}
+}
+
+// Flush implements the http.Flusher interface.
+func (w *streamingResponseWriter) Flush() {
+	// nothing to do: data is handed to the reader on each Write()
+}
@@ -0,0 +1,155 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package httptest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"testing"
+	"time"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/httptest"
+	"github.com/sapcc/go-bits/must"
+)
+
+// This handler sends a few Server-Sent Events on "GET /events",
+// then keeps the connection open until the client goes away.
+var sseHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	for idx := 1; idx <= 3; idx++ {
+		// send each event in two writes to check reassembly
+		fmt.Fprintf(w, ": comment\nevent: tick\nid: %d\n", idx)
+		fmt.Fprintf(w, "data: first line %d\ndata: second line\n\n", idx)
+		w.(http.Flusher).Flush()
+	}
+	if r.URL.Query().Get("hang") == "" {
+		return
+	}
+	<-r.Context().Done()
+})
+
+func TestRespondToStream(t *testing.T) {
+	h := httptest.NewHandler(sseHandler)
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	// read events until the handler finishes
+	resp := h.RespondToStream(ctx, "GET /events")
+	assert.DeepEqual(t, "Status", resp.StatusCode, http.StatusOK)
+	assert.DeepEqual(t, "Content-Type", resp.Header.Get("Content-Type"), "text/event-stream")
+	var events []httptest.ServerSentEvent
+	for event, err := range resp.Events(time.Second) {
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		events = append(events, event)
+	}
+	resp.Close()
+	assert.DeepEqual(t, "events", events, []httptest.ServerSentEvent{
+		{Type: "tick", ID: "1", Data: "first line 1\nsecond line"},
+		{Type: "tick", ID: "2", Data: "first line 2\nsecond line"},
+		{Type: "tick", ID: "3", Data: "first line 3\nsecond line"},
+	})
+
+	// when the handler keeps the stream open, the deadline applies
+	resp = h.RespondToStream(ctx, "GET /events?hang=1")
+	chunk := must.Return(resp.NextChunk(time.Second))
+	assert.DeepEqual(t, "first chunk", string(chunk), ": comment\nevent: tick\nid: 1\n")
+	chunk = must.Return(resp.NextChunk(time.Second))
+	assert.DeepEqual(t, "second chunk", string(chunk), "data: first line 1\ndata: second line\n\n")
+	_ = must.Return(resp.NextEvent(time.Second))
+	_ = must.Return(resp.NextEvent(time.Second))
+	_, err := resp.NextEvent(10 * time.Millisecond)
+	if !errors.Is(err, httptest.ErrStreamTimeout) {
+		t.Errorf("expected ErrStreamTimeout, but got %v", err)
+	}
+	resp.Close() // this must not block since the request context is canceled
+
+	// after Close(), no further data is received
+	_, err = resp.NextChunk(time.Second)
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, but got %v", err)
+	}
+}
+
+func TestRespondToStreamWithoutHeaders(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	// a handler that returns without writing anything yields an empty 200 response
+	h := httptest.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	resp := h.RespondToStream(ctx, "GET /")
+	assert.DeepEqual(t, "Status", resp.StatusCode, http.StatusOK)
+	_, err := resp.NextChunk(time.Second)
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, but got %v", err)
+	}
+	resp.Close()
+
+	// a handler that panics before writing headers makes RespondToStream() panic instead of blocking forever
+	h = httptest.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("datacenter on fire")
+	}))
+	func() {
+		defer func() {
+			assert.DeepEqual(t, "panic", recover(), any("datacenter on fire"))
+		}()
+		h.RespondToStream(ctx, "GET /")
+		t.Error("expected RespondToStream() to panic, but it returned")
+	}()
+
+	// a handler that never writes headers is abandoned when ctx expires
+	h = httptest.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	resp = h.RespondToStream(timeoutCtx, "GET /")
+	assert.DeepEqual(t, "Status", resp.StatusCode, 0)
+	resp.Close()
+}
+
+func TestRespondToStreamWithCookieJar(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	jar := must.Return(cookiejar.New(nil))
+	h := httptest.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "12345"})
+		}
+		cookie, err := r.Cookie("session")
+		if err == nil {
+			fmt.Fprintf(w, "session=%s", cookie.Value)
+		}
+	}), httptest.WithCookieJar(jar))
+
+	// cookies set by streaming responses are stored in the jar...
+	resp := h.RespondToStream(ctx, "GET /login")
+	resp.Close()
+
+	// ...and cookies from the jar are sent with streaming requests
+	resp = h.RespondToStream(ctx, "GET /events")
+	chunk := must.Return(resp.NextChunk(time.Second))
+	assert.DeepEqual(t, "body", string(chunk), "session=12345")
+	resp.Close()
+}
@@ -0,0 +1,180 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+type diffLine struct {
+	Op   byte // ' ', '-' or '+'
+	Text string
+}
+
+// UnifiedDiff renders a line-based diff between the given texts in the
+// format of `diff -u`, with three lines of context around each change.
+// If the texts are equal, the empty string is returned.
+//
+// This is used by test helpers instead of calling an external `diff` binary,
+// which is not available on every platform.
+func UnifiedDiff(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	// compute a line-based diff by encoding each distinct line as a single rune
+	// (we do not use DiffLinesToRunes() because it is broken in the go-diff version that we use)
+	var lineTexts []string
+	lineRunes := make(map[string]rune)
+	encode := func(text string) []rune {
+		var result []rune
+		for _, line := range splitLinesKeepEOL(text) {
+			r, exists := lineRunes[line]
+			if !exists {
+				r = rune(len(lineTexts) + 1)
+				if r >= 0xD800 {
+					r += 0x800 // skip surrogate range
+				}
+				lineRunes[line] = r
+				lineTexts = append(lineTexts, line)
+			}
+			result = append(result, r)
+		}
+		return result
+	}
+	decode := func(r rune) string {
+		if r >= 0xE000 {
+			r -= 0x800
+		}
+		return lineTexts[r-1]
+	}
+	fromRunes := encode(from)
+	toRunes := encode(to)
+	diffs := diffmatchpatch.New().DiffMainRunes(fromRunes, toRunes, false)
+
+	var lines []diffLine
+	for _, d := range diffs {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		for _, r := range d.Text {
+			lines = append(lines, diffLine{op, decode(r)})
+		}
+	}
+
+	// group changes into hunks with context
+	const contextSize = 3
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	fromLineNo, toLineNo := 1, 1 // line numbers of lines[idx]
+	for idx := 0; idx < len(lines); {
+		if lines[idx].Op == ' ' {
+			idx++
+			fromLineNo++
+			toLineNo++
+			continue
+		}
+
+		// found a change: extend the hunk until there are enough unchanged lines after the last change
+		start := max(0, idx-contextSize)
+		end := idx
+		for end < len(lines) {
+			if lines[end].Op != ' ' {
+				end++
+				continue
+			}
+			nextChange := end
+			for nextChange < len(lines) && lines[nextChange].Op == ' ' {
+				nextChange++
+			}
+			if nextChange == len(lines) || nextChange-end > 2*contextSize {
+				end = min(len(lines), end+contextSize)
+				break
+			}
+			end = nextChange
+		}
+
+		// render hunk
+		hunkFromStart, hunkToStart := fromLineNo-(idx-start), toLineNo-(idx-start)
+		var fromCount, toCount int
+		var body strings.Builder
+		for _, line := range lines[start:end] {
+			if line.Op != '+' {
+				fromCount++
+			}
+			if line.Op != '-' {
+				toCount++
+			}
+			body.WriteByte(line.Op)
+			body.WriteString(line.Text)
+			if !strings.HasSuffix(line.Text, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", formatHunkRange(hunkFromStart, fromCount), formatHunkRange(hunkToStart, toCount))
+		sb.WriteString(body.String())
+
+		// continue after the hunk
+		for _, line := range lines[idx:end] {
+			if line.Op != '+' {
+				fromLineNo++
+			}
+			if line.Op != '-' {
+				toLineNo++
+			}
+		}
+		idx = end
+	}
+	return sb.String()
+}
+
+func splitLinesKeepEOL(text string) []string {
+	var result []string
+	for text != "" {
+		idx := strings.IndexByte(text, '\n')
+		if idx == -1 {
+			result = append(result, text)
+			break
+		}
+		result = append(result, text[:idx+1])
+		text = text[idx+1:]
+	}
+	return result
+}
+
+// Formats a line range in a hunk header like `diff -u` does.
+func formatHunkRange(start, count int) string {
+	switch count {
+	case 0:
+		// for empty ranges, `diff -u` reports the line before the range
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	default:
+		return fmt.Sprintf("%d,%d", start, count)
+	}
+}
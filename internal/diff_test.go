@@ -0,0 +1,54 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package internal
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	testCases := []struct {
+		From, To string
+		Expected string
+	}{
+		{"foo\nbar\n", "foo\nbar\n", ""},
+		{"", "x\n", "--- a\n+++ b\n@@ -0,0 +1 @@\n+x\n"},
+		{"x\n", "", "--- a\n+++ b\n@@ -1 +0,0 @@\n-x\n"},
+		// output as generated by `diff -u`, with one hunk per group of changes
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n",
+			"1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\nsixteen",
+			"--- a\n+++ b\n" +
+				"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+				"@@ -11,5 +11,5 @@\n 11\n 12\n 13\n-14\n 15\n+sixteen\n\\ No newline at end of file\n",
+		},
+		// changes that are close together are merged into a single hunk
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"1\nzwei\n3\n4\n5\n6\nsieben\n8\n",
+			"--- a\n+++ b\n@@ -1,8 +1,8 @@\n 1\n-2\n+zwei\n 3\n 4\n 5\n 6\n-7\n+sieben\n 8\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		actual := UnifiedDiff("a", "b", tc.From, tc.To)
+		if actual != tc.Expected {
+			t.Errorf("diff of %q -> %q: expected\n%s\nbut got\n%s", tc.From, tc.To, tc.Expected, actual)
+		}
+	}
+}
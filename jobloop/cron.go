@@ -68,8 +68,14 @@ func (i cronJobImpl) processOne(ctx context.Context, cfg jobConfig) error {
 	j := i.j
 
 	labels := j.Metadata.makeLabels(cfg)
+	if cfg.DryRunRecorder != nil {
+		cfg.recordDryRun(ctx, nil, labels)
+		return nil
+	}
+	ctx, finishRunJournalRecord := cfg.startRunJournalRecord(ctx, &j.Metadata)
 	err := j.Task(ctx, labels)
 	j.Metadata.countTask(labels, err)
+	finishRunJournalRecord(labels, err)
 	return err
 }
 
@@ -82,6 +88,9 @@ func (i cronJobImpl) ProcessOne(ctx context.Context, opts ...Option) error {
 func (i cronJobImpl) Run(ctx context.Context, opts ...Option) {
 	cfg := newJobConfig(opts)
 	runOnce := func() {
+		if !cfg.waitForResourceGuardrails(ctx, i.j.Metadata.ReadableName) {
+			return
+		}
 		err := i.processOne(ctx, cfg)
 		if err != nil {
 			logg.Error("could not run task%s for job %q: %s",
@@ -89,6 +98,9 @@ func (i cronJobImpl) Run(ctx context.Context, opts ...Option) {
 		}
 	}
 
+	if !cfg.waitForWarmup(ctx) {
+		return
+	}
 	if i.j.InitialDelay != 0 {
 		time.Sleep(i.j.InitialDelay)
 		runOnce()
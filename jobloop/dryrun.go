@@ -0,0 +1,96 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package jobloop
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// DryRunRecorder is the type of the callback that is given to WithDryRun().
+//
+// The task argument is the task that would have been processed: For a
+// ProducerConsumerJob, this is the task returned by DiscoverTask. For a
+// TxGuardedJob, this is the payload returned by DiscoverRow. For a CronJob,
+// this is always nil, since there is no discovery phase.
+type DryRunRecorder func(ctx context.Context, task any, labels prometheus.Labels)
+
+// WithDryRun is an option for a Job that runs the discovery phase of each task
+// as usual, but skips the processing phase. Instead of processing each task,
+// the job calls the provided recorder with the task that would have been
+// processed. If nil is given as the recorder, a log line is written for each
+// task instead. This allows for validating the task selection logic of a new
+// job in production without any risk of actually modifying anything.
+//
+// For a TxGuardedJob, the transaction is rolled back after the task has been
+// recorded. For a CronJob, the Task function is not called at all.
+//
+// Since tasks are not processed, the discovery phase will usually find the
+// same task again and again. Therefore, Run() on a ProducerConsumerJob or
+// TxGuardedJob waits after each recorded task
+// for the same amount of time as if no task had been available. Recorded
+// tasks are not counted in the job's counter metric.
+func WithDryRun(record DryRunRecorder) Option {
+	return func(cfg *jobConfig) {
+		if record == nil {
+			record = logDryRunTask
+		}
+		cfg.DryRunRecorder = record
+	}
+}
+
+func logDryRunTask(ctx context.Context, task any, labels prometheus.Labels) {
+	logg.Info("dry run: would process task %#v with labels %v", task, labels)
+}
+
+// Implemented by task types that wrap the value that is shown to the
+// DryRunRecorder, and need to release resources when they are not processed.
+type dryRunTask interface {
+	// Returns the value that shall be given to the DryRunRecorder.
+	dryRunPayload() any
+	// Releases all resources held by the task.
+	discardAfterDryRun()
+}
+
+// Internal API for job implementations: Hands the task to the recorder
+// instead of processing it.
+func (cfg jobConfig) recordDryRun(ctx context.Context, task any, labels prometheus.Labels) {
+	if t, ok := task.(dryRunTask); ok {
+		defer t.discardAfterDryRun()
+		task = t.dryRunPayload()
+	}
+	cfg.DryRunRecorder(ctx, task, labels)
+}
+
+// Internal API for job implementations: After a task has been recorded in a
+// dry run, slows down just like if no task had been available.
+func (cfg jobConfig) slowDownAfterDryRun(ctx context.Context) {
+	if cfg.DryRunRecorder == nil {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(noTasksDelay):
+	}
+}
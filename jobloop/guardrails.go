@@ -0,0 +1,148 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package jobloop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"time"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// ResourceGuardrails is the argument type for WithResourceGuardrails().
+// Thresholds that are set to zero are not checked.
+type ResourceGuardrails struct {
+	// If the resident set size (RSS) of this process exceeds this many bytes,
+	// the job will stop taking on new tasks until the RSS falls below this
+	// threshold again.
+	MaxRSSBytes uint64
+	// If the number of goroutines in this process exceeds this number, the job
+	// will stop taking on new tasks until the goroutine count falls below this
+	// threshold again.
+	MaxGoroutines int
+	// How often resource usage is checked again while task intake is paused.
+	// Defaults to 5 seconds.
+	CheckInterval time.Duration
+}
+
+// WithResourceGuardrails is an option for a Job that pauses the intake of new
+// tasks while the resource usage of the whole process exceeds any of the
+// given thresholds. Tasks that are already being processed are not
+// interrupted. Intake resumes once the resource usage has fallen below all
+// thresholds.
+//
+// This is intended for processes that run job loops alongside an API, to
+// ensure that a sudden flood of tasks cannot starve the API of memory.
+//
+// This option is always ignored during ProcessOne(), because unit tests
+// shall not depend on the resource usage of the test process.
+func WithResourceGuardrails(g ResourceGuardrails) Option {
+	return func(cfg *jobConfig) {
+		if g.CheckInterval <= 0 {
+			g.CheckInterval = 5 * time.Second
+		}
+		cfg.Guardrails = &g
+	}
+}
+
+type resourceUsage struct {
+	RSSBytes   uint64
+	Goroutines int
+}
+
+// This is a variable to allow substituting a double in unit tests.
+var measureResourceUsage = func() resourceUsage {
+	return resourceUsage{
+		RSSBytes:   measureRSS(),
+		Goroutines: runtime.NumGoroutine(),
+	}
+}
+
+func measureRSS() uint64 {
+	// on Linux, the RSS can be read from procfs: the second field in
+	// /proc/self/statm is the RSS in pages
+	buf, err := os.ReadFile("/proc/self/statm")
+	if err == nil {
+		fields := bytes.Fields(buf)
+		if len(fields) >= 2 {
+			pages, err := strconv.ParseUint(string(fields[1]), 10, 64)
+			if err == nil {
+				return pages * uint64(os.Getpagesize()) //nolint:gosec // page size is always positive
+			}
+		}
+	}
+
+	// elsewhere, fall back to the memory mapped by the Go runtime, which is an
+	// upper bound for the RSS of pure Go programs
+	sample := []metrics.Sample{{Name: "/memory/classes/total:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() == metrics.KindUint64 {
+		return sample[0].Value.Uint64()
+	}
+	return 0
+}
+
+// Returns a description of the first exceeded threshold, or "" if no
+// threshold is exceeded.
+func (g ResourceGuardrails) findViolation(usage resourceUsage) string {
+	if g.MaxRSSBytes > 0 && usage.RSSBytes > g.MaxRSSBytes {
+		return fmt.Sprintf("RSS is %d bytes (limit: %d bytes)", usage.RSSBytes, g.MaxRSSBytes)
+	}
+	if g.MaxGoroutines > 0 && usage.Goroutines > g.MaxGoroutines {
+		return fmt.Sprintf("%d goroutines are running (limit: %d)", usage.Goroutines, g.MaxGoroutines)
+	}
+	return ""
+}
+
+// Internal API for job implementations: Blocks while any of the configured
+// guardrails is violated. Returns false if `ctx` expired while waiting.
+func (cfg jobConfig) waitForResourceGuardrails(ctx context.Context, jobName string) bool {
+	g := cfg.Guardrails
+	if g == nil {
+		return ctx.Err() == nil
+	}
+
+	violation := g.findViolation(measureResourceUsage())
+	if violation == "" {
+		return ctx.Err() == nil
+	}
+	logg.Info("pausing task intake%s for job %q because %s",
+		cfg.PrefilledLabelsAsString(), jobName, violation)
+
+	ticker := time.NewTicker(g.CheckInterval)
+	defer ticker.Stop()
+	for violation != "" {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			violation = g.findViolation(measureResourceUsage())
+		}
+	}
+
+	logg.Info("resuming task intake%s for job %q", cfg.PrefilledLabelsAsString(), jobName)
+	return ctx.Err() == nil
+}
@@ -0,0 +1,102 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package jobloop
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestResourceGuardrails(t *testing.T) {
+	// simulate a process that has too many goroutines at first
+	var goroutineCount atomic.Int64
+	goroutineCount.Store(200)
+	defer func(orig func() resourceUsage) { measureResourceUsage = orig }(measureResourceUsage)
+	measureResourceUsage = func() resourceUsage {
+		return resourceUsage{RSSBytes: 1 << 20, Goroutines: int(goroutineCount.Load())}
+	}
+
+	engine := producerConsumerEngine{}
+	registry := prometheus.NewPedanticRegistry()
+	job := engine.Job(registry)
+
+	// start the job machinery
+	var wgJobLoop sync.WaitGroup
+	wgJobLoop.Add(1)
+	engine.wgProcessorsReady.Add(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer wgJobLoop.Done()
+		job.Run(ctx, WithResourceGuardrails(ResourceGuardrails{
+			MaxRSSBytes:   1 << 30,
+			MaxGoroutines: 100,
+			CheckInterval: 10 * time.Millisecond,
+		}))
+	}()
+
+	// while the guardrail is violated, no tasks shall be taken on
+	time.Sleep(100 * time.Millisecond)
+	engine.mutex.Lock()
+	discovered := engine.discovered
+	engine.mutex.Unlock()
+	if discovered != 0 {
+		t.Errorf("expected no tasks to be discovered while paused, but got %d", discovered)
+	}
+
+	// once the pressure subsides, all tasks shall be processed
+	goroutineCount.Store(50)
+	engine.wgProcessorsReady.Wait()
+	cancel()
+	wgJobLoop.Wait()
+
+	engine.checkAllProcessed(t, registry)
+}
+
+func TestResourceGuardrailsViolations(t *testing.T) {
+	g := ResourceGuardrails{MaxRSSBytes: 1000, MaxGoroutines: 10}
+	testCases := map[resourceUsage]string{
+		{RSSBytes: 500, Goroutines: 5}:   "",
+		{RSSBytes: 1000, Goroutines: 10}: "",
+		{RSSBytes: 1001, Goroutines: 5}:  "RSS is 1001 bytes (limit: 1000 bytes)",
+		{RSSBytes: 500, Goroutines: 11}:  "11 goroutines are running (limit: 10)",
+	}
+	for usage, expected := range testCases {
+		actual := g.findViolation(usage)
+		if actual != expected {
+			t.Errorf("expected findViolation(%#v) = %q, but got %q", usage, expected, actual)
+		}
+	}
+
+	// thresholds that are not set are not checked
+	actual := ResourceGuardrails{}.findViolation(resourceUsage{RSSBytes: 1 << 40, Goroutines: 1 << 20})
+	if actual != "" {
+		t.Errorf("expected no violation without thresholds, but got %q", actual)
+	}
+
+	// the RSS measurement shall yield something plausible
+	if measureRSS() == 0 {
+		t.Error("expected measureRSS() to return a nonzero value")
+	}
+}
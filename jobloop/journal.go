@@ -0,0 +1,207 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package jobloop
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/sqlext"
+)
+
+// RunJournalUpMigration and RunJournalDownMigration create and drop the
+// database table that is used by RunJournal. They need to be added to the
+// application's migrations (e.g. in easypg.Configuration) under a version
+// number that fits into the application's own sequence of migrations:
+//
+//	cfg.Migrations["042_add_jobloop_run_journal.up.sql"] = jobloop.RunJournalUpMigration
+//	cfg.Migrations["042_add_jobloop_run_journal.down.sql"] = jobloop.RunJournalDownMigration
+const (
+	RunJournalUpMigration = `
+		CREATE TABLE jobloop_run_journal (
+			id            BIGSERIAL   NOT NULL PRIMARY KEY,
+			job_name      TEXT        NOT NULL,
+			labels        JSONB       NOT NULL,
+			started_at    TIMESTAMPTZ NOT NULL,
+			finished_at   TIMESTAMPTZ NOT NULL,
+			outcome       TEXT        NOT NULL,
+			error_message TEXT        NOT NULL DEFAULT '',
+			counts        JSONB       NOT NULL
+		);
+		CREATE INDEX jobloop_run_journal_lookup ON jobloop_run_journal (job_name, finished_at);
+	`
+	RunJournalDownMigration = `
+		DROP TABLE jobloop_run_journal;
+	`
+)
+
+// RunJournal records each task executed by a job in the database table
+// "jobloop_run_journal" (see RunJournalUpMigration). This allows operators to
+// answer questions like "when did this job last succeed?" without looking
+// through logs, for example:
+//
+//	SELECT MAX(finished_at) FROM jobloop_run_journal WHERE job_name = 'sync project quotas' AND outcome = 'success';
+//
+// Each record contains the job's ReadableName, the task's labels, start and
+// end time, the outcome ("success" or "failure"), the error message (if any),
+// and the counts reported by the task through AddToRunJournalCount(). For a
+// ProducerConsumerJob or TxGuardedJob, the record covers the processing phase
+// only, so counts can only be reported from there. Failures during the
+// discovery phase are recorded separately, but iterations where no task was
+// found are not recorded at all.
+//
+// Records are written on a best-effort basis: If a record cannot be written,
+// an error is logged, but the task outcome is not affected. Use
+// WithRunJournal() to enable the journal for a job.
+type RunJournal struct {
+	// A connection to the database containing the run journal table, e.g.
+	// as returned by easypg.Connect(). Records are written outside of any
+	// transactions of the task, so that they are kept even if the task's
+	// transaction is rolled back.
+	DB *sql.DB
+	// Records older than this are deleted. If zero, 30 days are used.
+	Retention time.Duration
+	// Records are deleted at most once during this interval. If zero, one hour is used.
+	PruneInterval time.Duration
+
+	mutex       sync.Mutex
+	lastPruneAt time.Time
+}
+
+// WithRunJournal is an option for a Job that records each executed task in
+// the given RunJournal. Multiple jobs can share the same RunJournal. Tasks
+// recorded in a dry run (see WithDryRun()) are not written into the journal.
+func WithRunJournal(journal *RunJournal) Option {
+	return func(cfg *jobConfig) {
+		cfg.RunJournal = journal
+	}
+}
+
+type runJournalCountsKey struct{}
+
+// Counts for one run journal record, see AddToRunJournalCount().
+type runJournalCounts struct {
+	mutex  sync.Mutex
+	values map[string]int64
+}
+
+// AddToRunJournalCount adds the given amount to a named count in the run
+// journal record for the current task, e.g. the number of rows processed or
+// objects deleted. This function must be called with the context that was
+// given to the task callback. If the job does not have a run journal, this
+// function does nothing.
+func AddToRunJournalCount(ctx context.Context, name string, amount int64) {
+	counts, ok := ctx.Value(runJournalCountsKey{}).(*runJournalCounts)
+	if !ok {
+		return
+	}
+	counts.mutex.Lock()
+	defer counts.mutex.Unlock()
+	counts.values[name] += amount
+}
+
+// Internal API for job implementations: Prepares a run journal record for a
+// task that starts now. The returned context must be given to the task
+// callback, and the returned function must be called with the result of the
+// task once it has finished.
+func (cfg jobConfig) startRunJournalRecord(ctx context.Context, m *JobMetadata) (context.Context, func(labels prometheus.Labels, err error)) {
+	journal := cfg.RunJournal
+	if journal == nil {
+		return ctx, func(prometheus.Labels, error) {}
+	}
+
+	startedAt := time.Now()
+	counts := &runJournalCounts{values: make(map[string]int64)}
+	ctx = context.WithValue(ctx, runJournalCountsKey{}, counts)
+	return ctx, func(labels prometheus.Labels, err error) {
+		finishedAt := time.Now()
+		counts.mutex.Lock()
+		values := maps.Clone(counts.values)
+		counts.mutex.Unlock()
+
+		// the record shall be written even if the task failed because `ctx` expired
+		ctx := context.WithoutCancel(ctx)
+		err = journal.write(ctx, m.ReadableName, labels, startedAt, finishedAt, values, err)
+		if err != nil {
+			logg.Error("could not write run journal record for job %q: %s", m.ReadableName, err.Error())
+		}
+	}
+}
+
+var insertRunJournalRecordQuery = sqlext.SimplifyWhitespace(`
+	INSERT INTO jobloop_run_journal (job_name, labels, started_at, finished_at, outcome, error_message, counts)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+`)
+
+func (j *RunJournal) write(ctx context.Context, jobName string, labels prometheus.Labels, startedAt, finishedAt time.Time, counts map[string]int64, taskErr error) error {
+	outcome := outcomeValueSuccess
+	errorMessage := ""
+	if taskErr != nil {
+		outcome = outcomeValueFailure
+		errorMessage = taskErr.Error()
+	}
+
+	// the outcome label is redundant with the outcome column
+	labels = maps.Clone(labels)
+	delete(labels, outcomeLabelName)
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	countsJSON, err := json.Marshal(counts)
+	if err != nil {
+		return err
+	}
+
+	_, err = j.DB.ExecContext(ctx, insertRunJournalRecordQuery, jobName, string(labelsJSON), startedAt, finishedAt, outcome, errorMessage, string(countsJSON))
+	if err != nil {
+		return err
+	}
+	return j.pruneIfNecessary(ctx, finishedAt)
+}
+
+func (j *RunJournal) pruneIfNecessary(ctx context.Context, now time.Time) error {
+	pruneInterval := j.PruneInterval
+	if pruneInterval == 0 {
+		pruneInterval = time.Hour
+	}
+	retention := j.Retention
+	if retention == 0 {
+		retention = 30 * 24 * time.Hour
+	}
+
+	j.mutex.Lock()
+	if now.Sub(j.lastPruneAt) < pruneInterval {
+		j.mutex.Unlock()
+		return nil
+	}
+	j.lastPruneAt = now
+	j.mutex.Unlock()
+
+	_, err := j.DB.ExecContext(ctx, `DELETE FROM jobloop_run_journal WHERE finished_at < $1`, now.Add(-retention))
+	return err
+}
@@ -0,0 +1,138 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package jobloop
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+// A database/sql driver that records all executed statements with their arguments.
+type execRecordingDriver struct {
+	statements []recordedStatement
+}
+
+type recordedStatement struct {
+	Query string
+	Args  []any
+}
+
+func (d *execRecordingDriver) Open(string) (driver.Conn, error) { return execRecordingConn{d}, nil }
+
+// execRecordingDriver also implements driver.Connector, so that it can be used with sql.OpenDB()
+// without having to be registered globally (which panics when the test runs multiple times).
+func (d *execRecordingDriver) Connect(context.Context) (driver.Conn, error) { return d.Open("") }
+func (d *execRecordingDriver) Driver() driver.Driver                        { return d }
+
+type execRecordingConn struct{ d *execRecordingDriver }
+
+func (c execRecordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c execRecordingConn) Close() error { return nil }
+func (c execRecordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+func (c execRecordingConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s := recordedStatement{Query: query}
+	for _, arg := range args {
+		s.Args = append(s.Args, arg.Value)
+	}
+	c.d.statements = append(c.d.statements, s)
+	return driver.RowsAffected(1), nil
+}
+
+func TestRunJournal(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	d := &execRecordingDriver{}
+	db := sql.OpenDB(d)
+	defer db.Close()
+	journal := &RunJournal{DB: db, Retention: 24 * time.Hour}
+
+	taskErr := errors.New("datacenter on fire")
+	j := (&CronJob{
+		Metadata: JobMetadata{
+			ReadableName:  "journal test job",
+			CounterOpts:   prometheus.CounterOpts{Name: "journal_test_job_runs", Help: "Hello World."},
+			CounterLabels: []string{"region"},
+		},
+		Interval: time.Minute,
+		Task: func(ctx context.Context, labels prometheus.Labels) error {
+			AddToRunJournalCount(ctx, "things", 2)
+			AddToRunJournalCount(ctx, "things", 3)
+			if labels["region"] == "broken" {
+				return taskErr
+			}
+			return nil
+		},
+	}).Setup(prometheus.NewRegistry())
+
+	// first run: record is written, and old records are pruned
+	startTime := time.Now()
+	err := j.ProcessOne(ctx, WithRunJournal(journal), WithLabel("region", "good"))
+	assert.DeepEqual(t, "error", err, nil)
+	if len(d.statements) != 2 {
+		t.Fatalf("expected 2 statements, but got %#v", d.statements)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(d.statements[0].Query), "INSERT INTO jobloop_run_journal") {
+		t.Errorf("unexpected first statement: %s", d.statements[0].Query)
+	}
+	args := d.statements[0].Args
+	assert.DeepEqual(t, "job name", args[0], any("journal test job"))
+	assert.DeepEqual(t, "labels", args[1], any(`{"region":"good"}`))
+	assert.DeepEqual(t, "outcome", args[4], any("success"))
+	assert.DeepEqual(t, "error message", args[5], any(""))
+	assert.DeepEqual(t, "counts", args[6], any(`{"things":5}`))
+	if startedAt := args[2].(time.Time); startedAt.Before(startTime) {
+		t.Errorf("expected started_at to be after %s, but got %s", startTime, startedAt)
+	}
+	if !strings.HasPrefix(d.statements[1].Query, "DELETE FROM jobloop_run_journal") {
+		t.Errorf("unexpected second statement: %s", d.statements[1].Query)
+	}
+	if cutoff := d.statements[1].Args[0].(time.Time); cutoff.Before(startTime.Add(-24 * time.Hour)) {
+		t.Errorf("expected pruning cutoff to be after %s, but got %s", startTime.Add(-24*time.Hour), cutoff)
+	}
+
+	// second run: failures are recorded, and pruning is not repeated within the PruneInterval
+	d.statements = nil
+	err = j.ProcessOne(ctx, WithRunJournal(journal), WithLabel("region", "broken"))
+	assert.DeepEqual(t, "error", err, taskErr)
+	if len(d.statements) != 1 {
+		t.Fatalf("expected 1 statement, but got %#v", d.statements)
+	}
+	args = d.statements[0].Args
+	assert.DeepEqual(t, "outcome", args[4], any("failure"))
+	assert.DeepEqual(t, "error message", args[5], any("datacenter on fire"))
+
+	// without WithRunJournal(), nothing is recorded
+	d.statements = nil
+	err = j.ProcessOne(ctx, WithLabel("region", "good"))
+	assert.DeepEqual(t, "error", err, nil)
+	assert.DeepEqual(t, "statements", len(d.statements), 0)
+}
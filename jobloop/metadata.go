@@ -19,7 +19,11 @@
 
 package jobloop
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 // JobMetadata contains metadata and common configuration for a job. Types that
 // implement the Job interface will usually be holding one of these.
@@ -41,6 +45,7 @@ type JobMetadata struct {
 	CounterLabels []string
 
 	counter *prometheus.CounterVec
+	gauges  *workerGauges
 }
 
 const (
@@ -95,3 +100,56 @@ func (m *JobMetadata) countTask(labels prometheus.Labels, err error) {
 	}
 	m.counter.With(labels).Inc()
 }
+
+// Gauges describing the worker pool of a job. These are only maintained for
+// ProducerConsumerJob, and are shared between all jobs on the same registry
+// (with the job name as a label).
+type workerGauges struct {
+	Workers     prometheus.Gauge
+	BusyWorkers prometheus.Gauge
+	QueuedTasks prometheus.Gauge
+}
+
+// Internal API for job implementations: Registers the gauges described by
+// workerGauges, or reuses them if another job has already registered them.
+func (m *JobMetadata) setupWorkerGauges(registerer prometheus.Registerer) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	labelNames := []string{"job"}
+	workers := registerOrReuse(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobloop_workers",
+		Help: "Number of goroutines that are processing tasks for this job.",
+	}, labelNames))
+	busyWorkers := registerOrReuse(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobloop_busy_workers",
+		Help: "Number of goroutines that are currently processing a task for this job.",
+	}, labelNames))
+	queuedTasks := registerOrReuse(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobloop_queued_tasks",
+		Help: "Number of tasks for this job that have been selected, but are waiting for a goroutine to process them.",
+	}, labelNames))
+
+	// the metric name of the job's counter is unique, so it serves as a job identifier
+	jobName := prometheus.BuildFQName(m.CounterOpts.Namespace, m.CounterOpts.Subsystem, m.CounterOpts.Name)
+	m.gauges = &workerGauges{
+		Workers:     workers.WithLabelValues(jobName),
+		BusyWorkers: busyWorkers.WithLabelValues(jobName),
+		QueuedTasks: queuedTasks.WithLabelValues(jobName),
+	}
+}
+
+func registerOrReuse[C prometheus.Collector](registerer prometheus.Registerer, collector C) C {
+	err := registerer.Register(collector)
+	if err == nil {
+		return collector
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing
+		}
+	}
+	panic(err.Error())
+}
@@ -27,8 +27,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-// Option is a configuration option for a Job. Currently, only the number of
-// goroutines can be configured, but more options could be added in the future.
+// Option is a configuration option for a Job.
 //
 // This type is an implementation of the Functional Options pattern, see e.g.
 // <https://github.com/tmrts/go-patterns/blob/master/idiom/functional-options.md>
@@ -37,6 +36,10 @@ type Option func(*jobConfig)
 type jobConfig struct {
 	NumGoroutines   uint32
 	PrefilledLabels prometheus.Labels
+	Guardrails      *ResourceGuardrails
+	DryRunRecorder  DryRunRecorder
+	Warmup          warmupConfig
+	RunJournal      *RunJournal
 }
 
 func newJobConfig(opts []Option) jobConfig {
@@ -86,6 +86,13 @@ type ProducerConsumerJob[T any] struct {
 // Setup builds the Job interface for this job and registers the counter
 // metric. At runtime, `nil` can be given to use the default registry. In
 // tests, a test-local prometheus.Registry instance should be used instead.
+//
+// Additionally, the following gauge metrics are registered (or shared with
+// other jobs on the same registry). They have the label "job", containing the
+// name of the job's counter metric:
+//   - "jobloop_workers" (number of goroutines processing tasks)
+//   - "jobloop_busy_workers" (number of goroutines currently processing a task)
+//   - "jobloop_queued_tasks" (number of selected tasks waiting for a goroutine)
 func (j *ProducerConsumerJob[T]) Setup(registerer prometheus.Registerer) Job {
 	if j.DiscoverTask == nil {
 		panic("DiscoverTask must be set!")
@@ -95,6 +102,7 @@ func (j *ProducerConsumerJob[T]) Setup(registerer prometheus.Registerer) Job {
 	}
 
 	j.Metadata.setup(registerer)
+	j.Metadata.setupWorkerGauges(registerer)
 	// NOTE: We wrap `j` into a private type instead of implementing the
 	// Job interface directly on `j` to enforce that callers run Setup().
 	return producerConsumerJobImpl[T]{j}
@@ -108,6 +116,7 @@ type producerConsumerJobImpl[T any] struct {
 // well as by runSingleThreaded and runMultiThreaded in production.
 func (j *ProducerConsumerJob[T]) produceOne(ctx context.Context, cfg jobConfig, annotateErrors bool) (T, prometheus.Labels, error) {
 	labels := j.Metadata.makeLabels(cfg)
+	_, finishRunJournalRecord := cfg.startRunJournalRecord(ctx, &j.Metadata)
 	task, err := j.DiscoverTask(ctx, labels)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		if annotateErrors {
@@ -115,6 +124,7 @@ func (j *ProducerConsumerJob[T]) produceOne(ctx context.Context, cfg jobConfig,
 				cfg.PrefilledLabelsAsString(), j.Metadata.ReadableName, err)
 		}
 		j.Metadata.countTask(labels, err)
+		finishRunJournalRecord(labels, err)
 	}
 	return task, labels, err
 }
@@ -122,12 +132,21 @@ func (j *ProducerConsumerJob[T]) produceOne(ctx context.Context, cfg jobConfig,
 // Core consumer-side behavior. This is used by ProcessOne in unit tests, as
 // well as by runSingleThreaded and runMultiThreaded in production.
 func (j *ProducerConsumerJob[T]) consumeOne(ctx context.Context, cfg jobConfig, task T, labels prometheus.Labels, annotateErrors bool) error {
+	if cfg.DryRunRecorder != nil {
+		cfg.recordDryRun(ctx, task, labels)
+		return nil
+	}
+
+	ctx, finishRunJournalRecord := cfg.startRunJournalRecord(ctx, &j.Metadata)
+	j.Metadata.gauges.BusyWorkers.Inc()
+	defer j.Metadata.gauges.BusyWorkers.Dec() // even if ProcessTask panics
 	err := j.ProcessTask(ctx, task, labels)
 	if err != nil && annotateErrors {
 		err = fmt.Errorf("could not process task%s for job %q: %w",
 			cfg.PrefilledLabelsAsString(), j.Metadata.ReadableName, err)
 	}
 	j.Metadata.countTask(labels, err)
+	finishRunJournalRecord(labels, err)
 	return err
 }
 
@@ -150,24 +169,33 @@ func (i producerConsumerJobImpl[T]) ProcessOne(ctx context.Context, opts ...Opti
 // Run implements the jobloop.Job interface.
 func (i producerConsumerJobImpl[T]) Run(ctx context.Context, opts ...Option) {
 	cfg := newJobConfig(opts)
-
-	switch cfg.NumGoroutines {
-	case 0:
+	switch {
+	case cfg.NumGoroutines == 0:
 		panic("ProducerConsumerJob.Run() called with numGoroutines == 0")
-	case 1:
+	case cfg.NumGoroutines > 1 && !i.j.Metadata.ConcurrencySafe:
+		panic("ProducerConsumerJob.Run() called with numGoroutines > 1, but job is not ConcurrencySafe")
+	}
+	if !cfg.waitForWarmup(ctx) {
+		return
+	}
+
+	if cfg.NumGoroutines == 1 {
 		i.runSingleThreaded(ctx, cfg)
-	default:
-		if !i.j.Metadata.ConcurrencySafe {
-			panic("ProducerConsumerJob.Run() called with numGoroutines > 1, but job is not ConcurrencySafe")
-		}
+	} else {
 		i.runMultiThreaded(ctx, cfg)
 	}
 }
 
 // Implementation of Run() for `cfg.NumGoroutines == 1`.
 func (i producerConsumerJobImpl[T]) runSingleThreaded(ctx context.Context, cfg jobConfig) {
-	for ctx.Err() == nil { // while ctx has not expired
+	i.j.Metadata.gauges.Workers.Inc()
+	defer i.j.Metadata.gauges.Workers.Dec()
+
+	for cfg.waitForResourceGuardrails(ctx, i.j.Metadata.ReadableName) { // while ctx has not expired (blocks while resources are exhausted)
 		err := i.processOne(ctx, cfg)
+		if err == nil {
+			cfg.slowDownAfterDryRun(ctx)
+		}
 		logAndSlowDownOnError(err)
 	}
 }
@@ -187,10 +215,12 @@ func (i producerConsumerJobImpl[T]) runMultiThreaded(ctx context.Context, cfg jo
 	wg.Add(1)
 	go func(ch chan<- taskWithLabels[T]) {
 		defer wg.Done()
-		for ctx.Err() == nil { // while ctx has not expired
+		for cfg.waitForResourceGuardrails(ctx, j.Metadata.ReadableName) { // while ctx has not expired (blocks while resources are exhausted)
 			task, labels, err := j.produceOne(ctx, cfg, true)
 			if err == nil {
+				j.Metadata.gauges.QueuedTasks.Inc()
 				ch <- taskWithLabels[T]{task, labels}
+				cfg.slowDownAfterDryRun(ctx)
 			} else {
 				logAndSlowDownOnError(err)
 			}
@@ -205,10 +235,13 @@ func (i producerConsumerJobImpl[T]) runMultiThreaded(ctx context.Context, cfg jo
 	// We use `numGoroutines-1` here since we already have spawned one goroutine
 	// for the polling above.
 	wg.Add(int(cfg.NumGoroutines - 1))
+	j.Metadata.gauges.Workers.Add(float64(cfg.NumGoroutines - 1))
 	for range cfg.NumGoroutines - 1 {
 		go func(ch <-chan taskWithLabels[T]) {
 			defer wg.Done()
+			defer j.Metadata.gauges.Workers.Dec()
 			for item := range ch {
+				j.Metadata.gauges.QueuedTasks.Dec()
 				err := j.consumeOne(ctx, cfg, item.Task, item.Labels, true)
 				if err != nil {
 					logg.Error(err.Error())
@@ -221,13 +254,16 @@ func (i producerConsumerJobImpl[T]) runMultiThreaded(ctx context.Context, cfg jo
 	wg.Wait()
 }
 
+// How long Run() waits before polling again when no tasks are available.
+const noTasksDelay = 3 * time.Second
+
 func logAndSlowDownOnError(err error) {
 	switch {
 	case err == nil:
 		// nothing to do here
 	case errors.Is(err, sql.ErrNoRows):
 		// no tasks waiting right now - slow down a bit to avoid useless DB load
-		time.Sleep(3 * time.Second)
+		time.Sleep(noTasksDelay)
 	default:
 		// slow down a bit after an error to avoid hammering the DB during outages
 		logg.Error(err.Error())
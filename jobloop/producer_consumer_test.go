@@ -28,6 +28,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -102,7 +103,17 @@ func (e *producerConsumerEngine) checkAllProcessed(t *testing.T, registry *prome
 		t.Errorf("expected tasks 01 through 10 to be processed, but got %v", e.processed)
 	}
 
+	// after the job has shut down, the worker gauges are back to zero
 	expectedMetrics := []string{
+		"# HELP jobloop_busy_workers Number of goroutines that are currently processing a task for this job.\n",
+		"# TYPE jobloop_busy_workers gauge\n",
+		"jobloop_busy_workers{job=\"test_job_runs\"} 0\n",
+		"# HELP jobloop_queued_tasks Number of tasks for this job that have been selected, but are waiting for a goroutine to process them.\n",
+		"# TYPE jobloop_queued_tasks gauge\n",
+		"jobloop_queued_tasks{job=\"test_job_runs\"} 0\n",
+		"# HELP jobloop_workers Number of goroutines that are processing tasks for this job.\n",
+		"# TYPE jobloop_workers gauge\n",
+		"jobloop_workers{job=\"test_job_runs\"} 0\n",
 		"# HELP test_job_runs Hello World.\n",
 		"# TYPE test_job_runs counter\n",
 		"test_job_runs{task_outcome=\"failure\"} 0\n",
@@ -166,6 +177,13 @@ func TestMultiThreaded(t *testing.T) {
 
 	// wait until all tasks have been dispatched
 	engine.wgProcessorsReady.Wait()
+	// all tasks are being processed in parallel (the remaining worker is idle)
+	gauges := gatherGauges(t, registry)
+	assert.DeepEqual(t, "worker gauges", gauges, map[string]float64{
+		"jobloop_workers":      10,
+		"jobloop_busy_workers": 10,
+		"jobloop_queued_tasks": 0,
+	})
 	// allow them to proceed all at once
 	close(engine.processingBlocker)
 	// wait until all processing is done
@@ -174,3 +192,103 @@ func TestMultiThreaded(t *testing.T) {
 
 	engine.checkAllProcessed(t, registry)
 }
+
+func gatherGauges(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	result := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if metric.GetGauge() != nil {
+				result[family.GetName()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return result
+}
+
+func TestDryRun(t *testing.T) {
+	engine := producerConsumerEngine{}
+	registry := prometheus.NewPedanticRegistry()
+	job := engine.Job(registry)
+
+	// in a dry run, tasks are discovered, but handed to the recorder instead of being processed
+	var recorded []any
+	recorder := WithDryRun(func(ctx context.Context, task any, labels prometheus.Labels) {
+		recorded = append(recorded, task)
+	})
+	ctx := context.Background()
+	err := ProcessMany(job, ctx, 3, recorder)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "recorded tasks", recorded, []any{1, 2, 3})
+	assert.DeepEqual(t, "processed tasks", len(engine.processed), 0)
+
+	// recorded tasks are not counted as processed
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, family := range families {
+		if family.GetName() != "test_job_runs" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if value := metric.GetCounter().GetValue(); value != 0 {
+				t.Errorf("expected no tasks to be counted, but got %v = %g", metric.GetLabel(), value)
+			}
+		}
+	}
+
+	// for a CronJob, the task is not executed at all
+	recorded = nil
+	cronJob := (&CronJob{
+		Metadata: JobMetadata{
+			ReadableName: "test cron job",
+			CounterOpts:  prometheus.CounterOpts{Name: "test_cron_job_runs", Help: "Hello World."},
+		},
+		Interval: time.Hour,
+		Task: func(ctx context.Context, labels prometheus.Labels) error {
+			t.Error("cron job task was executed during a dry run")
+			return nil
+		},
+	}).Setup(registry)
+	err = cronJob.ProcessOne(ctx, recorder)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.DeepEqual(t, "recorded tasks", recorded, []any{nil})
+}
+
+func TestBusyWorkersAfterPanic(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	job := (&ProducerConsumerJob[int]{
+		Metadata: JobMetadata{
+			ReadableName:  "test job",
+			CounterOpts:   prometheus.CounterOpts{Name: "test_job_runs", Help: "Hello World."},
+			CounterLabels: []string{},
+		},
+		DiscoverTask: func(ctx context.Context, labels prometheus.Labels) (int, error) {
+			return 42, nil
+		},
+		ProcessTask: func(ctx context.Context, task int, labels prometheus.Labels) error {
+			panic("task processing failed")
+		},
+	}).Setup(registry)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected ProcessOne() to panic, but it did not")
+			}
+		}()
+		_ = job.ProcessOne(context.Background())
+	}()
+
+	// the panicking worker is not counted as busy forever
+	assert.DeepEqual(t, "busy workers", gatherGauges(t, registry)["jobloop_busy_workers"], 0.0)
+}
@@ -108,6 +108,17 @@ type txGuardedTask[Tx sqlext.Rollbacker, P any] struct {
 	Payload     P
 }
 
+// dryRunPayload implements the dryRunTask interface.
+func (t *txGuardedTask[Tx, P]) dryRunPayload() any {
+	return t.Payload
+}
+
+// discardAfterDryRun implements the dryRunTask interface.
+func (t *txGuardedTask[Tx, P]) discardAfterDryRun() {
+	//nolint:errcheck
+	t.Transaction.Rollback() // avoid the log line generated by sqlext.RollbackUnlessCommitted()
+}
+
 // Core producer-side behavior. This is used by ProcessOne in unit tests, as
 // well as by runSingleThreaded and runMultiThreaded in production.
 func (j *TxGuardedJob[Tx, P]) discoverTask(ctx context.Context, labels prometheus.Labels) (task *txGuardedTask[Tx, P], returnedError error) {
@@ -0,0 +1,97 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package jobloop
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+type warmupConfig struct {
+	MaxRandomDelay time.Duration
+	ReplicaIndex   int
+	ReplicaCount   int
+	SplayWindow    time.Duration
+}
+
+// WithStartupDelay is an option for a Job that makes Run() wait for a random
+// duration between 0 and maxDelay before looking for the first task. When all
+// replicas of a service are restarted at once (e.g. during a rolling deploy),
+// this avoids all of them hitting the database and upstream APIs at the same
+// moment.
+//
+// For a CronJob, the delay is applied before the InitialDelay or first Interval,
+// so it shifts the entire schedule of the job. This option is ignored by
+// ProcessOne().
+func WithStartupDelay(maxDelay time.Duration) Option {
+	return func(cfg *jobConfig) {
+		cfg.Warmup.MaxRandomDelay = maxDelay
+	}
+}
+
+// WithReplicaSplay is an option for a Job that makes Run() wait before looking
+// for the first task, for a duration that depends on which replica of the
+// service this process is. The given window is divided evenly among all
+// replicas, so replica 0 starts immediately, and the last replica starts
+// shortly before the end of the window. The replica index is usually derived
+// from the ordinal of a StatefulSet pod.
+//
+// If WithStartupDelay() is given as well, its random delay is added on top of
+// the splay. Like WithStartupDelay(), this option is ignored by ProcessOne().
+func WithReplicaSplay(replicaIndex, replicaCount int, window time.Duration) Option {
+	if replicaCount <= 0 || replicaIndex < 0 || replicaIndex >= replicaCount {
+		panic(fmt.Sprintf("WithReplicaSplay() called with invalid arguments: replicaIndex = %d, replicaCount = %d", replicaIndex, replicaCount))
+	}
+	return func(cfg *jobConfig) {
+		cfg.Warmup.ReplicaIndex = replicaIndex
+		cfg.Warmup.ReplicaCount = replicaCount
+		cfg.Warmup.SplayWindow = window
+	}
+}
+
+// Computes the delay before the first task. The argument must be a random
+// number with 0 <= r < 1, and is only taken as an argument to allow for unit tests.
+func (w warmupConfig) delay(r float64) time.Duration {
+	var d time.Duration
+	if w.ReplicaCount > 0 {
+		d = w.SplayWindow * time.Duration(w.ReplicaIndex) / time.Duration(w.ReplicaCount)
+	}
+	return d + time.Duration(float64(w.MaxRandomDelay)*r)
+}
+
+// Internal API for job implementations: Waits for the delay configured by
+// WithStartupDelay() and WithReplicaSplay(). Returns false if `ctx` expired
+// during the wait.
+func (cfg jobConfig) waitForWarmup(ctx context.Context) bool {
+	d := cfg.Warmup.delay(rand.Float64()) //nolint:gosec // no crypto-grade randomness needed for splay
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,77 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package jobloop
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWarmupDelay(t *testing.T) {
+	testCases := []struct {
+		Options  []Option
+		Random   float64
+		Expected time.Duration
+	}{
+		{nil, 0.5, 0},
+		{[]Option{WithStartupDelay(time.Minute)}, 0, 0},
+		{[]Option{WithStartupDelay(time.Minute)}, 0.5, 30 * time.Second},
+		{[]Option{WithReplicaSplay(0, 4, time.Minute)}, 0.5, 0},
+		{[]Option{WithReplicaSplay(3, 4, time.Minute)}, 0.5, 45 * time.Second},
+		{[]Option{WithReplicaSplay(1, 4, time.Minute), WithStartupDelay(10 * time.Second)}, 0.5, 20 * time.Second},
+	}
+	for idx, tc := range testCases {
+		actual := newJobConfig(tc.Options).Warmup.delay(tc.Random)
+		if actual != tc.Expected {
+			t.Errorf("test case %d: expected delay %s, but got %s", idx, tc.Expected, actual)
+		}
+	}
+}
+
+func TestWarmupIsInterruptedByContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := (&CronJob{
+		Metadata: JobMetadata{
+			ReadableName: "warmup test job",
+			CounterOpts:  prometheus.CounterOpts{Name: "warmup_test_job_runs", Help: "Hello World."},
+		},
+		Interval: time.Millisecond,
+		Task: func(context.Context, prometheus.Labels) error {
+			t.Error("task should not have been run")
+			return nil
+		},
+	}).Setup(prometheus.NewRegistry())
+
+	done := make(chan struct{})
+	go func() {
+		j.Run(ctx, WithReplicaSplay(1, 2, time.Hour))
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the context was cancelled")
+	}
+}
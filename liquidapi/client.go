@@ -107,6 +107,18 @@ func (c *Client) GetUsageReport(ctx context.Context, projectUUID string, req liq
 	return
 }
 
+// GetUsageReportDelta executes POST /v1/projects/:uuid/report-usage-delta.
+// This endpoint is only supported by liquids implementing IncrementalUsageLogic.
+func (c *Client) GetUsageReportDelta(ctx context.Context, projectUUID string, req UsageDeltaRequest) (result UsageDeltaReport, err error) {
+	url := c.ServiceURL("v1", "projects", projectUUID, "report-usage-delta")
+	opts := gophercloud.RequestOpts{KeepResponseBody: true, OkCodes: []int{http.StatusOK}}
+	resp, err := c.Post(ctx, url, req, nil, &opts)
+	if err == nil {
+		err = parseLiquidResponse(resp, &result)
+	}
+	return
+}
+
 // PutQuota executes PUT /v1/projects/:uuid/quota.
 func (c *Client) PutQuota(ctx context.Context, projectUUID string, req liquid.ServiceQuotaRequest) (err error) {
 	url := c.ServiceURL("v1", "projects", projectUUID, "quota")
@@ -0,0 +1,209 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package liquidapi
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sapcc/go-api-declarations/liquid"
+
+	"github.com/sapcc/go-bits/httpapi"
+	"github.com/sapcc/go-bits/respondwith"
+)
+
+// IncrementalUsageLogic is an optional extension of the Logic interface for
+// liquids where a full usage scan is very expensive (e.g. because large
+// projects contain many thousands of objects in the backend).
+//
+// If the Logic given to Run() implements this interface, the runtime serves
+// the additional endpoint "POST /v1/projects/:uuid/report-usage-delta" (see
+// type UsageDeltaRequest), which only rescans the resources that have changed
+// since the last report, as recorded in the UsageChangeTracker. The existing
+// "report-usage" endpoint continues to perform full scans.
+type IncrementalUsageLogic interface {
+	Logic
+
+	// UsageChangeTracker returns the tracker that records which resources
+	// have changed in which project. The logic is responsible for feeding it,
+	// e.g. by listening to event notifications from the backend. This is
+	// called once during Run().
+	UsageChangeTracker() UsageChangeTracker
+
+	// ScanUsageOfResources is like ScanUsage, but the returned report only
+	// needs to contain entries for the given resources. Rates and metrics may
+	// be omitted from the report.
+	ScanUsageOfResources(ctx context.Context, projectUUID string, resources []liquid.ResourceName, req liquid.ServiceUsageRequest, serviceInfo liquid.ServiceInfo) (liquid.ServiceUsageReport, error)
+}
+
+// UsageChangeTracker is the interface for a pluggable store that records
+// which resources have changed in which project. Each change is assigned a
+// serial number that increases monotonically. Clients of the
+// "report-usage-delta" endpoint remember the serial of their last report and
+// provide it in the next request.
+//
+// NewInMemoryUsageChangeTracker() provides a basic implementation. Liquids
+// with multiple replicas will need an implementation backed by a shared
+// database instead.
+type UsageChangeTracker interface {
+	// MarkChanged records that the usage of the given resources in the given
+	// project has changed.
+	MarkChanged(ctx context.Context, projectUUID string, resources ...liquid.ResourceName) error
+	// ChangesSince returns the resources in the given project that have
+	// changed after the given serial, as well as the current serial.
+	//
+	// If the tracker cannot reliably tell which changes occurred since the
+	// given serial (e.g. because the serial predates a restart of the
+	// process), `isComplete` shall be false. A full usage scan will be
+	// performed in this case.
+	ChangesSince(ctx context.Context, projectUUID string, serial uint64) (changed []liquid.ResourceName, currentSerial uint64, isComplete bool, err error)
+}
+
+// UsageDeltaRequest is the request payload format for
+// POST /v1/projects/:uuid/report-usage-delta. This endpoint is an extension
+// of the LIQUID protocol that is only provided by liquids implementing
+// IncrementalUsageLogic.
+type UsageDeltaRequest struct {
+	liquid.ServiceUsageRequest
+
+	// The Serial from the previous UsageDeltaReport for this project, or 0
+	// if there is none (in which case a full scan is performed).
+	SinceSerial uint64 `json:"sinceSerial"`
+}
+
+// UsageDeltaReport is the response payload format for
+// POST /v1/projects/:uuid/report-usage-delta.
+type UsageDeltaReport struct {
+	liquid.ServiceUsageReport
+
+	// The serial to be given as SinceSerial in the next UsageDeltaRequest.
+	Serial uint64 `json:"serial"`
+	// If true, a full scan was performed and the report contains all
+	// resources, rates and metrics. If false, the report only contains those
+	// resources that have changed since SinceSerial, and the client must
+	// retain the previously reported data for all other resources.
+	IsFullReport bool `json:"isFullReport"`
+}
+
+func (rt *runtime) handleReportUsageDelta(w http.ResponseWriter, r *http.Request) {
+	httpapi.IdentifyEndpoint(r, "/v1/projects/:id/report-usage-delta")
+	if !rt.requireToken(w, r, "liquid:get_usage") {
+		return
+	}
+	projectUUID := mux.Vars(r)["project_id"]
+
+	var req UsageDeltaRequest
+	if !requireJSON(w, r, &req) {
+		return
+	}
+
+	resp, err := buildUsageDeltaReport(r.Context(), rt.IncrementalLogic, rt.ChangeTracker, projectUUID, req, rt.getServiceInfo())
+	if respondwith.ErrorText(w, err) {
+		return
+	}
+	respondwith.JSON(w, http.StatusOK, resp)
+}
+
+func buildUsageDeltaReport(ctx context.Context, logic IncrementalUsageLogic, tracker UsageChangeTracker, projectUUID string, req UsageDeltaRequest, serviceInfo liquid.ServiceInfo) (UsageDeltaReport, error) {
+	// NOTE: The current serial is obtained before the scan, so that changes
+	// occurring during the scan will be picked up again by the next request.
+	changed, serial, isComplete, err := tracker.ChangesSince(ctx, projectUUID, req.SinceSerial)
+	if err != nil {
+		return UsageDeltaReport{}, err
+	}
+
+	if req.SinceSerial == 0 || !isComplete {
+		report, err := logic.ScanUsage(ctx, projectUUID, req.ServiceUsageRequest, serviceInfo)
+		return UsageDeltaReport{report, serial, true}, err
+	}
+
+	if len(changed) == 0 {
+		report := liquid.ServiceUsageReport{InfoVersion: serviceInfo.Version}
+		return UsageDeltaReport{report, serial, false}, nil
+	}
+	report, err := logic.ScanUsageOfResources(ctx, projectUUID, changed, req.ServiceUsageRequest, serviceInfo)
+	return UsageDeltaReport{report, serial, false}, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// in-memory implementation of UsageChangeTracker
+
+type inMemoryUsageChangeTracker struct {
+	mutex sync.Mutex
+	// serials start at the process start time to ensure that serials from
+	// before a restart are recognized as such
+	initialSerial uint64
+	currentSerial uint64
+	// lastChanged[projectUUID][resourceName] = serial of last change
+	lastChanged map[string]map[liquid.ResourceName]uint64
+}
+
+// NewInMemoryUsageChangeTracker returns a UsageChangeTracker that holds its
+// data in memory. After a restart of the process, all serials given out by
+// the previous process are reported as incomplete, thus causing one full scan
+// per project.
+func NewInMemoryUsageChangeTracker() UsageChangeTracker {
+	// NOTE: Microseconds are used instead of nanoseconds to keep serials
+	// below 2^53, so that they survive a roundtrip through a float64 in JSON
+	// parsers that do not support large integers.
+	serial := uint64(time.Now().UnixMicro()) //nolint:gosec // the current time is not negative
+	return &inMemoryUsageChangeTracker{
+		initialSerial: serial,
+		currentSerial: serial,
+		lastChanged:   make(map[string]map[liquid.ResourceName]uint64),
+	}
+}
+
+// MarkChanged implements the UsageChangeTracker interface.
+func (t *inMemoryUsageChangeTracker) MarkChanged(_ context.Context, projectUUID string, resources ...liquid.ResourceName) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.currentSerial++
+	if t.lastChanged[projectUUID] == nil {
+		t.lastChanged[projectUUID] = make(map[liquid.ResourceName]uint64)
+	}
+	for _, res := range resources {
+		t.lastChanged[projectUUID][res] = t.currentSerial
+	}
+	return nil
+}
+
+// ChangesSince implements the UsageChangeTracker interface.
+func (t *inMemoryUsageChangeTracker) ChangesSince(_ context.Context, projectUUID string, serial uint64) ([]liquid.ResourceName, uint64, bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if serial < t.initialSerial || serial > t.currentSerial {
+		return nil, t.currentSerial, false, nil
+	}
+	var changed []liquid.ResourceName
+	for res, lastChangedAt := range t.lastChanged[projectUUID] {
+		if lastChangedAt > serial {
+			changed = append(changed, res)
+		}
+	}
+	slices.Sort(changed)
+	return changed, t.currentSerial, true, nil
+}
@@ -0,0 +1,145 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package liquidapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/sapcc/go-api-declarations/liquid"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/httpapi"
+	"github.com/sapcc/go-bits/mock"
+	"github.com/sapcc/go-bits/must"
+)
+
+type incrementalTestLogic struct {
+	tracker      UsageChangeTracker
+	scannedFully int
+}
+
+func (l *incrementalTestLogic) Init(ctx context.Context, provider *gophercloud.ProviderClient, eo gophercloud.EndpointOpts) error {
+	return nil
+}
+
+func (l *incrementalTestLogic) BuildServiceInfo(ctx context.Context) (liquid.ServiceInfo, error) {
+	return liquid.ServiceInfo{Version: 42}, nil
+}
+
+func (l *incrementalTestLogic) ScanCapacity(ctx context.Context, req liquid.ServiceCapacityRequest, serviceInfo liquid.ServiceInfo) (liquid.ServiceCapacityReport, error) {
+	return liquid.ServiceCapacityReport{InfoVersion: serviceInfo.Version}, nil
+}
+
+func (l *incrementalTestLogic) ScanUsage(ctx context.Context, projectUUID string, req liquid.ServiceUsageRequest, serviceInfo liquid.ServiceInfo) (liquid.ServiceUsageReport, error) {
+	l.scannedFully++
+	return l.ScanUsageOfResources(ctx, projectUUID, []liquid.ResourceName{"bar", "foo"}, req, serviceInfo)
+}
+
+func (l *incrementalTestLogic) SetQuota(ctx context.Context, projectUUID string, req liquid.ServiceQuotaRequest, serviceInfo liquid.ServiceInfo) error {
+	return nil
+}
+
+func (l *incrementalTestLogic) UsageChangeTracker() UsageChangeTracker {
+	return l.tracker
+}
+
+func (l *incrementalTestLogic) ScanUsageOfResources(ctx context.Context, projectUUID string, resources []liquid.ResourceName, req liquid.ServiceUsageRequest, serviceInfo liquid.ServiceInfo) (liquid.ServiceUsageReport, error) {
+	report := liquid.ServiceUsageReport{
+		InfoVersion: serviceInfo.Version,
+		Resources:   make(map[liquid.ResourceName]*liquid.ResourceUsageReport),
+	}
+	for _, res := range resources {
+		report.Resources[res] = &liquid.ResourceUsageReport{
+			PerAZ: liquid.InAnyAZ(liquid.AZResourceUsageReport{Usage: 5}),
+		}
+	}
+	return report, nil
+}
+
+func TestIncrementalUsageReport(t *testing.T) {
+	ctx := context.Background()
+	logic := &incrementalTestLogic{tracker: NewInMemoryUsageChangeTracker()}
+	serviceInfo := must.ReturnT(logic.BuildServiceInfo(ctx))(t)
+	rt := &runtime{
+		Logic:            logic,
+		IncrementalLogic: logic,
+		ChangeTracker:    logic.tracker,
+		ServiceInfo:      serviceInfo,
+		TokenValidator:   mock.NewValidator(mock.NewEnforcer(), nil),
+	}
+	h := httpapi.Compose(rt, httpapi.WithoutLogging())
+
+	resourceReport := assert.JSONObject{
+		"forbidden": false,
+		"perAZ":     assert.JSONObject{"any": assert.JSONObject{"usage": 5}},
+	}
+
+	// without a previous serial, a full scan is performed
+	resp := must.ReturnT(buildUsageDeltaReport(ctx, logic, logic.tracker, "project1", UsageDeltaRequest{}, serviceInfo))(t)
+	assert.DeepEqual(t, "IsFullReport", resp.IsFullReport, true)
+	assert.DeepEqual(t, "scannedFully", logic.scannedFully, 1)
+	serial := resp.Serial
+	assert.HTTPRequest{
+		Method:       "POST",
+		Path:         "/v1/projects/project1/report-usage-delta",
+		Body:         assert.JSONObject{"allAZs": []string{"az-one"}},
+		ExpectStatus: http.StatusOK,
+		ExpectBody: assert.JSONObject{
+			"infoVersion":  42,
+			"resources":    assert.JSONObject{"bar": resourceReport, "foo": resourceReport},
+			"serial":       serial,
+			"isFullReport": true,
+		},
+	}.Check(t, h)
+
+	// without changes, an empty report is returned
+	assert.HTTPRequest{
+		Method:       "POST",
+		Path:         "/v1/projects/project1/report-usage-delta",
+		Body:         assert.JSONObject{"allAZs": []string{"az-one"}, "sinceSerial": serial},
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.JSONObject{"infoVersion": 42, "serial": serial, "isFullReport": false},
+	}.Check(t, h)
+
+	// changes in other projects are not reported
+	must.SucceedT(t, logic.tracker.MarkChanged(ctx, "project2", "foo"))
+	must.SucceedT(t, logic.tracker.MarkChanged(ctx, "project1", "bar"))
+	assert.HTTPRequest{
+		Method:       "POST",
+		Path:         "/v1/projects/project1/report-usage-delta",
+		Body:         assert.JSONObject{"allAZs": []string{"az-one"}, "sinceSerial": serial},
+		ExpectStatus: http.StatusOK,
+		ExpectBody: assert.JSONObject{
+			"infoVersion":  42,
+			"resources":    assert.JSONObject{"bar": resourceReport},
+			"serial":       serial + 2,
+			"isFullReport": false,
+		},
+	}.Check(t, h)
+	assert.DeepEqual(t, "scannedFully", logic.scannedFully, 2)
+
+	// serials that the tracker does not know about cause a full scan
+	resp = must.ReturnT(buildUsageDeltaReport(ctx, logic, logic.tracker, "project1", UsageDeltaRequest{SinceSerial: 23}, serviceInfo))(t)
+	assert.DeepEqual(t, "IsFullReport", resp.IsFullReport, true)
+	assert.DeepEqual(t, "scannedFully", logic.scannedFully, 3)
+}
@@ -111,6 +111,8 @@ type RunOpts struct {
 
 type runtime struct {
 	Logic            Logic
+	IncrementalLogic IncrementalUsageLogic // only set if Logic implements this interface
+	ChangeTracker    UsageChangeTracker    // only set if IncrementalLogic is set
 	ServiceInfo      liquid.ServiceInfo
 	ServiceInfoMutex sync.RWMutex
 	TokenValidator   gopherpolicy.Validator
@@ -130,6 +132,10 @@ type runtime struct {
 //   - "liquid:get_usage" (object parameter "project_uuid")
 //   - "liquid:set_quota" (object parameter "project_uuid")
 //
+// If the Logic also implements IncrementalUsageLogic, an additional endpoint
+// for incremental usage reports is served. Refer to the documentation on that
+// interface for details.
+//
 // Please refer to the documentation on type RunOpts for various other
 // behaviors that this function provides.
 func Run(ctx context.Context, logic Logic, opts RunOpts) error {
@@ -192,6 +198,10 @@ func Run(ctx context.Context, logic Logic, opts RunOpts) error {
 		ServiceInfo:    serviceInfo,
 		TokenValidator: tv,
 	}
+	if incrementalLogic, ok := logic.(IncrementalUsageLogic); ok {
+		rt.IncrementalLogic = incrementalLogic
+		rt.ChangeTracker = incrementalLogic.UsageChangeTracker()
+	}
 
 	// if necessary, start a goroutine that polls for ServiceInfo updates
 	// (this requires some concurrency infrastructure to translate errors from
@@ -294,6 +304,9 @@ func (rt *runtime) AddTo(r *mux.Router) {
 	r.Methods("POST").Path("/v1/report-capacity").HandlerFunc(rt.handleReportCapacity)
 	r.Methods("POST").Path("/v1/projects/{project_id}/report-usage").HandlerFunc(rt.handleReportUsage)
 	r.Methods("PUT").Path("/v1/projects/{project_id}/quota").HandlerFunc(rt.handleSetQuota)
+	if rt.IncrementalLogic != nil {
+		r.Methods("POST").Path("/v1/projects/{project_id}/report-usage-delta").HandlerFunc(rt.handleReportUsageDelta)
+	}
 }
 
 func (rt *runtime) handleGetInfo(w http.ResponseWriter, r *http.Request) {
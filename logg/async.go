@@ -0,0 +1,225 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package logg
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AsyncWriter is an io.Writer that writes to another io.Writer in a
+// background goroutine, so that log calls never block on slow log sinks
+// (e.g. a stderr pipe that is not read fast enough during a logging burst).
+//
+// Lines are buffered in a queue of bounded size. When the queue is full, new
+// lines are dropped instead of blocking the caller, and counted (see
+// Dropped()). Once the queue has drained (or at least every 10 seconds during
+// a longer burst), a line like "WARNING: dropped 42 log lines because the log
+// queue was full" is written to the underlying writer. Since this line does not
+// go through the logger, it does not have the logger's prefix or timestamp.
+// Lines that are not dropped are written in the order in which they were given
+// to Write(), so the ordering of log lines from each goroutine is preserved.
+//
+// To use it with this package, give it to the logger:
+//
+//	w := logg.NewAsyncWriter(os.Stderr, 10000)
+//	defer w.Close()
+//	logg.SetLogger(log.New(w, log.Prefix(), log.Flags()))
+//
+// Fatal() flushes an AsyncWriter used in this way before terminating the
+// program, but waits at most 5 seconds for a stuck log sink.
+type AsyncWriter struct {
+	inner   io.Writer
+	queue   chan asyncWriterItem
+	done    chan struct{}
+	dropped atomic.Uint64
+	// closed is protected by mutex; Write() holds a read lock while enqueuing,
+	// so that Close() can close the queue safely
+	mutex  sync.RWMutex
+	closed bool
+	// serializes direct writes to `inner` after Close()
+	innerMutex sync.Mutex
+}
+
+const (
+	// How long Fatal() waits for an AsyncWriter to be flushed.
+	fatalFlushTimeout = 5 * time.Second
+	// How often Flush() retries enqueuing its marker while the queue is full.
+	flushRetryInterval = 10 * time.Millisecond
+	// How often dropped lines are reported at most while the queue is not empty.
+	droppedReportInterval = 10 * time.Second
+)
+
+type asyncWriterItem struct {
+	line    []byte
+	flushed chan struct{} // only set for flush markers
+}
+
+// NewAsyncWriter creates an AsyncWriter that writes to the given writer, and
+// buffers up to `queueSize` lines. It starts a goroutine that runs until Close() is called.
+func NewAsyncWriter(inner io.Writer, queueSize int) *AsyncWriter {
+	if queueSize <= 0 {
+		panic("NewAsyncWriter() called with non-positive queue size")
+	}
+	w := &AsyncWriter{
+		inner: inner,
+		queue: make(chan asyncWriterItem, queueSize),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	var (
+		reportedDrops uint64
+		lastReport    = time.Now()
+	)
+	for item := range w.queue {
+		if item.flushed == nil {
+			_, _ = w.inner.Write(item.line) // errors are ignored, same as in stdlog.Logger.Println()
+		}
+
+		// report dropped lines once the burst that caused them is over (or
+		// periodically if the burst does not end), but before a flush marker
+		// is acknowledged, so that Flush() also covers the report
+		dropped := w.dropped.Load()
+		if dropped > reportedDrops && (len(w.queue) == 0 || time.Since(lastReport) >= droppedReportInterval) {
+			_, _ = fmt.Fprintf(w.inner, "WARNING: dropped %d log lines because the log queue was full\n", dropped-reportedDrops)
+			reportedDrops = dropped
+			lastReport = time.Now()
+		}
+
+		if item.flushed != nil {
+			close(item.flushed)
+		}
+	}
+}
+
+// Write implements the io.Writer interface. It never blocks on the
+// underlying writer and always reports success. After Close(), writes go to
+// the underlying writer directly.
+func (w *AsyncWriter) Write(buf []byte) (int, error) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if w.closed {
+		// wait for the queue to be drained, so that lines stay in order
+		<-w.done
+		w.innerMutex.Lock()
+		defer w.innerMutex.Unlock()
+		return w.inner.Write(buf)
+	}
+
+	// the caller may reuse `buf` after we return (stdlog.Logger does this)
+	line := append([]byte(nil), buf...)
+	select {
+	case w.queue <- asyncWriterItem{line: line}:
+	default:
+		w.dropped.Add(1)
+	}
+	return len(buf), nil
+}
+
+// Dropped returns the number of lines that were dropped so far because the queue was full.
+func (w *AsyncWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Flush blocks until all lines that were written before this call have been
+// written to the underlying writer, or until the given timeout has passed.
+// Returns whether all lines have been written.
+func (w *AsyncWriter) Flush(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// while the queue is full, retry instead of blocking on the send, since
+	// holding the read lock for that long would block Close() (and, because
+	// of the pending Close(), also all Write() calls)
+	flushed := make(chan struct{})
+	for {
+		enqueued, closed := w.tryEnqueue(asyncWriterItem{flushed: flushed})
+		if closed {
+			select {
+			case <-w.done:
+				return true
+			case <-timer.C:
+				return false
+			}
+		}
+		if enqueued {
+			break
+		}
+		select {
+		case <-time.After(flushRetryInterval):
+		case <-timer.C:
+			return false
+		}
+	}
+
+	select {
+	case <-flushed:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Enqueues the given item if the queue has room for it. Returns whether the
+// item was enqueued, and whether the queue was closed already.
+func (w *AsyncWriter) tryEnqueue(item asyncWriterItem) (enqueued, closed bool) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if w.closed {
+		return false, true
+	}
+	select {
+	case w.queue <- item:
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// Close writes all queued lines to the underlying writer, and stops the
+// background goroutine. The underlying writer is not closed.
+func (w *AsyncWriter) Close() error {
+	w.mutex.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mutex.Unlock()
+	<-w.done
+	return nil
+}
+
+// Flushes the logger's writer before the program terminates, if it is an AsyncWriter.
+func flushLogger() {
+	mu.Lock()
+	logger := log
+	mu.Unlock()
+	if w, ok := logger.Writer().(*AsyncWriter); ok {
+		w.Flush(fatalFlushTimeout)
+	}
+}
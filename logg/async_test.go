@@ -0,0 +1,219 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package logg
+
+import (
+	"bytes"
+	"fmt"
+	stdlog "log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A writer that blocks until released, to simulate a slow log sink.
+type blockingWriter struct {
+	release chan struct{}
+	mutex   sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.buf.Write(p)
+}
+
+func TestAsyncWriterOrdering(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAsyncWriter(&buf, 10000)
+	logger := stdlog.New(w, "", 0)
+
+	// lines from concurrent goroutines may be interleaved, but each
+	// goroutine's lines must appear in order
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				logger.Printf("goroutine %d line %d", g, i)
+			}
+		}()
+	}
+	wg.Wait()
+	if !w.Flush(time.Minute) {
+		t.Fatal("Flush() timed out")
+	}
+
+	nextLine := make(map[int]int)
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var g, i int
+		_, err := fmt.Sscanf(line, "goroutine %d line %d", &g, &i)
+		if err != nil {
+			t.Fatalf("unexpected line %q: %s", line, err.Error())
+		}
+		if i != nextLine[g] {
+			t.Errorf("expected line %d from goroutine %d, but got line %d", nextLine[g], g, i)
+		}
+		nextLine[g] = i + 1
+	}
+	for g := range 4 {
+		if nextLine[g] != 100 {
+			t.Errorf("expected 100 lines from goroutine %d, but got %d", g, nextLine[g])
+		}
+	}
+	if w.Dropped() != 0 {
+		t.Errorf("expected no dropped lines, but got %d", w.Dropped())
+	}
+	w.Close()
+}
+
+func TestAsyncWriterDropsWhenFull(t *testing.T) {
+	inner := &blockingWriter{release: make(chan struct{})}
+	w := NewAsyncWriter(inner, 2)
+
+	// the first line is taken by the background goroutine (which then blocks
+	// on the inner writer), the next two fill the queue, and the rest are
+	// dropped; none of these calls may block
+	must := func(n int, err error) {
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	must(w.Write([]byte("line 1\n")))
+	for w.Dropped() == 0 {
+		// wait until the background goroutine has picked up the first line and the queue is full
+		must(w.Write([]byte("filler\n")))
+	}
+	dropped := w.Dropped()
+
+	close(inner.release)
+	if !w.Flush(time.Minute) {
+		t.Fatal("Flush() timed out")
+	}
+	must(w.Write([]byte("last line\n")))
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(inner.buf.String(), "\n"), "\n")
+	if lines[0] != "line 1" || lines[len(lines)-1] != "last line" {
+		t.Errorf("unexpected output: %q", inner.buf.String())
+	}
+	if dropped == 0 || w.Dropped() < dropped {
+		t.Errorf("expected dropped lines to be counted, but got %d", w.Dropped())
+	}
+	expectedReport := fmt.Sprintf("WARNING: dropped %d log lines because the log queue was full\n", w.Dropped())
+	if !strings.Contains(inner.buf.String(), expectedReport) {
+		t.Errorf("expected report of dropped lines %q, but got %q", expectedReport, inner.buf.String())
+	}
+
+	// after Close(), writes go through directly
+	must(w.Write([]byte("after close\n")))
+	if !strings.HasSuffix(inner.buf.String(), "after close\n") {
+		t.Errorf("expected write after Close() to go through, but got %q", inner.buf.String())
+	}
+}
+
+func TestAsyncWriterWithStuckSink(t *testing.T) {
+	inner := &blockingWriter{release: make(chan struct{})}
+	w := NewAsyncWriter(inner, 1)
+
+	// Flush() gives up when the sink does not make progress
+	_, _ = w.Write([]byte("line 1\n"))
+	_, _ = w.Write([]byte("line 2\n"))
+	if w.Flush(10 * time.Millisecond) {
+		t.Error("expected Flush() to time out, but it reported success")
+	}
+
+	close(inner.release)
+	if !w.Flush(time.Minute) {
+		t.Error("expected Flush() to succeed after the sink was released, but it timed out")
+	}
+	must := func(n int, err error) {
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	must(0, w.Close())
+
+	// concurrent writes after Close() are serialized (this is checked by the race detector)
+	var buf bytes.Buffer
+	w = NewAsyncWriter(&buf, 10)
+	must(0, w.Close())
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			must(w.Write([]byte("line\n")))
+		}()
+	}
+	wg.Wait()
+	if buf.String() != strings.Repeat("line\n", 4) {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestAsyncWriterFlushDoesNotBlockClose(t *testing.T) {
+	inner := &blockingWriter{release: make(chan struct{})}
+	w := NewAsyncWriter(inner, 1)
+	for w.Dropped() == 0 {
+		// wait until the background goroutine is stuck on the inner writer and the queue is full
+		_, _ = w.Write([]byte("filler\n"))
+	}
+
+	// Flush() has to wait for the queue to have room...
+	flushResult := make(chan bool)
+	go func() {
+		flushResult <- w.Flush(time.Minute)
+	}()
+	time.Sleep(5 * flushRetryInterval)
+
+	// ...but must not prevent Close() from closing the queue in the meantime
+	closeDone := make(chan struct{})
+	go func() {
+		_ = w.Close()
+		close(closeDone)
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		w.mutex.RLock()
+		closed := w.closed
+		w.mutex.RUnlock()
+		if closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Close() was blocked by Flush()")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(inner.release)
+	<-closeDone
+	if !<-flushResult {
+		t.Error("expected Flush() to succeed after Close(), but it timed out")
+	}
+}
@@ -0,0 +1,63 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package logg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
+
+// ShowErrorFingerprints can be set to true to append a fingerprint to each
+// message logged with level ERROR or FATAL, as a field of the form
+// `fingerprint="0123456789abcdef"` at the end of the log line. See
+// Fingerprint() for how the fingerprint is computed.
+//
+// Alerting rules and dashboards can use this field to group identical errors
+// across processes, services and releases.
+var ShowErrorFingerprints = false
+
+var fingerprintNormalizers = []struct {
+	rx          *regexp.Regexp
+	replacement string
+}{
+	// order matters: UUIDs and hex strings contain digits, so they must be replaced before numbers
+	{regexp.MustCompile(`"(?:[^"\\]|\\.)*"`), `"<str>"`},
+	{regexp.MustCompile(`'(?:[^'\\]|\\.)*'`), `'<str>'`},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), `<uuid>`},
+	{regexp.MustCompile(`(?i)\b(?:0x)?[0-9a-f]*[0-9][0-9a-f]*[a-f][0-9a-f]*\b|\b(?:0x)?[0-9a-f]*[a-f][0-9a-f]*[0-9][0-9a-f]*\b`), `<hex>`},
+	{regexp.MustCompile(`\d+(?:\.\d+)*`), `<num>`},
+}
+
+// Fingerprint computes a stable fingerprint for the given log message. The
+// message is normalized before hashing by replacing parts that usually vary
+// between occurrences of the same error (quoted strings, UUIDs, hexadecimal
+// IDs and numbers) with placeholders. For example, the following messages
+// have the same fingerprint:
+//
+//	could not delete project "foo": got 503 response after 1.2s
+//	could not delete project "bar": got 504 response after 3s
+func Fingerprint(msg string) string {
+	for _, n := range fingerprintNormalizers {
+		msg = n.rx.ReplaceAllString(msg, n.replacement)
+	}
+	sum := sha256.Sum256([]byte(msg))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,80 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package logg
+
+import (
+	"bytes"
+	stdlog "log"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	groups := [][]string{
+		{
+			`could not delete project "foo": got 503 response after 1.2s`,
+			`could not delete project "bar": got 504 response after 3s`,
+		},
+		{
+			`cannot find share 8f0b5a7e-3b1c-4f8e-9d2a-6c4e1f0a9b3d in backend`,
+			`cannot find share 0C4E1F0A-9B3D-4F8E-9D2A-8F0B5A7E3B1C in backend`,
+		},
+		{
+			`commit deadbeef42 not found in 'my-repo'`,
+			`commit 0123abcd not found in 'other-repo'`,
+		},
+		{
+			`cannot reach database`,
+		},
+	}
+
+	seen := make(map[string]int)
+	for idx, group := range groups {
+		expected := Fingerprint(group[0])
+		if len(expected) != 16 {
+			t.Errorf("expected a fingerprint with 16 characters, but got %q", expected)
+		}
+		for _, msg := range group[1:] {
+			actual := Fingerprint(msg)
+			if actual != expected {
+				t.Errorf("expected fingerprint of %q to be %q (same as for %q), but got %q", msg, expected, group[0], actual)
+			}
+		}
+		if otherIdx, exists := seen[expected]; exists {
+			t.Errorf("expected groups %d and %d to have different fingerprints, but both have %q", otherIdx, idx, expected)
+		}
+		seen[expected] = idx
+	}
+}
+
+func TestShowErrorFingerprints(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(stdlog.New(&buf, "", 0))
+	ShowErrorFingerprints = true
+	defer func() { ShowErrorFingerprints = false }()
+
+	Error("could not frobnicate %d widgets", 42)
+	Info("frobnicated %d widgets", 23)
+
+	expected := `ERROR: could not frobnicate 42 widgets fingerprint="` + Fingerprint("could not frobnicate 1 widgets") + `"` + "\n" +
+		"INFO: frobnicated 23 widgets\n"
+	if buf.String() != expected {
+		t.Errorf("expected log output %q, but got %q", expected, buf.String())
+	}
+}
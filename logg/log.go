@@ -38,6 +38,7 @@
 package logg
 
 import (
+	"fmt"
 	stdlog "log"
 	"os"
 	"strings"
@@ -60,38 +61,46 @@ func SetLogger(l *stdlog.Logger) {
 
 // Fatal logs a fatal error and terminates the program.
 func Fatal(msg string, args ...any) {
-	doLog("FATAL: "+msg, args)
+	doLog("FATAL", msg, args)
+	flushLogger()
 	os.Exit(1)
 }
 
 // Error logs a non-fatal error.
 func Error(msg string, args ...any) {
-	doLog("ERROR: "+msg, args)
+	doLog("ERROR", msg, args)
 }
 
 // Info logs an informational message.
 func Info(msg string, args ...any) {
-	doLog("INFO: "+msg, args)
+	doLog("INFO", msg, args)
 }
 
 // Debug logs a debug message if debug logging is enabled.
 func Debug(msg string, args ...any) {
 	if ShowDebug {
-		doLog("DEBUG: "+msg, args)
+		doLog("DEBUG", msg, args)
 	}
 }
 
 // Other logs a message with a custom log level.
 func Other(level, msg string, args ...any) {
-	doLog(level+": "+msg, args)
+	doLog(level, msg, args)
 }
 
-func doLog(msg string, args []any) {
+func doLog(level, msg string, args []any) {
 	msg = strings.TrimSpace(msg)               // most importantly, skip trailing '\n'
 	msg = strings.ReplaceAll(msg, "\n", "\\n") // avoid multiline log messages
 	if len(args) > 0 {
-		log.Printf(msg+"\n", args...)
-	} else {
-		log.Println(msg)
+		msg = fmt.Sprintf(msg, args...)
 	}
+
+	level, ok := applyLevelOverrides(level, msg)
+	if !ok {
+		return
+	}
+	if ShowErrorFingerprints && (level == "ERROR" || level == "FATAL") {
+		msg += ` fingerprint="` + Fingerprint(msg) + `"`
+	}
+	writeLine(log, level+": "+msg)
 }
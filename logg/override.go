@@ -0,0 +1,114 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package logg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// LevelOverride changes the log level of all messages with the given Level
+// whose text (after formatting, and without the level prefix) starts with the
+// given MessagePrefix. An empty MessagePrefix matches all messages of that
+// level.
+//
+// If NewLevel is empty, matching messages are suppressed entirely. If
+// NewLevel is "DEBUG", matching messages are only shown when ShowDebug is set.
+//
+// This is mostly useful for silencing a known-noisy message temporarily without
+// having to redeploy. For example:
+//
+//	logg.SetLevelOverrides([]logg.LevelOverride{
+//		// downgrade a known-noisy error to an informational message
+//		{Level: "ERROR", MessagePrefix: "cannot reach upstream:", NewLevel: "INFO"},
+//		// suppress the request log written by package httpapi
+//		{Level: "REQUEST"},
+//	})
+type LevelOverride struct {
+	Level         string `json:"level"`
+	MessagePrefix string `json:"prefix"`
+	NewLevel      string `json:"new_level"`
+}
+
+var (
+	overrides   []LevelOverride
+	overridesMu sync.RWMutex
+)
+
+// SetLevelOverrides replaces the set of active log level overrides. If
+// multiple overrides match the same message, the first one wins. Passing an
+// empty slice removes all overrides.
+func SetLevelOverrides(list []LevelOverride) {
+	list = append([]LevelOverride(nil), list...) // defense against the caller modifying the slice later
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	overrides = list
+}
+
+// GetLevelOverrides returns the set of active log level overrides.
+func GetLevelOverrides() []LevelOverride {
+	overridesMu.RLock()
+	defer overridesMu.RUnlock()
+	return append([]LevelOverride{}, overrides...)
+}
+
+// LoadLevelOverridesFromEnv reads a JSON-encoded list of LevelOverride
+// objects from the given environment variable and activates it using
+// SetLevelOverrides(). If the environment variable is empty, no change is made.
+//
+//	$ export MYAPP_LOG_LEVEL_OVERRIDES='[{"level":"ERROR","prefix":"known-noisy error:","new_level":"INFO"}]'
+func LoadLevelOverridesFromEnv(key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	var list []LevelOverride
+	err := json.Unmarshal([]byte(value), &list)
+	if err != nil {
+		return fmt.Errorf("while parsing %s: %w", key, err)
+	}
+	SetLevelOverrides(list)
+	return nil
+}
+
+// Returns the level with which the given message shall be logged, or false if
+// the message shall not be logged.
+func applyLevelOverrides(level, msg string) (string, bool) {
+	overridesMu.RLock()
+	defer overridesMu.RUnlock()
+
+	for _, o := range overrides {
+		if o.Level == level && strings.HasPrefix(msg, o.MessagePrefix) {
+			switch o.NewLevel {
+			case "":
+				return "", false
+			case "DEBUG":
+				return o.NewLevel, ShowDebug
+			default:
+				return o.NewLevel, true
+			}
+		}
+	}
+	return level, true
+}
@@ -0,0 +1,96 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package logg
+
+import (
+	"bytes"
+	stdlog "log"
+	"reflect"
+	"testing"
+)
+
+func TestLoadLevelOverridesFromEnv(t *testing.T) {
+	defer SetLevelOverrides(nil)
+
+	// an empty variable does not change the active overrides
+	previous := []LevelOverride{{Level: "INFO", MessagePrefix: "previous"}}
+	SetLevelOverrides(previous)
+	t.Setenv("TEST_LOG_LEVEL_OVERRIDES", "")
+	err := LoadLevelOverridesFromEnv("TEST_LOG_LEVEL_OVERRIDES")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if actual := GetLevelOverrides(); !reflect.DeepEqual(actual, previous) {
+		t.Errorf("expected overrides %#v, but got %#v", previous, actual)
+	}
+
+	// invalid values are rejected without changing the active overrides
+	for _, value := range []string{
+		`not json`,
+		`{"level":"ERROR","new_level":"INFO"}`,
+		`[{"level":42}]`,
+	} {
+		t.Setenv("TEST_LOG_LEVEL_OVERRIDES", value)
+		err := LoadLevelOverridesFromEnv("TEST_LOG_LEVEL_OVERRIDES")
+		if err == nil {
+			t.Errorf("expected error for %q, but got none", value)
+		}
+		if actual := GetLevelOverrides(); !reflect.DeepEqual(actual, previous) {
+			t.Errorf("expected overrides %#v after parsing %q, but got %#v", previous, value, actual)
+		}
+	}
+
+	// a valid value replaces the active overrides
+	t.Setenv("TEST_LOG_LEVEL_OVERRIDES", `[
+		{"level":"ERROR","prefix":"cannot reach upstream:","new_level":"INFO"},
+		{"level":"ERROR","prefix":"cannot","new_level":"DEBUG"},
+		{"level":"REQUEST"}
+	]`)
+	err = LoadLevelOverridesFromEnv("TEST_LOG_LEVEL_OVERRIDES")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []LevelOverride{
+		{Level: "ERROR", MessagePrefix: "cannot reach upstream:", NewLevel: "INFO"},
+		{Level: "ERROR", MessagePrefix: "cannot", NewLevel: "DEBUG"},
+		{Level: "REQUEST"},
+	}
+	if actual := GetLevelOverrides(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected overrides %#v, but got %#v", expected, actual)
+	}
+
+	// if multiple overrides match, the first one wins; messages that are
+	// downgraded to DEBUG are hidden since ShowDebug is not set; messages that
+	// do not match any override are logged unchanged
+	var buf bytes.Buffer
+	SetLogger(stdlog.New(&buf, "", 0))
+	Error("cannot reach upstream: connection refused")
+	Error("cannot find widget")
+	Error("widget is broken")
+	Other("REQUEST", "GET /v1/widgets")
+	Other("WARNING", "cannot find gadget")
+
+	expectedOutput := "INFO: cannot reach upstream: connection refused\n" +
+		"ERROR: widget is broken\n" +
+		"WARNING: cannot find gadget\n"
+	if buf.String() != expectedOutput {
+		t.Errorf("expected log output %q, but got %q", expectedOutput, buf.String())
+	}
+}
@@ -0,0 +1,147 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package logg
+
+import (
+	stdlog "log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// TimestampRFC3339Nano can be used as TimestampOptions.Format to render
+	// timestamps like "2006-01-02T15:04:05.999999999Z07:00".
+	TimestampRFC3339Nano = time.RFC3339Nano
+	// TimestampEpochMillis can be used as TimestampOptions.Format to render
+	// timestamps as the number of milliseconds since the Unix epoch.
+	TimestampEpochMillis = "epoch-millis"
+
+	// the layout used by the stdlog flags Ldate|Ltime
+	stdlogTimestampLayout = "2006/01/02 15:04:05"
+)
+
+// TimestampOptions configures how timestamps are rendered at the start of
+// each log line. See SetTimestampOptions() for details.
+type TimestampOptions struct {
+	// Either TimestampRFC3339Nano, TimestampEpochMillis, or any layout string
+	// accepted by time.Time.Format(). If empty, the stdlog format
+	// ("2006/01/02 15:04:05") is used.
+	Format string
+	// The timezone that timestamps are converted into before rendering. If
+	// nil, time.Local is used. Use time.UTC to log in UTC.
+	Location *time.Location
+}
+
+var (
+	timestampOpts   *TimestampOptions
+	timestampOptsMu sync.RWMutex
+)
+
+// SetTimestampOptions configures how timestamps are rendered in log lines.
+// Once this is called, logg renders timestamps by itself and ignores the
+// date/time flags (Ldate, Ltime, Lmicroseconds, LUTC) of the logger given to
+// SetLogger(). For example:
+//
+//	logg.SetTimestampOptions(logg.TimestampOptions{
+//		Format:   logg.TimestampRFC3339Nano,
+//		Location: time.UTC,
+//	})
+//	logg.Info("starting up")
+//	// output: 2006-01-02T15:04:05.123456789Z INFO: starting up
+//
+// Passing nil restores the default behavior of rendering timestamps as
+// configured in the logger's flags.
+func SetTimestampOptions(opts *TimestampOptions) {
+	if opts != nil {
+		cloned := *opts // defense against the caller modifying the struct later
+		opts = &cloned
+	}
+	timestampOptsMu.Lock()
+	defer timestampOptsMu.Unlock()
+	timestampOpts = opts
+}
+
+// FormatTimestamp renders the given timestamp in the format configured with
+// SetTimestampOptions(). This is intended for other log writers that shall
+// render timestamps consistently with this package.
+func FormatTimestamp(t time.Time) string {
+	timestampOptsMu.RLock()
+	opts := timestampOpts
+	timestampOptsMu.RUnlock()
+	if opts == nil {
+		opts = &TimestampOptions{}
+	}
+	return opts.render(t)
+}
+
+func (opts TimestampOptions) render(t time.Time) string {
+	if opts.Location == nil {
+		t = t.In(time.Local)
+	} else {
+		t = t.In(opts.Location)
+	}
+
+	switch opts.Format {
+	case "":
+		return t.Format(stdlogTimestampLayout)
+	case TimestampEpochMillis:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	default:
+		return t.Format(opts.Format)
+	}
+}
+
+// The calldepth for stdlog.Logger.Output() in writeLine(), such that Lshortfile
+// and Llongfile report the caller of the public logging function (writeLine ->
+// doLog -> Info/Error/etc. -> caller).
+const writeLineCallDepth = 4
+
+// Serializes writes in writeLine() when timestamp options are configured.
+var writeLineMutex sync.Mutex
+
+// Writes the given line to the logger. If timestamp options are configured,
+// the timestamp is rendered here instead of by the logger.
+func writeLine(logger *stdlog.Logger, line string) {
+	timestampOptsMu.RLock()
+	opts := timestampOpts
+	timestampOptsMu.RUnlock()
+	if opts == nil {
+		_ = logger.Output(writeLineCallDepth, line) // errors are ignored, same as in stdlog.Logger.Println()
+		return
+	}
+
+	// to avoid the logger adding its own timestamp, we write through a temporary
+	// logger with the same settings except for the date/time flags; the
+	// timestamp is placed where the original logger would place it
+	ts := opts.render(time.Now())
+	flags := logger.Flags()
+	prefix, msg := logger.Prefix()+ts+" ", line
+	if flags&stdlog.Lmsgprefix != 0 {
+		prefix, msg = ts+" ", logger.Prefix()+line
+	}
+	flags &^= stdlog.Ldate | stdlog.Ltime | stdlog.Lmicroseconds | stdlog.LUTC | stdlog.Lmsgprefix
+	tmpLogger := stdlog.New(logger.Writer(), prefix, flags)
+
+	// the temporary logger does not share the mutex of the original logger, so we need to serialize writes ourselves
+	writeLineMutex.Lock()
+	defer writeLineMutex.Unlock()
+	_ = tmpLogger.Output(writeLineCallDepth, msg) // errors are ignored, same as in stdlog.Logger.Println()
+}
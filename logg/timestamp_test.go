@@ -0,0 +1,105 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package logg
+
+import (
+	"bytes"
+	stdlog "log"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	ts := time.Date(2025, 3, 14, 15, 9, 26, 535897932, time.UTC)
+	cet := time.FixedZone("CET", 3600)
+	defer SetTimestampOptions(nil)
+
+	testCases := []struct {
+		Options  *TimestampOptions
+		Expected string
+	}{
+		{&TimestampOptions{Location: time.UTC}, "2025/03/14 15:09:26"},
+		{&TimestampOptions{Location: cet}, "2025/03/14 16:09:26"},
+		{&TimestampOptions{Format: TimestampRFC3339Nano, Location: time.UTC}, "2025-03-14T15:09:26.535897932Z"},
+		{&TimestampOptions{Format: TimestampRFC3339Nano, Location: cet}, "2025-03-14T16:09:26.535897932+01:00"},
+		{&TimestampOptions{Format: TimestampEpochMillis, Location: cet}, "1741964966535"},
+		{&TimestampOptions{Format: time.Kitchen, Location: time.UTC}, "3:09PM"},
+	}
+	for _, tc := range testCases {
+		SetTimestampOptions(tc.Options)
+		actual := FormatTimestamp(ts)
+		if actual != tc.Expected {
+			t.Errorf("expected %#v to render %q, but got %q", *tc.Options, tc.Expected, actual)
+		}
+	}
+}
+
+func TestTimestampOptionsInLogOutput(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(stdlog.New(&buf, "myapp: ", stdlog.LstdFlags))
+	SetTimestampOptions(&TimestampOptions{Format: TimestampEpochMillis})
+	defer SetTimestampOptions(nil)
+
+	Info("starting up")
+	SetLogger(stdlog.New(&buf, "myapp: ", stdlog.LstdFlags|stdlog.Lmsgprefix))
+	Info("listening on port %d", 8080)
+
+	// the logger's own timestamp must not appear in addition to ours
+	rx := regexp.MustCompile(`^myapp: \d{13} INFO: starting up\n\d{13} myapp: INFO: listening on port 8080\n$`)
+	if !rx.MatchString(buf.String()) {
+		t.Errorf("expected log output to match %q, but got %q", rx.String(), buf.String())
+	}
+}
+
+func TestTimestampOptionsWithFileFlagsAndConcurrency(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(stdlog.New(&buf, "myapp: ", stdlog.LstdFlags|stdlog.Lshortfile))
+	SetTimestampOptions(&TimestampOptions{Format: TimestampEpochMillis})
+	defer SetTimestampOptions(nil)
+
+	// concurrent log calls must not interleave (this is also checked by the race detector)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				Info("hello")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the file name refers to the caller of Info(), like it would without timestamp options
+	rx := regexp.MustCompile(`^myapp: \d{13} timestamp_test\.go:\d+: INFO: hello$`)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 200 {
+		t.Errorf("expected 200 lines, but got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !rx.MatchString(line) {
+			t.Errorf("expected log line to match %q, but got %q", rx.String(), line)
+			break
+		}
+	}
+}
@@ -18,32 +18,75 @@
 
 package mock
 
-import policy "github.com/databus23/goslo.policy"
+import (
+	"sync"
+
+	policy "github.com/databus23/goslo.policy"
+)
 
 // Enforcer implements the gopherpolicy.Enforcer interface. During enforcement,
 // all accesses are allowed by default. More restrictive policies can be
-// configured with Forbid() and Allow(). Request attributes cannot be checked.
+// configured with Forbid() and Allow(), or with SetRule() for rules whose
+// result depends on the token. All methods are safe for concurrent use.
 type Enforcer struct {
+	mutex          sync.RWMutex
 	forbiddenRules map[string]bool
+	ruleFuncs      map[string]func(policy.Context) bool
 }
 
 // NewEnforcer initializes an Enforcer instance.
 func NewEnforcer() *Enforcer {
-	return &Enforcer{make(map[string]bool)}
+	return &Enforcer{
+		forbiddenRules: make(map[string]bool),
+		ruleFuncs:      make(map[string]func(policy.Context) bool),
+	}
 }
 
 // Forbid will cause all subsequent calls to Enforce() to return false when
 // called for this rule.
 func (e *Enforcer) Forbid(rule string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	e.forbiddenRules[rule] = true
+	delete(e.ruleFuncs, rule)
 }
 
-// Allow reverses a previous Forbid call and allows the given policy rule.
+// Allow reverses a previous Forbid or SetRule call and allows the given policy rule.
 func (e *Enforcer) Allow(rule string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	e.forbiddenRules[rule] = false
+	delete(e.ruleFuncs, rule)
+}
+
+// SetRule will cause all subsequent calls to Enforce() for this rule to
+// return the result of the given function. This can be used together with
+// Validator.AddToken() to allow a rule only for some tokens, for example:
+//
+//	enforcer.SetRule("project:edit", func(c policy.Context) bool {
+//		return slices.Contains(c.Roles, "admin")
+//	})
+func (e *Enforcer) SetRule(rule string, check func(policy.Context) bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.ruleFuncs[rule] = check
+	delete(e.forbiddenRules, rule)
+}
+
+// Reset reverses all previous Forbid and SetRule calls, so that all rules are allowed again.
+func (e *Enforcer) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	clear(e.forbiddenRules)
+	clear(e.ruleFuncs)
 }
 
 // Enforce implements the gopherpolicy.Enforcer interface.
 func (e *Enforcer) Enforce(rule string, ctx policy.Context) bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if check, exists := e.ruleFuncs[rule]; exists {
+		return check(ctx)
+	}
 	return !e.forbiddenRules[rule]
 }
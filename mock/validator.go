@@ -19,7 +19,9 @@
 package mock
 
 import (
+	"errors"
 	"net/http"
+	"sync"
 
 	policy "github.com/databus23/goslo.policy"
 
@@ -29,29 +31,78 @@ import (
 // Validator implements the gopherpolicy.Validator and gopherpolicy.Enforcer
 // interfaces.
 //
-// During validation, the X-Auth-Token header on the request is not inspected
-// at all. Instead, auth success is always assumed and a token is built from
-// the Auth parameters provided during New(), using the mock itself as Enforcer.
+// By default, the X-Auth-Token header on the request is not inspected at all
+// during validation. Instead, auth success is always assumed and a token is
+// built from the Auth parameters provided during New(), using the mock itself
+// as Enforcer. Tests that need to distinguish between multiple users can
+// register tokens with AddToken() instead.
 //
 // During enforcement, all accesses are allowed by default. More restrictive
 // policies can be configured with Forbid() and Allow().
 type Validator[E gopherpolicy.Enforcer] struct {
 	Enforcer E
 	Auth     map[string]string
+
+	mutex  sync.RWMutex
+	tokens map[string]mockToken
+}
+
+type mockToken struct {
+	Auth  map[string]string
+	Roles []string
 }
 
 // NewValidator initializes a new Validator. The provided auth variables will
 // be mirrored into all gopherpolicy.Token instances returned by this Validator.
 func NewValidator[E gopherpolicy.Enforcer](enforcer E, auth map[string]string) *Validator[E] {
-	return &Validator[E]{enforcer, auth}
+	return &Validator[E]{Enforcer: enforcer, Auth: auth}
+}
+
+// AddToken registers a token, such that requests with this exact value in
+// their X-Auth-Token header are authenticated with the given auth variables
+// and roles. Registering the same token again replaces the previous entry.
+//
+// Once at least one token has been registered, CheckToken() only accepts
+// registered tokens. Requests with other X-Auth-Token values (or without
+// one) are treated as unauthenticated, so Token.Require() on them yields 401.
+func (v *Validator[E]) AddToken(token string, auth map[string]string, roles ...string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.tokens == nil {
+		v.tokens = make(map[string]mockToken)
+	}
+	v.tokens[token] = mockToken{auth, roles}
+}
+
+// RemoveToken reverses a previous AddToken call. This can be used to simulate
+// the revocation of a token.
+func (v *Validator[E]) RemoveToken(token string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	delete(v.tokens, token)
 }
 
 // CheckToken implements the gopherpolicy.Validator interface.
 func (v *Validator[E]) CheckToken(r *http.Request) *gopherpolicy.Token {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	auth := v.Auth
+	var roles []string
+	if v.tokens != nil {
+		t, exists := v.tokens[r.Header.Get("X-Auth-Token")]
+		if !exists {
+			return &gopherpolicy.Token{Err: errors.New("token not registered with mock.Validator")}
+		}
+		auth = t.Auth
+		roles = t.Roles
+	}
+
 	return &gopherpolicy.Token{
 		Enforcer: v.Enforcer,
 		Context: policy.Context{
-			Auth:    v.Auth,
+			Auth:    auth,
+			Roles:   roles,
 			Request: map[string]string{},
 		},
 	}
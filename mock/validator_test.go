@@ -20,8 +20,11 @@ package mock
 
 import (
 	"net/http"
+	"slices"
 	"testing"
 
+	policy "github.com/databus23/goslo.policy"
+
 	"github.com/sapcc/go-bits/assert"
 )
 
@@ -67,3 +70,61 @@ func TestValidator(t *testing.T) {
 		ExpectStatus: http.StatusNoContent,
 	}.Check(t, h)
 }
+
+func TestValidatorWithTokens(t *testing.T) {
+	v := NewValidator(NewEnforcer(), nil)
+	v.AddToken("admin-token", map[string]string{"user_name": "admin"}, "admin")
+	v.AddToken("member-token", map[string]string{"user_name": "member"}, "member")
+	v.Enforcer.SetRule("api:edit", func(c policy.Context) bool {
+		return slices.Contains(c.Roles, "admin")
+	})
+
+	// setup a simple HTTP handler that outputs the user name, or 401 or 403 depending on auth result
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := v.CheckToken(r)
+		if !token.Require(w, "api:edit") {
+			return
+		}
+		w.Write([]byte(token.UserName())) //nolint:errcheck
+	})
+
+	// only registered tokens are accepted
+	for token, expectedStatus := range map[string]int{
+		"admin-token":   http.StatusOK,
+		"member-token":  http.StatusForbidden,
+		"unknown-token": http.StatusUnauthorized,
+		"":              http.StatusUnauthorized,
+	} {
+		assert.HTTPRequest{
+			Method:       http.MethodGet,
+			Path:         "/",
+			Header:       map[string]string{"X-Auth-Token": token},
+			ExpectStatus: expectedStatus,
+		}.Check(t, h)
+	}
+	assert.HTTPRequest{
+		Method:       http.MethodGet,
+		Path:         "/",
+		Header:       map[string]string{"X-Auth-Token": "admin-token"},
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("admin"),
+	}.Check(t, h)
+
+	// Reset() allows all rules again
+	v.Enforcer.Reset()
+	assert.HTTPRequest{
+		Method:       http.MethodGet,
+		Path:         "/",
+		Header:       map[string]string{"X-Auth-Token": "member-token"},
+		ExpectStatus: http.StatusOK,
+	}.Check(t, h)
+
+	// RemoveToken() simulates token revocation
+	v.RemoveToken("member-token")
+	assert.HTTPRequest{
+		Method:       http.MethodGet,
+		Path:         "/",
+		Header:       map[string]string{"X-Auth-Token": "member-token"},
+		ExpectStatus: http.StatusUnauthorized,
+	}.Check(t, h)
+}
@@ -58,3 +58,37 @@ func Return[T any](val T, err error) T {
 	Succeed(err)
 	return val
 }
+
+// TestingT is implemented by *testing.T, and also satisfied by ginkgo.GinkgoT().
+type TestingT interface {
+	Helper()
+	Fatal(args ...any)
+}
+
+// SucceedT is a variant of Succeed() for use in unit tests.
+// Instead of exiting the program, any non-nil errors are reported with t.Fatal(),
+// so only the current test is aborted instead of the whole test binary.
+//
+//	must.SucceedT(t, os.WriteFile("fixtures/config.ini", fileContents, 0666))
+func SucceedT(t TestingT, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+// ReturnT is a variant of Return() for use in unit tests.
+// Instead of exiting the program, any non-nil errors are reported with t.Fatal(),
+// so only the current test is aborted instead of the whole test binary.
+//
+// Since Go does not allow passing further arguments alongside a multi-valued
+// function call, the TestingT instance is given in a second call:
+//
+//	buf := must.ReturnT(os.ReadFile("fixtures/config.ini"))(t)
+func ReturnT[T any](val T, err error) func(TestingT) T {
+	return func(t TestingT) T {
+		t.Helper()
+		SucceedT(t, err)
+		return val
+	}
+}
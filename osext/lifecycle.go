@@ -0,0 +1,234 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package osext
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// Standardized exit codes for use with Lifecycle.Exit() and WithExitCode().
+const (
+	// The process terminated normally, including graceful shutdowns after SIGINT or SIGTERM.
+	ExitSuccess = 0
+	// The process terminated because of an error.
+	ExitFailure = 1
+	// The process was invoked incorrectly (e.g. missing or invalid command-line arguments).
+	ExitUsage = 2
+	// The process could not start because of invalid configuration (EX_CONFIG from sysexits.h).
+	ExitConfig = 78
+)
+
+// ExitCodeError is an error that carries an exit code for Lifecycle.Exit().
+// Use WithExitCode() to construct it.
+type ExitCodeError struct {
+	Inner error
+	Code  int
+}
+
+// WithExitCode wraps an error such that Lifecycle.Exit() will terminate the
+// process with the given exit code instead of ExitFailure. For example:
+//
+//	cfg, err := parseConfig()
+//	if err != nil {
+//		lc.Exit(osext.WithExitCode(err, osext.ExitConfig))
+//	}
+func WithExitCode(err error, code int) error {
+	if err == nil {
+		return nil
+	}
+	return ExitCodeError{err, code}
+}
+
+// Error implements the builtin/error interface.
+func (e ExitCodeError) Error() string {
+	return e.Inner.Error()
+}
+
+// Unwrap implements the interface implied by package errors.
+func (e ExitCodeError) Unwrap() error {
+	return e.Inner
+}
+
+// LifecycleOpts contains options for NewLifecycle().
+type LifecycleOpts struct {
+	// How long to wait after a termination signal was received before
+	// canceling the context. This has the same purpose as the `delay` argument
+	// of httpext.ContextWithSIGINT(): to give reverse-proxies some extra time
+	// to notice the pending shutdown.
+	ShutdownDelay time.Duration
+	// How long each shutdown hook may run before its context is canceled.
+	// Defaults to 30 seconds.
+	HookTimeout time.Duration
+}
+
+// Lifecycle unifies the handling of process termination for main() functions.
+// It combines signal handling, ordered shutdown hooks, and standardized exit
+// codes:
+//
+//	func main() {
+//		lc := osext.NewLifecycle(context.Background(), osext.LifecycleOpts{ShutdownDelay: 10 * time.Second})
+//		ctx := lc.Context()
+//
+//		db, err := easypg.Connect(dbURL, cfg)
+//		if err != nil {
+//			lc.Exit(err)
+//		}
+//		lc.OnShutdown("close DB connection", func(context.Context) error { return db.Close() })
+//
+//		err = httpext.ListenAndServeContext(ctx, ":8080", handler)
+//		lc.Exit(err)
+//	}
+//
+// The context returned by Context() is canceled when SIGINT or SIGTERM is
+// received (after the configured ShutdownDelay). If a second signal is
+// received during shutdown, the process exits immediately with the exit code
+// 128+N (where N is the signal number), as is customary for shells.
+type Lifecycle struct {
+	opts   LifecycleOpts
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex sync.Mutex
+	hooks []shutdownHook
+
+	// for unit tests
+	signalChan chan os.Signal
+	exit       func(int)
+}
+
+type shutdownHook struct {
+	Name string
+	Func func(context.Context) error
+}
+
+// NewLifecycle creates a Lifecycle and starts listening for termination signals.
+// This should be called at most once per process, at the start of main().
+func NewLifecycle(parent context.Context, opts LifecycleOpts) *Lifecycle {
+	l := newLifecycle(parent, opts)
+	signal.Notify(l.signalChan, os.Interrupt, syscall.SIGTERM)
+	return l
+}
+
+func newLifecycle(parent context.Context, opts LifecycleOpts) *Lifecycle {
+	if opts.HookTimeout <= 0 {
+		opts.HookTimeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithCancel(parent)
+	l := &Lifecycle{
+		opts:       opts,
+		ctx:        ctx,
+		cancel:     cancel,
+		signalChan: make(chan os.Signal, 2),
+		exit:       os.Exit,
+	}
+	go l.handleSignals()
+	return l
+}
+
+func (l *Lifecycle) handleSignals() {
+	sig := <-l.signalChan
+	logg.Info("%s received, shutting down...", sig)
+	go func() {
+		time.Sleep(l.opts.ShutdownDelay)
+		l.cancel()
+	}()
+
+	sig = <-l.signalChan
+	logg.Error("%s received during shutdown, exiting immediately", sig)
+	l.exit(exitCodeForSignal(sig))
+}
+
+func exitCodeForSignal(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return ExitFailure
+}
+
+// Context returns a context that is canceled when the process shall shut down.
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// OnShutdown registers a hook that will be run by Exit(). Hooks are run in
+// reverse order of registration (like deferred function calls), so that
+// resources are released in the opposite order of their acquisition. Errors
+// returned by hooks are logged, and cause a nonzero exit code.
+func (l *Lifecycle) OnShutdown(name string, hook func(context.Context) error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.hooks = append(l.hooks, shutdownHook{name, hook})
+}
+
+// Shutdown cancels the context, runs all shutdown hooks, and returns the exit
+// code for the given error (as described on Exit). It is usually called
+// through Exit(), but can be used directly if the exit code needs to be
+// inspected.
+func (l *Lifecycle) Shutdown(err error) int {
+	l.cancel()
+
+	exitCode := ExitSuccess
+	if err != nil {
+		logg.Error(err.Error())
+		exitCode = ExitFailure
+		var ece ExitCodeError
+		if errors.As(err, &ece) {
+			exitCode = ece.Code
+		}
+	}
+
+	l.mutex.Lock()
+	hooks := l.hooks
+	l.hooks = nil
+	l.mutex.Unlock()
+
+	for idx := len(hooks) - 1; idx >= 0; idx-- {
+		hook := hooks[idx]
+		ctx, cancel := context.WithTimeout(context.Background(), l.opts.HookTimeout)
+		hookErr := hook.Func(ctx)
+		cancel()
+		if hookErr != nil {
+			logg.Error("during shutdown hook %q: %s", hook.Name, hookErr.Error())
+			if exitCode == ExitSuccess {
+				exitCode = ExitFailure
+			}
+		}
+	}
+	return exitCode
+}
+
+// Exit runs Shutdown() and then terminates the process. The exit code is:
+//
+//   - ExitSuccess if `err` is nil and all shutdown hooks succeeded,
+//   - the code given to WithExitCode() if `err` was wrapped that way,
+//   - ExitFailure otherwise.
+//
+// A non-nil `err` is logged before the shutdown hooks are run.
+func (l *Lifecycle) Exit(err error) {
+	l.exit(l.Shutdown(err))
+}
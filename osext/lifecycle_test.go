@@ -0,0 +1,95 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package osext
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLifecycleShutdown(t *testing.T) {
+	testCases := []struct {
+		Error            error
+		FailingHook      bool
+		ExpectedExitCode int
+	}{
+		{nil, false, ExitSuccess},
+		{nil, true, ExitFailure},
+		{errors.New("something broke"), false, ExitFailure},
+		{WithExitCode(errors.New("invalid config"), ExitConfig), false, ExitConfig},
+		{WithExitCode(errors.New("invalid config"), ExitConfig), true, ExitConfig},
+	}
+
+	for _, tc := range testCases {
+		l := newLifecycle(context.Background(), LifecycleOpts{})
+		var calls []string
+		l.OnShutdown("first", func(context.Context) error {
+			calls = append(calls, "first")
+			return nil
+		})
+		l.OnShutdown("second", func(context.Context) error {
+			calls = append(calls, "second")
+			if tc.FailingHook {
+				return errors.New("hook failed")
+			}
+			return nil
+		})
+
+		exitCode := l.Shutdown(tc.Error)
+		if exitCode != tc.ExpectedExitCode {
+			t.Errorf("expected exit code %d for %#v, but got %d", tc.ExpectedExitCode, tc, exitCode)
+		}
+		if !reflect.DeepEqual(calls, []string{"second", "first"}) {
+			t.Errorf("expected hooks to run in reverse order, but got %v", calls)
+		}
+		if l.Context().Err() == nil {
+			t.Error("expected context to be canceled after shutdown")
+		}
+	}
+}
+
+func TestLifecycleSignals(t *testing.T) {
+	l := newLifecycle(context.Background(), LifecycleOpts{ShutdownDelay: 10 * time.Millisecond})
+	exitCodeChan := make(chan int, 1)
+	l.exit = func(code int) { exitCodeChan <- code }
+
+	// first signal cancels the context after the delay
+	l.signalChan <- syscall.SIGTERM
+	select {
+	case <-l.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("context was not canceled after SIGTERM")
+	}
+
+	// second signal forces an immediate exit
+	l.signalChan <- syscall.SIGINT
+	select {
+	case code := <-exitCodeChan:
+		if code != 130 {
+			t.Errorf("expected exit code 130 after second signal, but got %d", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("process did not exit after second signal")
+	}
+}
@@ -37,13 +37,43 @@ import (
 // Client provides API access to a Prometheus server. It is constructed through
 // the Connect method on type Config.
 type Client struct {
-	api prom_v1.API
+	api       prom_v1.API
+	staleness *stalenessCheck
+	limits    QueryLimits
 }
 
 // GetVector executes a Prometheus query and returns a vector of results.
+//
+// If the client has a staleness check (see WithStalenessCheck), the returned
+// error may be of type StaleResultError. That condition can be checked with
+// `promquery.IsErrStaleResult(err)`. Likewise, if the client has query limits
+// (see WithQueryLimits), the returned error may be of type
+// QueryLimitExceededError.
 func (c Client) GetVector(ctx context.Context, queryStr string) (model.Vector, error) {
-	value, warnings, err := c.api.Query(ctx, queryStr, time.Now())
+	err := c.checkStalenessIsSupported(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	resultVector, err := c.query(ctx, queryStr, now)
+	if err != nil {
+		return nil, err
+	}
+	err = c.checkStaleness(ctx, queryStr, resultVector, now)
+	if err != nil {
+		return nil, err
+	}
+	return resultVector, nil
+}
+
+func (c Client) query(ctx context.Context, queryStr string, evalTime time.Time) (model.Vector, error) {
+	queryCtx, opts, cancel := c.limits.prepare(ctx)
+	defer cancel()
+	value, warnings, err := c.api.Query(queryCtx, queryStr, evalTime, opts...)
 	if err != nil {
+		if c.limits.isTimeout(ctx, queryCtx, err) {
+			return nil, QueryLimitExceededError{Query: queryStr, MaxDuration: c.limits.MaxDuration}
+		}
 		return nil, fmt.Errorf("could not execute Prometheus query: %s: %w", queryStr, err)
 	}
 	for _, warning := range warnings {
@@ -54,6 +84,9 @@ func (c Client) GetVector(ctx context.Context, queryStr string) (model.Vector, e
 	if !ok {
 		return nil, fmt.Errorf("could not execute Prometheus query: %s: unexpected type %T", queryStr, value)
 	}
+	if c.limits.MaxSeries > 0 && len(resultVector) > c.limits.MaxSeries {
+		return nil, QueryLimitExceededError{Query: queryStr, MaxSeries: c.limits.MaxSeries}
+	}
 	return resultVector, nil
 }
 
@@ -74,7 +74,7 @@ func ConfigFromEnv(envPrefix string) Config {
 // Connect sets up a Prometheus client from the given Config.
 func (cfg Config) Connect() (Client, error) {
 	if cfg.cachedConnection != nil {
-		return Client{cfg.cachedConnection}, nil
+		return Client{api: cfg.cachedConnection}, nil
 	}
 
 	if cfg.ServerURL == "" {
@@ -128,5 +128,5 @@ func (cfg Config) Connect() (Client, error) {
 	}
 
 	cfg.cachedConnection = prom_v1.NewAPI(client) // speed up future calls to Connect()
-	return Client{cfg.cachedConnection}, nil
+	return Client{api: cfg.cachedConnection}, nil
 }
@@ -0,0 +1,88 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package promquery
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	prom_v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// GetExemplars returns the exemplars for all series selected by the given
+// query within the given time range. This is mostly useful for debugging
+// views, e.g. to link from a latency histogram to the traces of slow requests.
+func (c Client) GetExemplars(ctx context.Context, queryStr string, start, end time.Time) ([]prom_v1.ExemplarQueryResult, error) {
+	result, err := c.api.QueryExemplars(ctx, queryStr, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("could not query Prometheus exemplars: %s: %w", queryStr, err)
+	}
+	return result, nil
+}
+
+// GetMetricMetadata returns the metadata (type, help text and unit) of the
+// given metric, as reported by the targets that Prometheus scrapes. If the
+// metric is not known to Prometheus, false is returned. If different targets
+// report different metadata for the same metric, the first one is returned.
+func (c Client) GetMetricMetadata(ctx context.Context, metricName string) (prom_v1.Metadata, bool, error) {
+	result, err := c.api.Metadata(ctx, metricName, "")
+	if err != nil {
+		return prom_v1.Metadata{}, false, fmt.Errorf("could not query Prometheus metadata for metric %q: %w", metricName, err)
+	}
+	entries := result[metricName]
+	if len(entries) == 0 {
+		return prom_v1.Metadata{}, false, nil
+	}
+	return entries[0], true, nil
+}
+
+// GetMetadataForQuery executes a Prometheus query and returns the metadata of
+// all metrics appearing in its result, keyed by metric name. Result series
+// without a metric name (e.g. because the query aggregates over them) are
+// ignored, as are metrics without metadata.
+func (c Client) GetMetadataForQuery(ctx context.Context, queryStr string) (map[string]prom_v1.Metadata, error) {
+	resultVector, err := c.GetVector(ctx, queryStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var metricNames []string
+	for _, sample := range resultVector {
+		name := string(sample.Metric[model.MetricNameLabel])
+		if name != "" && !slices.Contains(metricNames, name) {
+			metricNames = append(metricNames, name)
+		}
+	}
+
+	result := make(map[string]prom_v1.Metadata, len(metricNames))
+	for _, name := range metricNames {
+		metadata, ok, err := c.GetMetricMetadata(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result[name] = metadata
+		}
+	}
+	return result, nil
+}
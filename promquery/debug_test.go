@@ -0,0 +1,99 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package promquery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	prom_v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+// A fake implementation of prom_v1.API that only implements the methods needed by the tests.
+type fakeAPI struct {
+	prom_v1.API
+	vector     model.Vector
+	timestamps model.Vector // result for queries wrapped in timestamp()
+	exemplars  []prom_v1.ExemplarQueryResult
+	metadata   map[string][]prom_v1.Metadata
+}
+
+func (a fakeAPI) Query(ctx context.Context, query string, ts time.Time, opts ...prom_v1.Option) (model.Value, prom_v1.Warnings, error) {
+	if strings.HasPrefix(query, "timestamp(") {
+		return a.timestamps, nil, nil
+	}
+	return a.vector, nil, nil
+}
+
+func (a fakeAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]prom_v1.ExemplarQueryResult, error) {
+	if query == "invalid" {
+		return nil, errors.New("bad_data: parse error")
+	}
+	return a.exemplars, nil
+}
+
+func (a fakeAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]prom_v1.Metadata, error) {
+	return map[string][]prom_v1.Metadata{metric: a.metadata[metric]}, nil
+}
+
+func TestDebugHelpers(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	requestMetadata := prom_v1.Metadata{Type: prom_v1.MetricTypeCounter, Help: "Number of requests.", Unit: ""}
+	exemplars := []prom_v1.ExemplarQueryResult{{
+		SeriesLabels: model.LabelSet{"__name__": "request_duration_seconds_bucket"},
+		Exemplars:    []prom_v1.Exemplar{{Labels: model.LabelSet{"trace_id": "abc"}, Value: 1.5}},
+	}}
+	c := Client{api: fakeAPI{
+		vector: model.Vector{
+			{Metric: model.Metric{"__name__": "requests_total", "method": "GET"}},
+			{Metric: model.Metric{"__name__": "requests_total", "method": "POST"}},
+			{Metric: model.Metric{"__name__": "unknown_metric"}},
+			{Metric: model.Metric{"method": "GET"}},
+		},
+		exemplars: exemplars,
+		metadata: map[string][]prom_v1.Metadata{
+			"requests_total": {requestMetadata, {Type: prom_v1.MetricTypeGauge}},
+		},
+	}}
+
+	result, err := c.GetExemplars(ctx, "request_duration_seconds_bucket", time.Now().Add(-time.Hour), time.Now())
+	assert.DeepEqual(t, "GetExemplars error", err, nil)
+	assert.DeepEqual(t, "GetExemplars result", result, exemplars)
+	_, err = c.GetExemplars(ctx, "invalid", time.Now().Add(-time.Hour), time.Now())
+	assert.DeepEqual(t, "GetExemplars error", err.Error(), "could not query Prometheus exemplars: invalid: bad_data: parse error")
+
+	metadata, ok, err := c.GetMetricMetadata(ctx, "requests_total")
+	assert.DeepEqual(t, "GetMetricMetadata error", err, nil)
+	assert.DeepEqual(t, "GetMetricMetadata ok", ok, true)
+	assert.DeepEqual(t, "GetMetricMetadata result", metadata, requestMetadata)
+	_, ok, err = c.GetMetricMetadata(ctx, "unknown_metric")
+	assert.DeepEqual(t, "GetMetricMetadata error", err, nil)
+	assert.DeepEqual(t, "GetMetricMetadata ok", ok, false)
+
+	metadataByName, err := c.GetMetadataForQuery(ctx, `requests_total or unknown_metric or sum(requests_total)`)
+	assert.DeepEqual(t, "GetMetadataForQuery error", err, nil)
+	assert.DeepEqual(t, "GetMetadataForQuery result", metadataByName, map[string]prom_v1.Metadata{"requests_total": requestMetadata})
+}
@@ -20,6 +20,11 @@
 package promquery
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+
 	"github.com/sapcc/go-bits/errext"
 )
 
@@ -38,3 +43,61 @@ func (e NoRowsError) Error() string {
 func IsErrNoRows(err error) bool {
 	return errext.IsOfType[NoRowsError](err)
 }
+
+// StaleResultError is returned by GetVector() and GetSingleValue() if the
+// client has a staleness check with RejectStaleResults, and the result contains
+// samples that are older than the configured maximum age.
+type StaleResultError struct {
+	Query string
+	// The maximum age configured in Client.WithStalenessCheck().
+	MaxAge time.Duration
+	// The time series whose samples are too old (in the order in which they
+	// appeared in the query result), and their respective sample timestamps.
+	StaleSeries []StaleSeries
+}
+
+// StaleSeries appears in type StaleResultError.
+type StaleSeries struct {
+	Metric    model.Metric
+	Timestamp time.Time
+}
+
+// Error implements the builtin/error interface.
+func (e StaleResultError) Error() string {
+	var oldest time.Time
+	for _, series := range e.StaleSeries {
+		if oldest.IsZero() || series.Timestamp.Before(oldest) {
+			oldest = series.Timestamp
+		}
+	}
+	return fmt.Sprintf("Prometheus query returned %d series with samples older than %s (oldest sample from %s): %s",
+		len(e.StaleSeries), e.MaxAge.String(), oldest.UTC().Format(time.RFC3339), e.Query)
+}
+
+// IsErrStaleResult checks whether the given error is a StaleResultError.
+func IsErrStaleResult(err error) bool {
+	return errext.IsOfType[StaleResultError](err)
+}
+
+// QueryLimitExceededError is returned by GetVector() and GetSingleValue() if
+// the client has query limits (see Client.WithQueryLimits()), and a query
+// exceeded one of them. Exactly one of the fields MaxDuration and MaxSeries
+// is set, depending on which limit was exceeded.
+type QueryLimitExceededError struct {
+	Query       string
+	MaxDuration time.Duration
+	MaxSeries   int
+}
+
+// Error implements the builtin/error interface.
+func (e QueryLimitExceededError) Error() string {
+	if e.MaxSeries > 0 {
+		return fmt.Sprintf("Prometheus query returned more than %d series: %s", e.MaxSeries, e.Query)
+	}
+	return fmt.Sprintf("Prometheus query took longer than %s: %s", e.MaxDuration.String(), e.Query)
+}
+
+// IsErrQueryLimitExceeded checks whether the given error is a QueryLimitExceededError.
+func IsErrQueryLimitExceeded(err error) bool {
+	return errext.IsOfType[QueryLimitExceededError](err)
+}
@@ -0,0 +1,85 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package promquery
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	prom_v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// QueryLimits is an argument type for Client.WithQueryLimits().
+type QueryLimits struct {
+	// If non-zero, queries that take longer than this are aborted.
+	MaxDuration time.Duration
+	// If non-zero, queries that return more than this many series fail.
+	MaxSeries int
+}
+
+// WithQueryLimits returns a copy of this Client that enforces the given
+// limits on all queries executed through it. Queries exceeding a limit fail
+// with a QueryLimitExceededError. That condition can be checked with
+// `promquery.IsErrQueryLimitExceeded(err)`. This protects shared Prometheus
+// servers from accidentally expensive queries, e.g. when a label selector is
+// missing.
+//
+// The limits are also forwarded to Prometheus (as the "timeout" and "limit"
+// query parameters), so that Prometheus can stop evaluating the query early.
+// Prometheus versions that do not support these parameters ignore them; in
+// this case, the limits are only enforced on the client side.
+func (c Client) WithQueryLimits(limits QueryLimits) Client {
+	c.limits = limits
+	return c
+}
+
+// Applies the query limits to the given context and returns the options for
+// prom_v1.API.Query(). The returned function must be called when the query
+// is finished.
+func (l QueryLimits) prepare(ctx context.Context) (context.Context, []prom_v1.Option, context.CancelFunc) {
+	var opts []prom_v1.Option
+	cancel := context.CancelFunc(func() {})
+	if l.MaxDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, l.MaxDuration)
+		opts = append(opts, prom_v1.WithTimeout(l.MaxDuration))
+	}
+	if l.MaxSeries > 0 {
+		// ask for one more series than allowed, so that we can tell whether the limit was exceeded
+		opts = append(opts, prom_v1.WithLimit(uint64(l.MaxSeries)+1))
+	}
+	return ctx, opts, cancel
+}
+
+// Checks whether the given error from prom_v1.API.Query() was caused by
+// exceeding MaxDuration. `parentCtx` is the context given by the caller,
+// `queryCtx` is the context returned by prepare().
+func (l QueryLimits) isTimeout(parentCtx, queryCtx context.Context, err error) bool {
+	if l.MaxDuration == 0 {
+		return false
+	}
+	// the client-side timeout expired (but not the caller's own deadline)
+	if errors.Is(queryCtx.Err(), context.DeadlineExceeded) && parentCtx.Err() == nil {
+		return true
+	}
+	// the server-side timeout expired
+	var promErr *prom_v1.Error
+	return errors.As(err, &promErr) && promErr.Type == prom_v1.ErrTimeout
+}
@@ -0,0 +1,93 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package promquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	prom_v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+// A fake implementation of prom_v1.API that takes a long time to answer queries.
+type slowAPI struct {
+	fakeAPI
+	err error // error reported by the server if the query is not canceled
+}
+
+func (a slowAPI) Query(ctx context.Context, query string, ts time.Time, opts ...prom_v1.Option) (model.Value, prom_v1.Warnings, error) {
+	if a.err != nil {
+		return nil, nil, a.err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case <-time.After(5 * time.Second):
+		return a.fakeAPI.Query(ctx, query, ts, opts...)
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	api := fakeAPI{
+		vector: model.Vector{
+			{Metric: model.Metric{"az": "az-a"}, Value: 100},
+			{Metric: model.Metric{"az": "az-b"}, Value: 200},
+		},
+	}
+
+	// results within the series limit are returned as-is
+	result, err := Client{api: api}.WithQueryLimits(QueryLimits{MaxSeries: 2}).GetVector(ctx, "capacity_bytes")
+	assert.DeepEqual(t, "GetVector error", err, nil)
+	assert.DeepEqual(t, "GetVector result", result, api.vector)
+
+	// results exceeding the series limit are rejected
+	_, err = Client{api: api}.WithQueryLimits(QueryLimits{MaxSeries: 1}).GetVector(ctx, "capacity_bytes")
+	assert.DeepEqual(t, "GetVector error", err, error(QueryLimitExceededError{Query: "capacity_bytes", MaxSeries: 1}))
+	assert.DeepEqual(t, "GetVector error message", err.Error(), "Prometheus query returned more than 1 series: capacity_bytes")
+
+	// slow queries are aborted on the client side...
+	c := Client{api: slowAPI{fakeAPI: api}}.WithQueryLimits(QueryLimits{MaxDuration: 10 * time.Millisecond})
+	_, err = c.GetSingleValue(ctx, "capacity_bytes", nil)
+	if !IsErrQueryLimitExceeded(err) {
+		t.Fatalf("expected QueryLimitExceededError, but got %v", err)
+	}
+	assert.DeepEqual(t, "GetSingleValue error message", err.Error(), "Prometheus query took longer than 10ms: capacity_bytes")
+
+	// ...or on the server side
+	c = Client{api: slowAPI{fakeAPI: api, err: &prom_v1.Error{Type: prom_v1.ErrTimeout, Msg: "query timed out"}}}.
+		WithQueryLimits(QueryLimits{MaxDuration: time.Minute})
+	_, err = c.GetVector(ctx, "capacity_bytes")
+	if !IsErrQueryLimitExceeded(err) {
+		t.Errorf("expected QueryLimitExceededError, but got %v", err)
+	}
+
+	// when the caller's own context expires, this is not reported as exceeding the limit
+	shortCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = Client{api: slowAPI{fakeAPI: api}}.WithQueryLimits(QueryLimits{MaxDuration: time.Minute}).GetVector(shortCtx, "capacity_bytes")
+	if err == nil || IsErrQueryLimitExceeded(err) {
+		t.Errorf("expected context error, but got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package promquery
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// StalenessAction is an argument type for Client.WithStalenessCheck().
+type StalenessAction int
+
+const (
+	// RejectStaleResults causes queries with stale results to fail with a StaleResultError.
+	RejectStaleResults StalenessAction = iota
+	// LogStaleResults causes stale results to be reported in the log,
+	// but the results are returned as usual.
+	LogStaleResults
+)
+
+// WithStalenessCheck returns a copy of this Client that checks the age of the
+// samples in the results of GetVector() and GetSingleValue(). If any sample is
+// older than `maxAge`, the given action is taken. This is intended for
+// calculations that would otherwise silently use outdated numbers when an
+// exporter stops reporting, e.g. because it hangs or was not scraped anymore.
+//
+// Prometheus reports the evaluation time as timestamp for all instant query
+// results, so the actual sample timestamps are obtained by running the query
+// a second time, wrapped in the timestamp() function. This doubles the number
+// of queries executed through this Client.
+//
+// Prometheus only reports actual sample timestamps through timestamp() when
+// its argument is a plain vector selector (e.g. `foo` or `foo{bar="baz"}`).
+// For everything else, including filters (e.g. `foo > 0`), aggregations
+// (e.g. `sum(foo)`) and functions (e.g. `rate(foo[5m])`), the evaluation time
+// is reported, so the result would always appear to be fresh. Therefore, when
+// the staleness check is enabled, GetVector() and GetSingleValue() fail for
+// all queries that are not plain vector selectors, without executing them. To
+// check the freshness of other queries, use a separate Client with a staleness
+// check to query the underlying time series directly.
+//
+// Also note that Prometheus only considers samples within the lookback delta
+// (5 minutes by default) of the evaluation time. Series whose last sample is
+// older than that are not part of the result at all, so this check can only
+// detect staleness if `maxAge` is shorter than the lookback delta.
+func (c Client) WithStalenessCheck(maxAge time.Duration, action StalenessAction) Client {
+	c.staleness = &stalenessCheck{maxAge, action}
+	return c
+}
+
+type stalenessCheck struct {
+	MaxAge time.Duration
+	Action StalenessAction
+}
+
+// Called by GetVector() before executing the original query.
+func (c Client) checkStalenessIsSupported(queryStr string) error {
+	if c.staleness == nil || isPlainVectorSelector(queryStr) {
+		return nil
+	}
+	return fmt.Errorf("cannot check staleness of results for Prometheus query %q: only plain vector selectors like `foo{bar=\"baz\"}` are supported", queryStr)
+}
+
+// Matches the metric name at the start of a vector selector.
+var metricNameRx = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*`)
+
+// Checks whether the given PromQL query consists of nothing but a vector
+// selector, i.e. a metric name and/or a set of label matchers in braces. The
+// label matchers are not validated further since nothing but label matchers
+// is allowed within the braces anyway.
+func isPlainVectorSelector(query string) bool {
+	rest := strings.TrimSpace(query)
+	name := metricNameRx.FindString(rest)
+	rest = strings.TrimSpace(rest[len(name):])
+	if rest == "" {
+		return name != ""
+	}
+	if rest[0] != '{' {
+		return false
+	}
+
+	// find the closing brace, while skipping over quoted strings
+	for pos := 1; pos < len(rest); pos++ {
+		switch c := rest[pos]; c {
+		case '"', '\'', '`':
+			for pos++; pos < len(rest) && rest[pos] != c; pos++ {
+				if rest[pos] == '\\' && c != '`' {
+					pos++ // skip escaped character
+				}
+			}
+		case '}':
+			return strings.TrimSpace(rest[pos+1:]) == ""
+		}
+	}
+	return false // unterminated braces
+}
+
+// Called by GetVector() with the same evaluation time as the original query.
+func (c Client) checkStaleness(ctx context.Context, queryStr string, result model.Vector, evalTime time.Time) error {
+	if c.staleness == nil || len(result) == 0 {
+		return nil
+	}
+
+	timestamps, err := c.query(ctx, fmt.Sprintf("timestamp(%s)", queryStr), evalTime)
+	if err != nil {
+		return fmt.Errorf("while checking for stale results: %w", err)
+	}
+
+	// timestamp() drops the metric name, so we need to do the same to match samples to series
+	timestampByFingerprint := make(map[model.Fingerprint]time.Time, len(timestamps))
+	for _, sample := range timestamps {
+		secs, frac := math.Modf(float64(sample.Value))
+		timestampByFingerprint[fingerprintWithoutName(sample.Metric)] = time.Unix(int64(secs), int64(frac*float64(time.Second)))
+	}
+
+	staleErr := StaleResultError{Query: queryStr, MaxAge: c.staleness.MaxAge}
+	for _, sample := range result {
+		timestamp, exists := timestampByFingerprint[fingerprintWithoutName(sample.Metric)]
+		if exists && evalTime.Sub(timestamp) > c.staleness.MaxAge {
+			staleErr.StaleSeries = append(staleErr.StaleSeries, StaleSeries{sample.Metric, timestamp})
+		}
+	}
+	if len(staleErr.StaleSeries) == 0 {
+		return nil
+	}
+
+	switch c.staleness.Action {
+	case LogStaleResults:
+		logg.Error(staleErr.Error())
+		return nil
+	default:
+		return staleErr
+	}
+}
+
+func fingerprintWithoutName(metric model.Metric) model.Fingerprint {
+	labels := make(model.LabelSet, len(metric))
+	for name, value := range metric {
+		if name != model.MetricNameLabel {
+			labels[name] = value
+		}
+	}
+	return labels.Fingerprint()
+}
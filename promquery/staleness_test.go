@@ -0,0 +1,118 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package promquery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestStalenessCheck(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+	now := time.Now()
+	freshTime := now.Add(-30 * time.Second).Truncate(time.Second)
+	staleTime := now.Add(-10 * time.Minute).Truncate(time.Second)
+
+	api := fakeAPI{
+		vector: model.Vector{
+			{Metric: model.Metric{"__name__": "capacity_bytes", "az": "az-a"}, Value: 100},
+			{Metric: model.Metric{"__name__": "capacity_bytes", "az": "az-b"}, Value: 200},
+		},
+		timestamps: model.Vector{
+			{Metric: model.Metric{"az": "az-a"}, Value: model.SampleValue(freshTime.Unix())},
+			{Metric: model.Metric{"az": "az-b"}, Value: model.SampleValue(staleTime.Unix())},
+		},
+	}
+
+	// without staleness check, results are returned as-is
+	result, err := Client{api: api}.GetVector(ctx, "capacity_bytes")
+	assert.DeepEqual(t, "GetVector error", err, nil)
+	assert.DeepEqual(t, "GetVector result", result, api.vector)
+
+	// with a lenient staleness check, results are returned as-is
+	result, err = Client{api: api}.WithStalenessCheck(time.Hour, RejectStaleResults).GetVector(ctx, "capacity_bytes")
+	assert.DeepEqual(t, "GetVector error", err, nil)
+	assert.DeepEqual(t, "GetVector result", result, api.vector)
+
+	// with a strict staleness check, stale results are rejected...
+	c := Client{api: api}.WithStalenessCheck(5*time.Minute, RejectStaleResults)
+	_, err = c.GetVector(ctx, "capacity_bytes")
+	if !IsErrStaleResult(err) {
+		t.Fatalf("expected StaleResultError, but got %v", err)
+	}
+	assert.DeepEqual(t, "StaleResultError", err, error(StaleResultError{
+		Query:  "capacity_bytes",
+		MaxAge: 5 * time.Minute,
+		StaleSeries: []StaleSeries{{
+			Metric:    model.Metric{"__name__": "capacity_bytes", "az": "az-b"},
+			Timestamp: staleTime,
+		}},
+	}))
+	_, err = c.GetSingleValue(ctx, "capacity_bytes", nil)
+	if !IsErrStaleResult(err) {
+		t.Errorf("expected StaleResultError, but got %v", err)
+	}
+
+	// ...or only logged
+	result, err = Client{api: api}.WithStalenessCheck(5*time.Minute, LogStaleResults).GetVector(ctx, "capacity_bytes")
+	assert.DeepEqual(t, "GetVector error", err, nil)
+	assert.DeepEqual(t, "GetVector result", result, api.vector)
+	// queries that are not plain vector selectors are rejected, since their results always look fresh
+	for _, query := range []string{"sum(capacity_bytes)", "capacity_bytes > 0"} {
+		_, err = Client{api: api}.WithStalenessCheck(5*time.Minute, LogStaleResults).GetVector(ctx, query)
+		assert.DeepEqual(t, "GetVector error for "+query, fmt.Sprint(err),
+			fmt.Sprintf("cannot check staleness of results for Prometheus query %q: only plain vector selectors like `foo{bar=\"baz\"}` are supported", query))
+	}
+}
+
+func TestIsPlainVectorSelector(t *testing.T) {
+	testCases := map[string]bool{
+		`capacity_bytes`:                          true,
+		`  capacity_bytes  `:                      true,
+		`node:capacity_bytes:sum`:                 true,
+		`capacity_bytes{az="az-a"}`:               true,
+		`capacity_bytes { az=~"az-.*", }`:         true,
+		`{__name__="capacity_bytes"}`:             true,
+		`capacity_bytes{az="}"}`:                  true,
+		`capacity_bytes{az="\"} > 0"}`:            true,
+		"capacity_bytes{az=`a\\`}":                true,
+		``:                                        false,
+		`capacity_bytes > 0`:                      false,
+		`capacity_bytes{az="az-a"} > 0`:           false,
+		`capacity_bytes{az="}"} > 0`:              false,
+		`sum(capacity_bytes)`:                     false,
+		`sum by (az) (capacity_bytes)`:            false,
+		`rate(capacity_bytes[5m])`:                false,
+		`capacity_bytes[5m]`:                      false,
+		`capacity_bytes offset 5m`:                false,
+		`capacity_bytes{az="az-a"`:                false,
+		`capacity_bytes{az="az-a}`:                false,
+		`capacity_bytes{az="a"} or other{az="b"}`: false,
+	}
+	for query, expected := range testCases {
+		assert.DeepEqual(t, "isPlainVectorSelector("+query+")", isPlainVectorSelector(query), expected)
+	}
+}
@@ -0,0 +1,144 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package promquery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Unit is a unit of measurement for values returned by Prometheus queries.
+// Use the Unit argument of Client.GetSingleValueIn() to have values converted
+// into the unit that the caller expects.
+type Unit string
+
+// Possible values for Unit.
+const (
+	// UnitNone is used for dimensionless values like counts or ratios.
+	UnitNone Unit = ""
+
+	UnitBytes     Unit = "B"
+	UnitKibibytes Unit = "KiB"
+	UnitMebibytes Unit = "MiB"
+	UnitGibibytes Unit = "GiB"
+	UnitTebibytes Unit = "TiB"
+
+	UnitCores      Unit = "cores"
+	UnitMillicores Unit = "millicores"
+
+	UnitSeconds      Unit = "s"
+	UnitMilliseconds Unit = "ms"
+	UnitMinutes      Unit = "min"
+	UnitHours        Unit = "h"
+)
+
+type unitInfo struct {
+	Dimension string
+	Factor    float64 // multiply by this to get to the base unit of this dimension
+}
+
+var unitInfos = map[Unit]unitInfo{
+	UnitNone:         {"none", 1},
+	UnitBytes:        {"information", 1},
+	UnitKibibytes:    {"information", 1 << 10},
+	UnitMebibytes:    {"information", 1 << 20},
+	UnitGibibytes:    {"information", 1 << 30},
+	UnitTebibytes:    {"information", 1 << 40},
+	UnitCores:        {"CPU", 1},
+	UnitMillicores:   {"CPU", 1e-3},
+	UnitSeconds:      {"time", 1},
+	UnitMilliseconds: {"time", 1e-3},
+	UnitMinutes:      {"time", 60},
+	UnitHours:        {"time", 3600},
+}
+
+// UnitMismatchError is returned by Unit.Convert() and related functions when
+// a value cannot be converted between two units of different dimensions, or
+// when one of the units is unknown.
+type UnitMismatchError struct {
+	From Unit
+	To   Unit
+}
+
+// Error implements the builtin/error interface.
+func (e UnitMismatchError) Error() string {
+	return fmt.Sprintf("cannot convert value from unit %q into unit %q", e.From, e.To)
+}
+
+// Convert converts a value given in this unit into the target unit. An error
+// of type UnitMismatchError is returned if the units measure different
+// things (e.g. bytes vs. seconds).
+func (u Unit) Convert(value float64, target Unit) (float64, error) {
+	from, ok1 := unitInfos[u]
+	to, ok2 := unitInfos[target]
+	if !ok1 || !ok2 || from.Dimension != to.Dimension {
+		return 0, UnitMismatchError{From: u, To: target}
+	}
+	if u == target {
+		return value, nil
+	}
+	return value * from.Factor / to.Factor, nil
+}
+
+// UnitOfMetric returns the unit of the given metric, based on the suffix
+// conventions for Prometheus metric names (e.g. "node_memory_MemTotal_bytes"
+// is in bytes). False is returned if the unit cannot be determined.
+func UnitOfMetric(metricName string) (Unit, bool) {
+	metricName = strings.TrimSuffix(metricName, "_total")
+	switch {
+	case strings.HasSuffix(metricName, "_bytes"):
+		return UnitBytes, true
+	case strings.HasSuffix(metricName, "_seconds"):
+		return UnitSeconds, true
+	case strings.HasSuffix(metricName, "_cores"):
+		return UnitCores, true
+	case strings.HasSuffix(metricName, "_ratio"):
+		return UnitNone, true
+	default:
+		return UnitNone, false
+	}
+}
+
+// GetSingleValueIn is like GetSingleValue, but converts the result value from
+// the unit that the query produces into the unit expected by the caller. If
+// the two units are not compatible, a UnitMismatchError is returned before
+// the query is executed. The defaultValue, if any, is given in the target unit.
+//
+//	// result will be in GiB even though the query produces bytes
+//	capacityGiB, err := client.GetSingleValueIn(ctx,
+//		`sum(node_filesystem_size_bytes{mountpoint="/"})`, promquery.UnitBytes,
+//		promquery.UnitGibibytes, nil)
+func (c Client) GetSingleValueIn(ctx context.Context, queryStr string, queryUnit, targetUnit Unit, defaultValue *float64) (float64, error) {
+	// check compatibility before doing any expensive work
+	_, err := queryUnit.Convert(0, targetUnit)
+	if err != nil {
+		return 0, fmt.Errorf("while preparing Prometheus query: %s: %w", queryStr, err)
+	}
+
+	value, err := c.GetSingleValue(ctx, queryStr, nil)
+	if err != nil {
+		if defaultValue != nil && IsErrNoRows(err) {
+			return *defaultValue, nil
+		}
+		return 0, err
+	}
+	return queryUnit.Convert(value, targetUnit)
+}
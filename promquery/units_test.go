@@ -0,0 +1,79 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package promquery
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sapcc/go-bits/assert"
+)
+
+func TestUnitConversion(t *testing.T) {
+	testCases := []struct {
+		Value    float64
+		From, To Unit
+		Expected float64
+	}{
+		{3 << 30, UnitBytes, UnitGibibytes, 3},
+		{2, UnitTebibytes, UnitGibibytes, 2048},
+		{1500, UnitMillicores, UnitCores, 1.5},
+		{90, UnitMinutes, UnitHours, 1.5},
+		{250, UnitMilliseconds, UnitSeconds, 0.25},
+		{42, UnitNone, UnitNone, 42},
+	}
+	for _, tc := range testCases {
+		actual, err := tc.From.Convert(tc.Value, tc.To)
+		if err != nil {
+			t.Errorf("unexpected error while converting %g %s to %s: %s", tc.Value, tc.From, tc.To, err.Error())
+			continue
+		}
+		assert.DeepEqual(t, string(tc.From)+" -> "+string(tc.To), actual, tc.Expected)
+	}
+
+	_, err := UnitGibibytes.Convert(1, UnitSeconds)
+	var ume UnitMismatchError
+	if !errors.As(err, &ume) {
+		t.Fatalf("expected UnitMismatchError, but got %v", err)
+	}
+	assert.DeepEqual(t, "error message", err.Error(), `cannot convert value from unit "GiB" into unit "s"`)
+
+	_, err = Unit("furlongs").Convert(1, Unit("furlongs"))
+	if !errors.As(err, &ume) {
+		t.Errorf("expected UnitMismatchError for unknown unit, but got %v", err)
+	}
+}
+
+func TestUnitOfMetric(t *testing.T) {
+	for metricName, expected := range map[string]Unit{
+		"node_memory_MemTotal_bytes":        UnitBytes,
+		"process_cpu_seconds_total":         UnitSeconds,
+		"kube_pod_container_resource_cores": UnitCores,
+		"node_filesystem_avail_bytes":       UnitBytes,
+		"openstack_compute_usage_ratio":     UnitNone,
+	} {
+		actual, ok := UnitOfMetric(metricName)
+		assert.DeepEqual(t, metricName+" ok", ok, true)
+		assert.DeepEqual(t, metricName, actual, expected)
+	}
+
+	_, ok := UnitOfMetric("up")
+	assert.DeepEqual(t, "up ok", ok, false)
+}
@@ -86,10 +86,14 @@ func (cs ConfigSet[K, V]) Pick(key K, defaultValue V) V {
 // Expansion follows the same rules as for regexp.ExpandString() from the standard library.
 func (cs ConfigSet[K, V]) PickAndFill(key K, defaultValue V, fill func(value *V, expand func(string) string)) V {
 	keyRx, value, ok := cs.pick(key)
+	return fillValue(keyRx, value, ok, key, defaultValue, fill)
+}
+
+// The common implementation of ConfigSet.PickAndFill and IndexedConfigSet.PickAndFill.
+func fillValue[K ~string, V any](keyRx BoundedRegexp, value V, ok bool, key K, defaultValue V, fill func(value *V, expand func(string) string)) V {
 	if !ok {
 		return defaultValue
 	}
-
 	rx, err := keyRx.Regexp()
 	if err != nil {
 		// defense in depth: this should not happen because the regex should have been validated at UnmarshalYAML time
@@ -109,3 +113,76 @@ func (cs ConfigSet[K, V]) PickAndFill(key K, defaultValue V, fill func(value *V,
 	}
 	return value
 }
+
+// IndexedConfigSet is a read-only view of a ConfigSet that is optimized for
+// large numbers of entries. It is built with ConfigSet.Index().
+//
+// In a ConfigSet, Pick and PickAndFill check each entry in turn until a match
+// is found. In an IndexedConfigSet, entries whose keys are literal strings
+// (i.e. do not contain any regex syntax) are looked up in a map instead, so
+// only the entries with actual regexes need to be checked one by one. The
+// result is always the same as for the ConfigSet: The first matching entry
+// wins, regardless of whether its key is a literal or a regex.
+type IndexedConfigSet[K ~string, V any] struct {
+	// key = literal, value = index of first entry in `entries` with that literal as key
+	literals map[string]int
+	// indexes of all entries in `entries` with non-literal keys, in order
+	regexes []int
+	entries ConfigSet[K, V]
+}
+
+// Index builds an IndexedConfigSet from this ConfigSet. Since the index is not
+// updated when the ConfigSet changes, this should only be done once the
+// ConfigSet is final, e.g. after loading the configuration that contains it.
+func (cs ConfigSet[K, V]) Index() IndexedConfigSet[K, V] {
+	ics := IndexedConfigSet[K, V]{
+		literals: make(map[string]int),
+		entries:  cs,
+	}
+	for idx, entry := range cs {
+		if !isLiteral(string(entry.Key)) {
+			ics.regexes = append(ics.regexes, idx)
+			continue
+		}
+		if _, exists := ics.literals[string(entry.Key)]; !exists {
+			ics.literals[string(entry.Key)] = idx
+		}
+	}
+	return ics
+}
+
+// Like ConfigSet.pick(), but with the index.
+func (ics IndexedConfigSet[K, V]) pick(key K) (BoundedRegexp, V, bool) {
+	literalIdx, hasLiteral := ics.literals[string(key)]
+	for _, idx := range ics.regexes {
+		if hasLiteral && idx > literalIdx {
+			break // the literal match comes first
+		}
+		entry := ics.entries[idx]
+		if entry.Key.MatchString(string(key)) {
+			return entry.Key, entry.Value, true
+		}
+	}
+	if hasLiteral {
+		entry := ics.entries[literalIdx]
+		return entry.Key, entry.Value, true
+	}
+	var zero V
+	return "", zero, false
+}
+
+// Pick works like ConfigSet.Pick.
+func (ics IndexedConfigSet[K, V]) Pick(key K, defaultValue V) V {
+	_, value, ok := ics.pick(key)
+	if ok {
+		return value
+	} else {
+		return defaultValue
+	}
+}
+
+// PickAndFill works like ConfigSet.PickAndFill.
+func (ics IndexedConfigSet[K, V]) PickAndFill(key K, defaultValue V, fill func(value *V, expand func(string) string)) V {
+	keyRx, value, ok := ics.pick(key)
+	return fillValue(keyRx, value, ok, key, defaultValue, fill)
+}
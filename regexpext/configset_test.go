@@ -20,6 +20,7 @@
 package regexpext
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/sapcc/go-bits/assert"
@@ -74,3 +75,59 @@ func TestConfigSetWithFill(t *testing.T) {
 	value = cs.PickAndFill("Bob", Name{}, fill)
 	assert.DeepEqual(t, `cs.PickAndFill("Bob")`, value, Name{FirstName: "Bob", LastName: "Mc"})
 }
+
+func TestIndexedConfigSet(t *testing.T) {
+	cs := ConfigSet[string, int]{
+		{Key: "foo", Value: 1},
+		{Key: "ba(r|z)", Value: 2},
+		{Key: "bar", Value: 3},
+		{Key: "foo", Value: 4},
+		{Key: "qu+x", Value: 5},
+		{Key: "quux", Value: 6},
+	}
+	ics := cs.Index()
+
+	// results must be identical to those of the ConfigSet itself
+	for _, key := range []string{"foo", "bar", "baz", "qux", "quux", "quuux", "other"} {
+		assert.DeepEqual(t, `ics.Pick("`+key+`")`, ics.Pick(key, 0), cs.Pick(key, 0))
+	}
+
+	// PickAndFill also works
+	ics2 := ConfigSet[string, string]{
+		{Key: "static", Value: "literal"},
+		{Key: `item-(\d+)`, Value: "number $1"},
+	}.Index()
+	fill := func(value *string, expand func(string) string) { *value = expand(*value) }
+	assert.DeepEqual(t, `ics.PickAndFill("static")`, ics2.PickAndFill("static", "", fill), "literal")
+	assert.DeepEqual(t, `ics.PickAndFill("item-42")`, ics2.PickAndFill("item-42", "", fill), "number 42")
+	assert.DeepEqual(t, `ics.PickAndFill("other")`, ics2.PickAndFill("other", "default", fill), "default")
+}
+
+// Builds a ConfigSet like in a large real-world configuration: mostly
+// literal keys, with a few regexes at the end as a catch-all.
+func buildLargeConfigSet(size int) ConfigSet[string, int] {
+	cs := make(ConfigSet[string, int], size)
+	for idx := range size - 2 {
+		cs[idx].Key = BoundedRegexp(fmt.Sprintf("service-%d", idx))
+		cs[idx].Value = idx
+	}
+	cs[size-2].Key = `service-\d+-canary`
+	cs[size-1].Key = `.*`
+	return cs
+}
+
+func BenchmarkConfigSetPick(b *testing.B) {
+	cs := buildLargeConfigSet(5000)
+	b.ResetTimer()
+	for range b.N {
+		cs.Pick("service-4000", -1)
+	}
+}
+
+func BenchmarkIndexedConfigSetPick(b *testing.B) {
+	ics := buildLargeConfigSet(5000).Index()
+	b.ResetTimer()
+	for range b.N {
+		ics.Pick("service-4000", -1)
+	}
+}
@@ -0,0 +1,97 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package respondwith
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// AutomaticHEAD wraps a handler for GET requests such that it can also serve
+// HEAD requests. For HEAD requests, the inner handler is executed as if the
+// request was a GET request, but the response body is discarded. The response
+// headers are sent unchanged, with a Content-Length header added to reflect the
+// size of the discarded body (unless the inner handler already set one).
+//
+// gorilla/mux does not derive HEAD routes from GET routes, so both methods must
+// be declared on the route explicitly:
+//
+//	r.Methods("GET", "HEAD").Path("/v1/objects/{id}").Handler(respondwith.AutomaticHEAD(h))
+//
+// Since the response headers are held back until the inner handler returns,
+// this must not be used for endpoints that stream their response.
+func AutomaticHEAD(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.Method = http.MethodGet
+		hw := headResponseWriter{inner: w}
+		inner.ServeHTTP(&hw, r)
+
+		if hw.statusCode == 0 {
+			hw.statusCode = http.StatusOK
+		}
+		if w.Header().Get("Content-Length") == "" && bodyAllowedForStatus(hw.statusCode) {
+			w.Header().Set("Content-Length", strconv.FormatUint(hw.bytesWritten, 10))
+		}
+		w.WriteHeader(hw.statusCode)
+	})
+}
+
+// Reference: bodyAllowedForStatus() in net/http.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// The http.ResponseWriter used by AutomaticHEAD().
+type headResponseWriter struct {
+	inner        http.ResponseWriter
+	statusCode   int
+	bytesWritten uint64
+}
+
+// Header implements the http.ResponseWriter interface.
+func (w *headResponseWriter) Header() http.Header {
+	return w.inner.Header()
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (w *headResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *headResponseWriter) Write(buf []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	w.bytesWritten += uint64(len(buf))
+	return len(buf), nil
+}
@@ -0,0 +1,68 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package respondwith_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/respondwith"
+)
+
+func TestAutomaticHEAD(t *testing.T) {
+	r := mux.NewRouter()
+	r.Methods("GET", "HEAD").Path("/json").Handler(respondwith.AutomaticHEAD(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		respondwith.JSON(w, http.StatusOK, map[string]string{"hello": "world"})
+	})))
+	r.Methods("GET", "HEAD").Path("/empty").Handler(respondwith.AutomaticHEAD(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	// GET requests are passed through unchanged
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/json",
+		ExpectStatus: http.StatusOK,
+		ExpectHeader: map[string]string{"X-Method": "GET", "Content-Type": "application/json"},
+		ExpectBody:   assert.JSONObject{"hello": "world"},
+	}.Check(t, r)
+
+	// HEAD requests get the same headers with Content-Length, but no body
+	assert.HTTPRequest{
+		Method:       "HEAD",
+		Path:         "/json",
+		ExpectStatus: http.StatusOK,
+		ExpectHeader: map[string]string{"X-Method": "GET", "Content-Type": "application/json", "Content-Length": "18"},
+		ExpectBody:   assert.StringData(""),
+	}.Check(t, r)
+
+	// no Content-Length for responses that cannot have a body
+	assert.HTTPRequest{
+		Method:       "HEAD",
+		Path:         "/empty",
+		ExpectStatus: http.StatusNoContent,
+		ExpectHeader: map[string]string{"Content-Length": ""},
+		ExpectBody:   assert.StringData(""),
+	}.Check(t, r)
+}
@@ -0,0 +1,115 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package respondwith
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// MaintenanceMode can be used to reject requests with a consistent
+// "503 Service Unavailable" response while the application is undergoing
+// maintenance, e.g. during controlled data migrations. Maintenance mode is
+// active while it is enabled through Enable(), or while the file at
+// FlagFilePath exists (if configured). The zero value is ready to use.
+//
+// Maintenance mode only affects those handlers that are wrapped in
+// Middleware(), or that call ServiceUnavailable() themselves.
+// Handlers for healthchecks should not be wrapped, so that the application
+// does not get restarted by its orchestrator for being unhealthy:
+//
+//	mm := &respondwith.MaintenanceMode{FlagFilePath: "/var/run/myapp/maintenance"}
+//	r := mux.NewRouter()
+//	r.Methods("GET").Path("/healthcheck").HandlerFunc(handleHealthcheck)
+//	r.Methods("POST").Path("/v1/objects").Handler(mm.Middleware(http.HandlerFunc(handleCreateObject)))
+type MaintenanceMode struct {
+	// (optional) If not empty, maintenance mode is active while a file exists at this path.
+	FlagFilePath string
+	// (optional) The value for the Retry-After header. Defaults to 1 minute.
+	RetryAfter time.Duration
+	// (optional) The response body. Defaults to a generic message.
+	Message string
+
+	enabled atomic.Bool
+}
+
+// Enable activates maintenance mode.
+func (m *MaintenanceMode) Enable() {
+	m.enabled.Store(true)
+}
+
+// Disable deactivates maintenance mode. If FlagFilePath is configured and the
+// file exists, maintenance mode stays active until the file is removed.
+func (m *MaintenanceMode) Disable() {
+	m.enabled.Store(false)
+}
+
+// IsActive returns whether maintenance mode is currently active.
+func (m *MaintenanceMode) IsActive() bool {
+	if m.enabled.Load() {
+		return true
+	}
+	if m.FlagFilePath == "" {
+		return false
+	}
+	_, err := os.Stat(m.FlagFilePath)
+	return err == nil
+}
+
+// ServiceUnavailable produces a "503 Service Unavailable" response with a
+// Retry-After header if maintenance mode is active. Otherwise, nothing is done
+// and false is returned. Idiomatic usage looks like this:
+//
+//	if mm.ServiceUnavailable(w) {
+//		return
+//	}
+func (m *MaintenanceMode) ServiceUnavailable(w http.ResponseWriter) bool {
+	if !m.IsActive() {
+		return false
+	}
+
+	retryAfter := m.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = time.Minute
+	}
+	message := m.Message
+	if message == "" {
+		message = "service is undergoing maintenance, please retry later"
+	}
+
+	retryAfterSecs := int((retryAfter + time.Second - 1) / time.Second) // round up
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSecs))
+	http.Error(w, message, http.StatusServiceUnavailable)
+	return true
+}
+
+// Middleware wraps the given handler such that all requests are rejected by
+// ServiceUnavailable() while maintenance mode is active.
+func (m *MaintenanceMode) Middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.ServiceUnavailable(w) {
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
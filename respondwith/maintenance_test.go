@@ -0,0 +1,91 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package respondwith_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+	"github.com/sapcc/go-bits/respondwith"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	flagFilePath := filepath.Join(t.TempDir(), "maintenance")
+	mm := &respondwith.MaintenanceMode{FlagFilePath: flagFilePath, RetryAfter: 90 * time.Second}
+
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/healthcheck").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "ok", http.StatusOK)
+	})
+	r.Methods("GET").Path("/v1/objects").Handler(mm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondwith.JSON(w, http.StatusOK, []string{"foo", "bar"})
+	})))
+
+	expectAvailable := func() {
+		t.Helper()
+		assert.HTTPRequest{
+			Method:       "GET",
+			Path:         "/v1/objects",
+			ExpectStatus: http.StatusOK,
+			ExpectBody:   assert.StringData(`["foo","bar"]`),
+		}.Check(t, r)
+	}
+	expectMaintenance := func() {
+		t.Helper()
+		assert.HTTPRequest{
+			Method:       "GET",
+			Path:         "/v1/objects",
+			ExpectStatus: http.StatusServiceUnavailable,
+			ExpectHeader: map[string]string{"Retry-After": "90"},
+			ExpectBody:   assert.StringData("service is undergoing maintenance, please retry later\n"),
+		}.Check(t, r)
+	}
+
+	// maintenance mode is initially inactive
+	expectAvailable()
+
+	// maintenance mode can be toggled in code...
+	mm.Enable()
+	expectMaintenance()
+	mm.Disable()
+	expectAvailable()
+
+	// ...or by creating the flag file
+	must.SucceedT(t, os.WriteFile(flagFilePath, nil, 0o666))
+	expectMaintenance()
+	must.SucceedT(t, os.Remove(flagFilePath))
+	expectAvailable()
+
+	// unwrapped handlers are not affected
+	mm.Enable()
+	assert.HTTPRequest{
+		Method:       "GET",
+		Path:         "/healthcheck",
+		ExpectStatus: http.StatusOK,
+		ExpectBody:   assert.StringData("ok\n"),
+	}.Check(t, r)
+}
@@ -0,0 +1,250 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package respondwith
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/go-bits/errext"
+)
+
+// JSONOf is like JSON, but the type of the payload is given as a type
+// argument. When the type argument is spelled out explicitly, the compiler
+// checks that the handler returns what the endpoint is documented to return:
+//
+//	respondwith.JSONOf[ProjectReport](w, http.StatusOK, report)
+func JSONOf[T any](w http.ResponseWriter, code int, data T) {
+	JSON(w, code, data)
+}
+
+// Envelope describes a JSON response body that wraps a payload of type T
+// in an object with a single key, as is customary in OpenStack APIs. For
+// example:
+//
+//	var projectEnvelope = respondwith.Envelope[Project]{Key: "project"}
+//
+//	func (p *v1Provider) GetProject(w http.ResponseWriter, r *http.Request) {
+//		...
+//		projectEnvelope.Respond(w, http.StatusOK, project) // writes {"project":{...}}
+//	}
+//
+// In tests, the same Envelope can be used to check response bodies with CheckShape().
+type Envelope[T any] struct {
+	Key string
+}
+
+// Respond writes a JSON response with the given payload wrapped in this envelope.
+func (e Envelope[T]) Respond(w http.ResponseWriter, code int, payload T) {
+	JSON(w, code, map[string]T{e.Key: payload})
+}
+
+// CheckShape is like CheckJSONShape(), but expects the payload to be wrapped
+// in this envelope. The envelope must be an object that contains exactly the
+// key of this envelope.
+func (e Envelope[T]) CheckShape(body []byte) error {
+	description := fmt.Sprintf("envelope %q with type %s", e.Key, reflect.TypeFor[T]().String())
+	return checkJSONBody(body, description, func(errs *errext.ErrorSet, value any) {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			errs.Addf("expected object at $, but got %T", value)
+			return
+		}
+		payload, exists := obj[e.Key]
+		if exists {
+			checkJSONShape(errs, reflect.TypeFor[T](), payload, "$."+e.Key)
+		} else {
+			errs.Addf("missing field $.%s", e.Key)
+		}
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			if key != e.Key {
+				errs.Addf("unexpected field $.%s", key)
+			}
+		}
+	})
+}
+
+// CheckJSONShape checks whether the given JSON document has the shape of the
+// type T, and returns an error describing all mismatches if not. This is
+// intended for tests, to catch response-shape drift between the declared
+// payload type of an endpoint and what it actually returns (e.g. when the
+// response is produced from a different type, or passed through a proxy):
+//
+//   - Objects must not contain fields that do not exist in the respective
+//     struct type ("unexpected field").
+//   - Objects must contain all fields of the respective struct type, except
+//     for those marked as "omitempty" or "omitzero" ("missing field").
+//
+// For maps, the map values are checked. For slices and arrays, the elements are
+// checked. Types that implement json.Marshaler, json.Unmarshaler,
+// encoding.TextMarshaler or encoding.TextUnmarshaler (e.g. time.Time) are not
+// checked further, since their JSON representation is not derived from their
+// Go structure. Null is accepted for all values.
+func CheckJSONShape[T any](body []byte) error {
+	t := reflect.TypeFor[T]()
+	return checkJSONBody(body, "type "+t.String(), func(errs *errext.ErrorSet, value any) {
+		checkJSONShape(errs, t, value, "$")
+	})
+}
+
+// Parses the given JSON document and runs the given check on it.
+func checkJSONBody(body []byte, description string, check func(*errext.ErrorSet, any)) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return fmt.Errorf("cannot parse JSON: %w", err)
+	}
+
+	var errs errext.ErrorSet
+	check(&errs, value)
+	if errs.IsEmpty() {
+		return nil
+	}
+	return errors.New("JSON does not match " + description + ": " + errs.Join(", "))
+}
+
+var customJSONTypes = []reflect.Type{
+	reflect.TypeFor[json.Marshaler](),
+	reflect.TypeFor[json.Unmarshaler](),
+	reflect.TypeFor[encoding.TextMarshaler](),
+	reflect.TypeFor[encoding.TextUnmarshaler](),
+}
+
+// Returns whether values of the given type have a custom JSON representation.
+func hasCustomJSON(t reflect.Type) bool {
+	// the pointer type has the methods of both value and pointer receivers
+	pt := reflect.PointerTo(t)
+	return slices.ContainsFunc(customJSONTypes, pt.Implements)
+}
+
+func checkJSONShape(errs *errext.ErrorSet, t reflect.Type, value any, path string) {
+	if value == nil {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if hasCustomJSON(t) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			errs.Addf("expected object at %s, but got %T", path, value)
+			return
+		}
+		fields := jsonFieldsOf(t)
+		for _, field := range fields {
+			fieldValue, exists := obj[field.Name]
+			if !exists {
+				if !field.Optional {
+					errs.Addf("missing field %s.%s", path, field.Name)
+				}
+				continue
+			}
+			checkJSONShape(errs, field.Type, fieldValue, path+"."+field.Name)
+		}
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			if !slices.ContainsFunc(fields, func(f jsonField) bool { return f.Name == key }) {
+				errs.Addf("unexpected field %s.%s", path, key)
+			}
+		}
+	case reflect.Map:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			errs.Addf("expected object at %s, but got %T", path, value)
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			checkJSONShape(errs, t.Elem(), obj[key], path+"."+key)
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return // []byte is serialized as a base64 string
+		}
+		list, ok := value.([]any)
+		if !ok {
+			errs.Addf("expected array at %s, but got %T", path, value)
+			return
+		}
+		for idx, elem := range list {
+			checkJSONShape(errs, t.Elem(), elem, fmt.Sprintf("%s[%d]", path, idx))
+		}
+	default:
+		// scalar types and interfaces are not checked
+	}
+}
+
+type jsonField struct {
+	Name     string
+	Type     reflect.Type
+	Optional bool
+}
+
+// Returns the fields of the given struct type as they appear in its JSON
+// serialization. Fields of embedded structs without a JSON name are promoted.
+func jsonFieldsOf(t reflect.Type) []jsonField {
+	var result []jsonField
+	for idx := range t.NumField() {
+		field := t.Field(idx)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embeddedType := field.Type
+			if embeddedType.Kind() == reflect.Pointer {
+				embeddedType = embeddedType.Elem()
+			}
+			if embeddedType.Kind() == reflect.Struct {
+				result = append(result, jsonFieldsOf(embeddedType)...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		optionList := strings.Split(options, ",")
+		result = append(result, jsonField{
+			Name:     name,
+			Type:     field.Type,
+			Optional: slices.Contains(optionList, "omitempty") || slices.Contains(optionList, "omitzero"),
+		})
+	}
+	return result
+}
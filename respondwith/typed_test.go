@@ -0,0 +1,141 @@
+/*******************************************************************************
+*
+* Copyright 2025 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package respondwith_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+	"github.com/sapcc/go-bits/respondwith"
+)
+
+type testCommon struct {
+	ID string `json:"id"`
+}
+
+type testProject struct {
+	testCommon
+	Name      string            `json:"name"`
+	Tags      []string          `json:"tags,omitempty"`
+	Quotas    map[string]uint64 `json:"quotas"`
+	Resources []testResource    `json:"resources"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type testResource struct {
+	Name  string  `json:"name"`
+	Usage *uint64 `json:"usage"`
+}
+
+// testDuration has a custom JSON representation, but only implements
+// json.Marshaler, not json.Unmarshaler.
+type testDuration struct {
+	Seconds int
+}
+
+func (d testDuration) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + (time.Duration(d.Seconds) * time.Second).String() + `"`), nil
+}
+
+// testLevel has a custom JSON representation through encoding.TextMarshaler.
+type testLevel struct {
+	Value int
+}
+
+func (l *testLevel) MarshalText() ([]byte, error) {
+	return []byte(strings.Repeat("*", l.Value)), nil
+}
+
+type testJob struct {
+	Timeout  testDuration `json:"timeout"`
+	Priority *testLevel   `json:"priority"`
+}
+
+func TestEnvelope(t *testing.T) {
+	envelope := respondwith.Envelope[testProject]{Key: "project"}
+	project := testProject{
+		testCommon: testCommon{ID: "abc"},
+		Name:       "foo",
+		Quotas:     map[string]uint64{"cores": 10},
+		Resources:  []testResource{{Name: "cores"}},
+		CreatedAt:  time.Unix(0, 0).UTC(),
+	}
+
+	rec := httptest.NewRecorder()
+	envelope.Respond(rec, http.StatusCreated, project)
+	assert.DeepEqual(t, "status", rec.Code, http.StatusCreated)
+	assert.DeepEqual(t, "body", rec.Body.String(),
+		`{"project":{"id":"abc","name":"foo","quotas":{"cores":10},"resources":[{"name":"cores","usage":null}],"created_at":"1970-01-01T00:00:00Z"}}`+"\n")
+
+	// a body produced from the declared type matches its shape
+	assert.DeepEqual(t, "shape error", envelope.CheckShape(rec.Body.Bytes()), nil)
+
+	// missing and unexpected fields are reported
+	err := envelope.CheckShape([]byte(`{"project":{"id":"abc","quotas":{"cores":10},"resources":[{"name":"cores","usage":5,"capacity":20}],"created_at":"1970-01-01T00:00:00Z","domain_id":"def"}}`))
+	expected := `JSON does not match envelope "project" with type respondwith_test.testProject: ` +
+		"missing field $.project.name, unexpected field $.project.resources[0].capacity, unexpected field $.project.domain_id"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+
+	// the envelope must have exactly the expected key
+	err = envelope.CheckShape([]byte(`{"projects":{"id":"abc","name":"foo","quotas":{},"resources":[],"created_at":"1970-01-01T00:00:00Z"}}`))
+	expected = `JSON does not match envelope "project" with type respondwith_test.testProject: missing field $.project, unexpected field $.projects`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+	err = envelope.CheckShape([]byte(`{"project":null,"links":[]}`))
+	expected = `JSON does not match envelope "project" with type respondwith_test.testProject: unexpected field $.links`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+	err = envelope.CheckShape([]byte(`[]`))
+	expected = `JSON does not match envelope "project" with type respondwith_test.testProject: expected object at $, but got []interface {}`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+
+	// type mismatches for containers are reported
+	err = respondwith.CheckJSONShape[[]testResource]([]byte(`{"name":"cores"}`))
+	expected = "JSON does not match type []respondwith_test.testResource: expected array at $, but got map[string]interface {}"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestCheckJSONShapeWithCustomMarshalers(t *testing.T) {
+	// types with custom marshaling are not checked against their Go structure
+	buf := must.ReturnT(json.Marshal(testJob{Timeout: testDuration{Seconds: 90}, Priority: &testLevel{Value: 3}}))(t)
+	assert.DeepEqual(t, "body", string(buf), `{"timeout":"1m30s","priority":"***"}`)
+	assert.DeepEqual(t, "shape error", respondwith.CheckJSONShape[testJob](buf), nil)
+}
+
+func TestJSONOf(t *testing.T) {
+	rec := httptest.NewRecorder()
+	respondwith.JSONOf[[]string](rec, http.StatusOK, []string{"foo", "bar"})
+	assert.DeepEqual(t, "content type", rec.Header().Get("Content-Type"), "application/json")
+	assert.DeepEqual(t, "body", rec.Body.String(), `["foo","bar"]`+"\n")
+}
@@ -0,0 +1,202 @@
+/******************************************************************************
+*
+*  Copyright 2025 SAP SE
+*
+*  Licensed under the Apache License, Version 2.0 (the "License");
+*  you may not use this file except in compliance with the License.
+*  You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+*  Unless required by applicable law or agreed to in writing, software
+*  distributed under the License is distributed on an "AS IS" BASIS,
+*  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*  See the License for the specific language governing permissions and
+*  limitations under the License.
+*
+******************************************************************************/
+
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// PKIRequest contains the parameters for issuing a certificate from a PKI
+// secrets engine in Vault, see IssueCertificate().
+type PKIRequest struct {
+	// (required) Where the PKI secrets engine is mounted, e.g. "pki".
+	MountPath string
+	// (required) The name of the role to issue the certificate with.
+	Role string
+	// (required) The common name of the certificate.
+	CommonName string
+	// (optional) Further DNS names and IP addresses to include as subject alternative names.
+	AltNames []string
+	IPSANs   []string
+	// (optional) The requested lifetime of the certificate. If zero, the default of the role applies.
+	TTL time.Duration
+}
+
+// IssueCertificate issues a new leaf certificate and private key from a PKI
+// secrets engine in Vault. The returned certificate contains the full chain
+// (excluding the root CA) and has its Leaf field filled.
+func IssueCertificate(ctx context.Context, client *api.Client, req PKIRequest) (*tls.Certificate, error) {
+	data := map[string]any{
+		"common_name": req.CommonName,
+	}
+	if len(req.AltNames) > 0 {
+		data["alt_names"] = strings.Join(req.AltNames, ",")
+	}
+	if len(req.IPSANs) > 0 {
+		data["ip_sans"] = strings.Join(req.IPSANs, ",")
+	}
+	if req.TTL > 0 {
+		data["ttl"] = req.TTL.String()
+	}
+
+	path := fmt.Sprintf("%s/issue/%s", strings.Trim(req.MountPath, "/"), req.Role)
+	secret, err := client.Logical().WriteWithContext(ctx, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("while issuing certificate for %q from Vault: %w", req.CommonName, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("while issuing certificate for %q from Vault: empty response from %s", req.CommonName, path)
+	}
+
+	certPEM, _ := secret.Data["certificate"].(string) //nolint:errcheck // missing values are checked below
+	keyPEM, _ := secret.Data["private_key"].(string)  //nolint:errcheck // missing values are checked below
+	if certPEM == "" || keyPEM == "" {
+		return nil, fmt.Errorf("while issuing certificate for %q from Vault: response from %s does not contain certificate and private key", req.CommonName, path)
+	}
+	// the chain contains the issuing CA and all intermediates (if any), but not the root CA
+	chain, _ := secret.Data["ca_chain"].([]any) //nolint:errcheck // the chain is optional
+	for _, caPEM := range chain {
+		if s, ok := caPEM.(string); ok {
+			certPEM = strings.TrimSpace(certPEM) + "\n" + s
+		}
+	}
+
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("while parsing certificate for %q issued by Vault: %w", req.CommonName, err)
+	}
+	return &cert, nil
+}
+
+// CertificateRenewer holds a certificate issued from a PKI secrets engine in
+// Vault, and renews it before it expires. Its GetCertificate method can be
+// used in a tls.Config to always serve the most recent certificate:
+//
+//	renewer := must.Return(vault.NewCertificateRenewer(ctx, client, vault.PKIRequest{
+//		MountPath:  "pki",
+//		Role:       "my-service",
+//		CommonName: "my-service.example.com",
+//	}))
+//	go renewer.Run(ctx, nil)
+//	server := &http.Server{
+//		Addr:      ":443",
+//		Handler:   handler,
+//		TLSConfig: &tls.Config{GetCertificate: renewer.GetCertificate},
+//	}
+//	err := server.ListenAndServeTLS("", "")
+type CertificateRenewer struct {
+	client  *api.Client
+	request PKIRequest
+	cert    atomic.Pointer[tls.Certificate]
+}
+
+// NewCertificateRenewer issues an initial certificate, and returns a
+// CertificateRenewer holding it.
+func NewCertificateRenewer(ctx context.Context, client *api.Client, req PKIRequest) (*CertificateRenewer, error) {
+	cert, err := IssueCertificate(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	r := &CertificateRenewer{client: client, request: req}
+	r.cert.Store(cert)
+	return r, nil
+}
+
+// Certificate returns the most recently issued certificate.
+func (r *CertificateRenewer) Certificate() *tls.Certificate {
+	return r.cert.Load()
+}
+
+// GetCertificate has the signature required for tls.Config.GetCertificate.
+// It returns the most recently issued certificate.
+func (r *CertificateRenewer) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Run renews the certificate until `ctx` expires. Renewal takes place once
+// two thirds of the certificate's lifetime have passed. If renewal fails, it
+// is retried every minute until it succeeds.
+//
+// If `onRenew` is not nil, it is called with each renewed certificate, e.g.
+// to write it into files that are read by other components.
+func (r *CertificateRenewer) Run(ctx context.Context, onRenew func(*tls.Certificate)) {
+	for {
+		renewalTime, err := renewalTimeOf(r.cert.Load())
+		if err != nil {
+			logg.Error("could not determine renewal time for certificate for %q (will renew immediately): %s", r.request.CommonName, err.Error())
+			renewalTime = time.Now()
+		}
+		timer := time.NewTimer(time.Until(renewalTime))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		cert, err := IssueCertificate(ctx, r.client, r.request)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			logg.Error("could not renew certificate for %q (will retry in %s): %s", r.request.CommonName, renewalRetryInterval, err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(renewalRetryInterval):
+			}
+			continue
+		}
+		r.cert.Store(cert)
+		if onRenew != nil {
+			onRenew(cert)
+		}
+	}
+}
+
+const renewalRetryInterval = time.Minute
+
+// Returns the time after which the given certificate shall be renewed.
+func renewalTimeOf(cert *tls.Certificate) (time.Time, error) {
+	leaf := cert.Leaf
+	if leaf == nil {
+		// should not happen since tls.X509KeyPair() fills Leaf, but better be safe than sorry
+		if len(cert.Certificate) == 0 {
+			return time.Time{}, errors.New("certificate chain is empty")
+		}
+		var err error
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("while parsing leaf certificate: %w", err)
+		}
+	}
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return leaf.NotBefore.Add(lifetime * 2 / 3), nil
+}
@@ -0,0 +1,111 @@
+/******************************************************************************
+*
+*  Copyright 2025 SAP SE
+*
+*  Licensed under the Apache License, Version 2.0 (the "License");
+*  you may not use this file except in compliance with the License.
+*  You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+*  Unless required by applicable law or agreed to in writing, software
+*  distributed under the License is distributed on an "AS IS" BASIS,
+*  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*  See the License for the specific language governing permissions and
+*  limitations under the License.
+*
+******************************************************************************/
+
+package vault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/sapcc/go-bits/assert"
+	"github.com/sapcc/go-bits/must"
+)
+
+func TestIssueCertificate(t *testing.T) {
+	ctx := context.TODO() // TODO: use t.Context() in Go 1.24+
+
+	// generate a self-signed certificate to be returned by the fake Vault
+	key := must.Return(ecdsa.GenerateKey(elliptic.P256(), rand.Reader))
+	notBefore := time.Now().UTC().Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(3 * time.Hour),
+	}
+	certDER := must.Return(x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key))
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: must.Return(x509.MarshalECPrivateKey(key))})
+
+	var requestBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/v1/pki/issue/my-role" {
+			http.Error(w, "unexpected request: "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		must.Succeed(json.NewDecoder(r.Body).Decode(&requestBody))
+		w.Header().Set("Content-Type", "application/json")
+		must.Succeed(json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{
+				"certificate": string(certPEM),
+				"private_key": string(keyPEM),
+				"ca_chain":    []string{string(certPEM)},
+			},
+		}))
+	}))
+	defer server.Close()
+
+	cfg := api.DefaultConfig()
+	cfg.Address = server.URL
+	client := must.Return(api.NewClient(cfg))
+	client.SetToken("dummy")
+
+	renewer := must.Return(NewCertificateRenewer(ctx, client, PKIRequest{
+		MountPath:  "/pki/",
+		Role:       "my-role",
+		CommonName: "example.com",
+		AltNames:   []string{"www.example.com", "api.example.com"},
+		TTL:        3 * time.Hour,
+	}))
+	assert.DeepEqual(t, "request body", requestBody, map[string]any{
+		"common_name": "example.com",
+		"alt_names":   "www.example.com,api.example.com",
+		"ttl":         "3h0m0s",
+	})
+
+	cert := must.Return(renewer.GetCertificate(nil))
+	assert.DeepEqual(t, "length of chain", len(cert.Certificate), 2)
+	assert.DeepEqual(t, "leaf serial", cert.Leaf.SerialNumber, big.NewInt(42))
+	assert.DeepEqual(t, "renewal time", must.ReturnT(renewalTimeOf(cert))(t), notBefore.Add(2*time.Hour))
+
+	// if Leaf is not filled, the leaf certificate is parsed from the chain
+	certWithoutLeaf := &tls.Certificate{Certificate: cert.Certificate}
+	assert.DeepEqual(t, "renewal time without Leaf", must.ReturnT(renewalTimeOf(certWithoutLeaf))(t), notBefore.Add(2*time.Hour))
+
+	// if the leaf certificate cannot be found, an error is returned instead of a bogus renewal time
+	for _, broken := range []*tls.Certificate{{}, {Certificate: [][]byte{[]byte("garbage")}}} {
+		_, err := renewalTimeOf(broken)
+		if err == nil {
+			t.Errorf("expected error for certificate chain %q, but got none", broken.Certificate)
+		}
+	}
+}